@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// Admin job statuses
+const (
+	jobRunning   = "running"
+	jobFinished  = "finished"
+	jobCancelled = "cancelled"
+)
+
+// adminJob is a job as the admin API reports it
+type adminJob struct {
+	*jobs.Job
+	Status string `json:"status"`
+}
+
+// runningJobs are the jobs being processed, so operators can list and cancel them. Jobs move to
+// the job store when they finish.
+type runningJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*runningJob
+}
+
+// runningJob is a snapshot of a job taken when it started and the cancel func of its context
+type runningJob struct {
+	job       jobs.Job
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+func (rj *runningJobs) add(job *jobs.Job, cancel context.CancelFunc) {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	if rj.jobs == nil {
+		rj.jobs = make(map[string]*runningJob)
+	}
+	rj.jobs[job.ID] = &runningJob{job: *job, cancel: cancel}
+}
+
+// remove drops a finished job and reports whether it was cancelled
+func (rj *runningJobs) remove(id string) bool {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	running, ok := rj.jobs[id]
+	delete(rj.jobs, id)
+	return ok && running.cancelled
+}
+
+// cancel cancels a running job's context and reports whether the job was running
+func (rj *runningJobs) cancel(id string) bool {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	running, ok := rj.jobs[id]
+	if ok {
+		running.cancelled = true
+		running.cancel()
+	}
+	return ok
+}
+
+// get returns the snapshot of a running job
+func (rj *runningJobs) get(id string) (adminJob, bool) {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	running, ok := rj.jobs[id]
+	if !ok {
+		return adminJob{}, false
+	}
+	job := running.job
+	status := jobRunning
+	if running.cancelled {
+		status = jobCancelled
+	}
+	return adminJob{Job: &job, Status: status}, true
+}
+
+// list returns the running jobs, newest first
+func (rj *runningJobs) list() []adminJob {
+	rj.mu.Lock()
+	ids := make([]string, 0, len(rj.jobs))
+	for id := range rj.jobs {
+		ids = append(ids, id)
+	}
+	rj.mu.Unlock()
+
+	list := make([]adminJob, 0, len(ids))
+	for _, id := range ids {
+		if job, ok := rj.get(id); ok {
+			list = append(list, job)
+		}
+	}
+	slices.SortFunc(list, func(a, b adminJob) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return list
+}
+
+// storedJob is a finished job as the admin API reports it
+func storedJob(job *jobs.Job) adminJob {
+	if job.Cancelled {
+		return adminJob{Job: job, Status: jobCancelled}
+	}
+	return adminJob{Job: job, Status: jobFinished}
+}
+
+// handleAdminJobs lists the running jobs, then the stored ones, newest first. status filters
+// them to running, finished or cancelled; limit caps the list (default 50).
+func (s *server) handleAdminJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && status != jobRunning && status != jobFinished && status != jobCancelled {
+		writeRequestError(w, r, badRequest("Invalid status value (must be 'running', 'finished' or 'cancelled')"))
+		return
+	}
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeRequestError(w, r, badRequest("Invalid limit value (must be a positive integer)"))
+			return
+		}
+		limit = n
+	}
+
+	list := s.running.list()
+	for _, job := range s.jobs.List() {
+		list = append(list, storedJob(job))
+	}
+	if status != "" {
+		list = slices.DeleteFunc(list, func(job adminJob) bool { return job.Status != status })
+	}
+	total := len(list)
+	list = list[:min(limit, len(list))]
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"total": total, "jobs": list}); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// handleAdminJob returns a running or stored job with its status
+func (s *server) handleAdminJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("id")
+	job, ok := s.running.get(id)
+	if !ok {
+		stored, found := s.jobs.Get(id)
+		if !found {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		job = storedJob(stored)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// handleCancelJob cancels a running job. Its client gets the usual timed out or cancelled error
+// and the job is recorded as cancelled.
+func (s *server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("id")
+	if !s.running.cancel(id) {
+		if _, ok := s.jobs.Get(id); ok {
+			http.Error(w, "Job is not running", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("ADMIN | Cancelled job %s", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": "cancelling", "job_id": id}); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// handleRetryJob runs a finished or cancelled job again in the background, with the same source,
+// settings and seed, and answers with the new job's ID
+func (s *server) handleRetryJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("id")
+	if _, ok := s.running.get(id); ok {
+		http.Error(w, "Job is still running", http.StatusConflict)
+		return
+	}
+	original, ok := s.jobs.Get(id)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	job := &jobs.Job{
+		ID:           jobs.NewID(),
+		CreatedAt:    time.Now(),
+		Settings:     original.Settings,
+		Source:       original.Source,
+		DocumentHash: original.DocumentHash,
+		ReprocessOf:  original.ID,
+		Owner:        original.Owner,
+	}
+	log.Printf("ADMIN | Retrying job %s as job %s", original.ID, job.ID)
+	s.runAsync(w, r, &processRequest{}, job.ID, func(w http.ResponseWriter, r *http.Request) { s.runJob(w, r, job) })
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/client"
+	"github.com/arnnvv/cutcrap/pkg/config"
+)
+
+const adminUsage = `usage: cutcrap admin [-url URL] [-key KEY] jobs <command>
+
+Manages the jobs of a running server through its admin API.
+
+  jobs list [-status running|finished|cancelled] [-limit N]
+                   list running and stored jobs, newest first
+  jobs show <id>   print a job as JSON
+  jobs cancel <id> cancel a running job
+  jobs retry <id>  run a finished or cancelled job again with the same source, settings and seed
+
+  -url  server address (default http://localhost:$PORT)
+  -key  admin API key (default the first of ADMIN_API_KEYS)
+`
+
+// runAdmin is the "admin" subcommand: job management against a running server's admin API. It
+// returns the process exit code.
+func runAdmin(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, adminUsage) }
+	serverURL := flags.String("url", "http://localhost:"+cfg.Port, "server address")
+	key := flags.String("key", "", "admin API key")
+	if err := flags.Parse(args); err != nil || flags.NArg() < 2 || flags.Arg(0) != "jobs" {
+		flags.Usage()
+		return 2
+	}
+	c := client.New(*serverURL, &http.Client{Timeout: time.Minute})
+	c.APIKey = *key
+	if c.APIKey == "" && len(cfg.AdminAPIKeys) > 0 {
+		c.APIKey = cfg.AdminAPIKeys[0]
+	}
+
+	ctx := context.Background()
+	command, rest := flags.Arg(1), flags.Args()[2:]
+	var err error
+	switch command {
+	case "list":
+		err = adminListJobs(ctx, c, rest)
+	case "show", "cancel", "retry":
+		if len(rest) != 1 {
+			flags.Usage()
+			return 2
+		}
+		err = adminJobCommand(ctx, c, command, rest[0])
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cutcrap admin: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// adminListJobs prints the jobs as a table
+func adminListJobs(ctx context.Context, c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, adminUsage) }
+	status := flags.String("status", "", "running, finished or cancelled")
+	limit := flags.Int("limit", 0, "maximum number of jobs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	list, err := c.AdminJobs(ctx, *status, *limit)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tMODE\tRATIO\tCREATED\tDURATION")
+	for _, job := range list {
+		duration := "-"
+		if job.Status != jobRunning {
+			duration = job.Duration.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%g\t%s\t%s\n", job.ID, job.Status, job.Settings.Mode, job.Settings.Ratio,
+			job.CreatedAt.Local().Format(time.DateTime), duration)
+	}
+	return tw.Flush()
+}
+
+// adminJobCommand runs show, cancel or retry on one job
+func adminJobCommand(ctx context.Context, c *client.Client, command, id string) error {
+	switch command {
+	case "show":
+		job, err := c.AdminJob(ctx, id)
+		if err != nil {
+			return err
+		}
+		out := json.NewEncoder(os.Stdout)
+		out.SetIndent("", "  ")
+		return out.Encode(job)
+	case "cancel":
+		if err := c.CancelJob(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("Cancelling job %s\n", id)
+	case "retry":
+		accepted, err := c.RetryJob(ctx, id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Retrying job %s as job %s\n", id, accepted.JobID)
+	}
+	return nil
+}
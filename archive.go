@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/archive"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+const maxArchiveSize = 64 << 20 // 64 MB
+
+// runArchive processes every document of a zip upload as its own job and responds with a zip
+// of the outputs under the same paths. A member that fails gets a "<path>.error.txt" entry instead.
+func (s *server) runArchive(w http.ResponseWriter, r *http.Request, data []byte, settings jobs.Settings) {
+	members, err := archive.Read(data, s.cfg.ArchiveMaxFiles)
+	if err != nil {
+		logging.Errorf("VALIDATION FAILED: %v", err)
+		http.Error(w, "Invalid archive: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(members) == 0 {
+		logging.Errorf("VALIDATION FAILED: archive has no supported documents")
+		http.Error(w, "Archive contains no supported documents (.txt, .md)", http.StatusBadRequest)
+		return
+	}
+	log.Printf("ARCHIVE START | Documents: %d | Mode: %s | Ratio: %.2f", len(members), settings.Mode, settings.Ratio)
+
+	ctx := reqctx.WithMetadata(r.Context(), reqctx.Metadata{Tenant: r.Header.Get("X-Tenant-ID")})
+	outputs := make([]archive.Member, 0, len(members))
+	var jobIDs []string
+	for i, member := range members {
+		job := &jobs.Job{
+			ID:        jobs.NewID(),
+			CreatedAt: time.Now(),
+			Settings:  settings,
+			Source:    member.Text,
+			Owner:     requestOwner(r),
+		}
+		jobIDs = append(jobIDs, job.ID)
+		log.Printf("ARCHIVE DOCUMENT %d/%d | Path: %s | Job: %s | Words: %d", i+1, len(members), member.Path, job.ID, wordcount.Count(member.Text))
+
+		result, err := s.runTextJob(ctx, job)
+		if r.Context().Err() != nil {
+			log.Printf("Archive processing cancelled: %v", r.Context().Err())
+			writeProcessError(w, r, settings.Mode, r.Context().Err())
+			return
+		}
+		if err != nil {
+			logging.Errorf("ARCHIVE DOCUMENT FAILED | Path: %s | %v", member.Path, err)
+			outputs = append(outputs, archive.Member{Path: member.Path + ".error.txt", Text: "Processing failed: " + err.Error() + "\n"})
+			continue
+		}
+		outputs = append(outputs, archive.Member{Path: member.Path, Text: result})
+	}
+
+	var body bytes.Buffer
+	if err := archive.Write(&body, outputs); err != nil {
+		logging.Errorf("ARCHIVE WRITE FAILED: %v", err)
+		http.Error(w, "Failed to build output archive", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("ARCHIVE READY | Documents: %d | Size: %d bytes", len(outputs), body.Len())
+
+	w.Header().Set("X-Job-IDs", strings.Join(jobIDs, ","))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=processed_documents.zip")
+	w.Write(body.Bytes())
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/arnnvv/cutcrap/pkg/docx"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/store"
+)
+
+// artifactFormats are the formats a job's results can be listed and downloaded in, in listing
+// order
+var artifactFormats = []string{"txt", "md", "docx", "pdf", "json", "csv", "tsv", "srt", "vtt", "ffmetadata"}
+
+// artifactTypes are the content types of the artifact formats
+var artifactTypes = map[string]string{
+	"txt":        "text/plain; charset=utf-8",
+	"md":         "text/markdown; charset=utf-8",
+	"docx":       "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"pdf":        "application/pdf",
+	"json":       "application/json",
+	"csv":        "text/csv; charset=utf-8",
+	"tsv":        "text/tab-separated-values; charset=utf-8",
+	"srt":        "application/x-subrip",
+	"vtt":        "text/vtt; charset=utf-8",
+	"ffmetadata": "text/plain; charset=utf-8",
+}
+
+// jobArtifact is one format a job's result can be downloaded in
+type jobArtifact struct {
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	// Generated is false for a format converted from the plain-text output on its first download
+	Generated bool `json:"generated"`
+	// Size is the length in bytes, once generated
+	Size int64  `json:"size,omitempty"`
+	URL  string `json:"url"`
+}
+
+// artifactCache keeps the results of jobs, and the formats converted from them, when the
+// document store is not enabled. Entries are dropped with their job, or oldest first once they
+// hold more than maxSize bytes (0 for no limit).
+type artifactCache struct {
+	mu      sync.Mutex
+	jobs    map[string]map[string][]byte
+	order   []artifactKey
+	size    int64
+	maxSize int64
+
+	// generating are the conversions running, so concurrent downloads share one
+	generating map[artifactKey]*artifactGeneration
+}
+
+// artifactKey names one format of one job's result
+type artifactKey struct {
+	id, format string
+}
+
+// artifactGeneration is one running conversion and, once done is closed, its result
+type artifactGeneration struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+func (c *artifactCache) put(id, format string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxSize > 0 && int64(len(data)) > c.maxSize {
+		logging.Warnf("%s artifact of job %s (%d bytes) is larger than the artifact cache", format, id, len(data))
+		return
+	}
+	if c.jobs == nil {
+		c.jobs = make(map[string]map[string][]byte)
+	}
+	if c.jobs[id] == nil {
+		c.jobs[id] = make(map[string][]byte)
+	}
+	if old, ok := c.jobs[id][format]; ok {
+		c.size -= int64(len(old))
+	} else {
+		c.order = append(c.order, artifactKey{id, format})
+	}
+	c.jobs[id][format] = data
+	c.size += int64(len(data))
+
+	for c.maxSize > 0 && c.size > c.maxSize {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		c.size -= int64(len(c.jobs[oldest.id][oldest.format]))
+		delete(c.jobs[oldest.id], oldest.format)
+		if len(c.jobs[oldest.id]) == 0 {
+			delete(c.jobs, oldest.id)
+		}
+		log.Printf("Artifact cache full, dropped %s artifact of job %s", oldest.format, oldest.id)
+	}
+}
+
+func (c *artifactCache) get(id, format string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.jobs[id][format]
+	return data, ok
+}
+
+func (c *artifactCache) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, data := range c.jobs[id] {
+		c.size -= int64(len(data))
+	}
+	delete(c.jobs, id)
+	c.order = slices.DeleteFunc(c.order, func(key artifactKey) bool { return key.id == id })
+}
+
+// generate runs convert for one format of a job, unless a download of the same artifact is
+// already converting it, in which case it waits for that conversion's result instead
+func (c *artifactCache) generate(ctx context.Context, id, format string, convert func() ([]byte, error)) ([]byte, error) {
+	key := artifactKey{id, format}
+	c.mu.Lock()
+	if running, ok := c.generating[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-running.done:
+			return running.data, running.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if c.generating == nil {
+		c.generating = make(map[artifactKey]*artifactGeneration)
+	}
+	running := &artifactGeneration{done: make(chan struct{})}
+	c.generating[key] = running
+	c.mu.Unlock()
+
+	running.data, running.err = convert()
+	c.mu.Lock()
+	delete(c.generating, key)
+	c.mu.Unlock()
+	close(running.done)
+	return running.data, running.err
+}
+
+// handleArtifacts lists the formats a job's result can be downloaded in: the results it was
+// answered with and the formats its plain-text output converts to
+func (s *server) handleArtifacts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := s.ownedJob(w, r)
+	if !ok {
+		return
+	}
+
+	_, hasOutput := s.jobOutput(job)
+	artifacts := []jobArtifact{}
+	for _, format := range artifactFormats {
+		artifact := jobArtifact{Format: format, ContentType: artifactTypes[format], URL: apiVersion + "/jobs/" + job.ID + "/artifacts/" + format}
+		if size, ok := s.artifactSize(job, format); ok {
+			artifact.Generated, artifact.Size = true, size
+		} else if !hasOutput || !s.convertible(format) {
+			continue
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"job_id": job.ID, "artifacts": artifacts}); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// handleArtifact downloads a job's result in one format. Formats converted from the plain-text
+// output are generated on the first download and kept with the job's results.
+func (s *server) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := s.ownedJob(w, r)
+	if !ok {
+		return
+	}
+	s.serveArtifact(w, r, job, r.PathValue("format"))
+}
+
+// serveArtifact responds with a job's result in format, generating it first if needed
+func (s *server) serveArtifact(w http.ResponseWriter, r *http.Request, job *jobs.Job, format string) {
+	if artifactTypes[format] == "" {
+		http.Error(w, "Unknown artifact format", http.StatusNotFound)
+		return
+	}
+
+	data, ok := s.readArtifact(job, format)
+	if !ok {
+		output, hasOutput := s.jobOutput(job)
+		if !hasOutput || !s.convertible(format) {
+			http.Error(w, "Artifact not available for this job", http.StatusNotFound)
+			return
+		}
+		// Concurrent downloads share one conversion, which outlives any one of them
+		var err error
+		data, err = s.artifacts.generate(r.Context(), job.ID, format, func() ([]byte, error) {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), s.cfg.RequestTimeout)
+			defer cancel()
+			data, err := s.convertOutput(ctx, format, output)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Generated %s artifact of job %s (%d bytes)", format, job.ID, len(data))
+			s.saveResult(job, format, data)
+			return data, nil
+		})
+		if err != nil {
+			log.Printf("Failed to generate %s artifact of job %s: %v", format, job.ID, err)
+			http.Error(w, "Failed to generate artifact", http.StatusBadGateway)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", artifactTypes[format])
+	w.Header().Set("Content-Disposition", "attachment; filename="+resultFilename(job.Settings.Mode, format))
+	w.Write(data)
+}
+
+// convertible reports whether format is generated from a job's plain-text output
+func (s *server) convertible(format string) bool {
+	switch format {
+	case "txt", "md", "docx":
+		return true
+	case "pdf":
+		return s.cfg.Pdf_api != ""
+	}
+	return false
+}
+
+// convertOutput renders a job's plain-text output, which is markdown, in a convertible format
+func (s *server) convertOutput(ctx context.Context, format, output string) ([]byte, error) {
+	switch format {
+	case "docx":
+		return docx.Render(output)
+	case "pdf":
+		pdf, err := s.renderPDF(ctx, output)
+		if err != nil {
+			return nil, err
+		}
+		defer pdf.Close()
+		return io.ReadAll(pdf)
+	}
+	return []byte(output), nil
+}
+
+// storedArtifactPath is the document store file of a job's result in format, or "" when there is
+// none
+func (s *server) storedArtifactPath(job *jobs.Job, format string) string {
+	if s.documents == nil || job.DocumentHash == "" {
+		return ""
+	}
+	key, _, err := store.SettingsKey(job.Settings)
+	if err != nil {
+		return ""
+	}
+	return s.documents.ResultPath(job.DocumentHash, key+"."+format)
+}
+
+// artifactSize is the size of a job's result in format, if it was generated
+func (s *server) artifactSize(job *jobs.Job, format string) (int64, bool) {
+	if path := s.storedArtifactPath(job, format); path != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size(), true
+	}
+	if format == "txt" && job.Output != "" {
+		return int64(len(job.Output)), true
+	}
+	data, ok := s.artifacts.get(job.ID, format)
+	return int64(len(data)), ok
+}
+
+// readArtifact returns a job's result in format, if it was generated
+func (s *server) readArtifact(job *jobs.Job, format string) ([]byte, bool) {
+	if path := s.storedArtifactPath(job, format); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Failed to read stored %s artifact of job %s: %v", format, job.ID, err)
+		}
+		return data, err == nil
+	}
+	if format == "txt" && job.Output != "" {
+		return []byte(job.Output), true
+	}
+	return s.artifacts.get(job.ID, format)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/cutcrap"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/search"
+)
+
+// askChunks is how many processed chunks closest to a question the answer is written from
+const askChunks = 5
+
+// maxQuestionLength bounds the question of an /ask request, in bytes
+const maxQuestionLength = 2000
+
+// askResponse is the answer to a question about a job's document
+type askResponse struct {
+	JobID     string     `json:"job_id"`
+	Question  string     `json:"question"`
+	Answer    string     `json:"answer"`
+	Citations []citation `json:"citations"`
+}
+
+// citation is a processed chunk an answer cites, numbered from 1 in document order
+type citation struct {
+	Chunk int    `json:"chunk"`
+	Text  string `json:"text"`
+}
+
+// handleAsk answers a question grounded in the processed chunks of a finished document job,
+// as kept by the document store. The chunks are embedded on the first question and kept while
+// the job is; the answer is written from the chunks closest to the question and cites them.
+func (s *server) handleAsk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.chunkVectors == nil {
+		http.Error(w, "Question answering is not enabled on this server", http.StatusNotFound)
+		return
+	}
+	job, ok := s.ownedJob(w, r)
+	if !ok {
+		return
+	}
+	question := strings.TrimSpace(r.FormValue("question"))
+	if question == "" || len(question) > maxQuestionLength {
+		writeRequestError(w, r, badRequest("Invalid question (must be 1 to %d characters)", maxQuestionLength))
+		return
+	}
+	chunks, ok := s.jobChunks(job)
+	if !ok {
+		writeRequestError(w, r, badRequest("Job has no stored chunks to answer from"))
+		return
+	}
+	log.Printf("\n\n=== ASK REQUEST === Job: %s", job.ID)
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.RequestTimeout*2)
+	defer cancel()
+	if err := s.embedChunks(ctx, job, chunks); err != nil {
+		log.Printf("Failed to embed chunks of job %s: %v", job.ID, err)
+		http.Error(w, "Failed to index the document", http.StatusBadGateway)
+		return
+	}
+	vectors, err := s.engine.Embed(ctx, api.EmbedQuery, []string{question})
+	if err != nil {
+		log.Printf("Failed to embed question: %v", err)
+		http.Error(w, "Failed to embed question", http.StatusBadGateway)
+		return
+	}
+
+	matches := s.chunkVectors.Nearest(job.ID, vectors[0], askChunks)
+	passages := make(map[int]string, len(matches))
+	for _, match := range matches {
+		if match.Text != "" {
+			passages[match.Passage+1] = match.Text
+		}
+	}
+	answer, err := s.engine.AnswerQuestion(ctx, question, passages, engineOptions(job.Settings))
+	if err != nil {
+		log.Printf("Failed to answer question about job %s: %v", job.ID, err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "Answering timed out", http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, "Failed to answer question", http.StatusBadGateway)
+		return
+	}
+	log.Printf("RESPONSE READY (ask) | Job: %s | Passages: %d | Citations: %v", job.ID, len(passages), answer.Citations)
+
+	response := askResponse{JobID: job.ID, Question: question, Answer: answer.Text, Citations: []citation{}}
+	for _, number := range answer.Citations {
+		response.Citations = append(response.Citations, citation{Chunk: number, Text: passages[number]})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// jobChunks returns the outputs of the chunks a document job was condensed in, as stored with
+// its result. Chunks left without output are kept empty so the rest keep their numbers.
+func (s *server) jobChunks(job *jobs.Job) ([]string, bool) {
+	if s.documents == nil || job.DocumentHash == "" {
+		return nil, false
+	}
+	data, err := s.documents.Chunks(job.DocumentHash, chunkSettings(job.Settings))
+	if err != nil {
+		return nil, false
+	}
+	var outputs []cutcrap.ChunkOutput
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		log.Printf("Failed to decode stored chunks of job %s: %v", job.ID, err)
+		return nil, false
+	}
+	chunks := make([]string, len(outputs))
+	found := false
+	for i, output := range outputs {
+		chunks[i] = strings.TrimSpace(output.Output)
+		found = found || chunks[i] != ""
+	}
+	return chunks, found
+}
+
+// embedChunks embeds the processed chunks of a job, unless that was done before
+func (s *server) embedChunks(ctx context.Context, job *jobs.Job, chunks []string) error {
+	if s.chunkVectors.Has(job.ID) {
+		return nil
+	}
+	var texts []string
+	for _, chunk := range chunks {
+		if chunk != "" {
+			texts = append(texts, chunk)
+		}
+	}
+	vectors, err := s.engine.Embed(ctx, api.EmbedDocument, texts)
+	if err != nil {
+		return err
+	}
+	// Empty chunks get no vector and are never closest to a question
+	passages := make([]search.Passage, len(chunks))
+	next := 0
+	for i, chunk := range chunks {
+		passages[i] = search.Passage{Text: chunk}
+		if chunk != "" {
+			passages[i].Vector = vectors[next]
+			next++
+		}
+	}
+	// Added under the store's lock, so a job evicted meanwhile isn't indexed again
+	s.jobs.WithJob(job.ID, func(*jobs.Job) { s.chunkVectors.Add(job.ID, job.Owner, passages) })
+	log.Printf("Job %s embedded for questions (%d chunks)", job.ID, len(texts))
+	return nil
+}
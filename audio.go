@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+const maxAudioSize = 200 << 20 // 200 MB
+
+// transcribeUpload transcribes the audio upload of req, writing the error response and returning
+// false when that fails. The transcript then goes through transcript mode like pasted text.
+func (s *server) transcribeUpload(w http.ResponseWriter, r *http.Request, req *processRequest) (string, bool) {
+	if s.transcriber == nil {
+		writeRequestError(w, r, badRequest("Audio transcription is not enabled on this server"))
+		return "", false
+	}
+	startTime := time.Now()
+	log.Printf("TRANSCRIBING | File: %s | Size: %d bytes | Backend: %s", req.AudioName, len(req.Audio), s.cfg.TranscribeBackend)
+	text, err := s.transcriber.Transcribe(r.Context(), req.AudioName, req.Audio)
+	if err != nil {
+		logging.Errorf("TRANSCRIPTION FAILED: %v", err)
+		writeRequestError(w, r, &requestError{Status: http.StatusBadGateway, Message: "Audio transcription failed"})
+		return "", false
+	}
+	if text == "" {
+		writeRequestError(w, r, &requestError{Status: http.StatusUnprocessableEntity, Message: "No speech found in the audio file"})
+		return "", false
+	}
+	log.Printf("TRANSCRIBED | %d words in %v", wordcount.Count(text), time.Since(startTime))
+	return text, true
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/cutcrap"
+	"github.com/arnnvv/cutcrap/pkg/fakeprovider"
+	"github.com/arnnvv/cutcrap/pkg/httpclient"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+const benchUsage = `usage: cutcrap bench [flags]
+
+Runs the chunker and worker pool over a document against a synthetic provider that answers
+like the real one but only after a simulated latency, for every CHUNK_SIZE and MAX_CONCURRENT
+combination given, and prints throughput, memory and scheduling stats. No API calls are made.
+
+  -chunk-sizes 500,1000   CHUNK_SIZE values (default CHUNK_SIZE)
+  -concurrency 2,4,8      MAX_CONCURRENT values (default MAX_CONCURRENT)
+  -input FILE             document to process (default a synthetic one of -words words)
+  -words N                length of the synthetic document (default 20000)
+  -mode MODE              processing mode (default document)
+  -ratio R                condensing ratio (default 0.5)
+  -latency D              simulated base latency per model call (default 800ms)
+  -per-word D             simulated latency per output word (default 2ms)
+  -jitter F               latency varies by up to ±F, a fraction (default 0.2)
+  -runs N                 runs per combination, averaged (default 1)
+  -v                      show the pipeline's logs
+`
+
+// benchResult is the outcome of one CHUNK_SIZE and MAX_CONCURRENT combination
+type benchResult struct {
+	chunks   int
+	calls    int64
+	peak     int64
+	wall     time.Duration
+	stats    metrics.PoolSummary
+	alloc    uint64
+	peakHeap uint64
+}
+
+// runBench is the "bench" subcommand: a throughput benchmark of the pipeline for sizing
+// deployments. It returns the process exit code.
+func runBench(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, benchUsage) }
+	chunkSizesFlag := flags.String("chunk-sizes", strconv.Itoa(cfg.ChunkSize), "CHUNK_SIZE values")
+	concurrencyFlag := flags.String("concurrency", strconv.Itoa(cfg.MaxConcurrent), "MAX_CONCURRENT values")
+	input := flags.String("input", "", "document to process")
+	words := flags.Int("words", 20000, "length of the synthetic document")
+	mode := flags.String("mode", cutcrap.ModeDocument, "processing mode")
+	ratio := flags.Float64("ratio", 0.5, "condensing ratio")
+	latency := flags.Duration("latency", 800*time.Millisecond, "simulated base latency per model call")
+	perWord := flags.Duration("per-word", 2*time.Millisecond, "simulated latency per output word")
+	jitter := flags.Float64("jitter", 0.2, "latency jitter fraction")
+	runs := flags.Int("runs", 1, "runs per combination")
+	verbose := flags.Bool("v", false, "show the pipeline's logs")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	chunkSizes, err := parsePositiveInts(*chunkSizesFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cutcrap bench: invalid -chunk-sizes: %v\n", err)
+		return 2
+	}
+	concurrencies, err := parsePositiveInts(*concurrencyFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cutcrap bench: invalid -concurrency: %v\n", err)
+		return 2
+	}
+	if *runs <= 0 || *words <= 0 || *ratio <= 0 || *ratio >= 1 {
+		flags.Usage()
+		return 2
+	}
+
+	text := syntheticDocument(*words)
+	if *input != "" {
+		data, err := os.ReadFile(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cutcrap bench: %v\n", err)
+			return 1
+		}
+		text = string(data)
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	httpclient.Configure(max(cfg.HTTPMaxIdleConnsPerHost, slices.Max(concurrencies)))
+
+	inputWords := wordcount.Count(text)
+	fmt.Printf("Input: %d words, mode %s, ratio %g, %d run(s) each\n", inputWords, *mode, *ratio, *runs)
+	fmt.Printf("Provider: %v per call + %v per output word, ±%.0f%% jitter\n\n", *latency, *perWord, *jitter*100)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "CHUNK_SIZE\tMAX_CONCURRENT\tCHUNKS\tCALLS\tPEAK_IN_FLIGHT\tWALL\tWORDS/S\tCHUNK_P50\tCHUNK_P95\tALLOC\tPEAK_HEAP\t")
+	failed := 0
+	for _, size := range chunkSizes {
+		for _, concurrency := range concurrencies {
+			provider := &fakeprovider.Handler{Latency: *latency, PerOutputWord: *perWord, Jitter: *jitter}
+			result, err := benchCombination(cfg, provider, text, *mode, *ratio, size, concurrency, *runs)
+			if err != nil {
+				fmt.Fprintf(tw, "%d\t%d\tFAILED: %v\t\t\t\t\t\t\t\t\t\n", size, concurrency, err)
+				failed++
+				continue
+			}
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%v\t%.0f\t%dms\t%dms\t%s\t%s\t\n",
+				size, concurrency, result.chunks, result.calls, result.peak,
+				result.wall.Round(time.Millisecond), float64(inputWords)/result.wall.Seconds(),
+				result.stats.LatencyP50Ms, result.stats.LatencyP95Ms, formatBytes(result.alloc), formatBytes(result.peakHeap))
+		}
+	}
+	tw.Flush()
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// benchCombination processes text runs times with one CHUNK_SIZE and MAX_CONCURRENT against
+// provider. Calls and wall time are averaged per run; memory is the most any run used.
+func benchCombination(base *config.Config, provider *fakeprovider.Handler, text, mode string, ratio float64, size, concurrency, runs int) (benchResult, error) {
+	server := httptest.NewServer(provider)
+	defer server.Close()
+
+	// The synthetic provider stands in for whatever backend is configured; caches, hooks and
+	// limits that would skew or block the runs are off
+	cfg := *base
+	cfg.ChunkSize, cfg.ChunkOverlap, cfg.MaxConcurrent = size, min(base.ChunkOverlap, size-1), concurrency
+	cfg.Provider, cfg.GeminiBaseURL, cfg.OpenRouterKey = "gemini", server.URL, "bench"
+	cfg.LLMRecordMode, cfg.ProviderHeaders, cfg.ProviderAllowedHosts, cfg.ProviderAuditLog = "", "", nil, ""
+	cfg.PreHooks, cfg.PostHooks, cfg.PostProcessors = nil, nil, nil
+	cfg.MaxChunks, cfg.MaxInputTokens, cfg.SpeakerCacheSize, cfg.ContextCacheMinChunks = 0, 0, 0, 0
+	engine, err := cutcrap.New(&cfg)
+	if err != nil {
+		return benchResult{}, err
+	}
+
+	var result benchResult
+	for range runs {
+		runtime.GC()
+		var before runtime.MemStats
+		runtime.ReadMemStats(&before)
+		peakHeap, stop := sampleHeap(before.HeapAlloc)
+
+		stats := &metrics.PoolStats{}
+		seed := int64(1)
+		ctx, cancel := context.WithTimeout(metrics.WithPoolStats(context.Background(), stats), jobTimeout(&cfg, text))
+		start := time.Now()
+		_, err := engine.Condense(ctx, mode, text, cutcrap.Options{Ratio: ratio, Seed: &seed})
+		wall := time.Since(start)
+		cancel()
+		stop()
+		if err != nil {
+			return benchResult{}, err
+		}
+
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		result.wall += wall
+		result.stats = stats.Summary()
+		result.chunks = result.stats.Chunks
+		result.alloc = max(result.alloc, after.TotalAlloc-before.TotalAlloc)
+		result.peakHeap = max(result.peakHeap, *peakHeap-before.HeapAlloc)
+	}
+	result.wall /= time.Duration(runs)
+	result.calls = provider.Calls() / int64(runs)
+	result.peak = provider.PeakInFlight()
+	return result, nil
+}
+
+// sampleHeap tracks the largest heap seen, from start, until stop is called
+func sampleHeap(start uint64) (*uint64, func()) {
+	peak := start
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		var stats runtime.MemStats
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				runtime.ReadMemStats(&stats)
+				peak = max(peak, stats.HeapAlloc)
+			}
+		}
+	}()
+	return &peak, func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// parsePositiveInts reads a comma separated list of positive integers
+func parsePositiveInts(list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%q is not a positive integer", field)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+// formatBytes writes n in KB or MB
+func formatBytes(n uint64) string {
+	if n < 1<<20 {
+		return fmt.Sprintf("%.0fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+}
+
+// benchWords are the vocabulary of synthetic documents
+var benchWords = strings.Fields(`the a of and to in is that for it as with was on by be this are from
+at an which or have has not but their its they more can were been one all also other into time
+system process data model result value study approach method analysis design performance level
+cost team market report growth policy research support service network design change customer
+project quality risk energy security platform budget strategy evidence review impact period`)
+
+// syntheticDocument returns a deterministic document of about words words: headed sections of
+// paragraphs of sentences
+func syntheticDocument(words int) string {
+	random := rand.New(rand.NewPCG(1, 2))
+	var b strings.Builder
+	written, section := 0, 0
+	for written < words {
+		section++
+		fmt.Fprintf(&b, "# Section %d\n\n", section)
+		for range 4 {
+			for range 5 + random.IntN(4) {
+				length := 8 + random.IntN(17)
+				sentence := make([]string, length)
+				for i := range sentence {
+					sentence[i] = benchWords[random.IntN(len(benchWords))]
+				}
+				sentence[0] = strings.ToUpper(sentence[0][:1]) + sentence[0][1:]
+				b.WriteString(strings.Join(sentence, " ") + ". ")
+				written += length
+			}
+			b.WriteString("\n\n")
+		}
+	}
+	return b.String()
+}
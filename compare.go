@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/textdiff"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// compareSides are the field prefixes of the two parameter sets of a /compare request
+var compareSides = [2]string{"a", "b"}
+
+// compareResponse is the JSON response of /compare
+type compareResponse struct {
+	A    compareResult `json:"a"`
+	B    compareResult `json:"b"`
+	Diff []textdiff.Op `json:"diff"`
+}
+
+// compareResult is the output of one side of a comparison, recorded as its own job
+type compareResult struct {
+	JobID    string         `json:"job_id"`
+	Settings jobs.Settings  `json:"settings"`
+	Output   string         `json:"output"`
+	Metrics  metrics.Report `json:"metrics"`
+}
+
+// handleCompare runs the same input with two parameter sets and returns both outputs with a
+// sentence-level diff. The request takes the /process fields as the common base; a_ratio,
+// a_profile, a_style and a_model (and the b_ equivalents) override them per side.
+func (s *server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	log.Printf("\n\n=== COMPARE REQUEST ===")
+
+	req, err := parseProcessRequest(r, s.profiles, s.uploads)
+	if err != nil {
+		writeRequestError(w, r, err)
+		return
+	}
+	r = r.WithContext(api.WithPriority(r.Context(), req.Priority))
+	if req.TwoTrack || req.TagTone || req.ExecutiveSummary || req.Glossary || req.Flashcards != "" || req.Output != "" || req.Archive != nil || req.EmailTo != "" || req.WebhookURL != "" {
+		writeRequestError(w, r, badRequest("two_track, tag_tone, executive_summary, glossary, flashcards, output, archive, email_to and webhook_url are not supported by /compare"))
+		return
+	}
+	if req.Mode == "outline" {
+		writeRequestError(w, r, badRequest("outline mode is not supported by /compare"))
+		return
+	}
+	text := req.Text
+	if text == "" && req.Document != "" {
+		if s.documents == nil {
+			writeRequestError(w, r, badRequest("Document references are not enabled on this server"))
+			return
+		}
+		if text, err = s.documents.Get(req.Document); err != nil {
+			writeRequestError(w, r, &requestError{Status: http.StatusNotFound, Message: "Referenced document not found"})
+			return
+		}
+	}
+	if req.Audio != nil {
+		var ok bool
+		if text, ok = s.transcribeUpload(w, r, req); !ok {
+			return
+		}
+	}
+	if text == "" {
+		writeRequestError(w, r, badRequest("Text field is missing or empty"))
+		return
+	}
+
+	// Both sides use the same seed so only the compared parameters differ
+	seed := rand.Int64N(1 << 31)
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+	var sides [2]*jobs.Job
+	var runInfos [2]*api.RunInfo
+	for i, name := range compareSides {
+		settings, err := s.compareSettings(r, req, name)
+		if err != nil {
+			writeRequestError(w, r, err)
+			return
+		}
+		settings.Seed = seed
+		sides[i] = &jobs.Job{ID: jobs.NewID(), CreatedAt: time.Now(), Settings: settings, Source: text, Owner: requestOwner(r)}
+		runInfos[i] = &api.RunInfo{Seed: &seed}
+		s.storeSource(sides[i])
+	}
+
+	// Each side runs with half of MAX_CONCURRENT, so the chunks take twice the waves
+	ctx, cancel := context.WithTimeout(r.Context(), min(2*jobTimeout(s.cfg, text), s.cfg.JobTimeoutMax))
+	defer cancel()
+	// Work shared by both sides (e.g. speaker analysis) is recorded with side a
+	ctx = api.WithRunInfo(ctx, runInfos[0])
+	ctx = reqctx.WithMetadata(ctx, reqctx.Metadata{JobID: sides[0].ID + "+" + sides[1].ID, Tenant: r.Header.Get("X-Tenant-ID")})
+	for i := range sides {
+		// Both sides share the worker pool, so their chunk stats can't be told apart
+		defer s.recordJob(sides[i], runInfos[i], nil)
+	}
+
+	mode := req.Mode
+	optsA, optsB := engineOptions(sides[0].Settings), engineOptions(sides[1].Settings)
+	optsA.RunInfo, optsB.RunInfo = runInfos[0], runInfos[1]
+	log.Printf("COMPARE START | Jobs: %s, %s | Mode: %s | Words: %d | Ratio: %.2f vs %.2f | Style: '%s' vs '%s' | Model: '%s' vs '%s'",
+		sides[0].ID, sides[1].ID, mode, wordcount.Count(text), optsA.Ratio, optsB.Ratio, optsA.Style, optsB.Style, optsA.Model, optsB.Model)
+
+	outputA, outputB, err := s.engine.Compare(ctx, mode, text, optsA, optsB)
+	if err != nil {
+		writeProcessError(w, r, mode, err)
+		return
+	}
+
+	response := compareResponse{Diff: textdiff.Diff(outputA, outputB)}
+	for i, output := range [2]string{outputA, outputB} {
+		sides[i].Output = output
+		s.saveResult(sides[i], "txt", []byte(output))
+		result := compareResult{JobID: sides[i].ID, Settings: sides[i].Settings, Output: output, Metrics: metrics.NewReport(text, output)}
+		logMetrics(compareSides[i], result.Metrics)
+		if i == 0 {
+			response.A = result
+		} else {
+			response.B = result
+		}
+	}
+	log.Printf("RESPONSE READY (compare) | Output: %d vs %d words | Diff: %d runs",
+		wordcount.Count(outputA), wordcount.Count(outputB), len(response.Diff))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// compareSettings applies the overrides of one side to the common request
+func (s *server) compareSettings(r *http.Request, req *processRequest, side string) (jobs.Settings, error) {
+	settings := jobs.Settings{
+		Mode:                req.Mode,
+		Ratio:               req.Ratio,
+		TranslateTo:         req.TranslateTo,
+		Style:               req.Style,
+		Model:               req.Model,
+		Format:              req.Format,
+		KeepSections:        req.KeepSections,
+		PruneReferences:     req.PruneReferences,
+		SkipSpeakerAnalysis: req.SkipSpeakerAnalysis,
+		SpeakerAliases:      req.SpeakerAliases,
+		KeepSpeakerNames:    req.KeepSpeakerNames,
+	}
+
+	if name := strings.TrimSpace(r.FormValue(side + "_profile")); name != "" {
+		p, ok := s.profiles[name]
+		if !ok {
+			return settings, invalidField(side+"_profile", "Unknown %s_profile '%s'", side, name)
+		}
+		if p.Mode != "" && p.Mode != req.Mode {
+			return settings, invalidField(side+"_profile", "%s_profile '%s' is for %s mode; both sides must use the same mode", side, name, p.Mode)
+		}
+		if p.Ratio > 0 {
+			settings.Ratio = p.Ratio
+		}
+		settings.Style, settings.Model = p.Style, p.Model
+	}
+	if value := r.FormValue(side + "_ratio"); value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio <= 0 || ratio > 1 {
+			return settings, invalidField(side+"_ratio", "Invalid %s_ratio value (must be > 0 and <= 1)", side)
+		}
+		settings.Ratio = ratio
+	}
+	if style := strings.TrimSpace(r.FormValue(side + "_style")); style != "" {
+		if _, ok := api.Styles[style]; !ok {
+			return settings, invalidField(side+"_style", "Unknown %s_style '%s'", side, style)
+		}
+		settings.Style = style
+	}
+	if model := strings.TrimSpace(r.FormValue(side + "_model")); model != "" {
+		if !s.knownModel(model) {
+			return settings, invalidField(side+"_model", "Unknown %s_model '%s' (must be a routed model or the model of a profile)", side, model)
+		}
+		settings.Model = model
+	}
+	return settings, nil
+}
+
+// knownModel reports whether a model is configured on the server, so clients can't send jobs
+// to arbitrary models
+func (s *server) knownModel(model string) bool {
+	if model == s.cfg.FastModel || model == s.cfg.StrongModel {
+		return true
+	}
+	for _, p := range s.profiles {
+		if model == p.Model {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/cutcrap"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// Bounds of a /compare/documents request
+const (
+	maxComparedDocuments = 5
+	// maxComparedWords is the longest a document is compared at; longer outputs are condensed
+	// to this length first so all of them fit in one prompt
+	maxComparedWords = 4000
+	// defaultCompareRatio is the ratio uploads are condensed at when the request sets none
+	defaultCompareRatio = 0.3
+)
+
+// comparedDocument is one input of a document comparison, numbered from 1 in request order:
+// jobs first, then uploads
+type comparedDocument struct {
+	Document int    `json:"document"`
+	JobID    string `json:"job_id"`
+	Filename string `json:"filename,omitempty"`
+	Words    int    `json:"words"`
+
+	output string
+}
+
+// documentComparisonResponse is the comparative summary of the documents of a request
+type documentComparisonResponse struct {
+	Documents   []comparedDocument `json:"documents"`
+	Agreements  []string           `json:"agreements"`
+	Differences []string           `json:"differences"`
+	Unique      []api.UniquePoints `json:"unique"`
+}
+
+// handleCompareDocuments summarizes what two or more documents agree on, where they differ and
+// what only one of them says. Documents are the outputs of recorded jobs, named by the repeated
+// job field, and text files uploaded as files, which are condensed as new document jobs first.
+func (s *server) handleCompareDocuments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	const maxMemory = 32 << 20 // 32 MB
+	if err := r.ParseMultipartForm(maxMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		logging.Errorf("MULTIPART FORM PARSE ERROR: %v", err)
+		writeRequestError(w, r, badRequest("Failed to parse multipart form"))
+		return
+	}
+	ids := r.Form["job"]
+	var uploads []*multipart.FileHeader
+	if r.MultipartForm != nil {
+		uploads = r.MultipartForm.File["files"]
+	}
+	if count := len(ids) + len(uploads); count < 2 || count > maxComparedDocuments {
+		writeRequestError(w, r, badRequest("Invalid number of documents (must be 2 to %d jobs and files)", maxComparedDocuments))
+		return
+	}
+	ratio := defaultCompareRatio
+	if ratioStr := r.FormValue("ratio"); ratioStr != "" {
+		var err error
+		if ratio, err = strconv.ParseFloat(ratioStr, 64); err != nil || ratio <= 0 || ratio > 1 {
+			writeRequestError(w, r, badRequest("Invalid ratio value (must be > 0 and <= 1)"))
+			return
+		}
+	}
+
+	docs := make([]comparedDocument, 0, len(ids)+len(uploads))
+	for _, id := range ids {
+		job, ok := s.jobs.Get(strings.TrimSpace(id))
+		if !ok || job.Owner != requestOwner(r) {
+			http.Error(w, "Job not found: "+id, http.StatusNotFound)
+			return
+		}
+		output, ok := s.jobOutput(job)
+		if !ok {
+			http.Error(w, "The output of job "+job.ID+" is not available", http.StatusNotFound)
+			return
+		}
+		docs = append(docs, comparedDocument{JobID: job.ID, output: output})
+	}
+	var sources []string
+	for _, header := range uploads {
+		text, _, err := readTextFile(header)
+		if err != nil {
+			writeRequestError(w, r, err)
+			return
+		}
+		if strings.TrimSpace(text) == "" {
+			writeRequestError(w, r, badRequest("Text file '%s' is empty", header.Filename))
+			return
+		}
+		sources = append(sources, text)
+	}
+	log.Printf("\n\n=== COMPARE DOCUMENTS REQUEST === Jobs: %q | Files: %d | Ratio: %.2f", ids, len(uploads), ratio)
+
+	// Every step runs under a deadline of its own: uploads are condensed under their job's, long
+	// outputs under one budgeted like a job over the output, the comparison under REQUEST_TIMEOUT
+	ctx := reqctx.WithMetadata(r.Context(), reqctx.Metadata{Tenant: r.Header.Get("X-Tenant-ID")})
+
+	// Uploads are recorded as jobs of their own, so they can be compared again by ID
+	for i, text := range sources {
+		job := &jobs.Job{
+			ID:        jobs.NewID(),
+			CreatedAt: time.Now(),
+			Settings:  jobs.Settings{Mode: cutcrap.ModeDocument, Ratio: ratio, Seed: rand.Int64N(1 << 31)},
+			Source:    text,
+			Owner:     requestOwner(r),
+		}
+		output, err := s.runTextJob(ctx, job)
+		if err != nil {
+			log.Printf("Failed to condense uploaded file '%s': %v", uploads[i].Filename, err)
+			writeProcessError(w, r, cutcrap.ModeDocument, err)
+			return
+		}
+		docs = append(docs, comparedDocument{JobID: job.ID, Filename: uploads[i].Filename, output: output})
+	}
+
+	texts := make([]string, len(docs))
+	for i := range docs {
+		doc := &docs[i]
+		doc.Document = i + 1
+		words := wordcount.Count(doc.output)
+		if words > maxComparedWords {
+			log.Printf("Condensing document %d (%d words) to %d words for comparison", doc.Document, words, maxComparedWords)
+			shorter, err := s.condenseForComparison(ctx, doc.output, words)
+			if err != nil {
+				writeProcessError(w, r, cutcrap.ModeDocument, err)
+				return
+			}
+			doc.output, words = shorter, wordcount.Count(shorter)
+		}
+		doc.Words, texts[i] = words, doc.output
+	}
+
+	compareCtx, cancel := context.WithTimeout(ctx, s.cfg.RequestTimeout)
+	defer cancel()
+	comparison, err := s.engine.CompareDocuments(compareCtx, texts)
+	if err != nil {
+		log.Printf("Failed to compare documents: %v", err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "Comparison timed out", http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, "Failed to compare documents", http.StatusBadGateway)
+		return
+	}
+	log.Printf("RESPONSE READY (compare documents) | Documents: %d | Agreements: %d | Differences: %d", len(docs), len(comparison.Agreements), len(comparison.Differences))
+
+	response := documentComparisonResponse{
+		Documents:   docs,
+		Agreements:  comparison.Agreements,
+		Differences: comparison.Differences,
+		Unique:      comparison.Unique,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// condenseForComparison condenses an output of words words to about maxComparedWords, within
+// the deadline of a job over the output
+func (s *server) condenseForComparison(ctx context.Context, output string, words int) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout(s.cfg, output))
+	defer cancel()
+	return s.engine.Condense(ctx, cutcrap.ModeDocument, output, cutcrap.Options{Ratio: float64(maxComparedWords) / float64(words)})
+}
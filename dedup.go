@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/store"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// inflightRuns tracks the synchronous jobs currently running, keyed by source hash and
+// settings, so an identical request arriving meanwhile can share the result
+type inflightRuns struct {
+	mu   sync.Mutex
+	runs map[string]*inflightRun
+}
+
+// inflightRun is one running job and, once done is closed, its captured response
+type inflightRun struct {
+	jobID     string
+	done      chan struct{}
+	response  bufferedResponse
+	cancelled bool
+}
+
+// runJobOnce runs a job, or attaches the request to an identical job of the same API key and
+// tenant that is already running and replays that job's response. The attached request is not
+// recorded as a job of its own: it gets the running job's X-Job-ID, marked with
+// X-Deduplicated. Unless the seed was given explicitly it is left out of the comparison, since
+// a random one is picked per request. Streamed responses aren't shared.
+func (s *server) runJobOnce(w http.ResponseWriter, r *http.Request, job *jobs.Job, explicitSeed bool) {
+	settings := job.Settings
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		s.shouldStream(settings.Mode, settings, wordcount.Count(job.Source)) {
+		s.runJob(w, r, job)
+		return
+	}
+
+	if !explicitSeed {
+		settings.Seed = 0
+	}
+	settingsKey, _, err := store.SettingsKey(settings)
+	if err != nil {
+		s.runJob(w, r, job)
+		return
+	}
+	key := store.Hash(job.Source) + "/" + settingsKey + "/" + job.Owner
+
+	s.inflight.mu.Lock()
+	if s.inflight.runs == nil {
+		s.inflight.runs = make(map[string]*inflightRun)
+	}
+	if run, ok := s.inflight.runs[key]; ok {
+		s.inflight.mu.Unlock()
+		log.Printf("DUPLICATE REQUEST | Attaching to in-flight job %s", run.jobID)
+		select {
+		case <-run.done:
+		case <-r.Context().Done():
+			return
+		}
+		if run.cancelled {
+			log.Printf("In-flight job %s was cancelled by its client, running job %s instead", run.jobID, job.ID)
+			s.runJob(w, r, job)
+			return
+		}
+		w.Header().Set("X-Deduplicated", "true")
+		run.response.replay(w)
+		return
+	}
+	run := &inflightRun{jobID: job.ID, done: make(chan struct{}), response: bufferedResponse{header: http.Header{}}}
+	s.inflight.runs[key] = run
+	s.inflight.mu.Unlock()
+
+	defer func() {
+		s.inflight.mu.Lock()
+		delete(s.inflight.runs, key)
+		s.inflight.mu.Unlock()
+		run.cancelled = r.Context().Err() != nil
+		close(run.done)
+	}()
+	tee := &teeResponse{ResponseWriter: w, copy: &run.response}
+	s.runJob(tee, r, job)
+	for name, values := range w.Header() {
+		run.response.header[name] = values
+	}
+}
+
+// replay writes a captured response to w
+func (b *bufferedResponse) replay(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	if b.status != 0 {
+		w.WriteHeader(b.status)
+	}
+	w.Write(b.body.Bytes())
+}
+
+// teeResponse writes a response through to the client while capturing a copy of it
+type teeResponse struct {
+	http.ResponseWriter
+	copy *bufferedResponse
+}
+
+func (t *teeResponse) WriteHeader(status int) {
+	t.copy.WriteHeader(status)
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *teeResponse) Write(p []byte) (int, error) {
+	t.copy.Write(p)
+	return t.ResponseWriter.Write(p)
+}
+
+func (t *teeResponse) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (t *teeResponse) markFailed() { t.copy.failed = true }
+
+// markFailed records on the writers capturing w that the response failed after its status was
+// sent (by a heartbeat or a stream), so the captured copy isn't replayed as a success
+func markFailed(w http.ResponseWriter) {
+	if f, ok := w.(interface{ markFailed() }); ok {
+		f.markFailed()
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// defaultDownloadTTL is how long a signed download link is valid when the request sets no
+// expires_in
+const defaultDownloadTTL = 24 * time.Hour
+
+// sharedDownload is a signed link to one artifact of a job
+type sharedDownload struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handleShareArtifact signs a link to one artifact of a job that downloads without an API key
+// until it expires. expires_in sets the lifetime in seconds, up to DOWNLOAD_URL_MAX_TTL.
+func (s *server) handleShareArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.cfg.DownloadSigningSecret == "" {
+		http.Error(w, "Signed downloads are not enabled on this server", http.StatusNotFound)
+		return
+	}
+	job, ok := s.ownedJob(w, r)
+	if !ok {
+		return
+	}
+	format := r.PathValue("format")
+	if artifactTypes[format] == "" {
+		http.Error(w, "Unknown artifact format", http.StatusNotFound)
+		return
+	}
+	ttl := min(defaultDownloadTTL, s.cfg.DownloadURLMaxTTL)
+	if value := r.FormValue("expires_in"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > s.cfg.DownloadURLMaxTTL {
+			writeRequestError(w, r, badRequest("Invalid expires_in value (must be between 1 and %d seconds)", int(s.cfg.DownloadURLMaxTTL.Seconds())))
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires.Unix(), 10)},
+		"signature": {s.downloadSignature(job.ID, format, expires.Unix())},
+	}
+	link := requestOrigin(r) + apiVersion + "/downloads/" + job.ID + "/" + format + "?" + query.Encode()
+	log.Printf("Signed %s download of job %s until %s", format, job.ID, expires.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sharedDownload{URL: link, ExpiresAt: expires.UTC()}); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// handleSignedDownload serves an artifact through a link signed by /share. It is mounted without
+// authentication; the signature and expiry stand in for the API key.
+func (s *server) handleSignedDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.cfg.DownloadSigningSecret == "" {
+		http.Error(w, "Signed downloads are not enabled on this server", http.StatusNotFound)
+		return
+	}
+	id, format := r.PathValue("id"), r.PathValue("format")
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	signature, _ := hex.DecodeString(r.URL.Query().Get("signature"))
+	expected, _ := hex.DecodeString(s.downloadSignature(id, format, expires))
+	if err != nil || !hmac.Equal(signature, expected) {
+		http.Error(w, "Invalid download signature", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() >= expires {
+		http.Error(w, "Download link has expired", http.StatusForbidden)
+		return
+	}
+	job, ok := s.jobs.Get(id)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	s.serveArtifact(w, r, job, format)
+}
+
+// downloadSignature is the hex HMAC-SHA256 of "<job id>/<format>/<expires>" under
+// DOWNLOAD_SIGNING_SECRET
+func (s *server) downloadSignature(id, format string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.DownloadSigningSecret))
+	mac.Write([]byte(id + "/" + format + "/" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requestOrigin is the scheme and host the client reached the server at, honoring the
+// X-Forwarded-Proto and X-Forwarded-Host of a proxy in front of it
+func requestOrigin(r *http.Request) string {
+	scheme, host := r.Header.Get("X-Forwarded-Proto"), r.Header.Get("X-Forwarded-Host")
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	if host == "" {
+		host = r.Host
+	}
+	return scheme + "://" + host
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/mailer"
+)
+
+// bufferedResponse captures a handler's response so it can be delivered out of band
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// failed is set by markFailed when the handler failed after the status was sent
+	failed bool
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// filename returns the attachment filename of the captured response, or fallback
+func (b *bufferedResponse) filename(fallback string) string {
+	if _, params, err := mime.ParseMediaType(b.header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+	return fallback
+}
+
+// runAsync answers 202 Accepted right away, runs the job in the background and delivers the
+// result (or the error) by email to req.EmailTo and/or to req.WebhookURL when it completes
+func (s *server) runAsync(w http.ResponseWriter, r *http.Request, req *processRequest, jobID string, run func(http.ResponseWriter, *http.Request)) {
+	background := r.Clone(context.WithoutCancel(r.Context()))
+	go func() {
+		res := &bufferedResponse{header: http.Header{}}
+		run(res, background)
+		if req.EmailTo != "" {
+			s.emailResult(req.EmailTo, jobID, res)
+		}
+		if req.WebhookURL != "" {
+			s.notifyWebhook(req.WebhookURL, jobID, res)
+		}
+	}()
+
+	response := map[string]string{"status": "accepted"}
+	if req.EmailTo != "" {
+		log.Printf("Job accepted for email delivery to %s", maskEmail(req.EmailTo))
+		response["email_to"] = req.EmailTo
+	}
+	if req.WebhookURL != "" {
+		log.Printf("Job accepted for webhook delivery to %s", req.WebhookURL)
+		response["webhook_url"] = req.WebhookURL
+	}
+	if jobID != "" {
+		response["job_id"] = jobID
+		w.Header().Set("X-Job-ID", jobID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// emailResult mails a captured response: the output as an attachment, or the error message in the body
+func (s *server) emailResult(to, jobID string, res *bufferedResponse) {
+	reference := ""
+	if jobID != "" {
+		reference = fmt.Sprintf(" (job %s)", jobID)
+	}
+
+	var err error
+	if res.status != http.StatusOK {
+		body := fmt.Sprintf("Processing of your document%s failed:\n\n%s\n", reference, strings.TrimSpace(res.body.String()))
+		err = s.mailer.Send(to, "Your document could not be processed", body, nil)
+	} else {
+		filename := res.filename("processed_document.txt")
+		attachment := &mailer.Attachment{
+			Filename:    filename,
+			ContentType: res.header.Get("Content-Type"),
+			Data:        res.body.Bytes(),
+		}
+		body := fmt.Sprintf("Your document%s has been processed. The result is attached as %s.\n", reference, filename)
+		err = s.mailer.Send(to, "Your processed document is ready", body, attachment)
+	}
+
+	if err != nil {
+		logging.Errorf("EMAIL DELIVERY FAILED: %v", err)
+		return
+	}
+	log.Printf("Result%s emailed to %s (status %d, %d bytes)", reference, maskEmail(to), res.status, res.body.Len())
+}
+
+// maskEmail hides all of an address but the first character and the domain for logs:
+// "jane@example.com" becomes "j***@example.com"
+func maskEmail(address string) string {
+	local, domain, ok := strings.Cut(address, "@")
+	if !ok || local == "" {
+		return "***"
+	}
+	_, size := utf8.DecodeRuneInString(local)
+	return local[:size] + "***@" + domain
+}
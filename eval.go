@@ -0,0 +1,180 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/eval"
+	"github.com/arnnvv/cutcrap/pkg/i18n"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+)
+
+// maxEvalItems bounds the size of one /eval batch
+const maxEvalItems = 50
+
+// evalRequest is the JSON body of /eval: processing settings and the items to score
+type evalRequest struct {
+	Mode    string     `json:"mode"`
+	Ratio   float64    `json:"ratio"`
+	Profile string     `json:"profile"`
+	Style   string     `json:"style"`
+	Model   string     `json:"model"`
+	Seed    *int64     `json:"seed"`
+	Items   []evalItem `json:"items"`
+	// Priority is "low" unless set: evaluation batches give way to interactive requests
+	Priority string `json:"priority"`
+}
+
+// evalItem is one source with an optional reference summary. An item that already has an
+// output is only scored, not processed.
+type evalItem struct {
+	ID        string `json:"id"`
+	Text      string `json:"text"`
+	Reference string `json:"reference"`
+	Output    string `json:"output"`
+}
+
+// evalItemResult is the scored output of one item
+type evalItemResult struct {
+	ID     string      `json:"id"`
+	JobID  string      `json:"job_id,omitempty"`
+	Output string      `json:"output"`
+	Scores eval.Scores `json:"scores"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// evalResponse holds the per-item scores and their mean over the items that succeeded
+type evalResponse struct {
+	Settings jobs.Settings    `json:"settings"`
+	Items    []evalItemResult `json:"items"`
+	Mean     eval.Scores      `json:"mean"`
+}
+
+// handleEval processes a batch of items with one set of settings and scores each output
+// against its reference (ROUGE-L, compression, entity recall). Every processed item is
+// recorded as a job, so outliers can be looked up and reprocessed.
+func (s *server) handleEval(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	log.Printf("\n\n=== EVAL REQUEST ===")
+
+	var req evalRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 32<<20)).Decode(&req); err != nil {
+		writeRequestError(w, r, badRequest("Invalid JSON body: %v", err))
+		return
+	}
+	settings, err := s.evalSettings(&req)
+	if err != nil {
+		writeRequestError(w, r, err)
+		return
+	}
+	log.Printf("EVAL START | Items: %d | Mode: %s | Ratio: %.2f | Style: '%s' | Model: '%s' | Seed: %d",
+		len(req.Items), settings.Mode, settings.Ratio, settings.Style, settings.Model, settings.Seed)
+
+	priority, err := api.ParsePriority(cmp.Or(req.Priority, "low"))
+	if err != nil {
+		writeRequestError(w, r, badRequest("Invalid priority value: %v", err))
+		return
+	}
+	ctx := reqctx.WithMetadata(api.WithPriority(r.Context(), priority), reqctx.Metadata{Tenant: r.Header.Get("X-Tenant-ID")})
+	response := evalResponse{Settings: settings}
+	var scored []eval.Scores
+	for i, item := range req.Items {
+		result := evalItemResult{ID: item.ID, Output: item.Output}
+		if result.ID == "" {
+			result.ID = "item-" + strconv.Itoa(i+1)
+		}
+		if result.Output == "" {
+			job := &jobs.Job{ID: jobs.NewID(), CreatedAt: time.Now(), Settings: settings, Source: item.Text, Owner: requestOwner(r)}
+			result.JobID = job.ID
+			if result.Output, err = s.runTextJob(ctx, job); err != nil {
+				_, result.Error = processError(i18n.English, settings.Mode, err)
+				logging.Errorf("EVAL ITEM FAILED | %s | %v", result.ID, err)
+				response.Items = append(response.Items, result)
+				if ctx.Err() != nil {
+					break
+				}
+				continue
+			}
+		}
+		result.Scores = eval.Evaluate(item.Text, result.Output, item.Reference)
+		log.Printf("EVAL ITEM | %s | ROUGE-L: %.3f | Compression: %.2f | Entity recall: %.2f",
+			result.ID, result.Scores.RougeL, result.Scores.Compression, result.Scores.EntityRecall)
+		scored = append(scored, result.Scores)
+		response.Items = append(response.Items, result)
+	}
+	response.Mean = eval.Mean(scored)
+	log.Printf("EVAL DONE | Scored: %d/%d | Mean ROUGE-L: %.3f | Mean compression: %.2f | Mean entity recall: %.2f",
+		len(scored), len(req.Items), response.Mean.RougeL, response.Mean.Compression, response.Mean.EntityRecall)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// evalSettings validates an eval request and resolves its profile into job settings
+func (s *server) evalSettings(req *evalRequest) (jobs.Settings, error) {
+	var settings jobs.Settings
+	if len(req.Items) == 0 || len(req.Items) > maxEvalItems {
+		return settings, badRequest("items must contain between 1 and %d entries", maxEvalItems)
+	}
+	for i, item := range req.Items {
+		if item.Text == "" {
+			return settings, badRequest("items[%d].text is missing or empty", i)
+		}
+	}
+
+	settings.Mode, settings.Ratio = req.Mode, req.Ratio
+	if req.Profile != "" {
+		p, ok := s.profiles[req.Profile]
+		if !ok {
+			return settings, badRequest("Unknown profile '%s'", req.Profile)
+		}
+		if settings.Ratio == 0 {
+			settings.Ratio = p.Ratio
+		}
+		if settings.Mode == "" {
+			settings.Mode = p.Mode
+		}
+		settings.Style, settings.Model = p.Style, p.Model
+	}
+	if settings.Mode == "" {
+		settings.Mode = "document"
+	}
+	if processLabels[settings.Mode] == "" {
+		return settings, badRequest("Invalid mode value (must be 'document', 'transcript', 'speaker_summary' or 'outline')")
+	}
+	if settings.Ratio <= 0 || settings.Ratio > 1 {
+		return settings, badRequest("Invalid ratio value (must be > 0 and <= 1)")
+	}
+	if req.Style != "" {
+		if _, ok := api.Styles[req.Style]; !ok {
+			return settings, badRequest("Unknown style '%s'", req.Style)
+		}
+		settings.Style = req.Style
+	}
+	if req.Model != "" {
+		if !s.knownModel(req.Model) {
+			return settings, badRequest("Unknown model '%s' (must be a routed model or the model of a profile)", req.Model)
+		}
+		settings.Model = req.Model
+	}
+
+	// One seed for the whole batch, so a rerun with other settings differs only in those
+	settings.Seed = rand.Int64N(1 << 31)
+	if req.Seed != nil {
+		settings.Seed = *req.Seed
+	}
+	return settings, nil
+}
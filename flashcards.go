@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// flashcardFormats maps each flashcards value to its content type
+var flashcardFormats = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"tsv":  "text/tab-separated-values; charset=utf-8",
+	"json": "application/json",
+}
+
+// flashcardsResponse is the JSON form of a flashcards export
+type flashcardsResponse struct {
+	Flashcards []api.Flashcard `json:"flashcards"`
+}
+
+// writeFlashcards derives flashcards from a job's processed output and sends them in the job's
+// flashcards format. The result is stored like any other.
+func (s *server) writeFlashcards(ctx context.Context, w http.ResponseWriter, r *http.Request, job *jobs.Job, output string) {
+	format := job.Settings.Flashcards
+	cards, err := s.engine.Flashcards(ctx, output, engineOptions(job.Settings))
+	if err != nil {
+		writeProcessError(w, r, job.Settings.Mode, err)
+		return
+	}
+	log.Printf("RESPONSE READY (flashcards) | Cards: %d | Format: %s", len(cards), format)
+
+	body, err := encodeFlashcards(format, cards)
+	if err != nil {
+		logging.Errorf("FLASHCARD ENCODE FAILED: %v", err)
+		http.Error(w, "Failed to encode flashcards", http.StatusInternalServerError)
+		return
+	}
+	s.saveResult(job, format, body)
+
+	w.Header().Set("Content-Type", flashcardFormats[format])
+	w.Header().Set("Content-Disposition", "attachment; filename=flashcards."+format)
+	w.Write(body)
+}
+
+// encodeFlashcards renders cards as CSV with a header row, as tab-separated text that Anki
+// imports directly (its header lines set the separator), or as JSON
+func encodeFlashcards(format string, cards []api.Flashcard) ([]byte, error) {
+	if format == "json" {
+		return json.Marshal(flashcardsResponse{Flashcards: cards})
+	}
+
+	var body bytes.Buffer
+	if format == "tsv" {
+		body.WriteString("#separator:tab\n#html:false\n#columns:Front\tBack\n")
+		// Fields can't hold tabs or line breaks, so those become spaces
+		flatten := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+		for _, card := range cards {
+			body.WriteString(flatten.Replace(card.Question) + "\t" + flatten.Replace(card.Answer) + "\n")
+		}
+		return body.Bytes(), nil
+	}
+
+	writer := csv.NewWriter(&body)
+	writer.Write([]string{"question", "answer"})
+	for _, card := range cards {
+		writer.Write([]string{card.Question, card.Answer})
+	}
+	writer.Flush()
+	return body.Bytes(), writer.Error()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/cutcrap"
+	"github.com/arnnvv/cutcrap/pkg/eval"
+	"github.com/arnnvv/cutcrap/pkg/recorder"
+	"github.com/arnnvv/cutcrap/pkg/textdiff"
+)
+
+// goldenSettings are the per-sample settings read from <name>.json next to the sample
+type goldenSettings struct {
+	Mode  string  `json:"mode"`
+	Ratio float64 `json:"ratio"`
+	Seed  int64   `json:"seed"`
+	Style string  `json:"style"`
+}
+
+const goldenUsage = `usage: cutcrap golden [-update] [-record] <dir>
+
+Runs every sample in dir (<name>.txt or <name>.md) through the pipeline and compares the output
+with <name>.golden. Model calls are replayed from dir/fixtures, so no API calls are made.
+Optional <name>.json sets {"mode", "ratio", "seed", "style"} (default document, 0.5, seed 1).
+
+  -update  write the outputs as the new goldens instead of comparing
+  -record  call the real API and record dir/fixtures (implies -update)
+`
+
+// runGolden is the "golden" subcommand: a regression check of the pipeline against stored
+// outputs. It returns the process exit code: 1 when any sample drifted or failed.
+func runGolden(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("golden", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, goldenUsage) }
+	update := flags.Bool("update", false, "write the outputs as the new goldens")
+	record := flags.Bool("record", false, "call the real API and record the fixtures")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	dir := flags.Arg(0)
+
+	cfg.LLMRecordMode, cfg.LLMRecordDir = recorder.ModeReplay, filepath.Join(dir, "fixtures")
+	if *record {
+		cfg.LLMRecordMode, *update = recorder.ModeRecord, true
+	}
+	engine, err := cutcrap.New(cfg)
+	if err != nil {
+		log.Printf("Invalid configuration: %v", err)
+		return 1
+	}
+
+	var samples []string
+	for _, pattern := range []string{"*.txt", "*.md"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		samples = append(samples, matches...)
+	}
+	if len(samples) == 0 {
+		log.Printf("No samples (*.txt, *.md) found in %s", dir)
+		return 1
+	}
+
+	failed := 0
+	for _, path := range samples {
+		name := strings.TrimSuffix(path, filepath.Ext(path))
+		status, err := runGoldenSample(engine, path, name, *update)
+		if err != nil {
+			status = "FAILED: " + err.Error()
+		}
+		if err != nil || strings.HasPrefix(status, "DRIFT") {
+			failed++
+		}
+		fmt.Printf("%-40s %s\n", filepath.Base(path), status)
+	}
+	fmt.Printf("%d samples, %d drifted or failed\n", len(samples), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runGoldenSample processes one sample and compares it with, or writes, its golden
+func runGoldenSample(engine *cutcrap.Engine, path, name string, update bool) (string, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	settings := goldenSettings{Mode: cutcrap.ModeDocument, Ratio: 0.5, Seed: 1}
+	if data, err := os.ReadFile(name + ".json"); err == nil {
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return "", fmt.Errorf("invalid %s.json: %w", filepath.Base(name), err)
+		}
+	}
+
+	output, err := engine.Condense(context.Background(), settings.Mode, string(source),
+		cutcrap.Options{Ratio: settings.Ratio, Seed: &settings.Seed, Style: settings.Style})
+	if err != nil {
+		return "", err
+	}
+
+	if update {
+		if err := os.WriteFile(name+".golden", []byte(output), 0o644); err != nil {
+			return "", err
+		}
+		return "updated", nil
+	}
+	golden, err := os.ReadFile(name + ".golden")
+	if err != nil {
+		return "", fmt.Errorf("no golden (run with -update to create it): %w", err)
+	}
+	if output == string(golden) {
+		return "ok", nil
+	}
+
+	deleted, inserted := 0, 0
+	for _, op := range textdiff.Diff(string(golden), output) {
+		switch op.Kind {
+		case textdiff.Delete:
+			deleted += len(textdiff.Sentences(op.Text))
+		case textdiff.Insert:
+			inserted += len(textdiff.Sentences(op.Text))
+		}
+	}
+	_, _, similarity := eval.RougeL(output, string(golden))
+	return fmt.Sprintf("DRIFT: %d sentences removed, %d added, ROUGE-L %.3f vs golden", deleted, inserted, similarity), nil
+}
@@ -0,0 +1,813 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/cutcrap"
+	"github.com/arnnvv/cutcrap/pkg/httpclient"
+	"github.com/arnnvv/cutcrap/pkg/i18n"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/mailer"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/search"
+	"github.com/arnnvv/cutcrap/pkg/slack"
+	"github.com/arnnvv/cutcrap/pkg/store"
+	"github.com/arnnvv/cutcrap/pkg/telegram"
+	"github.com/arnnvv/cutcrap/pkg/transcribe"
+	"github.com/arnnvv/cutcrap/pkg/transcript"
+	"github.com/arnnvv/cutcrap/pkg/webhook"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// server holds the dependencies shared by all HTTP handlers
+type server struct {
+	cfg    *config.Config
+	engine *cutcrap.Engine
+	jobs   *jobs.Store
+
+	// profiles are the named processing defaults from PROFILES
+	profiles map[string]profile
+
+	// documents is nil when DOCUMENT_STORE_DIR is not configured
+	documents *store.DocumentStore
+	// uploads is nil when UPLOAD_DIR is not configured
+	uploads *store.UploadStore
+	// mailer is nil when SMTP_HOST is not configured
+	mailer *mailer.Mailer
+	// slack is nil when SLACK_SIGNING_SECRET is not configured
+	slack *slack.Client
+	// telegram is nil when TELEGRAM_BOT_TOKEN is not configured
+	telegram *telegram.Client
+	// webhooks is nil when WEBHOOK_SECRET is not configured
+	webhooks *webhook.Sender
+	// transcriber is nil when TRANSCRIBE_BACKEND is not configured
+	transcriber transcribe.Transcriber
+	// limiter is nil when RATE_LIMIT_PER_MINUTE is not configured
+	limiter *rateLimiter
+
+	inflight inflightRuns
+	// idempotency replays responses to retried POSTs with the same Idempotency-Key
+	idempotency idempotencyKeys
+	// running are the jobs being processed, for the admin API
+	running runningJobs
+
+	// index is the full-text index of recorded jobs' outputs for /search
+	index *search.Index
+	// vectors (job outputs) and chunkVectors (processed chunks, for /ask) are nil when
+	// EMBEDDING_MODEL is not configured
+	vectors      *search.VectorIndex
+	chunkVectors *search.VectorIndex
+
+	// artifacts keeps job results for /jobs/{id}/artifacts when the document store is not enabled
+	artifacts artifactCache
+}
+
+// twoTrackResponse carries both transcript tracks produced by a single two_track job
+type twoTrackResponse struct {
+	Full             string         `json:"full"`
+	Condensed        string         `json:"condensed"`
+	FullMetrics      metrics.Report `json:"full_metrics"`
+	CondensedMetrics metrics.Report `json:"condensed_metrics"`
+	// Stats covers the chunks of both tracks
+	Stats metrics.PoolSummary `json:"stats"`
+}
+
+// executiveSummaryResponse carries the executive summary and the condensed document of one job
+type executiveSummaryResponse struct {
+	ExecutiveSummary string              `json:"executive_summary"`
+	Document         string              `json:"document"`
+	Metrics          metrics.Report      `json:"metrics"`
+	Stats            metrics.PoolSummary `json:"stats"`
+}
+
+// transcriptJSONResponse is the JSON form of a processed transcript with per-turn data
+type transcriptJSONResponse struct {
+	Transcript string              `json:"transcript"`
+	Turns      []transcript.Turn   `json:"turns"`
+	Metrics    metrics.Report      `json:"metrics"`
+	Stats      metrics.PoolSummary `json:"stats"`
+}
+
+// transcriptTurnsResponse is a transcript returned as speaker turns for output=json
+type transcriptTurnsResponse struct {
+	// Speakers are the distinct speakers in the order they first speak
+	Speakers []string            `json:"speakers"`
+	Turns    []transcript.Turn   `json:"turns"`
+	Stats    metrics.PoolSummary `json:"stats"`
+}
+
+func (s *server) handleProcess(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	log.Printf("\n\n=== NEW REQUEST ===")
+	log.Printf("From: %s | Method: %s | Content-Type: %s", r.RemoteAddr, r.Method, r.Header.Get("Content-Type"))
+	defer func() {
+		log.Printf("=== REQUEST COMPLETED IN %v ===\n", time.Since(startTime))
+	}()
+
+	req, err := parseProcessRequest(r, s.profiles, s.uploads)
+	if err != nil {
+		writeRequestError(w, r, err)
+		return
+	}
+	w, finish, ok := s.idempotent(w, r, req)
+	if !ok {
+		return
+	}
+	defer finish()
+	r = r.WithContext(api.WithPriority(r.Context(), req.Priority))
+	text := req.Text
+
+	// A stored document can be referenced by hash instead of re-uploading the text
+	if text == "" && req.Document != "" {
+		if s.documents == nil {
+			writeRequestError(w, r, badRequest("Document references are not enabled on this server"))
+			return
+		}
+		stored, err := s.documents.Get(req.Document)
+		if err != nil {
+			log.Printf("Document lookup failed: %v", err)
+			writeRequestError(w, r, &requestError{Status: http.StatusNotFound, Message: "Referenced document not found"})
+			return
+		}
+		text = stored
+	}
+	if req.Audio != nil {
+		var ok bool
+		if text, ok = s.transcribeUpload(w, r, req); !ok {
+			return
+		}
+	}
+
+	if text == "" && req.Archive == nil {
+		writeRequestError(w, r, badRequest("Text field is missing or empty"))
+		return
+	}
+	if req.Revises != "" {
+		if s.documents == nil {
+			writeRequestError(w, r, badRequest("Document revisions are not enabled on this server"))
+			return
+		}
+		if _, err := s.documents.Get(req.Revises); err != nil {
+			log.Printf("Revised document lookup failed: %v", err)
+			writeRequestError(w, r, &requestError{Status: http.StatusNotFound, Message: "Revised document not found"})
+			return
+		}
+	}
+
+	if req.EmailTo != "" && s.mailer == nil {
+		writeRequestError(w, r, badRequest("Email delivery is not enabled on this server"))
+		return
+	}
+	if req.WebhookURL != "" && s.webhooks == nil {
+		writeRequestError(w, r, badRequest("Webhook delivery is not enabled on this server"))
+		return
+	}
+
+	// Every job gets a seed so it can be regenerated; a random one is recorded if none is given
+	seed := rand.Int64N(1 << 31)
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+
+	settings := jobs.Settings{
+		Mode:        req.Mode,
+		Ratio:       req.Ratio,
+		TwoTrack:    req.TwoTrack,
+		TagTone:     req.TagTone,
+		TranslateTo: req.TranslateTo,
+		Style:       req.Style,
+		Model:       req.Model,
+		Format:      req.Format,
+		Seed:        seed,
+
+		KeepSections:        req.KeepSections,
+		PruneReferences:     req.PruneReferences,
+		Glossary:            req.Glossary,
+		ExecutiveSummary:    req.ExecutiveSummary,
+		Flashcards:          req.Flashcards,
+		SkipSpeakerAnalysis: req.SkipSpeakerAnalysis,
+		SpeakerAliases:      req.SpeakerAliases,
+		KeepSpeakerNames:    req.KeepSpeakerNames,
+		Output:              req.Output,
+		SpeakerStyle:        req.SpeakerStyle,
+		SpeakerSeparator:    req.SpeakerSeparator,
+		TurnSpacing:         req.TurnSpacing,
+	}
+	if req.Archive != nil {
+		run := func(w http.ResponseWriter, r *http.Request) { s.runArchive(w, r, req.Archive, settings) }
+		if req.EmailTo != "" || req.WebhookURL != "" {
+			s.runAsync(w, r, req, "", run)
+			return
+		}
+		run(w, r)
+		return
+	}
+
+	job := &jobs.Job{
+		ID:        jobs.NewID(),
+		CreatedAt: time.Now(),
+		Settings:  settings,
+		Source:    text,
+		Revises:   req.Revises,
+		Owner:     requestOwner(r),
+	}
+	if req.EmailTo != "" || req.WebhookURL != "" {
+		s.runAsync(w, r, req, job.ID, func(w http.ResponseWriter, r *http.Request) { s.runJob(w, r, job) })
+		return
+	}
+	s.runJobOnce(w, r, job, req.Seed != nil)
+}
+
+// ownedJob returns the job named by the request path when it belongs to the caller, or responds
+// 404. Other owners' jobs are not found either, so their IDs can't be probed.
+func (s *server) ownedJob(w http.ResponseWriter, r *http.Request) (*jobs.Job, bool) {
+	job, ok := s.jobs.Get(r.PathValue("id"))
+	if !ok || job.Owner != requestOwner(r) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return job, true
+}
+
+// handleJob returns the stored metadata of a job
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := s.ownedJob(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// handleReprocess runs a stored job again with exactly the same source, settings and seed
+func (s *server) handleReprocess(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	original, ok := s.ownedJob(w, r)
+	if !ok {
+		return
+	}
+	log.Printf("\n\n=== REPROCESS REQUEST === Job: %s", original.ID)
+	w, finish, ok := s.idempotent(w, r, nil)
+	if !ok {
+		return
+	}
+	defer finish()
+
+	job := &jobs.Job{
+		ID:           jobs.NewID(),
+		CreatedAt:    time.Now(),
+		Settings:     original.Settings,
+		Source:       original.Source,
+		DocumentHash: original.DocumentHash,
+		ReprocessOf:  original.ID,
+		Owner:        requestOwner(r),
+	}
+	s.runJob(w, r, job)
+}
+
+// recordJob stores a finished job together with the models and prompts it used and, when
+// stats is not nil, its chunk stats
+func (s *server) recordJob(job *jobs.Job, runInfo *api.RunInfo, stats *metrics.PoolStats) {
+	job.Duration = time.Since(job.CreatedAt)
+	job.Cancelled = s.running.remove(job.ID)
+	job.ModelVersions = runInfo.ModelVersions()
+	job.PromptHashes = runInfo.PromptHashes()
+	if stats != nil {
+		summary := stats.Summary()
+		job.Stats = &summary
+	}
+	s.jobs.Put(job)
+	s.indexJob(job)
+	log.Printf("Job %s recorded: seed=%d, models=%v, prompts=%d", job.ID, job.Settings.Seed, job.ModelVersions, len(job.PromptHashes))
+}
+
+// storeSource saves the job's source in the document store, when enabled, and sets its DocumentHash
+func (s *server) storeSource(job *jobs.Job) {
+	if s.documents == nil {
+		return
+	}
+	hash, err := s.documents.Put(job.Source)
+	if err != nil {
+		logging.Warnf("Failed to store source document: %v", err)
+		return
+	}
+	job.DocumentHash = hash
+}
+
+// jobTimeout is the deadline of a job over text: REQUEST_TIMEOUT for each wave of MAX_CONCURRENT
+// chunks plus two for the calls before and after them (e.g. speaker analysis, summaries), capped
+// at JOB_TIMEOUT_MAX
+func jobTimeout(cfg *config.Config, text string) time.Duration {
+	chunks := max(1, (wordcount.Count(text)+cfg.ChunkSize-1)/cfg.ChunkSize)
+	waves := (chunks + cfg.MaxConcurrent - 1) / cfg.MaxConcurrent
+	return min(time.Duration(waves+2)*cfg.RequestTimeout, cfg.JobTimeoutMax)
+}
+
+// runJob processes a job, records its reproducibility metadata and writes the result
+func (s *server) runJob(w http.ResponseWriter, r *http.Request, job *jobs.Job) {
+	settings := job.Settings
+	text, mode, ratio := job.Source, settings.Mode, settings.Ratio
+
+	ctx, cancel := context.WithTimeout(r.Context(), jobTimeout(s.cfg, text))
+	defer cancel()
+	s.running.add(job, cancel)
+
+	runInfo, stats := &api.RunInfo{Seed: &settings.Seed}, &metrics.PoolStats{}
+	ctx = api.WithRunInfo(ctx, runInfo)
+	ctx = metrics.WithPoolStats(ctx, stats)
+	ctx = reqctx.WithMetadata(ctx, reqctx.Metadata{JobID: job.ID, Tenant: r.Header.Get("X-Tenant-ID")})
+	defer s.recordJob(job, runInfo, stats)
+	w.Header().Set("X-Job-ID", job.ID)
+
+	s.storeSource(job)
+	if job.DocumentHash != "" {
+		w.Header().Set("X-Document-Hash", job.DocumentHash)
+	}
+
+	inputWordCount := wordcount.Count(text)
+	log.Printf("PROCESSING START | Job: %s | Mode: %s | Words: %d | Ratio: %.2f | Seed: %d", job.ID, mode, inputWordCount, ratio, settings.Seed)
+	opts := s.jobOptions(job)
+	defer s.saveChunks(job, opts)
+
+	if !settings.TwoTrack && !settings.TagTone && !settings.ExecutiveSummary && settings.Flashcards == "" && settings.Output == "" && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.streamEvents(ctx, w, r, job, opts)
+		return
+	}
+	if hb := s.paddingHeartbeat(w, settings); hb != nil {
+		defer hb.Stop()
+		w = hb
+	}
+
+	if settings.TwoTrack {
+		full, condensed, err := s.engine.CondenseTranscriptTwoTrack(ctx, text, engineOptions(settings))
+		if err != nil {
+			writeProcessError(w, r, mode, err)
+			return
+		}
+		log.Printf("RESPONSE READY (two-track) | Input: %d words | Full: %d words | Condensed: %d words",
+			inputWordCount, wordcount.Count(full), wordcount.Count(condensed))
+		fullMetrics, condensedMetrics := metrics.NewReport(text, full), metrics.NewReport(text, condensed)
+		logMetrics("full", fullMetrics)
+		logMetrics("condensed", condensedMetrics)
+
+		s.writeJSONResult(w, job, "processed_transcript.json", twoTrackResponse{Full: full, Condensed: condensed, FullMetrics: fullMetrics, CondensedMetrics: condensedMetrics, Stats: stats.Summary()})
+		return
+	}
+
+	if settings.ExecutiveSummary {
+		summary, full, err := s.engine.CondenseWithExecutiveSummary(ctx, text, opts)
+		if err != nil {
+			writeProcessError(w, r, mode, err)
+			return
+		}
+		log.Printf("RESPONSE READY (executive summary) | Input: %d words | Summary: %d words | Document: %d words",
+			inputWordCount, wordcount.Count(summary), wordcount.Count(full))
+		report := metrics.NewReport(text, full)
+		logMetrics("output", report)
+
+		s.writeJSONResult(w, job, "processed_document.json", executiveSummaryResponse{ExecutiveSummary: summary, Document: full, Metrics: report, Stats: stats.Summary()})
+		return
+	}
+
+	if settings.Output != "" {
+		turns, err := s.engine.CondenseTranscriptTurns(ctx, text, engineOptions(settings))
+		if err == nil && settings.TagTone {
+			err = s.engine.TagTones(ctx, turns, engineOptions(settings))
+		}
+		if err != nil {
+			writeProcessError(w, r, mode, err)
+			return
+		}
+		switch settings.Output {
+		case "srt", "vtt":
+			s.writeSubtitles(w, r, job, turns)
+			return
+		case "podlove_chapters", "id3_chapters":
+			s.writeChapters(ctx, w, r, job, turns)
+			return
+		}
+		log.Printf("RESPONSE READY (turns) | Input: %d words | Turns: %d", inputWordCount, len(turns))
+
+		s.writeJSONResult(w, job, "processed_transcript.json", transcriptTurnsResponse{Speakers: transcript.Speakers(turns), Turns: turns, Stats: stats.Summary()})
+		return
+	}
+
+	if !settings.TagTone && settings.Flashcards == "" && s.shouldStream(mode, settings, inputWordCount) {
+		s.streamResult(ctx, w, r, job, opts, inputWordCount)
+		return
+	}
+
+	// Stores the final text (condensed doc or formatted transcript)
+	combinedResult, err := s.engine.Condense(ctx, mode, text, opts)
+	if err != nil {
+		writeProcessError(w, r, mode, err)
+		return
+	}
+
+	if settings.Flashcards != "" {
+		s.writeFlashcards(ctx, w, r, job, combinedResult)
+		return
+	}
+
+	if settings.TagTone {
+		turns := transcript.ParseTurns(combinedResult)
+		if err := s.engine.TagTones(ctx, turns, opts); err != nil {
+			writeProcessError(w, r, mode, err)
+			return
+		}
+		log.Printf("RESPONSE READY (tone-tagged) | Input: %d words | Turns: %d", inputWordCount, len(turns))
+		report := metrics.NewReport(text, combinedResult)
+		logMetrics("output", report)
+
+		s.writeJSONResult(w, job, "processed_transcript.json", transcriptJSONResponse{Transcript: combinedResult, Turns: turns, Metrics: report, Stats: stats.Summary()})
+		return
+	}
+
+	// --- Response Handling ---
+	outputWordCount := wordcount.Count(combinedResult)
+	reduction := 0.0
+	if inputWordCount > 0 {
+		reduction = 100.0 - (float64(outputWordCount)/float64(inputWordCount))*100.0
+	}
+	log.Printf("RESPONSE READY | Input: %d words | Output: %d words | Reduction: %.1f%%",
+		inputWordCount, outputWordCount, reduction)
+	logMetrics("output", metrics.NewReport(text, combinedResult))
+
+	job.Output = combinedResult
+	s.saveResult(job, "txt", []byte(combinedResult))
+	s.writeResult(ctx, w, mode, combinedResult)
+}
+
+// processLabels names each mode in timeout error responses
+var processLabels = map[string]string{
+	"document":        "Document",
+	"transcript":      "Transcript",
+	"speaker_summary": "Speaker summary",
+	"outline":         "Outline",
+}
+
+// engineOptions converts job settings to library options. The seed travels in the job's api.RunInfo.
+func engineOptions(settings jobs.Settings) cutcrap.Options {
+	return cutcrap.Options{
+		Ratio:               settings.Ratio,
+		TranslateTo:         settings.TranslateTo,
+		Style:               settings.Style,
+		Model:               settings.Model,
+		Format:              settings.Format,
+		KeepSections:        settings.KeepSections,
+		PruneReferences:     settings.PruneReferences,
+		Glossary:            settings.Glossary,
+		SkipSpeakerAnalysis: settings.SkipSpeakerAnalysis,
+		SpeakerAliases:      settings.SpeakerAliases,
+		KeepSpeakerNames:    settings.KeepSpeakerNames,
+		TranscriptFormat: transcript.Format{
+			PlainSpeaker:  settings.SpeakerStyle == "plain",
+			Dash:          settings.SpeakerSeparator == "dash",
+			SingleNewline: settings.TurnSpacing == "newline",
+		},
+	}
+}
+
+// jobOptions are the engine options of a job. With the document store enabled, document jobs
+// record their chunk outputs, and a revision reuses the outputs recorded for the version it
+// revises.
+func (s *server) jobOptions(job *jobs.Job) cutcrap.Options {
+	opts := engineOptions(job.Settings)
+	if s.documents == nil || job.Settings.Mode != cutcrap.ModeDocument {
+		return opts
+	}
+	opts.Chunks = new([]cutcrap.ChunkOutput)
+	if job.Revises != "" {
+		data, err := s.documents.Chunks(job.Revises, chunkSettings(job.Settings))
+		if err == nil {
+			err = json.Unmarshal(data, &opts.Reuse)
+		}
+		if err != nil {
+			logging.Warnf("Revision of document %s is condensed in full: %v", job.Revises[:12], err)
+		}
+	}
+	return opts
+}
+
+// saveChunks stores the chunk outputs recorded while condensing a job's document. Outputs of an
+// incomplete run are kept too: each is still the output of its chunk.
+func (s *server) saveChunks(job *jobs.Job, opts cutcrap.Options) {
+	if opts.Chunks == nil || len(*opts.Chunks) == 0 || job.DocumentHash == "" {
+		return
+	}
+	data, err := json.Marshal(*opts.Chunks)
+	if err == nil {
+		err = s.documents.PutChunks(job.DocumentHash, chunkSettings(job.Settings), data)
+	}
+	if err != nil {
+		logging.Warnf("Failed to store chunk outputs of job %s: %v", job.ID, err)
+	}
+}
+
+// chunkSettings are the settings chunk outputs are stored under. The seed is left out so a
+// revision, which gets a seed of its own, finds the outputs of the previous version.
+func chunkSettings(settings jobs.Settings) jobs.Settings {
+	settings.Seed = 0
+	return settings
+}
+
+// runTextJob runs a job outside of an HTTP response through the engine and the result store.
+// It is recorded like any other job. Used for archive members and chat integrations.
+func (s *server) runTextJob(parent context.Context, job *jobs.Job) (string, error) {
+	ctx, cancel := context.WithTimeout(parent, jobTimeout(s.cfg, job.Source))
+	defer cancel()
+	s.running.add(job, cancel)
+
+	runInfo, stats := &api.RunInfo{Seed: &job.Settings.Seed}, &metrics.PoolStats{}
+	ctx = api.WithRunInfo(ctx, runInfo)
+	ctx = metrics.WithPoolStats(ctx, stats)
+	ctx = reqctx.WithMetadata(ctx, reqctx.Metadata{JobID: job.ID, Tenant: reqctx.MetadataFrom(parent).Tenant})
+	defer s.recordJob(job, runInfo, stats)
+	s.storeSource(job)
+	opts := s.jobOptions(job)
+	defer s.saveChunks(job, opts)
+
+	result, err := s.engine.Condense(ctx, job.Settings.Mode, job.Source, opts)
+	if err != nil {
+		return "", err
+	}
+	job.Output = result
+	s.saveResult(job, "txt", []byte(result))
+	return result, nil
+}
+
+// writeProcessError maps an error returned by the engine to an HTTP response
+func writeProcessError(w http.ResponseWriter, r *http.Request, mode string, err error) {
+	lang := requestLanguage(r)
+	status, message := processError(lang, mode, err)
+	w.Header().Set("Content-Language", lang)
+	http.Error(w, message, status)
+}
+
+// processError returns the status and message, in lang, reported for an error returned by the
+// engine
+func processError(lang, mode string, err error) (int, string) {
+	switch {
+	case errors.Is(err, cutcrap.ErrPreHook):
+		return http.StatusBadGateway, i18n.Text(lang, "Pre-processing hook failed")
+	case errors.Is(err, cutcrap.ErrTooLarge):
+		return http.StatusUnprocessableEntity, i18n.Sprintf(lang, "Input is too large to process: %s", strings.TrimPrefix(err.Error(), cutcrap.ErrTooLarge.Error()+": "))
+	case errors.Is(err, cutcrap.ErrChunking):
+		return http.StatusInternalServerError, i18n.Text(lang, "Text chunking failed")
+	case errors.Is(err, cutcrap.ErrEmptySummary):
+		return http.StatusInternalServerError, i18n.Text(lang, "Speaker summary generation failed")
+	case errors.Is(err, cutcrap.ErrEmptyExecutiveSummary):
+		return http.StatusInternalServerError, i18n.Text(lang, "Executive summary generation failed")
+	case errors.Is(err, cutcrap.ErrNoFlashcards):
+		return http.StatusInternalServerError, i18n.Text(lang, "Flashcard generation failed")
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusRequestTimeout, i18n.Sprintf(lang, "%s processing timed out or was cancelled", i18n.Text(lang, processLabels[mode]))
+	default:
+		return http.StatusInternalServerError, i18n.Sprintf(lang, "%s processing failed", i18n.Text(lang, processLabels[mode]))
+	}
+}
+
+// writeJSONResult encodes a JSON response, stores it as the job's result and sends it
+func (s *server) writeJSONResult(w http.ResponseWriter, job *jobs.Job, filename string, response any) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	s.saveResult(job, "json", body)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.Write(body)
+}
+
+// writeSubtitles responds with the turns of a transcript re-flowed across the cue timings of its
+// subtitle source, as an SRT or WebVTT file. Speaker names are written when there are several.
+func (s *server) writeSubtitles(w http.ResponseWriter, r *http.Request, job *jobs.Job, turns []transcript.Turn) {
+	cues := transcript.Subtitles(turns, transcript.ParseCues(job.Source), len(transcript.Speakers(turns)) > 1)
+	if len(cues) == 0 {
+		writeRequestError(w, r, &requestError{Status: http.StatusUnprocessableEntity, Message: "The transcript has no subtitle timings to export"})
+		return
+	}
+	body := transcript.WriteSRT(cues)
+	if job.Settings.Output == "vtt" {
+		body = transcript.WriteVTT(cues)
+	}
+	log.Printf("RESPONSE READY (%s) | Turns: %d | Cues: %d", job.Settings.Output, len(turns), len(cues))
+	s.saveResult(job, job.Settings.Output, []byte(body))
+
+	w.Header().Set("Content-Type", artifactTypes[job.Settings.Output])
+	w.Header().Set("Content-Disposition", "attachment; filename=processed_transcript."+job.Settings.Output)
+	io.WriteString(w, body)
+}
+
+// writeChapters responds with the chapters of a transcript with subtitle timings, as Podlove
+// Simple Chapters JSON or as an FFmpeg metadata file that muxes into ID3v2 chapter frames
+func (s *server) writeChapters(ctx context.Context, w http.ResponseWriter, r *http.Request, job *jobs.Job, turns []transcript.Turn) {
+	chapters, err := s.engine.Chapters(ctx, turns, engineOptions(job.Settings))
+	if err != nil {
+		writeProcessError(w, r, job.Settings.Mode, err)
+		return
+	}
+	if len(chapters) == 0 {
+		writeRequestError(w, r, &requestError{Status: http.StatusUnprocessableEntity, Message: "The transcript has no subtitle timings to chapter"})
+		return
+	}
+	log.Printf("RESPONSE READY (%s) | Turns: %d | Chapters: %d", job.Settings.Output, len(turns), len(chapters))
+
+	if job.Settings.Output == "podlove_chapters" {
+		body, err := transcript.PodloveChapters(chapters)
+		if err != nil {
+			logging.Errorf("JSON ENCODE FAILED: %v", err)
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+		s.saveResult(job, "json", body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", "attachment; filename=chapters.json")
+		w.Write(body)
+		return
+	}
+	body := transcript.FFMetadata(chapters)
+	s.saveResult(job, "ffmetadata", []byte(body))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=chapters.ffmetadata")
+	io.WriteString(w, body)
+}
+
+// saveResult stores a result version for the job's document when the document store is enabled,
+// and otherwise keeps it in memory with the job. Plain text is kept as the job's Output instead.
+func (s *server) saveResult(job *jobs.Job, ext string, data []byte) {
+	if s.documents == nil || job.DocumentHash == "" {
+		if ext != "txt" {
+			s.artifacts.put(job.ID, ext, data)
+		}
+		return
+	}
+	if _, err := s.documents.PutResult(job.DocumentHash, job.Settings, ext, data); err != nil {
+		logging.Warnf("Failed to store result for job %s: %v", job.ID, err)
+	}
+}
+
+// handleDocument lists the stored result versions of a document
+func (s *server) handleDocument(w http.ResponseWriter, r *http.Request) {
+	if s.documents == nil {
+		http.Error(w, "Document store is not enabled on this server", http.StatusNotFound)
+		return
+	}
+	hash := r.PathValue("hash")
+	if _, err := s.documents.Get(hash); err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	versions, err := s.documents.Results(hash)
+	if err != nil {
+		log.Printf("Failed to list results for %s: %v", hash, err)
+		http.Error(w, "Failed to list results", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"hash": hash, "results": versions}); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// handleDocumentResult downloads one stored result file of a document
+func (s *server) handleDocumentResult(w http.ResponseWriter, r *http.Request) {
+	if s.documents == nil {
+		http.Error(w, "Document store is not enabled on this server", http.StatusNotFound)
+		return
+	}
+	path := s.documents.ResultPath(r.PathValue("hash"), r.PathValue("file"))
+	if path == "" {
+		http.Error(w, "Result not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+r.PathValue("file"))
+	http.ServeFile(w, r, path)
+}
+
+// pdfClient renders results through PDF_API, with a timeout for the whole generation
+var pdfClient = httpclient.New(2 * time.Minute)
+
+// writeResult sends the final text as a PDF (via PDF_API) or as plain text
+func (s *server) writeResult(ctx context.Context, w http.ResponseWriter, mode, combinedResult string) {
+	cfg := s.cfg
+
+	// --- Determine if PDF should be generated ---
+	pdfApiAvailable := cfg.Pdf_api != ""
+	shouldGeneratePdfForDoc := mode != "transcript" && pdfApiAvailable && strings.Contains(combinedResult, "# ") // Document/summary PDF only if headings exist
+	shouldGeneratePdfForTranscript := mode == "transcript" && pdfApiAvailable                                    // Transcript PDF if API is set
+
+	if shouldGeneratePdfForDoc || shouldGeneratePdfForTranscript {
+		log.Printf("Attempting PDF generation via API: %s (Mode: %s)", cfg.Pdf_api, mode)
+		pdf, err := s.renderPDF(ctx, combinedResult)
+		if err != nil {
+			logging.Errorf("PDF GENERATION FAILED: %v", err)
+			http.Error(w, "PDF generation failed", http.StatusInternalServerError)
+			return
+		}
+		defer pdf.Close()
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", "attachment; filename="+resultFilename(mode, "pdf"))
+
+		// Stream the PDF response back to the original client
+		log.Printf("Streaming PDF response to client...")
+		if _, err := io.Copy(w, pdf); err != nil {
+			logging.Errorf("PDF STREAM FAILED: %v", err)
+			// Don't send another http.Error if header might be partially sent
+			return
+		}
+		log.Printf("PDF stream completed.")
+		return
+	}
+
+	// --- Send as Plain Text ---
+	if pdfApiAvailable {
+		if mode == "transcript" {
+			log.Printf("Sending transcript as plain text (PDF API available but not triggered).")
+		} else {
+			log.Printf("Sending document as plain text (PDF API available but no headings found).")
+		}
+	} else {
+		log.Printf("Sending response as plain text (PDF API not configured).")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename="+resultFilename(mode, "txt"))
+	io.WriteString(w, combinedResult)
+	// --- End Plain Text ---
+}
+
+// renderPDF converts markdown to a PDF through PDF_API and returns the PDF as it arrives. The
+// caller closes it.
+func (s *server) renderPDF(ctx context.Context, markdown string) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	mpWriter := multipart.NewWriter(&body)
+	// Use markdown for the file content type, PDF API should handle it
+	fileWriter, err := mpWriter.CreateFormFile("file", "content.md")
+	if err != nil {
+		return nil, fmt.Errorf("form creation failed: %w", err)
+	}
+	if _, err := fileWriter.Write([]byte(markdown)); err != nil {
+		return nil, fmt.Errorf("form write failed: %w", err)
+	}
+	mpWriter.Close() // Close writer before sending request
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.cfg.Pdf_api, &body)
+	if err != nil {
+		return nil, fmt.Errorf("request creation failed: %w", err)
+	}
+	// Set the correct multipart content type for the PDF API request
+	req.Header.Set("Content-Type", mpWriter.FormDataContentType())
+
+	resp, err := pdfClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("PDF API returned status %d: %s", resp.StatusCode, logging.Excerpt(string(respBodyBytes)))
+	}
+	return resp.Body, nil
+}
+
+// resultFilename is the download filename of a result in the given mode and format
+func resultFilename(mode, ext string) string {
+	switch mode {
+	case "transcript":
+		return "processed_transcript." + ext
+	case "speaker_summary":
+		return "speaker_summary." + ext
+	case "outline":
+		return "outline." + ext
+	}
+	return "processed_document." + ext
+}
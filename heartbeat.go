@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+)
+
+// heartbeat keeps an idle response alive by writing beat every interval, so proxies (e.g.
+// Cloudflare's 100 second limit) don't drop the connection while a job runs. Writes through it
+// are serialized with the beats. Stop must be called before the handler returns.
+type heartbeat struct {
+	http.ResponseWriter
+	beat []byte
+	// beforeOutput stops the beats at the first real write, for bodies that can only take
+	// padding at the start
+	beforeOutput bool
+	// prepare sets the response headers before the first beat commits them
+	prepare func(http.Header)
+
+	mu      sync.Mutex
+	written bool
+	beats   int
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// paddingHeartbeat starts newline heartbeats for a plain-text or JSON response when
+// HEARTBEAT_MODE is "whitespace", which operators opt into. The first beat commits a 200 status,
+// so a later failure is reported in the body. Responses that may become a PDF are left alone.
+func (s *server) paddingHeartbeat(w http.ResponseWriter, settings jobs.Settings) *heartbeat {
+	if s.cfg.HeartbeatMode != "whitespace" {
+		return nil
+	}
+	contentType, filename := "text/plain; charset=utf-8", resultFilename(settings.Mode, "txt")
+	if settings.TwoTrack || settings.TagTone || settings.Output == "json" {
+		contentType, filename = "application/json", "processed_transcript.json"
+	} else if settings.ExecutiveSummary {
+		contentType, filename = "application/json", "processed_document.json"
+	} else if settings.Flashcards == "json" {
+		contentType, filename = "application/json", "flashcards.json"
+	} else if settings.Output == "podlove_chapters" {
+		contentType, filename = "application/json", "chapters.json"
+	} else if settings.Flashcards != "" || settings.Output == "srt" || settings.Output == "vtt" || settings.Output == "id3_chapters" || s.cfg.Pdf_api != "" {
+		// WebVTT and FFmpeg metadata must start with their header, and subtitle parsers don't all
+		// skip blank lines
+		return nil
+	}
+	return startHeartbeat(w, s.cfg.HeartbeatInterval, "\n", true, func(h http.Header) {
+		h.Set("Content-Type", contentType)
+		h.Set("Content-Disposition", "attachment; filename="+filename)
+	})
+}
+
+// startHeartbeat wraps w and starts beating. It returns nil when w can't be flushed (e.g. a
+// response buffered for email delivery), since the beats would never reach the client.
+func startHeartbeat(w http.ResponseWriter, interval time.Duration, beat string, beforeOutput bool, prepare func(http.Header)) *heartbeat {
+	if interval <= 0 {
+		return nil
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		return nil
+	}
+	hb := &heartbeat{
+		ResponseWriter: w,
+		beat:           []byte(beat),
+		beforeOutput:   beforeOutput,
+		prepare:        prepare,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	go hb.run(interval)
+	return hb
+}
+
+func (hb *heartbeat) run(interval time.Duration) {
+	defer close(hb.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hb.stop:
+			return
+		case <-ticker.C:
+			hb.mu.Lock()
+			if hb.written && hb.beforeOutput {
+				hb.mu.Unlock()
+				return
+			}
+			if hb.beats == 0 && !hb.written && hb.prepare != nil {
+				hb.prepare(hb.ResponseWriter.Header())
+			}
+			_, err := hb.ResponseWriter.Write(hb.beat)
+			if err == nil {
+				hb.ResponseWriter.(http.Flusher).Flush()
+			}
+			hb.beats++
+			hb.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Stop ends the beats and waits for an in-progress beat to finish
+func (hb *heartbeat) Stop() {
+	close(hb.stop)
+	<-hb.done
+}
+
+// Committed reports whether a beat has already sent the status and headers. Errors after that
+// can only be reported in the body.
+func (hb *heartbeat) Committed() bool {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	return hb.beats > 0
+}
+
+func (hb *heartbeat) WriteHeader(status int) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	if hb.beats == 0 {
+		hb.ResponseWriter.WriteHeader(status)
+	} else if status >= 400 {
+		markFailed(hb.ResponseWriter)
+	}
+}
+
+func (hb *heartbeat) markFailed() { markFailed(hb.ResponseWriter) }
+
+func (hb *heartbeat) Write(p []byte) (int, error) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.written = true
+	return hb.ResponseWriter.Write(p)
+}
+
+func (hb *heartbeat) Flush() {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.ResponseWriter.(http.Flusher).Flush()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// maxIdempotencyKeyLength caps the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// idempotencyKeys remembers the responses of POSTs sent with an Idempotency-Key for
+// IDEMPOTENCY_TTL, so a retried request (after a client timeout or by a proxy) gets the first
+// response, and its job, instead of starting another one. Keys are scoped to the API key and
+// tenant; at most JOB_STORE_MAX are kept, holding at most IDEMPOTENCY_MAX_MB of responses, the
+// oldest finished ones giving way first.
+type idempotencyKeys struct {
+	mu      sync.Mutex
+	entries map[string]*idempotentRequest
+	order   []string // keys, oldest first
+	size    int64    // bytes of the kept response bodies
+}
+
+// idempotentRequest is the first request sent with a key and, once done is closed, its
+// captured response
+type idempotentRequest struct {
+	fingerprint string
+	createdAt   time.Time
+	done        chan struct{}
+	response    bufferedResponse
+	// failed is set when the request was cancelled, timed out or failed, including after a
+	// heartbeat had sent a 200 status; the key is then forgotten so a retry runs again
+	failed bool
+	// size is the length of the kept response body, counted once the request is done
+	size int64
+}
+
+// claim returns the request already recorded under key or, when there is none, records a new
+// one for fingerprint
+func (k *idempotencyKeys) claim(key, fingerprint string, ttl time.Duration, capacity int, maxSize int64) (*idempotentRequest, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.entries == nil {
+		k.entries = make(map[string]*idempotentRequest)
+	}
+	k.evict(time.Now().Add(-ttl), capacity-1, maxSize)
+	if entry, ok := k.entries[key]; ok {
+		return entry, true
+	}
+	entry := &idempotentRequest{fingerprint: fingerprint, createdAt: time.Now(), done: make(chan struct{}), response: bufferedResponse{header: http.Header{}}}
+	k.entries[key] = entry
+	k.order = append(k.order, key)
+	return entry, false
+}
+
+// evict drops the keys recorded before cutoff, then the oldest finished ones until at most
+// capacity are left, holding at most maxSize bytes of responses (0 for no limit). Requests still
+// running are kept.
+func (k *idempotencyKeys) evict(cutoff time.Time, capacity int, maxSize int64) {
+	kept := k.order[:0]
+	excess := len(k.entries) - capacity
+	for _, key := range k.order {
+		entry := k.entries[key]
+		select {
+		case <-entry.done:
+			if entry.createdAt.Before(cutoff) || excess > 0 || (maxSize > 0 && k.size > maxSize) {
+				delete(k.entries, key)
+				k.size -= entry.size
+				excess--
+				continue
+			}
+		default:
+		}
+		kept = append(kept, key)
+	}
+	k.order = kept
+}
+
+// keep counts the response of a finished entry against maxSize, making room for it by evicting
+// the oldest ones. A response larger than maxSize on its own is not kept.
+func (k *idempotencyKeys) keep(key string, entry *idempotentRequest, ttl time.Duration, capacity int, maxSize int64) {
+	size := int64(entry.response.body.Len())
+	if maxSize > 0 && size > maxSize {
+		logging.Warnf("Response of %d bytes is too large to keep for its Idempotency-Key", size)
+		k.forget(key, entry)
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.entries[key] == entry {
+		entry.size = size
+		k.size += size
+		k.evict(time.Now().Add(-ttl), capacity, maxSize)
+	}
+}
+
+// forget drops key if it still belongs to entry
+func (k *idempotencyKeys) forget(key string, entry *idempotentRequest) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.entries[key] == entry {
+		delete(k.entries, key)
+		k.size -= entry.size
+		k.order = slices.DeleteFunc(k.order, func(candidate string) bool { return candidate == key })
+	}
+}
+
+// idempotent handles the Idempotency-Key header of a POST. The first request with a key gets a
+// writer capturing its response and a finish func to defer; a retry with the same key waits for
+// that response and replays it, marked with Idempotent-Replayed, and a reuse of the key for a
+// different request (another path or fingerprint, such as the parsed form) is rejected. ok is
+// false when the request has been answered. Without the header, or with IDEMPOTENCY_TTL of 0,
+// w is returned as is.
+func (s *server) idempotent(w http.ResponseWriter, r *http.Request, fingerprint any) (_ http.ResponseWriter, finish func(), ok bool) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" || s.cfg.IdempotencyTTL == 0 {
+		return w, func() {}, true
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		writeRequestError(w, r, badRequest("Invalid Idempotency-Key header (at most %d characters)", maxIdempotencyKeyLength))
+		return w, nil, false
+	}
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	if err := json.NewEncoder(hash).Encode(fingerprint); err != nil {
+		logging.Warnf("Failed to fingerprint request for Idempotency-Key: %v", err)
+		return w, func() {}, true
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	scoped := requestAPIKey(r) + "/" + r.Header.Get("X-Tenant-ID") + "/" + key
+	maxSize := int64(s.cfg.IdempotencyMaxMB) << 20
+
+	for {
+		entry, existing := s.idempotency.claim(scoped, sum, s.cfg.IdempotencyTTL, s.cfg.JobStoreMax, maxSize)
+		if !existing {
+			tee := &teeResponse{ResponseWriter: w, copy: &entry.response}
+			return tee, func() {
+				for name, values := range w.Header() {
+					entry.response.header[name] = values
+				}
+				status := entry.response.status
+				entry.failed = r.Context().Err() != nil || entry.response.failed || status == 0 ||
+					status == http.StatusRequestTimeout || status >= 500
+				if entry.failed {
+					s.idempotency.forget(scoped, entry)
+				} else {
+					s.idempotency.keep(scoped, entry, s.cfg.IdempotencyTTL, s.cfg.JobStoreMax, maxSize)
+				}
+				close(entry.done)
+			}, true
+		}
+
+		if entry.fingerprint != sum {
+			writeRequestError(w, r, &requestError{Status: http.StatusUnprocessableEntity, Message: "Idempotency-Key was already used for a different request"})
+			return w, nil, false
+		}
+		log.Printf("IDEMPOTENT RETRY | Replaying the response to Idempotency-Key %q", key)
+		select {
+		case <-entry.done:
+		case <-r.Context().Done():
+			return w, nil, false
+		}
+		if entry.failed {
+			// The first attempt failed and its key was forgotten; this retry runs again
+			continue
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		entry.response.replay(w)
+		return w, nil, false
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+)
+
+// runJanitor deletes jobs and stored results older than RESULT_RETENTION every JANITOR_INTERVAL
+func (s *server) runJanitor() {
+	log.Printf("Janitor started: retention %v, interval %v", s.cfg.ResultRetention, s.cfg.JanitorInterval)
+	ticker := time.NewTicker(s.cfg.JanitorInterval)
+	defer ticker.Stop()
+	for {
+		s.expire()
+		<-ticker.C
+	}
+}
+
+// expire runs one janitor pass and records it in metrics.Janitor
+func (s *server) expire() {
+	cutoff := time.Now().Add(-s.cfg.ResultRetention)
+	jobsExpired := s.jobs.Expire(cutoff)
+
+	var filesDeleted int
+	var bytesReclaimed int64
+	if s.documents != nil {
+		stats, err := s.documents.Expire(cutoff)
+		if err != nil {
+			logging.Warnf("Janitor failed to expire stored documents: %v", err)
+		}
+		filesDeleted, bytesReclaimed = stats.Files, stats.Bytes
+	}
+
+	metrics.Janitor.RecordRun(jobsExpired, filesDeleted, bytesReclaimed)
+	if jobsExpired > 0 || filesDeleted > 0 {
+		log.Printf("Janitor expired %d jobs and deleted %d files (%d bytes)", jobsExpired, filesDeleted, bytesReclaimed)
+	}
+}
@@ -1,255 +1,218 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
-	"strconv"
-	"strings"
-	"time"
+	"os"
+	"slices"
 
-	"github.com/arnnvv/cutcrap/pkg/chunker"
 	"github.com/arnnvv/cutcrap/pkg/config"
-	"github.com/arnnvv/cutcrap/pkg/workers"
+	"github.com/arnnvv/cutcrap/pkg/cutcrap"
+	"github.com/arnnvv/cutcrap/pkg/httpclient"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/mailer"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+	"github.com/arnnvv/cutcrap/pkg/search"
+	"github.com/arnnvv/cutcrap/pkg/slack"
+	"github.com/arnnvv/cutcrap/pkg/store"
+	"github.com/arnnvv/cutcrap/pkg/telegram"
+	"github.com/arnnvv/cutcrap/pkg/transcribe"
+	"github.com/arnnvv/cutcrap/pkg/webhook"
 
 	"github.com/joho/godotenv"
 )
 
-func enableCors(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
-	(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-}
-
 func main() {
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("No .env file found or error loading .env file, using system env vars")
 	}
 
-	log.Println("Starting service")
 	cfg := config.Load()
-	log.Printf("Configuration loaded: Port=%s, MaxConcurrent=%d, ChunkSize=%d, PdfApi=%s", cfg.Port, cfg.MaxConcurrent, cfg.ChunkSize, cfg.Pdf_api)
-
-	http.HandleFunc("/process", func(w http.ResponseWriter, r *http.Request) {
-		enableCors(&w)
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		uploadHandler(cfg)(w, r)
+	logLevel, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL configuration: %v", err)
+	}
+	err = logging.Setup(logging.Options{
+		Level:      logLevel,
+		Format:     cfg.LogFormat,
+		Output:     cfg.LogOutput,
+		MaxSizeMB:  cfg.LogMaxSizeMB,
+		MaxBackups: cfg.LogMaxBackups,
 	})
+	if err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
 
-	log.Printf("Server starting on :%s", cfg.Port)
-	log.Fatal(http.ListenAndServe(":"+cfg.Port, nil))
-}
+	if len(os.Args) > 1 && os.Args[1] == "golden" {
+		os.Exit(runGolden(cfg, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		os.Exit(runAdmin(cfg, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBench(cfg, os.Args[2:]))
+	}
 
-func uploadHandler(cfg *config.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		startTime := time.Now()
-		log.Printf("\n\n=== NEW REQUEST ===")
-		log.Printf("From: %s | Method: %s | Content-Type: %s", r.RemoteAddr, r.Method, r.Header.Get("Content-Type"))
-		defer func() {
-			log.Printf("=== REQUEST COMPLETED IN %v ===\n", time.Since(startTime))
-		}()
-
-		const maxMemory = 32 << 20 // 32 MB
-		if err := r.ParseMultipartForm(maxMemory); err != nil {
-			log.Printf("MULTIPART FORM PARSE ERROR: %v", err)
-			if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
-				http.Error(w, "Invalid request format: Expected multipart/form-data", http.StatusBadRequest)
-			} else {
-				http.Error(w, "Invalid form data", http.StatusBadRequest)
-			}
-			return
-		}
+	checkOnly := len(os.Args) > 1 && os.Args[1] == "--check-config"
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if err := checkOpenAPI(); err != nil {
+		log.Fatalf("openapi.json is out of sync with request parsing: %v", err)
+	}
 
-		text := r.FormValue("text")
-		ratioStr := r.FormValue("ratio")
-		mode := r.FormValue("mode")
+	log.Println("Starting service")
+	log.Printf("Configuration loaded: Port=%s, MaxConcurrent=%d, ChunkSize=%d, PdfApi=%s", cfg.Port, cfg.MaxConcurrent, cfg.ChunkSize, cfg.Pdf_api)
 
-		log.Printf("Received Form Data: text(len)=%d, ratio='%s', mode='%s'", len(text), ratioStr, mode)
+	httpclient.Configure(cfg.HTTPMaxIdleConnsPerHost)
+	engine, err := cutcrap.New(cfg)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
-		if text == "" {
-			log.Printf("VALIDATION FAILED: Empty text field")
-			http.Error(w, "Text field is missing or empty", http.StatusBadRequest)
-			return
-		}
+	profiles, err := parseProfiles(cfg.Profiles)
+	if err != nil {
+		log.Fatalf("Invalid PROFILES configuration: %v", err)
+	}
 
-		ratio, err := strconv.ParseFloat(ratioStr, 64)
-		if err != nil || ratio <= 0 || ratio > 1 {
-			log.Printf("VALIDATION FAILED: Invalid ratio '%v'", ratioStr)
-			http.Error(w, "Invalid ratio value (must be > 0 and <= 1)", http.StatusBadRequest)
-			return
-		}
+	if checkOnly {
+		log.Println("Configuration OK")
+		return
+	}
 
-		if mode == "" {
-			log.Printf("VALIDATION FAILED: Mode field is missing, defaulting to 'document'")
-			mode = "document"
+	srv := &server{
+		cfg:      cfg,
+		engine:   engine,
+		jobs:     jobs.NewStore(cfg.JobStoreMax),
+		profiles: profiles,
+		index:    search.NewIndex(),
+	}
+	srv.artifacts.maxSize = int64(cfg.ArtifactCacheMaxMB) << 20
+	if cfg.EmbeddingModel != "" {
+		srv.vectors, srv.chunkVectors = search.NewVectorIndex(), search.NewVectorIndex()
+		log.Printf("Semantic search and questions enabled (%s embeddings)", cfg.EmbeddingModel)
+	}
+	srv.jobs.OnEvict = func(id string) {
+		srv.index.Remove(id)
+		srv.artifacts.remove(id)
+		if srv.vectors != nil {
+			srv.vectors.Remove(id)
+			srv.chunkVectors.Remove(id)
 		}
+	}
 
-		if mode != "document" && mode != "transcript" {
-			log.Printf("VALIDATION FAILED: Invalid mode value '%s'", mode)
-			http.Error(w, "Invalid mode value (must be 'document' or 'transcript')", http.StatusBadRequest)
-			return
+	if cfg.DocumentDir != "" {
+		documents, err := store.NewDocumentStore(cfg.DocumentDir)
+		if err != nil {
+			log.Fatalf("Invalid DOCUMENT_STORE_DIR configuration: %v", err)
 		}
+		srv.documents = documents
+	}
+
+	if cfg.ResultRetention > 0 {
+		go srv.runJanitor()
+	}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute) // Consider adjusting timeout based on mode/content length?
-		defer cancel()
-
-		inputWordCount := len(strings.Fields(text))
-		log.Printf("PROCESSING START | Mode: %s | Words: %d | Ratio: %.2f", mode, inputWordCount, ratio)
-
-		var combinedResult string // Stores the final text (condensed doc or formatted transcript)
-
-		if mode == "transcript" {
-			result := workers.ProcessTranscript(ctx, text, cfg, ratio)
-			if ctx.Err() != nil {
-				log.Printf("Transcript processing failed due to context error: %v", ctx.Err())
-				http.Error(w, "Transcript processing timed out or was cancelled", http.StatusRequestTimeout)
-				return // Stop processing
-			}
-			// If result is empty, it might be a valid outcome (e.g., empty input) or an internal processing error.
-			// Assume empty result is valid for now unless ctx.Err() was set.
-			combinedResult = result
-		} else { // document mode
-			chunks, err := chunker.ChunkText(text, cfg.ChunkSize) // Use sentence chunking for documents
-			if err != nil {
-				log.Printf("Text chunking failed: %v", err)
-				http.Error(w, "Text chunking failed", http.StatusInternalServerError)
-				return
-			}
-			// Pass nil for the speaker map in document mode
-			results := workers.ProcessChunks(ctx, chunks, cfg, ratio, "document", nil)
-			if ctx.Err() != nil {
-				log.Printf("Chunk processing failed due to context error: %v", ctx.Err())
-				http.Error(w, "Document processing timed out or was cancelled", http.StatusRequestTimeout)
-				return // Stop processing
-			}
-			combinedResult = combineResults(results) // Combine document chunks
+	if cfg.UploadDir != "" {
+		uploads, err := store.NewUploadStore(cfg.UploadDir, maxUploadSize)
+		if err != nil {
+			log.Fatalf("Invalid UPLOAD_DIR configuration: %v", err)
 		}
+		uploads.MaxPerOwner, uploads.MaxTotal = cfg.UploadMaxPerKey, int64(cfg.UploadMaxTotalMB)<<20
+		srv.uploads = uploads
+		go srv.runUploadExpiry()
+		log.Printf("Resumable uploads enabled at %s/uploads", apiVersion)
+	}
 
-		// --- Response Handling ---
-		// Only proceed if context is still valid
-		if ctx.Err() == nil {
-			outputWordCount := len(strings.Fields(combinedResult))
-			reduction := 0.0
-			if inputWordCount > 0 {
-				reduction = 100.0 - (float64(outputWordCount)/float64(inputWordCount))*100.0
-			}
-			log.Printf("RESPONSE READY | Input: %d words | Output: %d words | Reduction: %.1f%%",
-				inputWordCount, outputWordCount, reduction)
-
-			// --- Determine if PDF should be generated ---
-			pdfApiAvailable := cfg.Pdf_api != ""
-			shouldGeneratePdfForDoc := mode == "document" && pdfApiAvailable && strings.Contains(combinedResult, "# ") // Document PDF only if headings exist
-			shouldGeneratePdfForTranscript := mode == "transcript" && pdfApiAvailable                                  // Transcript PDF if API is set
-
-			if shouldGeneratePdfForDoc || shouldGeneratePdfForTranscript {
-				log.Printf("Attempting PDF generation via API: %s (Mode: %s)", cfg.Pdf_api, mode)
-				w.Header().Set("Content-Type", "application/pdf")
-
-				// Set appropriate PDF filename based on mode
-				pdfFilename := "processed_document.pdf"
-				if mode == "transcript" {
-					pdfFilename = "processed_transcript.pdf"
-				}
-				w.Header().Set("Content-Disposition", "attachment; filename="+pdfFilename)
-
-				// --- Call PDF Generation API ---
-				var body bytes.Buffer
-				mpWriter := multipart.NewWriter(&body)
-				// Use markdown for the file content type, PDF API should handle it
-				fileWriter, err := mpWriter.CreateFormFile("file", "content.md")
-				if err != nil {
-					log.Printf("PDF API FORM CREATION FAILED: %v", err)
-					http.Error(w, "PDF generation setup failed", http.StatusInternalServerError)
-					return
-				}
-
-				// Write the final combined text (document or transcript)
-				if _, err := fileWriter.Write([]byte(combinedResult)); err != nil {
-					log.Printf("PDF API WRITE FAILED: %v", err)
-					http.Error(w, "PDF generation content write failed", http.StatusInternalServerError)
-					return
-				}
-				mpWriter.Close() // Close writer before sending request
-
-				req, err := http.NewRequestWithContext(ctx, "POST", cfg.Pdf_api, &body)
-				if err != nil {
-					log.Printf("PDF API REQUEST CREATION FAILED: %v", err)
-					http.Error(w, "PDF generation request creation failed", http.StatusInternalServerError)
-					return
-				}
-				// Set the correct multipart content type for the PDF API request
-				req.Header.Set("Content-Type", mpWriter.FormDataContentType())
-
-				client := &http.Client{Timeout: 2 * time.Minute} // Timeout for PDF generation
-				resp, err := client.Do(req)
-				if err != nil {
-					log.Printf("PDF API REQUEST FAILED: %v", err)
-					http.Error(w, "PDF generation request failed", http.StatusInternalServerError)
-					return
-				}
-				defer resp.Body.Close()
-
-				if resp.StatusCode != http.StatusOK {
-					respBodyBytes, _ := io.ReadAll(resp.Body)
-					log.Printf("PDF API RETURNED STATUS: %d. Body: %s", resp.StatusCode, string(respBodyBytes))
-					http.Error(w, "PDF generation failed on external API", http.StatusInternalServerError)
-					return
-				}
-
-				// Stream the PDF response back to the original client
-				log.Printf("Streaming PDF response to client...")
-				if _, err := io.Copy(w, resp.Body); err != nil {
-					log.Printf("PDF STREAM FAILED: %v", err)
-					// Don't send another http.Error if header might be partially sent
-					return
-				}
-				log.Printf("PDF stream completed.")
-				// --- End PDF API Call ---
-
-			} else {
-				// --- Send as Plain Text ---
-				if pdfApiAvailable {
-					if mode == "transcript" {
-						log.Printf("Sending transcript as plain text (PDF API available but not triggered).")
-					} else {
-						log.Printf("Sending document as plain text (PDF API available but no headings found).")
-					}
-				} else {
-					log.Printf("Sending response as plain text (PDF API not configured).")
-				}
-
-				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-				// Set appropriate text filename based on mode
-				txtFilename := "processed_document.txt"
-				if mode == "transcript" {
-					txtFilename = "processed_transcript.txt"
-				}
-				w.Header().Set("Content-Disposition", "attachment; filename="+txtFilename)
-				io.WriteString(w, combinedResult)
-				// --- End Plain Text ---
-			}
-		} // End check for ctx.Err() == nil
+	if cfg.SMTPHost != "" {
+		srv.mailer = mailer.New(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
 	}
-}
 
-// combineResults joins string slices, used primarily for document chunks
-func combineResults(results []string) string {
-	// Filter out empty strings that might result from failed chunk processing
-	var validResults []string
-	for _, res := range results {
-		// Check if result is non-empty after trimming whitespace
-		if strings.TrimSpace(res) != "" {
-			validResults = append(validResults, res)
+	if cfg.RateLimitPerMinute > 0 {
+		srv.limiter = newRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst)
+	}
+
+	// Every route logs, counts and recovers; the API also authenticates and rate limits, except
+	// for its description
+	mux := http.NewServeMux()
+	base := []middleware{logRequests, recordMetrics, recoverPanics}
+	api := slices.Concat(base, []middleware{cors, srv.authenticate, srv.rateLimit})
+	registerAPI(mux, []apiRoute{
+		{"/process", srv.handleProcess},
+		{"/compare", srv.handleCompare},
+		{"/compare/documents", srv.handleCompareDocuments},
+		{"/eval", srv.handleEval},
+		{"/jobs/{id}", srv.handleJob},
+		{"/jobs/{id}/reprocess", srv.handleReprocess},
+		{"/jobs/{id}/refine", srv.handleRefine},
+		{"/jobs/{id}/ask", srv.handleAsk},
+		{"/jobs/{id}/artifacts", srv.handleArtifacts},
+		{"/jobs/{id}/artifacts/{format}", srv.handleArtifact},
+		{"/jobs/{id}/artifacts/{format}/share", srv.handleShareArtifact},
+		{"/uploads", srv.handleUploads},
+		{"/uploads/{id}", srv.handleUpload},
+		{"/documents/{hash}", srv.handleDocument},
+		{"/documents/{hash}/results/{file}", srv.handleDocumentResult},
+		{"/search", srv.handleSearch},
+		{"/search/semantic", srv.handleSemanticSearch},
+	}, api...)
+	// The admin API authenticates with ADMIN_API_KEYS instead
+	registerAPI(mux, []apiRoute{
+		{"/admin/jobs", srv.handleAdminJobs},
+		{"/admin/jobs/{id}", srv.handleAdminJob},
+		{"/admin/jobs/{id}/cancel", srv.handleCancelJob},
+		{"/admin/jobs/{id}/retry", srv.handleRetryJob},
+	}, slices.Concat(base, []middleware{cors, srv.authenticateAdmin, srv.rateLimit})...)
+	registerAPI(mux, []apiRoute{{"/openapi.json", handleOpenAPI}}, slices.Concat(base, []middleware{cors})...)
+	// Signed download links carry their own authorization
+	registerAPI(mux, []apiRoute{{"/downloads/{id}/{format}", srv.handleSignedDownload}}, slices.Concat(base, []middleware{cors, srv.rateLimit})...)
+	// Operational and integration endpoints aren't part of the versioned API
+	mux.Handle("/metrics", chain(http.HandlerFunc(srv.handleMetrics), api...))
+	mux.Handle("/", chain(handleUI(), base...))
+
+	if cfg.SlackSigningSecret != "" {
+		srv.slack = slack.New(cfg.SlackBotToken, cfg.SlackAPIURL, nil)
+		// Slack requests are authenticated by their signature instead of an API key
+		mux.Handle("/integrations/slack", chain(http.HandlerFunc(srv.handleSlack), base...))
+		log.Printf("Slack integration enabled at /integrations/slack")
+	}
+
+	if cfg.WebhookSecret != "" {
+		srv.webhooks = webhook.New(cfg.WebhookSecret, cfg.WebhookMaxAttempts, cfg.WebhookTimeout, cfg.WebhookDeadLetterFile)
+	}
+
+	switch cfg.TranscribeBackend {
+	case "whisper-cpp":
+		whisper, err := transcribe.NewWhisperCpp(cfg.TranscribeCommand, cfg.TranscribeTimeout)
+		if err != nil {
+			log.Fatalf("Invalid TRANSCRIBE_COMMAND configuration: %v", err)
 		}
+		srv.transcriber = whisper
+	case "api":
+		srv.transcriber = transcribe.NewAPI(cfg.TranscribeAPIURL, cfg.TranscribeAPIKey, cfg.TranscribeModel, cfg.TranscribeTimeout)
+	}
+	if srv.transcriber != nil {
+		log.Printf("Audio uploads enabled (%s transcription)", cfg.TranscribeBackend)
 	}
 
-	// Join valid chunks with double newlines for separation
-	return strings.Join(validResults, "\n\n")
+	if cfg.TelegramBotToken != "" {
+		srv.telegram = telegram.New(cfg.TelegramBotToken, cfg.TelegramAPIURL, nil)
+		go srv.runTelegramBot(context.Background())
+	}
+
+	log.Printf("Server starting on :%s", cfg.Port)
+	log.Fatal(http.ListenAndServe(":"+cfg.Port, mux))
+}
+
+// logMetrics logs the readability comparison between input and output
+func logMetrics(label string, report metrics.Report) {
+	log.Printf("METRICS (%s) | FK Grade: %.1f -> %.1f | Reading Ease: %.1f -> %.1f | Reading Time: %.0fs -> %.0fs | Lexical Density: %.2f -> %.2f",
+		label,
+		report.Input.FleschKincaidGrade, report.Output.FleschKincaidGrade,
+		report.Input.FleschReadingEase, report.Output.FleschReadingEase,
+		report.Input.ReadingTimeSeconds, report.Output.ReadingTimeSeconds,
+		report.Input.LexicalDensity, report.Output.LexicalDensity)
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+)
+
+// metricsResponse is the process-wide worker pool state served at /metrics
+type metricsResponse struct {
+	Chunks metrics.PoolSummary `json:"chunks"`
+	// SchedulerWaiting is the number of model calls waiting for a GLOBAL_MAX_CONCURRENT slot
+	SchedulerWaiting int `json:"scheduler_waiting"`
+	// Janitor is what RESULT_RETENTION cleanup has deleted since startup
+	Janitor metrics.JanitorSummary `json:"janitor"`
+	// HTTP is requests by route pattern
+	HTTP metrics.HTTPSummary `json:"http"`
+}
+
+// handleMetrics serves chunk latency percentiles, token throughput and failures across all jobs
+// since startup, for capacity planning
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	response := metricsResponse{Chunks: metrics.Pool.Summary(), Janitor: metrics.Janitor.Summary(), HTTP: metrics.HTTP.Summary()}
+	if scheduler := s.engine.Client().Scheduler; scheduler != nil {
+		response.SchedulerWaiting = scheduler.Waiting()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+)
+
+// middleware wraps a handler with one cross-cutting concern
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h in middlewares, the first of which sees the request first
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// statusRecorder remembers the status a handler responded with. It passes flushes through, so
+// event streams and heartbeats behave as without it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// recordStatus wraps w, or returns it when an outer middleware already did
+func recordStatus(w http.ResponseWriter) *statusRecorder {
+	if sr, ok := w.(*statusRecorder); ok {
+		return sr
+	}
+	return &statusRecorder{ResponseWriter: w}
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(p []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(p)
+}
+
+func (sr *statusRecorder) Flush() {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Status is the status sent so far, 200 for a handler that returned without writing
+func (sr *statusRecorder) Status() int {
+	if sr.status == 0 {
+		return http.StatusOK
+	}
+	return sr.status
+}
+
+// recoverPanics turns a panicking handler into a 500 response and logs the panic with its stack,
+// instead of dropping the connection. A response that was already started can only be cut off.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sr := recordStatus(w)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			metrics.HTTP.RecordPanic()
+			logging.Errorf("PANIC serving %s %s: %v\n%s", r.Method, r.URL.Path, recovered, debug.Stack())
+			if sr.status == 0 {
+				http.Error(sr, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(sr, r)
+	})
+}
+
+// logRequests logs the method, path, status and duration of each request
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		sr := recordStatus(w)
+		next.ServeHTTP(sr, r)
+		log.Printf("HTTP %s %s %d %v", r.Method, r.URL.Path, sr.Status(), time.Since(startTime).Round(time.Millisecond))
+	})
+}
+
+// recordMetrics counts requests, error responses and latency by route pattern for /metrics
+func recordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		sr := recordStatus(w)
+		next.ServeHTTP(sr, r)
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTP.RecordRequest(route, sr.Status(), time.Since(startTime))
+	})
+}
+
+// cors sets CORS headers and answers preflight requests, which carry no credentials, before
+// authentication
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, PATCH, HEAD, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Requested-With, Upload-Offset, Upload-Length, Upload-Metadata, Tus-Resumable, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "Location, Upload-Offset, Upload-Length, Tus-Resumable, Idempotent-Replayed")
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate requires one of API_KEYS as a bearer token or X-API-Key header. Without API_KEYS
+// every request is let through.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	if len(s.cfg.APIKeys) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !validKey(requestAPIKey(r), s.cfg.APIKeys) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cutcrap"`)
+			http.Error(w, "Missing or invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestAPIKey returns the key a request authenticates with, or ""
+func requestAPIKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// requestOwner identifies who a request acts for: its API key and X-Tenant-ID, hashed so the
+// keys aren't kept with the data they own
+func requestOwner(r *http.Request) string {
+	sum := sha256.Sum256([]byte(requestAPIKey(r) + "/" + r.Header.Get("X-Tenant-ID")))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticateAdmin requires one of ADMIN_API_KEYS, like authenticate. Without ADMIN_API_KEYS
+// the admin API is disabled.
+func (s *server) authenticateAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.cfg.AdminAPIKeys) == 0 {
+			http.Error(w, "The admin API is not enabled on this server", http.StatusNotFound)
+			return
+		}
+		if !validKey(requestAPIKey(r), s.cfg.AdminAPIKeys) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cutcrap admin"`)
+			http.Error(w, "Missing or invalid admin API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validKey compares key with every one of keys in constant time
+func validKey(key string, keys []string) bool {
+	valid := false
+	for _, candidate := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+			valid = true
+		}
+	}
+	return key != "" && valid
+}
+
+// rateLimit rejects clients past RATE_LIMIT_PER_MINUTE with 429. Clients are told apart by their
+// API key, so those sharing an address (e.g. behind a proxy) get a bucket each, and by their
+// address when they send none, as the web UI does. Without API_KEYS keys aren't checked, so a
+// client could dodge the limit by changing its key.
+func (s *server) rateLimit(next http.Handler) http.Handler {
+	if s.limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := "key:" + requestAPIKey(r)
+		if client == "key:" {
+			host, _, _ := net.SplitHostPort(r.RemoteAddr)
+			client = "addr:" + host
+		}
+		if wait, ok := s.limiter.allow(client); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimiter is a token bucket per client, refilled at perMinute tokens a minute up to burst
+type rateLimiter struct {
+	mu        sync.Mutex
+	perMinute float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxIdleBuckets is how many client buckets are kept before full ones are dropped
+const maxIdleBuckets = 10000
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{perMinute: float64(perMinute), burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from client's bucket, or reports how long until one is available
+func (l *rateLimiter) allow(client string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	bucket, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.prune(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.last).Minutes()*l.perMinute)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / l.perMinute * float64(time.Minute)), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+// prune drops the buckets that have refilled, which behave like new ones
+func (l *rateLimiter) prune(now time.Time) {
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Minutes()*l.perMinute >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
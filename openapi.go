@@ -0,0 +1,58 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// openapiSpec describes the HTTP API; request parsing in request.go follows its schemas
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// checkOpenAPI reports the form fields that parseProcessRequest reads but the ProcessRequest
+// schema doesn't describe, and the reverse
+func checkOpenAPI() error {
+	var spec struct {
+		Components struct {
+			Schemas struct {
+				ProcessRequest struct {
+					Properties map[string]json.RawMessage `json:"properties"`
+				} `json:"ProcessRequest"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openapiSpec, &spec); err != nil {
+		return err
+	}
+	properties := spec.Components.Schemas.ProcessRequest.Properties
+	var undocumented, unknown []string
+	for _, field := range processFields {
+		if _, ok := properties[field]; !ok {
+			undocumented = append(undocumented, field)
+		}
+	}
+	for _, property := range slices.Sorted(maps.Keys(properties)) {
+		if !slices.Contains(processFields, property) {
+			unknown = append(unknown, property)
+		}
+	}
+	if len(undocumented) > 0 || len(unknown) > 0 {
+		return fmt.Errorf("ProcessRequest lacks %q and describes unparsed %q", undocumented, unknown)
+	}
+	return nil
+}
+
+// handleOpenAPI serves the OpenAPI specification
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapiSpec)
+}
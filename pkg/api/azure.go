@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultAzureAPIVersion is the Azure OpenAI REST API version used when none is configured
+const DefaultAzureAPIVersion = "2024-06-01"
+
+// AzureOpenAI serves generations from chat completions of an Azure OpenAI resource. Models are
+// addressed by deployment: Deployments maps Gemini model names to deployments, and every other
+// model goes to Deployment.
+type AzureOpenAI struct {
+	Endpoint    string
+	APIKey      string
+	APIVersion  string
+	Deployment  string
+	Deployments map[string]string
+	HTTPClient  *http.Client
+}
+
+// azureFinishReasons maps chat completion finish reasons to Gemini ones
+var azureFinishReasons = map[string]string{
+	"stop":           "STOP",
+	"length":         FinishMaxTokens,
+	"content_filter": FinishSafety,
+}
+
+func (a *AzureOpenAI) GenerateContent(ctx context.Context, model string, request []byte) (*GeminiResponse, error) {
+	parsed, err := parseGenerateRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []map[string]string
+	if system := parsed.system(); system != "" {
+		messages = append(messages, map[string]string{"role": "system", "content": system})
+	}
+	for _, message := range parsed.messages() {
+		messages = append(messages, map[string]string{"role": message.role, "content": message.text})
+	}
+	payload := map[string]any{"messages": messages}
+	config := parsed.GenerationConfig
+	if config.Temperature != nil {
+		payload["temperature"] = *config.Temperature
+	}
+	if config.TopP != nil {
+		payload["top_p"] = *config.TopP
+	}
+	if config.MaxOutputTokens > 0 {
+		payload["max_tokens"] = config.MaxOutputTokens
+	}
+	if len(config.StopSequences) > 0 {
+		payload["stop"] = config.StopSequences
+	}
+	if config.Seed != nil {
+		payload["seed"] = *config.Seed
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshal API payload: %w", err)
+	}
+
+	deployment := mapModel(a.Deployments, model, a.Deployment)
+	endpoint := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		strings.TrimRight(a.Endpoint, "/"), url.PathEscape(deployment), url.QueryEscape(cmp.Or(a.APIVersion, DefaultAzureAPIVersion)))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed create API request: %w", err)
+	}
+	req.Header.Set("api-key", a.APIKey)
+
+	var response struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := doJSON(a.HTTPClient, req, deployment, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in API response")
+	}
+	choice := response.Choices[0]
+	finishReason, ok := azureFinishReasons[choice.FinishReason]
+	if !ok {
+		finishReason = strings.ToUpper(choice.FinishReason)
+	}
+	return providerResponse(choice.Message.Content, finishReason, response.Model, response.Usage.PromptTokens, response.Usage.CompletionTokens), nil
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/awssig"
+)
+
+// CredentialsSource hands out AWS credentials (see awssig.Source)
+type CredentialsSource interface {
+	Retrieve(ctx context.Context) (awssig.Credentials, error)
+}
+
+// Bedrock serves generations from the Converse API of AWS Bedrock, signing requests with
+// Signature Version 4. Models maps Gemini model names to Bedrock model IDs, and every other
+// model goes to ModelID.
+type Bedrock struct {
+	Region      string
+	Credentials CredentialsSource
+	ModelID     string
+	Models      map[string]string
+	HTTPClient  *http.Client
+}
+
+// bedrockStopReasons maps Converse stop reasons to Gemini finish reasons
+var bedrockStopReasons = map[string]string{
+	"end_turn":             "STOP",
+	"stop_sequence":        "STOP",
+	"max_tokens":           FinishMaxTokens,
+	"guardrail_intervened": FinishSafety,
+	"content_filtered":     FinishSafety,
+}
+
+func (b *Bedrock) GenerateContent(ctx context.Context, model string, request []byte) (*GeminiResponse, error) {
+	parsed, err := parseGenerateRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Converse needs alternating roles, so consecutive turns of one role are merged
+	var messages []map[string]any
+	var lastRole string
+	for _, message := range parsed.messages() {
+		if message.role == lastRole {
+			content := messages[len(messages)-1]["content"].([]map[string]string)
+			messages[len(messages)-1]["content"] = append(content, map[string]string{"text": message.text})
+			continue
+		}
+		messages = append(messages, map[string]any{"role": message.role, "content": []map[string]string{{"text": message.text}}})
+		lastRole = message.role
+	}
+	payload := map[string]any{"messages": messages}
+	if system := parsed.system(); system != "" {
+		payload["system"] = []map[string]string{{"text": system}}
+	}
+	inference := map[string]any{}
+	config := parsed.GenerationConfig
+	if config.Temperature != nil {
+		inference["temperature"] = *config.Temperature
+	}
+	if config.TopP != nil {
+		inference["topP"] = *config.TopP
+	}
+	if config.MaxOutputTokens > 0 {
+		inference["maxTokens"] = config.MaxOutputTokens
+	}
+	if len(config.StopSequences) > 0 {
+		inference["stopSequences"] = config.StopSequences
+	}
+	if len(inference) > 0 {
+		payload["inferenceConfig"] = inference
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshal API payload: %w", err)
+	}
+
+	credentials, err := b.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed get AWS credentials: %w", err)
+	}
+	modelID := mapModel(b.Models, model, b.ModelID)
+	endpoint := fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/model/%s/converse", b.Region, awssig.Escape(modelID))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed create API request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	awssig.Sign(req, body, b.Region, "bedrock", credentials, time.Now())
+
+	var response struct {
+		Output struct {
+			Message struct {
+				Content []struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			} `json:"message"`
+		} `json:"output"`
+		StopReason string `json:"stopReason"`
+		Usage      struct {
+			InputTokens  int `json:"inputTokens"`
+			OutputTokens int `json:"outputTokens"`
+		} `json:"usage"`
+	}
+	if err := doJSON(b.HTTPClient, req, modelID, &response); err != nil {
+		return nil, err
+	}
+	var text strings.Builder
+	for _, content := range response.Output.Message.Content {
+		text.WriteString(content.Text)
+	}
+	finishReason, ok := bedrockStopReasons[response.StopReason]
+	if !ok {
+		finishReason = strings.ToUpper(response.StopReason)
+	}
+	return providerResponse(text.String(), finishReason, modelID, response.Usage.InputTokens, response.Usage.OutputTokens), nil
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// CreateCachedContext uploads the shared job instructions and the whole document as a Gemini
+// cached context for model and returns its resource name ("cachedContents/..."). Every chunk
+// call then sends only its chunk, and generation must use the same model. Gemini enforces a
+// minimum token count for caches, so small inputs are rejected and callers should fall back to
+// inline prompts.
+func (c *Client) CreateCachedContext(ctx context.Context, model, instructions, document string, ttl time.Duration) (string, error) {
+	logger := reqctx.Logger(ctx)
+	if c.Provider != nil {
+		return "", fmt.Errorf("context caching is only supported by the Gemini API")
+	}
+	payload := map[string]any{
+		"model":             "models/" + model,
+		"systemInstruction": map[string]any{"parts": []map[string]string{{"text": instructions}}},
+		"contents":          []map[string]any{{"role": "user", "parts": []map[string]string{{"text": documentSection(document)}}}},
+		"ttl":               fmt.Sprintf("%ds", int(ttl.Seconds())),
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed marshal cache payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url("cachedContents"), bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed create cache request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cache request failed: %w", redactURL(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("cache API non-OK status: %s. Body: %s", resp.Status, logging.Excerpt(string(respBodyBytes)))
+	}
+
+	var created struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed decode cache response: %w", err)
+	}
+	if created.Name == "" {
+		return "", fmt.Errorf("no name in cache response")
+	}
+	logger.Printf("Created cached context %s for %s (%d words, ttl %v)", created.Name, model, wordcount.Count(document), ttl)
+	return created.Name, nil
+}
+
+// documentSection frames the cached document, which chunk calls refer to but don't process
+func documentSection(document string) string {
+	return fmt.Sprintf("The complete document is given below for context only. Each following request sends one chunk of it to process; use the rest of the document only to understand that chunk.\n\n--- FULL DOCUMENT START ---\n%s\n--- FULL DOCUMENT END ---", document)
+}
+
+// DeleteCachedContext removes a cached context before its TTL runs out
+func (c *Client) DeleteCachedContext(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", c.url(name), nil)
+	if err != nil {
+		return fmt.Errorf("failed create cache delete request: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cache delete request failed: %w", redactURL(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cache delete non-OK status: %s", resp.Status)
+	}
+	return nil
+}
+
+// ProcessChunkWithCache processes one chunk of inputWordCount words against a cached context
+// created for model from BuildInstructions and the document, sending only the chunk itself
+// instead of the full prompt
+func (c *Client) ProcessChunkWithCache(ctx context.Context, text, model, mode, cacheName string, inputWordCount, targetWordCount int) (string, error) {
+	logger := reqctx.Debug(ctx)
+	startTime := time.Now()
+	logger.Printf("Processing text chunk with cached context (mode: %s, model: %s, %d words)", mode, model, inputWordCount)
+
+	payload := map[string]any{
+		"cachedContent":    cacheName,
+		"contents":         []map[string]any{{"role": "user", "parts": []map[string]string{{"text": chunkSection(mode, text)}}}},
+		"generationConfig": chunkGenerationConfig(mode, targetWordCount, inputWordCount),
+	}
+
+	response, err := c.generateContent(ctx, model, payload, 0)
+	if err != nil {
+		return "", fmt.Errorf("cached API request failed (%s mode): %w", mode, err)
+	}
+	candidate := response.Candidates[0]
+	if err := blockedError(candidate.FinishReason); err != nil {
+		return "", fmt.Errorf("cached API request failed (%s mode): %w", mode, err)
+	}
+
+	result := candidate.Content.Parts[0].Text
+	checkOutputSize(ctx, mode, targetWordCount, result, candidate.FinishReason)
+	if candidate.FinishReason == FinishMaxTokens {
+		if mode == "transcript" || mode == "transcript_condensed" {
+			return processSplit(ctx, text, mode, func(half string) (string, error) {
+				return c.ProcessChunkWithCache(ctx, half, model, mode, cacheName, wordcount.Count(half), max(targetWordCount/2, 1))
+			})
+		}
+		result = c.continueTruncated(ctx, model, payload, result)
+	}
+	logger.Printf("Cached API call successful (%s mode). Result: %d words. Time: %v", mode, wordcount.Count(result), time.Since(startTime))
+	return result, nil
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/httpclient"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+)
+
+// DefaultBaseURL is the Gemini API root used when no base URL is configured
+const DefaultBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// Client talks to the Gemini API. The HTTP client and base URL are injectable so the
+// pipeline can run against a fake provider (see pkg/fakeprovider) instead of Google.
+type Client struct {
+	APIKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+	// Scheduler, when set, bounds the generation requests in flight across all jobs
+	Scheduler *Scheduler
+	// SpeakerCache, when set, keeps speaker analyses by transcript hash
+	SpeakerCache *SpeakerCache
+	// CallTimeout, when set, is the timeout of the calls that have none of their own (the chunk
+	// calls), growing with the prompt
+	CallTimeout time.Duration
+	// Provider, when set, serves generations instead of the Gemini API (see AzureOpenAI, Bedrock)
+	Provider Provider
+	// MaxInputTokens, when set, is the estimated chunk size past which ExceedsContext reports true
+	MaxInputTokens int
+}
+
+const (
+	// defaultCallTimeout is the timeout of calls without one of their own when CallTimeout is
+	// not set
+	defaultCallTimeout = 60 * time.Second
+	// callTimeoutPerKWords is the time CallTimeout is extended by for every 1000 prompt words
+	callTimeoutPerKWords = 10 * time.Second
+	// bytesPerWord estimates the words of a JSON payload from its size
+	bytesPerWord = 6
+)
+
+// callTimeout is the timeout of a call with a payload of bodySize bytes: the call's own timeout
+// when it has one, otherwise CallTimeout scaled to the payload, or defaultCallTimeout
+func (c *Client) callTimeout(own time.Duration, bodySize int) time.Duration {
+	if own > 0 {
+		return own
+	}
+	if c.CallTimeout <= 0 {
+		return defaultCallTimeout
+	}
+	return c.CallTimeout + time.Duration(bodySize/bytesPerWord/1000)*callTimeoutPerKWords
+}
+
+// New returns a client. An empty baseURL uses DefaultBaseURL and a nil httpClient uses
+// httpclient.Default; per-call timeouts are applied through the request context.
+func New(apiKey, baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if httpClient == nil {
+		httpClient = httpclient.Default
+	}
+	return &Client{
+		APIKey:     apiKey,
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: httpClient,
+	}
+}
+
+// url builds the full URL for an API path, with the API key as query parameter
+func (c *Client) url(path string) string {
+	return c.BaseURL + "/" + path + "?key=" + url.QueryEscape(c.APIKey)
+}
+
+// redactURL masks the API key in the URL of a transport error, which would otherwise be
+// carried into logs and error messages
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = logging.Scrub(urlErr.URL)
+	}
+	return err
+}
+
+// generateContent posts a payload to the generateContent endpoint for the given model
+// and returns the decoded response. A response without any candidate text is an error.
+// A timeout of 0 leaves the call to CallTimeout, see callTimeout.
+func (c *Client) generateContent(ctx context.Context, model string, payload map[string]any, timeout time.Duration) (*GeminiResponse, error) {
+	info := RunInfoFrom(ctx)
+	if info != nil {
+		info.applySeed(payload)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshal API payload: %w", err)
+	}
+
+	// Time spent waiting for a slot doesn't count against the call timeout
+	if c.Scheduler != nil {
+		if err := c.Scheduler.Acquire(ctx); err != nil {
+			return nil, fmt.Errorf("waiting for a request slot: %w", err)
+		}
+		defer c.Scheduler.Release()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout(timeout, len(body)))
+	defer cancel()
+
+	callStart := time.Now()
+	var response *GeminiResponse
+	if c.Provider != nil {
+		response, err = c.Provider.GenerateContent(ctx, model, body)
+	} else {
+		response, err = c.postGenerateContent(ctx, model, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
+		if len(response.Candidates) > 0 {
+			if err := blockedError(response.Candidates[0].FinishReason); err != nil {
+				return nil, err
+			}
+		}
+		return nil, fmt.Errorf("no content in API response")
+	}
+	if info != nil {
+		info.record(response.ModelVersion, body)
+	}
+	usage := response.UsageMetadata
+	metrics.RecordCall(ctx, usage.PromptTokenCount, usage.CandidatesTokenCount, usage.TotalTokenCount, time.Since(callStart))
+	return response, nil
+}
+
+// postGenerateContent sends a generateContent request to the Gemini API
+func (c *Client) postGenerateContent(ctx context.Context, model string, body []byte) (*GeminiResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url("models/"+model+":generateContent"), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed create API request: %w", err)
+	}
+	var response GeminiResponse
+	if err := doJSON(c.HTTPClient, req, model, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// doJSON sends a JSON request to a model API and decodes its JSON response into out. The body of
+// an error response is logged rather than returned, as it may echo the prompt.
+func doJSON(client *http.Client, req *http.Request, model string, out any) error {
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("API request failed: %w", redactURL(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBodyBytes, _ := io.ReadAll(resp.Body)
+		reqctx.Logger(req.Context()).Printf("API non-OK status (model %s): %s. Body: %s", model, resp.Status, logging.Excerpt(string(respBodyBytes)))
+		if isContextLengthError(resp.StatusCode, respBodyBytes) {
+			return fmt.Errorf("API request failed: %s: %w", resp.Status, ErrContextLength)
+		}
+		return fmt.Errorf("API request failed: %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed decode API response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// ErrContextLength is returned when the model rejected a prompt as longer than its context
+var ErrContextLength = errors.New("prompt exceeds the model's context length")
+
+// bytesPerToken estimates the tokens of text without word breaks, where tokensPerWord undercounts
+const bytesPerToken = 4
+
+// contextLengthMessages are the error messages of prompts that don't fit the context, as worded
+// by Gemini, OpenAI and Bedrock models
+var contextLengthMessages = []string{
+	"exceeds the maximum number of tokens",
+	"context_length_exceeded",
+	"maximum context length",
+	"input is too long",
+	"prompt is too long",
+	"too many input tokens",
+}
+
+// isContextLengthError reports whether an error response rejects the prompt for its length
+func isContextLengthError(status int, body []byte) bool {
+	if status != http.StatusBadRequest && status != http.StatusRequestEntityTooLarge {
+		return false
+	}
+	body = bytes.ToLower(body)
+	for _, message := range contextLengthMessages {
+		if bytes.Contains(body, []byte(message)) {
+			return true
+		}
+	}
+	return false
+}
+
+// EstimateTokens estimates the prompt tokens of text, by its words or, for text with few word
+// breaks, by its size
+func EstimateTokens(text string) int {
+	return max(int(float64(wordcount.Count(text))*tokensPerWord), len(text)/bytesPerToken)
+}
+
+// ExceedsContext reports whether text is estimated to be past MaxInputTokens
+func (c *Client) ExceedsContext(text string) bool {
+	return c.MaxInputTokens > 0 && EstimateTokens(text) > c.MaxInputTokens
+}
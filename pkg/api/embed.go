@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+)
+
+// Embedding task types: indexed text and the queries searching it are embedded differently
+const (
+	EmbedDocument = "RETRIEVAL_DOCUMENT"
+	EmbedQuery    = "RETRIEVAL_QUERY"
+)
+
+// maxEmbedBatch is the most texts one batchEmbedContents request may carry
+const maxEmbedBatch = 100
+
+type embedRequest struct {
+	Model    string        `json:"model"`
+	Content  GeminiContent `json:"content"`
+	TaskType string        `json:"taskType"`
+}
+
+type embedResponse struct {
+	Embeddings []struct {
+		Values []float32 `json:"values"`
+	} `json:"embeddings"`
+}
+
+// Embed returns the embedding of each of texts by model, in order, for taskType (EmbedDocument or
+// EmbedQuery). Embeddings are only available from the Gemini API, not from other providers.
+func (c *Client) Embed(ctx context.Context, model, taskType string, texts []string) ([][]float32, error) {
+	if c.Provider != nil {
+		return nil, fmt.Errorf("embeddings are only supported by the Gemini API")
+	}
+	startTime := time.Now()
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += maxEmbedBatch {
+		batch := texts[start:min(start+maxEmbedBatch, len(texts))]
+		embeddings, err := c.embedBatch(ctx, model, taskType, batch)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, embeddings...)
+	}
+	reqctx.Debug(ctx).Printf("Embedded %d texts with %s in %v", len(texts), model, time.Since(startTime))
+	return vectors, nil
+}
+
+// embedBatch sends one batchEmbedContents request
+func (c *Client) embedBatch(ctx context.Context, model, taskType string, texts []string) ([][]float32, error) {
+	requests := make([]embedRequest, len(texts))
+	for i, text := range texts {
+		requests[i] = embedRequest{Model: "models/" + model, Content: GeminiContent{Parts: []GeminiPart{{Text: text}}}, TaskType: taskType}
+	}
+	body, err := json.Marshal(map[string]any{"requests": requests})
+	if err != nil {
+		return nil, fmt.Errorf("failed marshal embedding payload: %w", err)
+	}
+
+	if c.Scheduler != nil {
+		if err := c.Scheduler.Acquire(ctx); err != nil {
+			return nil, fmt.Errorf("waiting for a request slot: %w", err)
+		}
+		defer c.Scheduler.Release()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout(30*time.Second, len(body)))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url("models/"+model+":batchEmbedContents"), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed create API request: %w", err)
+	}
+	var response embedResponse
+	if err := doJSON(c.HTTPClient, req, model, &response); err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding request returned %d embeddings for %d texts", len(response.Embeddings), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for i, embedding := range response.Embeddings {
+		vectors[i] = embedding.Values
+	}
+	return vectors, nil
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// Finish reasons of generations the model stopped on its own terms
+const (
+	FinishSafety     = "SAFETY"
+	FinishRecitation = "RECITATION"
+)
+
+// ErrBlocked is returned when the model refused to generate for safety or recitation reasons
+var ErrBlocked = errors.New("generation blocked by the model")
+
+const (
+	// maxContinuations bounds how often a truncated document output is asked to go on
+	maxContinuations = 2
+	// minSplitWords is the smallest transcript chunk that is split again after a truncated output
+	minSplitWords = 50
+)
+
+const continuePrompt = "Your answer was cut off. Continue exactly where you stopped, without repeating anything or adding any introduction."
+
+// blockedError reports a generation stopped for safety or recitation, or nil for other reasons
+func blockedError(finishReason string) error {
+	if finishReason == FinishSafety || finishReason == FinishRecitation {
+		return fmt.Errorf("%w (finish reason: %s)", ErrBlocked, finishReason)
+	}
+	return nil
+}
+
+// continueTruncated asks the model to go on from a document output that hit its token limit,
+// sending payload's conversation with the partial output as the model's turn. The continuations
+// share the maxOutputTokens of payload with the partial output, so they only finish outputs the
+// model cut off below that budget, such as at its own output limit; an output that used up the
+// budget is a runaway one and is not continued. An output that is still cut off, or whose
+// continuation fails, is trimmed back to its last complete sentence.
+func (c *Client) continueTruncated(ctx context.Context, model string, payload map[string]any, result string) string {
+	logger := reqctx.Logger(ctx)
+	startTime := time.Now()
+	contents, _ := payload["contents"].([]map[string]any)
+	generationConfig, _ := payload["generationConfig"].(map[string]any)
+	budget, _ := generationConfig["maxOutputTokens"].(int)
+	for attempt := 1; attempt <= maxContinuations; attempt++ {
+		words := wordcount.Count(result)
+		remaining := budget - int(float64(words)*tokensPerWord)
+		if remaining < minOutputTokens {
+			logger.Printf("Chunk output truncated at %d words, which uses up its output budget; not continuing", words)
+			break
+		}
+		logger.Printf("Chunk output truncated at %d words, continuing (attempt %d/%d, %d tokens left)", words, attempt, maxContinuations, remaining)
+		next := maps.Clone(payload)
+		nextConfig := maps.Clone(generationConfig)
+		nextConfig["maxOutputTokens"] = remaining
+		next["generationConfig"] = nextConfig
+		conversation := make([]map[string]any, 0, len(contents)+2)
+		for _, content := range contents {
+			turn := map[string]any{"role": "user"}
+			for k, v := range content {
+				turn[k] = v
+			}
+			conversation = append(conversation, turn)
+		}
+		conversation = append(conversation,
+			map[string]any{"role": "model", "parts": []map[string]string{{"text": result}}},
+			map[string]any{"role": "user", "parts": []map[string]string{{"text": continuePrompt}}},
+		)
+		next["contents"] = conversation
+
+		response, err := c.generateContent(ctx, model, next, 0)
+		if err != nil {
+			reqctx.Warn(ctx).Printf("Continuing truncated output failed: %v", err)
+			break
+		}
+		candidate := response.Candidates[0]
+		result += candidate.Content.Parts[0].Text
+		if candidate.FinishReason != FinishMaxTokens {
+			logger.Printf("Truncated output completed in %v (%d words)", time.Since(startTime), wordcount.Count(result))
+			return result
+		}
+	}
+	reqctx.Warn(ctx).Printf("Chunk output still truncated, trimming to the last complete sentence")
+	return trimToSentence(result)
+}
+
+// processSplit handles a transcript chunk whose JSON output hit its token limit. A cut-off JSON
+// array can't be continued reliably, so the chunk is split in two (see SplitInHalf) and each half
+// is passed to process, with the turns of both joined into one array.
+func processSplit(ctx context.Context, text, mode string, process func(half string) (string, error)) (string, error) {
+	if wordcount.Count(text) < minSplitWords {
+		return "", fmt.Errorf("output truncated (%s mode) and the chunk is too small to split", mode)
+	}
+	halves := SplitInHalf(text)
+	reqctx.Logger(ctx).Printf("Transcript chunk output truncated, retrying as two halves of %d and %d words", wordcount.Count(halves[0]), wordcount.Count(halves[1]))
+
+	var outputs [2]string
+	for i, half := range halves {
+		result, err := process(half)
+		if err != nil {
+			return "", err
+		}
+		outputs[i] = result
+	}
+	return JoinHalves(mode, outputs)
+}
+
+// SplitInHalf splits a chunk in two at its middle line break, at its middle word when it is a
+// single line, or at its middle rune when it is a single word
+func SplitInHalf(text string) [2]string {
+	lines := strings.Split(text, "\n")
+	if len(lines) >= 2 {
+		return [2]string{strings.Join(lines[:len(lines)/2], "\n"), strings.Join(lines[len(lines)/2:], "\n")}
+	}
+	words := strings.Fields(text)
+	if len(words) >= 2 {
+		return [2]string{strings.Join(words[:len(words)/2], " "), strings.Join(words[len(words)/2:], " ")}
+	}
+	// A single run without spaces is cut at the rune nearest its middle
+	middle := len(text) / 2
+	for middle > 0 && !utf8.RuneStart(text[middle]) {
+		middle--
+	}
+	return [2]string{text[:middle], text[middle:]}
+}
+
+// JoinHalves joins the outputs of the two halves of a split chunk: the turns of transcript modes
+// into one JSON array, and any other output as two paragraphs
+func JoinHalves(mode string, outputs [2]string) (string, error) {
+	if mode != "transcript" && mode != "transcript_condensed" {
+		return strings.TrimSpace(outputs[0]) + "\n\n" + strings.TrimSpace(outputs[1]), nil
+	}
+	var turns []json.RawMessage
+	for _, output := range outputs {
+		var halfTurns []json.RawMessage
+		if err := json.Unmarshal([]byte(output), &halfTurns); err != nil {
+			return "", fmt.Errorf("failed decode turns of split chunk: %w", err)
+		}
+		turns = append(turns, halfTurns...)
+	}
+	merged, err := json.Marshal(turns)
+	if err != nil {
+		return "", fmt.Errorf("failed encode turns of split chunk: %w", err)
+	}
+	return string(merged), nil
+}
+
+// trimToSentence cuts text after its last sentence end or paragraph break. Text without either
+// is returned as it is.
+func trimToSentence(text string) string {
+	cut := strings.LastIndex(text, "\n\n")
+	for i := len(text) - 1; i > cut; i-- {
+		if !strings.ContainsRune(".!?", rune(text[i])) {
+			continue
+		}
+		end := i + 1
+		// Keep a closing quote or bracket with its sentence
+		for end < len(text) {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			if !strings.ContainsRune(`"')]”’`, r) {
+				break
+			}
+			end += size
+		}
+		if end == len(text) || text[end] == ' ' || text[end] == '\n' {
+			return text[:end]
+		}
+	}
+	if cut > 0 {
+		return strings.TrimRight(text[:cut], " \n")
+	}
+	return text
+}
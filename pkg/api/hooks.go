@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// RequestHook is called with every request to a model backend before it is sent, and may change
+// its headers. A returned error fails the request; a returned response is used instead of
+// sending it, e.g. to mock the backend.
+type RequestHook func(req *http.Request) (*http.Response, error)
+
+// ResponseHook is called after every request to a model backend with its response or error
+type ResponseHook func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+
+// Hooks let deployments add headers, audit logging, an egress allowlist or a mock backend to the
+// model API traffic without changing this package
+type Hooks struct {
+	OnRequest  []RequestHook
+	OnResponse []ResponseHook
+}
+
+// Transport wraps next so every request runs through the hooks. Use it as the transport of the
+// HTTP client passed to New and to the providers.
+func (h *Hooks) Transport(next http.RoundTripper) http.RoundTripper {
+	return &hookTransport{hooks: h, next: next}
+}
+
+type hookTransport struct {
+	hooks *Hooks
+	next  http.RoundTripper
+}
+
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not change its request, so hooks get a copy
+	req = req.Clone(req.Context())
+	start := time.Now()
+	var resp *http.Response
+	var err error
+	for _, hook := range t.hooks.OnRequest {
+		if resp, err = hook(req); resp != nil || err != nil {
+			break
+		}
+	}
+	if resp == nil && err == nil {
+		resp, err = t.next.RoundTrip(req)
+	}
+	for _, hook := range t.hooks.OnResponse {
+		hook(req, resp, err, time.Since(start))
+	}
+	return resp, err
+}
+
+// HeaderHook sets headers on every request, e.g. for an API gateway in front of the backend
+func HeaderHook(headers http.Header) RequestHook {
+	return func(req *http.Request) (*http.Response, error) {
+		for name, values := range headers {
+			req.Header[name] = slices.Clone(values)
+		}
+		return nil, nil
+	}
+}
+
+// AllowHostsHook fails requests to any host not in hosts
+func AllowHostsHook(hosts []string) RequestHook {
+	return func(req *http.Request) (*http.Response, error) {
+		if !slices.Contains(hosts, strings.ToLower(req.URL.Hostname())) {
+			return nil, fmt.Errorf("egress to %s is not allowed", req.URL.Hostname())
+		}
+		return nil, nil
+	}
+}
+
+// auditEntry is one line of the audit log. Bodies are never logged, as they hold the documents.
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Status    int       `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ElapsedMs int64     `json:"elapsed_ms"`
+}
+
+// AuditHook writes a JSON line per request to w, with the URL scrubbed of API keys
+func AuditHook(w io.Writer) ResponseHook {
+	var mu sync.Mutex
+	return func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+		entry := auditEntry{Time: time.Now().UTC(), Method: req.Method, URL: logging.Scrub(req.URL.String()), ElapsedMs: elapsed.Milliseconds()}
+		if resp != nil {
+			entry.Status = resp.StatusCode
+		}
+		if err != nil {
+			entry.Error = logging.Scrub(err.Error())
+		}
+		line, _ := json.Marshal(entry)
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(append(line, '\n'))
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import "strings"
+
+// languages maps the ISO 639-1 codes of the translation targets to the English names used in the
+// translation prompt.
+var languages = map[string]string{
+	"ar": "Arabic",
+	"bg": "Bulgarian",
+	"bn": "Bengali",
+	"ca": "Catalan",
+	"cs": "Czech",
+	"da": "Danish",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"et": "Estonian",
+	"fa": "Persian",
+	"fi": "Finnish",
+	"fr": "French",
+	"gu": "Gujarati",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"hr": "Croatian",
+	"hu": "Hungarian",
+	"id": "Indonesian",
+	"it": "Italian",
+	"ja": "Japanese",
+	"kn": "Kannada",
+	"ko": "Korean",
+	"lt": "Lithuanian",
+	"lv": "Latvian",
+	"ml": "Malayalam",
+	"mr": "Marathi",
+	"ms": "Malay",
+	"nl": "Dutch",
+	"no": "Norwegian",
+	"pa": "Punjabi",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ro": "Romanian",
+	"ru": "Russian",
+	"sk": "Slovak",
+	"sl": "Slovenian",
+	"sr": "Serbian",
+	"sv": "Swedish",
+	"sw": "Swahili",
+	"ta": "Tamil",
+	"te": "Telugu",
+	"th": "Thai",
+	"tl": "Tagalog",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"ur": "Urdu",
+	"vi": "Vietnamese",
+	"zh": "Chinese",
+}
+
+// LanguageName returns the English name of a translation target given as an ISO 639-1 code
+// ("de", or a regional "pt-BR") or as the name itself, matched case-insensitively. Unknown
+// languages report false.
+func LanguageName(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	code, _, _ := strings.Cut(strings.ReplaceAll(value, "_", "-"), "-")
+	if name, ok := languages[strings.ToLower(code)]; ok {
+		return name, true
+	}
+	for _, name := range languages {
+		if strings.EqualFold(name, value) {
+			return name, true
+		}
+	}
+	return "", false
+}
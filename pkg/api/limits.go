@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// Output limits of chunk calls. An English word is about 1.4 tokens, and the limit leaves room
+// for twice the target so only runaway generations are cut off.
+const (
+	tokensPerWord   = 1.4
+	outputHeadroom  = 2.0
+	minOutputTokens = 256
+	// oversizeFactor is how far past its target a chunk output may run before it is flagged
+	oversizeFactor = 1.5
+)
+
+// FinishMaxTokens is the finish reason of a generation cut off by maxOutputTokens
+const FinishMaxTokens = "MAX_TOKENS"
+
+// documentStopSequences end a document generation that starts repeating the prompt's
+// delimiters, which is how runaway outputs usually begin
+var documentStopSequences = []string{"--- TEXT TO CONDENSE"}
+
+// maxOutputTokens is the output token limit of a chunk call. Full transcript cleanup keeps nearly
+// every word, so its limit follows the input rather than the target, and transcript modes answer
+// in JSON, which about doubles the tokens per word.
+func maxOutputTokens(mode string, targetWordCount, inputWordCount int) int {
+	words := targetWordCount
+	if mode == "transcript" {
+		words = max(words, inputWordCount)
+	}
+	tokens := float64(words) * tokensPerWord * outputHeadroom
+	if mode == "transcript" || mode == "transcript_condensed" {
+		tokens *= 2
+	}
+	return max(int(tokens), minOutputTokens)
+}
+
+// checkOutputSize logs and counts chunk outputs that hit the token limit or run well past their
+// target. Full transcript cleanup has no meaningful target, so only the limit is checked there.
+func checkOutputSize(ctx context.Context, mode string, targetWordCount int, result, finishReason string) {
+	words := wordcount.Count(result)
+	truncated := finishReason == FinishMaxTokens
+	oversize := mode != "transcript" && float64(words) > float64(targetWordCount)*oversizeFactor
+	if !truncated && !oversize {
+		return
+	}
+	reqctx.Warn(ctx).Printf("Oversize chunk output (%s mode): %d words for a target of %d (finish reason: %s)", mode, words, targetWordCount, finishReason)
+	metrics.RecordOversize(ctx)
+}
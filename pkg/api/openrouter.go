@@ -3,42 +3,60 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
 )
 
 // GeminiResponse struct remains the same
-type GeminiResponse struct { // ... (keep struct definition) ...
-	Candidates []struct {
-		Content struct {
-			Parts []struct {
-				Text string `json:"text"`
-			} `json:"parts"`
-			Role string `json:"role"`
-		} `json:"content"`
-		FinishReason string  `json:"finishReason"`
-		AvgLogprobs  float64 `json:"avgLogprobs"`
-	} `json:"candidates"`
-	UsageMetadata struct {
-		PromptTokenCount     int `json:"promptTokenCount"`
-		CandidatesTokenCount int `json:"candidatesTokenCount"`
-		TotalTokenCount      int `json:"totalTokenCount"`
-	} `json:"usageMetadata"`
-	ModelVersion string `json:"modelVersion"`
+type GeminiResponse struct {
+	Candidates    []GeminiCandidate `json:"candidates"`
+	UsageMetadata GeminiUsage       `json:"usageMetadata"`
+	ModelVersion  string            `json:"modelVersion"`
+}
+
+// GeminiCandidate is one generated answer
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason"`
+	AvgLogprobs  float64       `json:"avgLogprobs"`
+}
+
+// GeminiContent is one turn of a conversation, in requests and responses
+type GeminiContent struct {
+	Parts []GeminiPart `json:"parts"`
+	Role  string       `json:"role,omitempty"`
+}
+
+// GeminiPart is a text part of a GeminiContent
+type GeminiPart struct {
+	Text string `json:"text"`
+}
+
+// GeminiUsage is the token counts of a generation
+type GeminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
 }
 
 // AnalyzeSpeakers remains the same (returns raw analysis string)
-func AnalyzeSpeakers(ctx context.Context, fullText, apiKey string) (string, error) {
+func (c *Client) AnalyzeSpeakers(ctx context.Context, fullText string) (string, error) {
+	logger := reqctx.Logger(ctx)
 	// ... (Keep implementation the same) ...
 	startTime := time.Now()
-	log.Printf("Starting speaker analysis for text of %d words", len(strings.Fields(fullText)))
+	if analysis, ok := c.SpeakerCache.Get(fullText); ok {
+		logger.Printf("Using cached speaker analysis for text of %d words", wordcount.Count(fullText))
+		return analysis, nil
+	}
+	logger.Printf("Starting speaker analysis for text of %d words", wordcount.Count(fullText))
 
 	analysisPrompt := `Analyze the following podcast transcript to identify the speakers. Provide the following information in a clear, concise list format:
 1. Total number of distinct speakers detected.
@@ -64,152 +82,849 @@ Return ONLY the analysis result using this exact format:
 		"contents": []map[string]any{{"parts": []map[string]string{{"text": fmt.Sprintf(analysisPrompt, fullText)}}}},
 		// Optional generationConfig
 	}
-	body, err := json.Marshal(payload)
+	response, err := c.generateContent(ctx, "gemini-2.0-flash", payload, 90*time.Second)
 	if err != nil {
-		return "", fmt.Errorf("failed marshal analysis payload: %w", err)
+		return "", fmt.Errorf("analysis API request failed: %w", err)
 	}
 
-	apiURL := "https://generativelanguage.googleapis.com/v1beta/models/models/gemini-2.0-flash:generateContent?key=" + apiKey // Or your preferred model
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(body))
-	if err != nil {
-		return "", fmt.Errorf("failed create analysis request: %w", err)
+	analysisResult := response.Candidates[0].Content.Parts[0].Text
+	c.SpeakerCache.Put(fullText, analysisResult)
+	logger.Printf("Successfully completed speaker analysis in %v.", time.Since(startTime))
+	return analysisResult, nil
+}
+
+// ProcessTextWithMode processes one chunk of inputWordCount words with the given model. The speaker role->name map is only used in transcript modes.
+func (c *Client) ProcessTextWithMode(ctx context.Context, text, model string, inputWordCount, targetWordCount int, mode string, speakerRoleNameMap map[string]string) (string, error) {
+	logger := reqctx.Debug(ctx)
+	startTime := time.Now()
+	logger.Printf("Processing text chunk (mode: %s, model: %s, %d words, target: %d)", mode, model, inputWordCount, targetWordCount)
+
+	prompt := BuildInstructions(mode, targetWordCount, speakerRoleNameMap, OverridesFrom(ctx)) + "\n\n" + chunkSection(mode, text)
+
+	payload := map[string]any{
+		"contents":         []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": chunkGenerationConfig(mode, targetWordCount, inputWordCount),
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 90 * time.Second}
-	resp, err := client.Do(req)
+	response, err := c.generateContent(ctx, model, payload, 0)
 	if err != nil {
-		return "", fmt.Errorf("analysis API request failed: %w", err)
+		return "", fmt.Errorf("API request failed (%s mode): %w", mode, err)
+	}
+	candidate := response.Candidates[0]
+	if err := blockedError(candidate.FinishReason); err != nil {
+		return "", fmt.Errorf("API request failed (%s mode): %w", mode, err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		respBodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("analysis API non-OK status: %s. Body: %s", resp.Status, string(respBodyBytes))
+	result := candidate.Content.Parts[0].Text
+	checkOutputSize(ctx, mode, targetWordCount, result, candidate.FinishReason)
+	if candidate.FinishReason == FinishMaxTokens {
+		if mode == "transcript" || mode == "transcript_condensed" {
+			return processSplit(ctx, text, mode, func(half string) (string, error) {
+				return c.ProcessTextWithMode(ctx, half, model, wordcount.Count(half), max(targetWordCount/2, 1), mode, speakerRoleNameMap)
+			})
+		}
+		result = c.continueTruncated(ctx, model, payload, result)
 	}
+	outputWordCount := wordcount.Count(result)
+	logger.Printf("API call successful (%s mode). Result: %d words. Time: %v", mode, outputWordCount, time.Since(startTime))
+	return result, nil
+}
+
+// wholeInputPrompt rewords the chunk prompt for an input small enough to go to the model in
+// one call, so it isn't framed as a piece of something larger
+var wholeInputPrompt = strings.NewReplacer(
+	"You are processing a chunk of subtitles from a podcast. Your task is to format this chunk as a clean, readable transcript segment",
+	"You are processing the complete subtitles of a short podcast. Your task is to format them as a clean, readable transcript",
+	"Return ONLY the JSON array for THIS CHUNK.", "Return ONLY the JSON array for the whole transcript.",
+	"Condense this chunk to approximately", "Condense the transcript to approximately",
+	"Condense this text to approximately", "Condense this complete document to approximately",
+)
+
+// ProcessWhole is ProcessTextWithMode for an input that is processed in a single call rather
+// than chunked
+func (c *Client) ProcessWhole(ctx context.Context, text, model string, targetWordCount int, mode string, speakerRoleNameMap map[string]string) (string, error) {
+	logger := reqctx.Debug(ctx)
+	startTime := time.Now()
+	inputWordCount := wordcount.Count(text)
+	logger.Printf("Processing whole input in one call (mode: %s, model: %s, %d words, target: %d)", mode, model, inputWordCount, targetWordCount)
 
-	var response GeminiResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed decode analysis response: %w", err)
+	section := chunkSection(mode, text)
+	if mode == "transcript" || mode == "transcript_condensed" {
+		section = fmt.Sprintf("--- SUBTITLES START ---\n%s\n--- SUBTITLES END ---\n\nJSON Output:", text)
 	}
-	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no content in analysis response")
+	prompt := wholeInputPrompt.Replace(BuildInstructions(mode, targetWordCount, speakerRoleNameMap, OverridesFrom(ctx))) + "\n\n" + section
+
+	payload := map[string]any{
+		"contents":         []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": chunkGenerationConfig(mode, targetWordCount, inputWordCount),
 	}
 
-	analysisResult := response.Candidates[0].Content.Parts[0].Text
-	log.Printf("Successfully completed speaker analysis in %v.", time.Since(startTime))
-	return analysisResult, nil
+	response, err := c.generateContent(ctx, model, payload, 0)
+	if err != nil {
+		return "", fmt.Errorf("API request failed (%s mode, whole input): %w", mode, err)
+	}
+	candidate := response.Candidates[0]
+	if err := blockedError(candidate.FinishReason); err != nil {
+		return "", fmt.Errorf("API request failed (%s mode, whole input): %w", mode, err)
+	}
+
+	result := candidate.Content.Parts[0].Text
+	checkOutputSize(ctx, mode, targetWordCount, result, candidate.FinishReason)
+	if candidate.FinishReason == FinishMaxTokens {
+		if mode == "transcript" || mode == "transcript_condensed" {
+			return processSplit(ctx, text, mode, func(half string) (string, error) {
+				return c.ProcessTextWithMode(ctx, half, model, wordcount.Count(half), max(targetWordCount/2, 1), mode, speakerRoleNameMap)
+			})
+		}
+		result = c.continueTruncated(ctx, model, payload, result)
+	}
+	logger.Printf("API call successful (%s mode, whole input). Result: %d words. Time: %v", mode, wordcount.Count(result), time.Since(startTime))
+	return result, nil
 }
 
-// --- ProcessTextWithMode --- NOW ACCEPTS speakerRoleNameMap map[string]string ---
-func ProcessTextWithMode(ctx context.Context, text, apiKey string, targetWordCount int, mode string, speakerRoleNameMap map[string]string) (string, error) { // Changed last param
-	startTime := time.Now()
-	inputWordCount := len(strings.Fields(text))
-	log.Printf("Processing text chunk (mode: %s, %d words, target: %d)", mode, inputWordCount, targetWordCount)
+// Styles describes the language of each writing style chunk output can be asked for. The
+// default "simple" style keeps the original prompts.
+var Styles = map[string]string{
+	"simple":       "extremely simple English with basic vocabulary (like for a 10-year-old)",
+	"professional": "clear, professional English suitable for business readers",
+	"academic":     "precise, formal English that keeps technical terms",
+}
+
+// BuildInstructions returns the instruction part of the chunk prompt, in the style and (for
+// documents) format of overrides. It is identical for every chunk of a job, which is what makes
+// it cacheable across chunk calls.
+func BuildInstructions(mode string, targetWordCount int, speakerRoleNameMap map[string]string, overrides Overrides) string {
+	styleDescription := ""
+	if overrides.Style != "" && overrides.Style != "simple" {
+		styleDescription = Styles[overrides.Style]
+	}
 
-	var prompt string
-	if mode == "transcript" {
+	if mode == "transcript" || mode == "transcript_condensed" {
 		// --- NEW DYNAMIC TRANSCRIPT PROMPT USING THE MAP ---
 		var speakerMappingInstructions string
 		if len(speakerRoleNameMap) > 0 {
 			var instructions []string
 			instructions = append(instructions, "Use this mapping to identify speakers:")
-			for role, name := range speakerRoleNameMap {
-				instructions = append(instructions, fmt.Sprintf("- If you identify '%s', use the name '%s'.", role, name))
+			// Sorted so the prompt is identical across chunks and runs (needed for caching and replay)
+			roles := make([]string, 0, len(speakerRoleNameMap))
+			for role := range speakerRoleNameMap {
+				roles = append(roles, role)
+			}
+			sort.Strings(roles)
+			for _, role := range roles {
+				instructions = append(instructions, fmt.Sprintf("- If you identify '%s', use the name '%s'.", role, speakerRoleNameMap[role]))
 			}
 			// Add instruction for unknown speakers? Or tell it to guess? Let's try being strict.
 			instructions = append(instructions, "- If a speaker doesn't match a role above, try to use their name if explicitly mentioned in the text.")
 			instructions = append(instructions, "- If no name is clear for a turn, label it 'Unknown Speaker'.") // Or omit? Let's try omit first.
 			speakerMappingInstructions = strings.Join(instructions, "\n")
 		} else {
-			log.Printf("Warning: Processing transcript chunk without speaker map.")
+			// The caller logs once per job that no speaker map is available
 			speakerMappingInstructions = "Speaker identification information is unavailable. Use speaker names if clearly mentioned in the text, otherwise label speakers generically (e.g., 'Speaker 1', 'Speaker 2')."
 		}
 
-		prompt = fmt.Sprintf(`You are processing a chunk of subtitles from a podcast. Your task is to format this chunk as a clean, readable transcript segment using extremely simple English (like for a 10-year-old).
+		// Full-length cleanup keeps nearly everything; the condensed track trims to the target
+		lengthConstraint := "- Do not shortern the length a lot"
+		if mode == "transcript_condensed" {
+			lengthConstraint = fmt.Sprintf("- Condense this chunk to approximately %d words, keeping every key point and who said it.\n- Drop filler, repetition, and small talk.", targetWordCount)
+		}
+
+		languageIntro, languageRule := "extremely simple English (like for a 10-year-old)", "very simple English, basic vocabulary only"
+		if styleDescription != "" {
+			languageIntro, languageRule = styleDescription, styleDescription
+		}
+
+		return fmt.Sprintf(`You are processing a chunk of subtitles from a podcast. Your task is to format this chunk as a clean, readable transcript segment using %s.
 
 **SPEAKER IDENTIFICATION RULES:**
 %s
 
 **FORMATTING RULES:**
-1. Use very simple English, basic vocabulary only.
+1. Use %s.
 2. Slightly improve grammar, spelling, and sentence structure for readability, but keep the meaning identical to the original subtitles.
-3. Format the output strictly line-by-line, starting each line ONLY with the speaker's correct NAME followed by a colon.
+3. Return a JSON array with one object per speaker turn, in order: {"speaker": NAME, "text": simplified speech}.
    Example:
-   Shandon: [Simplified speech]
-   Nikil Vora: [Simplified speech]
-   Chirag: [Simplified speech]
+   [{"speaker": "Shandon", "text": "[Simplified speech]"}, {"speaker": "Nikil Vora", "text": "[Simplified speech]"}]
+   If the subtitles have timings (like "00:01:02,500 --> 00:01:05,000"), also set "start" to the start time of the turn's first subtitle and "end" to the end time of its last one, copied exactly as written.
 
 **IMPORTANT CONSTRAINTS:**
-- Return ONLY the formatted transcript lines for THIS CHUNK. Each line MUST start with a speaker's NAME followed by a colon.
+- Return ONLY the JSON array for THIS CHUNK. Every object MUST have the speaker's NAME in "speaker".
 - Do NOT include roles (like "Host", "Guest 1"). Use ONLY the names provided in the mapping or identified directly.
-- Do not shortern the length a lot
+%s
 - Do NOT add introductions, summaries, explanations, or comments.
-- Do NOT repeat the speaker identification rules in your response.
+- Do NOT repeat the speaker identification rules in your response.`, languageIntro, speakerMappingInstructions, languageRule, lengthConstraint) // Use the map instructions
+	}
 
---- CURRENT CHUNK START ---
+	// document mode
+	language := "extremely simple English with basic vocabulary (like for a 10-year-old)"
+	if styleDescription != "" {
+		language = styleDescription
+	}
+	shape := "- Maintaining the original narration style as much as possible."
+	if overrides.Format == FormatBullets {
+		shape = "- Writing hierarchical bullet points instead of prose: under each heading, one \"- \" item per key point, with supporting details as nested items indented by two spaces. Never write paragraphs."
+	}
+	return fmt.Sprintf(`Condense this text to approximately %d words while:
+- Preserving all key plot points and essential information and data.
+- Using %s.
 %s
---- CURRENT CHUNK END ---
+- If you identify any headings in the text, format them as "# Heading" on their own line in markdown style.
+- Keeping bullet and numbered lists as lists, one item per line; never rewrite a list as prose.
+- Keeping every placeholder like [[CODE_1]] or [[MATH_1]] exactly as written, in the place it belongs.
+- Keeping citation markers such as [12], [^3] or (Smith, 2020) attached to the sentence they support; drop a marker only together with its sentence.
+- Keeping references to figures and tables (e.g. "as shown in Figure 3") so they still match the captions.
 
-Formatted Output:`, speakerMappingInstructions, text) // Use the map instructions
-		// --- END NEW PROMPT ---
+Important: Return ONLY the condensed text without any introductions, explanations, or summaries.`, targetWordCount, language, shape)
+}
 
-	} else { // document mode (prompt remains the same)
-		prompt = fmt.Sprintf(`Condense this text to approximately %d words while:
-- Preserving all key plot points and essential information and data.
-- Using extremely simple English with basic vocabulary (like for a 10-year-old).
-- Maintaining the original narration style as much as possible.
-- If you identify any headings in the text, format them as "# Heading" on their own line in markdown style.
+// transcriptTurnSchema constrains transcript chunk output to an array of {speaker, text} turns,
+// with the optional subtitle timings of each turn
+var transcriptTurnSchema = map[string]any{
+	"type": "ARRAY",
+	"items": map[string]any{
+		"type": "OBJECT",
+		"properties": map[string]any{
+			"speaker": map[string]any{"type": "STRING"},
+			"text":    map[string]any{"type": "STRING"},
+			"start":   map[string]any{"type": "STRING"},
+			"end":     map[string]any{"type": "STRING"},
+		},
+		"required": []string{"speaker", "text"},
+	},
+}
+
+// chunkGenerationConfig returns the generation settings for chunk calls. Transcript modes
+// use structured JSON output so turns can be decoded instead of parsed from free text. Every
+// mode gets an output token limit from its target, and documents get stop sequences.
+func chunkGenerationConfig(mode string, targetWordCount, inputWordCount int) map[string]any {
+	generationConfig := map[string]any{
+		"temperature":     0.4, // Adjust as needed
+		"maxOutputTokens": maxOutputTokens(mode, targetWordCount, inputWordCount),
+	}
+	if mode == "transcript" || mode == "transcript_condensed" {
+		generationConfig["responseMimeType"] = "application/json"
+		generationConfig["responseSchema"] = transcriptTurnSchema
+	} else {
+		generationConfig["stopSequences"] = documentStopSequences
+	}
+	return generationConfig
+}
+
+// chunkSection wraps a chunk in the delimiters the instructions refer to
+func chunkSection(mode, text string) string {
+	if mode == "transcript" || mode == "transcript_condensed" {
+		return fmt.Sprintf("--- CURRENT CHUNK START ---\n%s\n--- CURRENT CHUNK END ---\n\nJSON Output:", text)
+	}
+	return fmt.Sprintf("--- TEXT TO CONDENSE START ---\n%s\n--- TEXT TO CONDENSE END ---\n\nCondensed Text:", text)
+}
 
-Important: Return ONLY the condensed text without any introductions, explanations, or summaries.
+// SummarizeBySpeaker builds a per-speaker summary from a combined transcript with model.
+// The role->name map tells the model who the host and guests are.
+func (c *Client) SummarizeBySpeaker(ctx context.Context, model, combinedTranscript string, speakerRoleNameMap map[string]string) (string, error) {
+	logger := reqctx.Logger(ctx)
+	startTime := time.Now()
+	logger.Printf("Starting per-speaker summary for transcript of %d words", wordcount.Count(combinedTranscript))
+
+	var speakerLines []string
+	for role, name := range speakerRoleNameMap {
+		speakerLines = append(speakerLines, fmt.Sprintf("- %s: %s", role, name))
+	}
+	speakerList := "Speaker roles are unknown. Infer the host (the one asking questions) and guests from the transcript."
+	if len(speakerLines) > 0 {
+		sort.Strings(speakerLines)
+		speakerList = strings.Join(speakerLines, "\n")
+	}
 
---- TEXT TO CONDENSE START ---
+	prompt := fmt.Sprintf(`You are given a cleaned podcast transcript. Write a summary organized by speaker using extremely simple English (like for a 10-year-old).
+
+**SPEAKERS (role: name):**
+%s
+
+**OUTPUT RULES:**
+1. For the host, write a section with the heading "# [Name]'s key questions" followed by a bullet list of the main questions they asked.
+2. For each guest, write a section with the heading "# What [Name] argued" followed by a bullet list of their main points and claims.
+3. Use the speaker NAMES in headings, not roles (like "Host", "Guest 1") unless no name is known.
+4. Only include what the speaker actually said in the transcript. Do not guess.
+
+Important: Return ONLY the sections without any introductions, explanations, or closing remarks.
+
+--- TRANSCRIPT START ---
 %s
---- TEXT TO CONDENSE END ---
+--- TRANSCRIPT END ---
+
+Summary:`, speakerList, combinedTranscript)
 
-Condensed Text:`, targetWordCount, text)
+	payload := map[string]any{
+		"contents":         []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": map[string]any{"temperature": 0.3},
+	}
+
+	response, err := c.generateContent(ctx, model, payload, 90*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("speaker summary failed: %w", err)
+	}
+
+	result := response.Candidates[0].Content.Parts[0].Text
+	logger.Printf("Successfully completed per-speaker summary in %v. Result: %d words", time.Since(startTime), wordcount.Count(result))
+	return result, nil
+}
+
+// ExecutiveSummary writes a one-paragraph executive summary of an already condensed document
+// with model
+func (c *Client) ExecutiveSummary(ctx context.Context, model, condensed string) (string, error) {
+	logger := reqctx.Logger(ctx)
+	startTime := time.Now()
+	logger.Printf("Starting executive summary of %d words", wordcount.Count(condensed))
+
+	language := "clear, professional English suitable for business readers"
+	if style := OverridesFrom(ctx).Style; style != "" {
+		language = Styles[style]
 	}
+	prompt := fmt.Sprintf(`Write an executive summary of the following document: ONE paragraph of 80 to 150 words using %s.
+
+**RULES:**
+- Lead with the main conclusion or purpose, then the most important findings, numbers and decisions.
+- Only use information in the document. Do not add opinions or recommendations it doesn't make.
+- Write in the same language as the document.
+- Return ONLY the paragraph, without a heading, introduction or closing remarks.
+
+--- DOCUMENT START ---
+%s
+--- DOCUMENT END ---
+
+Executive summary:`, language, condensed)
 
 	payload := map[string]any{
 		"contents":         []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
-		"generationConfig": map[string]any{"temperature": 0.4}, // Adjust as needed
+		"generationConfig": map[string]any{"temperature": 0.3},
 	}
 
-	body, err := json.Marshal(payload)
+	response, err := c.generateContent(ctx, model, payload, 90*time.Second)
 	if err != nil {
-		return "", fmt.Errorf("failed marshal API payload: %w", err)
+		return "", fmt.Errorf("executive summary failed: %w", err)
+	}
+
+	result := strings.TrimSpace(response.Candidates[0].Content.Parts[0].Text)
+	logger.Printf("Successfully completed executive summary in %v. Result: %d words", time.Since(startTime), wordcount.Count(result))
+	return result, nil
+}
+
+// Answer is a reply to a question about a document with the passages it is based on
+type Answer struct {
+	Text string `json:"answer"`
+	// Citations are the numbers of the passages the answer uses
+	Citations []int `json:"citations"`
+}
+
+// answerSchema constrains answers to {answer, citations}
+var answerSchema = map[string]any{
+	"type": "OBJECT",
+	"properties": map[string]any{
+		"answer":    map[string]any{"type": "STRING"},
+		"citations": map[string]any{"type": "ARRAY", "items": map[string]any{"type": "INTEGER"}},
+	},
+	"required": []string{"answer", "citations"},
+}
+
+// AnswerQuestion answers a question from the given passages of a document only, keyed by their
+// passage number, citing the passages it uses. The answer is written with model.
+func (c *Client) AnswerQuestion(ctx context.Context, model, question string, passages map[int]string) (Answer, error) {
+	logger := reqctx.Logger(ctx)
+	startTime := time.Now()
+	logger.Printf("Answering question from %d passages", len(passages))
+
+	numbers := make([]int, 0, len(passages))
+	for number := range passages {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	var excerpts strings.Builder
+	for _, number := range numbers {
+		fmt.Fprintf(&excerpts, "[%d] %s\n\n", number, passages[number])
+	}
+
+	prompt := fmt.Sprintf(`Answer the question using ONLY the numbered passages from a document below.
+
+**RULES:**
+- Answer in a few clear sentences, in the language of the question.
+- Cite the passages you use by their numbers, like [3], right after the statement they support, and list the numbers in "citations".
+- If the passages don't contain the answer, say that the document doesn't say, and return no citations. Do not use outside knowledge.
+- Return a JSON object: {"answer": string, "citations": [number]}.
+
+--- PASSAGES START ---
+%s--- PASSAGES END ---
+
+Question: %s`, excerpts.String(), question)
+
+	payload := map[string]any{
+		"contents": []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": map[string]any{
+			"temperature":      0.2,
+			"responseMimeType": "application/json",
+			"responseSchema":   answerSchema,
+		},
 	}
 
-	apiURL := "https://generativelanguage.googleapis.com/v1beta/models/gemini-1.5-flash:generateContent?key=" + apiKey // Use appropriate model
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(body))
+	response, err := c.generateContent(ctx, model, payload, 60*time.Second)
 	if err != nil {
-		return "", fmt.Errorf("failed create API request: %w", err)
+		return Answer{}, fmt.Errorf("question answering failed: %w", err)
+	}
+
+	var answer Answer
+	if err := json.Unmarshal([]byte(response.Candidates[0].Content.Parts[0].Text), &answer); err != nil {
+		return Answer{}, fmt.Errorf("failed decode answer: %w", err)
+	}
+	// Only passages that were given can be cited
+	cited := answer.Citations[:0]
+	for _, number := range answer.Citations {
+		if _, ok := passages[number]; ok && !slices.Contains(cited, number) {
+			cited = append(cited, number)
+		}
 	}
-	req.Header.Set("Content-Type", "application/json")
+	answer.Citations = cited
+	logger.Printf("Answered question in %v with %d citations", time.Since(startTime), len(answer.Citations))
+	return answer, nil
+}
+
+// DocumentComparison is a comparative summary of several documents, which it refers to by their
+// number from 1 in the order they were given
+type DocumentComparison struct {
+	Agreements  []string       `json:"agreements"`
+	Differences []string       `json:"differences"`
+	Unique      []UniquePoints `json:"unique"`
+}
+
+// UniquePoints are the points only one of the compared documents makes
+type UniquePoints struct {
+	Document int      `json:"document"`
+	Points   []string `json:"points"`
+}
+
+// comparisonSchema constrains comparisons to {agreements, differences, unique}
+var comparisonSchema = map[string]any{
+	"type": "OBJECT",
+	"properties": map[string]any{
+		"agreements":  map[string]any{"type": "ARRAY", "items": map[string]any{"type": "STRING"}},
+		"differences": map[string]any{"type": "ARRAY", "items": map[string]any{"type": "STRING"}},
+		"unique": map[string]any{
+			"type": "ARRAY",
+			"items": map[string]any{
+				"type": "OBJECT",
+				"properties": map[string]any{
+					"document": map[string]any{"type": "INTEGER"},
+					"points":   map[string]any{"type": "ARRAY", "items": map[string]any{"type": "STRING"}},
+				},
+				"required": []string{"document", "points"},
+			},
+		},
+	},
+	"required": []string{"agreements", "differences", "unique"},
+}
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
+// CompareDocuments summarizes what the given documents agree on, where they differ and what
+// only one of them says, with model
+func (c *Client) CompareDocuments(ctx context.Context, model string, docs []string) (DocumentComparison, error) {
+	logger := reqctx.Logger(ctx)
+	startTime := time.Now()
+	logger.Printf("Comparing %d documents", len(docs))
+
+	var documents strings.Builder
+	for i, doc := range docs {
+		fmt.Fprintf(&documents, "--- DOCUMENT %d START ---\n%s\n--- DOCUMENT %d END ---\n\n", i+1, strings.TrimSpace(doc), i+1)
+	}
+
+	prompt := fmt.Sprintf(`Compare the %d numbered documents below for an analyst reading them side by side.
+
+**RULES:**
+- "agreements": points that all of the documents make, each stated once.
+- "differences": points the documents treat differently, such as conflicting figures, conclusions or recommendations. Say what each document says and name them as "Document 1", "Document 2" and so on.
+- "unique": for each document, the important points none of the others make. Leave a document out when it has none.
+- One short sentence per point, in extremely simple English (like for a 10-year-old). Only use what the documents say.
+- Return a JSON object: {"agreements": [string], "differences": [string], "unique": [{"document": number, "points": [string]}]}.
+
+%s`, len(docs), documents.String())
+
+	payload := map[string]any{
+		"contents": []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": map[string]any{
+			"temperature":      0.2,
+			"responseMimeType": "application/json",
+			"responseSchema":   comparisonSchema,
+		},
+	}
+
+	response, err := c.generateContent(ctx, model, payload, 120*time.Second)
 	if err != nil {
-		return "", fmt.Errorf("API request failed (%s mode): %w", mode, err)
+		return DocumentComparison{}, fmt.Errorf("document comparison failed: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		respBodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("API non-OK status (%s mode): %s. Body: %s", mode, resp.Status, string(respBodyBytes))
-		return "", fmt.Errorf("API request failed (%s mode): %s", mode, resp.Status)
+	var comparison DocumentComparison
+	if err := json.Unmarshal([]byte(response.Candidates[0].Content.Parts[0].Text), &comparison); err != nil {
+		return DocumentComparison{}, fmt.Errorf("failed decode comparison: %w", err)
+	}
+	// Only documents that were given can have unique points
+	unique := make([]UniquePoints, 0, len(comparison.Unique))
+	for _, points := range comparison.Unique {
+		if points.Document >= 1 && points.Document <= len(docs) && len(points.Points) > 0 {
+			unique = append(unique, points)
+		}
+	}
+	comparison.Unique = unique
+	if comparison.Agreements == nil {
+		comparison.Agreements = []string{}
 	}
+	if comparison.Differences == nil {
+		comparison.Differences = []string{}
+	}
+	logger.Printf("Compared %d documents in %v: %d agreements, %d differences", len(docs), time.Since(startTime), len(comparison.Agreements), len(comparison.Differences))
+	return comparison, nil
+}
+
+// OutlineEntry is the title and one-line gist of one section of a document
+type OutlineEntry struct {
+	Title string `json:"title"`
+	Gist  string `json:"gist"`
+}
 
-	var response GeminiResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed decode API response (%s mode): %w", mode, err)
+// OutlineSection writes the one-line gist of a section from its opening text with model. With an
+// empty title the model also names the section.
+func (c *Client) OutlineSection(ctx context.Context, model, title, excerpt string) (OutlineEntry, error) {
+	logger := reqctx.Debug(ctx)
+	startTime := time.Now()
+	logger.Printf("Outlining section %q (%d words)", title, wordcount.Count(excerpt))
+
+	titleRule := fmt.Sprintf(`- "title" is the section heading %q, returned unchanged.`, title)
+	if title == "" {
+		titleRule = `- "title" is a short heading of at most 6 words for this part of the document.`
+	}
+	prompt := fmt.Sprintf(`Below is the start of one section of a document. Describe what the section is about.
+
+**RULES:**
+%s
+- "gist" is ONE sentence of at most 25 words in extremely simple English (like for a 10-year-old) saying what the section covers or concludes.
+- Only use information in the text.
+- Return a JSON object: {"title": string, "gist": string}.
+
+--- SECTION START ---
+%s
+--- SECTION END ---`, titleRule, excerpt)
+
+	payload := map[string]any{
+		"contents": []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": map[string]any{
+			"temperature":      0.2,
+			"responseMimeType": "application/json",
+		},
+	}
+
+	response, err := c.generateContent(ctx, model, payload, 30*time.Second)
+	if err != nil {
+		return OutlineEntry{}, fmt.Errorf("outline of section %q failed: %w", title, err)
 	}
-	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no content in API response (%s mode)", mode)
+
+	var entry OutlineEntry
+	if err := json.Unmarshal([]byte(response.Candidates[0].Content.Parts[0].Text), &entry); err != nil {
+		return OutlineEntry{}, fmt.Errorf("failed decode outline entry: %w", err)
+	}
+	logger.Printf("Outlined section %q in %v", title, time.Since(startTime))
+	return entry, nil
+}
+
+// ToneTag is the sentiment/tone label pair for one speaker turn
+type ToneTag struct {
+	Index     int    `json:"index"`
+	Sentiment string `json:"sentiment"`
+	Tone      string `json:"tone"`
+}
+
+// TagTones labels each "Speaker: text" turn with a sentiment and tone using model.
+// The returned slice has one entry per input turn, in order; turns the model skipped are left empty.
+func (c *Client) TagTones(ctx context.Context, model string, turns []string) ([]ToneTag, error) {
+	logger := reqctx.Logger(ctx)
+	startTime := time.Now()
+	logger.Printf("Tagging sentiment/tone for %d turns", len(turns))
+
+	var numbered strings.Builder
+	for i, turn := range turns {
+		fmt.Fprintf(&numbered, "[%d] %s\n", i, turn)
+	}
+
+	prompt := fmt.Sprintf(`Label each numbered speaker turn from a podcast transcript with its sentiment and tone.
+
+**RULES:**
+- sentiment must be one of: "positive", "neutral", "negative", "mixed".
+- tone is one or two lowercase words describing how it is said (e.g. "curious", "skeptical", "enthusiastic", "serious", "humorous").
+- Return a JSON array with one object per turn: {"index": number, "sentiment": string, "tone": string}.
+- Return ONLY the JSON array.
+
+--- TURNS START ---
+%s--- TURNS END ---`, numbered.String())
+
+	payload := map[string]any{
+		"contents": []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": map[string]any{
+			"temperature":      0.2,
+			"responseMimeType": "application/json",
+		},
+	}
+
+	response, err := c.generateContent(ctx, model, payload, 60*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("tone tagging failed: %w", err)
+	}
+
+	var parsed []ToneTag
+	if err := json.Unmarshal([]byte(response.Candidates[0].Content.Parts[0].Text), &parsed); err != nil {
+		return nil, fmt.Errorf("failed decode tone tags: %w", err)
+	}
+
+	tags := make([]ToneTag, len(turns))
+	for _, tag := range parsed {
+		if tag.Index >= 0 && tag.Index < len(tags) {
+			tags[tag.Index] = tag
+		}
+	}
+	logger.Printf("Tagged %d turns in %v", len(parsed), time.Since(startTime))
+	return tags, nil
+}
+
+// ChapterMark is where a chapter of an episode starts, as the index of its first turn
+type ChapterMark struct {
+	Turn  int    `json:"turn"`
+	Title string `json:"title"`
+}
+
+// chapterSchema constrains chapterization output to an array of {turn, title} objects
+var chapterSchema = map[string]any{
+	"type": "ARRAY",
+	"items": map[string]any{
+		"type": "OBJECT",
+		"properties": map[string]any{
+			"turn":  map[string]any{"type": "INTEGER"},
+			"title": map[string]any{"type": "STRING"},
+		},
+		"required": []string{"turn", "title"},
+	},
+}
+
+// Chapters splits the numbered "Speaker: text" turns of an episode into chapters by topic with
+// model. The marks are returned in turn order without duplicates, and the first chapter starts at
+// turn 0 unless the turns are continued from an earlier part of the episode, which may still be
+// on its last topic.
+func (c *Client) Chapters(ctx context.Context, model string, turns []string, continued bool) ([]ChapterMark, error) {
+	logger := reqctx.Logger(ctx)
+	startTime := time.Now()
+	logger.Printf("Chapterizing %d turns", len(turns))
+
+	var numbered strings.Builder
+	for i, turn := range turns {
+		fmt.Fprintf(&numbered, "[%d] %s\n", i, turn)
+	}
+	firstRule := "the first chapter starts at turn 0."
+	if continued {
+		firstRule = "these turns continue an earlier part of the episode, so start a chapter at turn 0 only if a new topic begins there."
+	}
+
+	prompt := fmt.Sprintf(`Split this podcast episode into chapters, one per topic the speakers move on to, for listeners to skip between.
+
+**RULES:**
+- A chapter starts at the numbered turn where its topic begins; %s
+- Aim for chapters of a few minutes each; never start a chapter for a single short remark.
+- "title" is a short chapter title of at most 6 words, in the language of the transcript.
+- Return a JSON array in turn order: {"turn": number, "title": string}.
+- Return ONLY the JSON array.
+
+--- EPISODE TURNS START ---
+%s--- EPISODE TURNS END ---`, firstRule, numbered.String())
+
+	payload := map[string]any{
+		"contents": []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": map[string]any{
+			"temperature":      0.2,
+			"responseMimeType": "application/json",
+			"responseSchema":   chapterSchema,
+		},
+	}
+
+	response, err := c.generateContent(ctx, model, payload, 0)
+	if err != nil {
+		return nil, fmt.Errorf("chapterization failed: %w", err)
+	}
+
+	var parsed []ChapterMark
+	if err := json.Unmarshal([]byte(response.Candidates[0].Content.Parts[0].Text), &parsed); err != nil {
+		return nil, fmt.Errorf("failed decode chapters: %w", err)
+	}
+
+	var marks []ChapterMark
+	for _, mark := range parsed {
+		mark.Title = strings.TrimSpace(mark.Title)
+		if mark.Title == "" || mark.Turn < 0 || mark.Turn >= len(turns) || (len(marks) > 0 && mark.Turn <= marks[len(marks)-1].Turn) {
+			continue
+		}
+		marks = append(marks, mark)
+	}
+	if len(marks) > 0 && !continued {
+		marks[0].Turn = 0
+	}
+	logger.Printf("Found %d chapters in %v", len(marks), time.Since(startTime))
+	return marks, nil
+}
+
+// GlossaryTerm is a key term of a document with a short, simple definition
+type GlossaryTerm struct {
+	Term       string `json:"term"`
+	Definition string `json:"definition"`
+}
+
+// glossarySchema constrains term extraction output to an array of {term, definition} objects
+var glossarySchema = map[string]any{
+	"type": "ARRAY",
+	"items": map[string]any{
+		"type": "OBJECT",
+		"properties": map[string]any{
+			"term":       map[string]any{"type": "STRING"},
+			"definition": map[string]any{"type": "STRING"},
+		},
+		"required": []string{"term", "definition"},
+	},
+}
+
+// ExtractTerms returns the key terms of one chunk of source text with simple definitions, for
+// the glossary appended to a condensed document. The terms are extracted with model.
+func (c *Client) ExtractTerms(ctx context.Context, model, text string) ([]GlossaryTerm, error) {
+	logger := reqctx.Debug(ctx)
+	startTime := time.Now()
+	logger.Printf("Extracting key terms from chunk of %d words", wordcount.Count(text))
+
+	prompt := fmt.Sprintf(`List the key terms a reader of the following text needs to know: technical terms, names of concepts, methods, organisations and abbreviations.
+
+**RULES:**
+- At most 8 terms, the most important first. Skip everyday words.
+- Write the term as it appears in the text (spell out abbreviations as "ABC (Full Name)").
+- Give each term a definition of one short sentence in extremely simple English (like for a 10-year-old), based only on the text.
+- Ignore placeholders like [[CODE_1]] or [[MATH_1]].
+- Return a JSON array: [{"term": string, "definition": string}]. Return [] if there are no key terms.
+
+--- TEXT START ---
+%s
+--- TEXT END ---`, text)
+
+	payload := map[string]any{
+		"contents": []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": map[string]any{
+			"temperature":      0.2,
+			"responseMimeType": "application/json",
+			"responseSchema":   glossarySchema,
+		},
+	}
+
+	response, err := c.generateContent(ctx, model, payload, 60*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("term extraction failed: %w", err)
+	}
+
+	var terms []GlossaryTerm
+	if err := json.Unmarshal([]byte(response.Candidates[0].Content.Parts[0].Text), &terms); err != nil {
+		return nil, fmt.Errorf("failed decode key terms: %w", err)
+	}
+	logger.Printf("Extracted %d key terms in %v", len(terms), time.Since(startTime))
+	return terms, nil
+}
+
+// Flashcard is one question/answer pair for study
+type Flashcard struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// flashcardSchema constrains flashcard output to an array of {question, answer} objects
+var flashcardSchema = map[string]any{
+	"type": "ARRAY",
+	"items": map[string]any{
+		"type": "OBJECT",
+		"properties": map[string]any{
+			"question": map[string]any{"type": "STRING"},
+			"answer":   map[string]any{"type": "STRING"},
+		},
+		"required": []string{"question", "answer"},
+	},
+}
+
+// MakeFlashcards writes question/answer pairs covering the key facts of one chunk of condensed
+// output with model
+func (c *Client) MakeFlashcards(ctx context.Context, model, text string) ([]Flashcard, error) {
+	logger := reqctx.Debug(ctx)
+	startTime := time.Now()
+	logger.Printf("Making flashcards from chunk of %d words", wordcount.Count(text))
+
+	prompt := fmt.Sprintf(`Write study flashcards for the following notes.
+
+**RULES:**
+- One card per key fact, definition or idea; about one card per 40 words of notes, at most 12.
+- Each question must make sense on its own, without the notes (no "according to the text").
+- Answers are short: a word, a phrase or one sentence, in extremely simple English (like for a 10-year-old).
+- Only use information in the notes. Do not repeat a question.
+- Return a JSON array: [{"question": string, "answer": string}].
+
+--- NOTES START ---
+%s
+--- NOTES END ---`, text)
+
+	payload := map[string]any{
+		"contents": []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": map[string]any{
+			"temperature":      0.3,
+			"responseMimeType": "application/json",
+			"responseSchema":   flashcardSchema,
+		},
+	}
+
+	response, err := c.generateContent(ctx, model, payload, 60*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("flashcard generation failed: %w", err)
+	}
+
+	var cards []Flashcard
+	if err := json.Unmarshal([]byte(response.Candidates[0].Content.Parts[0].Text), &cards); err != nil {
+		return nil, fmt.Errorf("failed decode flashcards: %w", err)
+	}
+	logger.Printf("Made %d flashcards in %v", len(cards), time.Since(startTime))
+	return cards, nil
+}
+
+// TranslateText translates already-processed output into the target language with model,
+// keeping markdown headings, bold speaker names and line structure intact.
+func (c *Client) TranslateText(ctx context.Context, model, text, targetLanguage string) (string, error) {
+	logger := reqctx.Debug(ctx)
+	startTime := time.Now()
+	logger.Printf("Translating chunk of %d words to %s", wordcount.Count(text), targetLanguage)
+
+	prompt := fmt.Sprintf(`Translate the following text into %s.
+
+**RULES:**
+- Keep the exact same structure: line breaks, blank lines, markdown headings ("# Heading") and bold markers ("**Name**:").
+- Do NOT translate speaker names or other proper names.
+- Keep the language extremely simple (like for a 10-year-old).
+- Return ONLY the translated text without any introductions, explanations, or notes.
+
+--- TEXT START ---
+%s
+--- TEXT END ---
+
+Translation:`, targetLanguage, text)
+
+	payload := map[string]any{
+		"contents":         []map[string]any{{"parts": []map[string]string{{"text": prompt}}}},
+		"generationConfig": map[string]any{"temperature": 0.2},
+	}
+
+	response, err := c.generateContent(ctx, model, payload, 60*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("translation to %s failed: %w", targetLanguage, err)
 	}
 
 	result := response.Candidates[0].Content.Parts[0].Text
-	outputWordCount := len(strings.Fields(result))
-	log.Printf("API call successful (%s mode). Result: %d words. Time: %v", mode, outputWordCount, time.Since(startTime))
+	logger.Printf("Translation successful. Result: %d words. Time: %v", wordcount.Count(result), time.Since(startTime))
 	return result, nil
 }
@@ -0,0 +1,33 @@
+package api
+
+import "context"
+
+type overridesKey struct{}
+
+// Overrides are per-job generation settings carried by a context and applied to every chunk
+// call made with it
+type Overrides struct {
+	// Model replaces the routed model for chunk calls
+	Model string
+	// Style selects the writing style of chunk output (a key of Styles)
+	Style string
+	// Format is the shape of document chunk output: FormatProse (default) or FormatBullets
+	Format string
+}
+
+// Output formats of document chunks
+const (
+	FormatProse   = "prose"
+	FormatBullets = "bullets"
+)
+
+// WithOverrides attaches o to ctx
+func WithOverrides(ctx context.Context, o Overrides) context.Context {
+	return context.WithValue(ctx, overridesKey{}, o)
+}
+
+// OverridesFrom returns the overrides attached to ctx, or the zero value
+func OverridesFrom(ctx context.Context) Overrides {
+	o, _ := ctx.Value(overridesKey{}).(Overrides)
+	return o
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Provider serves generations from a model backend other than the Gemini API. Requests and
+// responses are in the Gemini generateContent format; a provider translates them to its own API.
+type Provider interface {
+	GenerateContent(ctx context.Context, model string, request []byte) (*GeminiResponse, error)
+}
+
+// jsonOnlyInstruction stands in for responseMimeType on backends without an equivalent
+const jsonOnlyInstruction = "Respond with the JSON only, without code fences or any other text."
+
+// generateRequest is the part of a generateContent request that providers translate
+type generateRequest struct {
+	SystemInstruction *GeminiContent  `json:"systemInstruction"`
+	Contents          []GeminiContent `json:"contents"`
+	CachedContent     string          `json:"cachedContent"`
+	GenerationConfig  struct {
+		Temperature      *float64 `json:"temperature"`
+		TopP             *float64 `json:"topP"`
+		MaxOutputTokens  int      `json:"maxOutputTokens"`
+		StopSequences    []string `json:"stopSequences"`
+		Seed             *int64   `json:"seed"`
+		ResponseMimeType string   `json:"responseMimeType"`
+	} `json:"generationConfig"`
+}
+
+// providerMessage is one conversation turn with role "user" or "assistant"
+type providerMessage struct {
+	role string
+	text string
+}
+
+// parseGenerateRequest decodes a generateContent request for translation. Cached contexts only
+// exist on the Gemini API, so requests referring to one are rejected.
+func parseGenerateRequest(request []byte) (*generateRequest, error) {
+	var parsed generateRequest
+	if err := json.Unmarshal(request, &parsed); err != nil {
+		return nil, fmt.Errorf("failed decode generate request: %w", err)
+	}
+	if parsed.CachedContent != "" {
+		return nil, fmt.Errorf("cached contexts are only supported by the Gemini API")
+	}
+	return &parsed, nil
+}
+
+// system returns the system instruction, with jsonOnlyInstruction for JSON responses
+func (r *generateRequest) system() string {
+	var parts []string
+	if r.SystemInstruction != nil {
+		parts = append(parts, r.SystemInstruction.text())
+	}
+	if r.GenerationConfig.ResponseMimeType == "application/json" {
+		parts = append(parts, jsonOnlyInstruction)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// messages returns the conversation, with Gemini's "model" role as "assistant"
+func (r *generateRequest) messages() []providerMessage {
+	messages := make([]providerMessage, len(r.Contents))
+	for i, content := range r.Contents {
+		role := "user"
+		if content.Role == "model" {
+			role = "assistant"
+		}
+		messages[i] = providerMessage{role: role, text: content.text()}
+	}
+	return messages
+}
+
+// text joins the text of every part
+func (c GeminiContent) text() string {
+	var b strings.Builder
+	for _, part := range c.Parts {
+		b.WriteString(part.Text)
+	}
+	return b.String()
+}
+
+// providerResponse builds the Gemini form of a provider's answer. An empty text gets no parts,
+// like a Gemini response without content.
+func providerResponse(text, finishReason, modelVersion string, promptTokens, outputTokens int) *GeminiResponse {
+	candidate := GeminiCandidate{FinishReason: finishReason, Content: GeminiContent{Role: "model"}}
+	if text != "" {
+		candidate.Content.Parts = []GeminiPart{{Text: text}}
+	}
+	return &GeminiResponse{
+		Candidates: []GeminiCandidate{candidate},
+		UsageMetadata: GeminiUsage{
+			PromptTokenCount:     promptTokens,
+			CandidatesTokenCount: outputTokens,
+			TotalTokenCount:      promptTokens + outputTokens,
+		},
+		ModelVersion: modelVersion,
+	}
+}
+
+// mapModel returns the backend model for a Gemini model name, or fallback when models has none
+func mapModel(models map[string]string, model, fallback string) string {
+	if mapped, ok := models[model]; ok {
+		return mapped
+	}
+	return fallback
+}
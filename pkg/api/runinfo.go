@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+)
+
+type runInfoKey struct{}
+
+// RunInfo collects reproducibility metadata for every API call made with a context that
+// carries it: the model versions that answered and a hash of each request payload.
+// When Seed is set it is sent as generationConfig.seed on every call.
+type RunInfo struct {
+	Seed *int64
+
+	mu            sync.Mutex
+	modelVersions map[string]bool
+	promptHashes  []string
+}
+
+// WithRunInfo attaches info to ctx so API calls made with it are recorded
+func WithRunInfo(ctx context.Context, info *RunInfo) context.Context {
+	return context.WithValue(ctx, runInfoKey{}, info)
+}
+
+// RunInfoFrom returns the RunInfo attached to ctx, or nil
+func RunInfoFrom(ctx context.Context) *RunInfo {
+	info, _ := ctx.Value(runInfoKey{}).(*RunInfo)
+	return info
+}
+
+// applySeed sets the seed on the payload's generationConfig, creating it if needed
+func (i *RunInfo) applySeed(payload map[string]any) {
+	if i.Seed == nil {
+		return
+	}
+	generationConfig, ok := payload["generationConfig"].(map[string]any)
+	if !ok {
+		generationConfig = map[string]any{}
+	} else {
+		// Copy so shared config maps (e.g. from chunkGenerationConfig) are never mutated
+		copied := make(map[string]any, len(generationConfig)+1)
+		for k, v := range generationConfig {
+			copied[k] = v
+		}
+		generationConfig = copied
+	}
+	generationConfig["seed"] = *i.Seed
+	payload["generationConfig"] = generationConfig
+}
+
+func (i *RunInfo) record(modelVersion string, body []byte) {
+	hash := sha256.Sum256(body)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.modelVersions == nil {
+		i.modelVersions = make(map[string]bool)
+	}
+	if modelVersion != "" {
+		i.modelVersions[modelVersion] = true
+	}
+	i.promptHashes = append(i.promptHashes, hex.EncodeToString(hash[:]))
+}
+
+// ModelVersions returns the distinct model versions reported by the API, sorted
+func (i *RunInfo) ModelVersions() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	versions := make([]string, 0, len(i.modelVersions))
+	for version := range i.modelVersions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// PromptHashes returns the SHA-256 of every request payload sent, sorted so that
+// runs with identical prompts compare equal regardless of worker scheduling
+func (i *RunInfo) PromptHashes() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	hashes := append([]string(nil), i.promptHashes...)
+	sort.Strings(hashes)
+	return hashes
+}
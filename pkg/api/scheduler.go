@@ -0,0 +1,190 @@
+package api
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+)
+
+// Priority orders generation requests waiting for the shared scheduler
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
+// ParsePriority parses "low", "normal" or "high"; "" is normal
+func ParsePriority(name string) (Priority, error) {
+	switch name {
+	case "low":
+		return PriorityLow, nil
+	case "", "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority %q (expected low, normal or high)", name)
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+type priorityKey struct{}
+
+// WithPriority sets the priority of the generation requests made with ctx
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority attached to ctx, normal when there is none
+func PriorityFrom(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// Scheduler bounds the generation requests in flight across all jobs sharing a Client. When
+// every slot is taken, waiting requests get the next free slot highest priority first, so small
+// interactive jobs aren't stuck behind the chunks of a batch. Within a priority, slots go round
+// robin across tenants (or across jobs for requests without a tenant), so one large document
+// can't hold every slot while others wait.
+type Scheduler struct {
+	mu      sync.Mutex
+	free    int
+	waiting waitQueue
+	arrival uint64
+	// round is the turn of the last waiter granted a slot; turns holds the last turn given to
+	// each tenant or job with requests waiting
+	round uint64
+	turns map[string]uint64
+}
+
+// NewScheduler returns a scheduler allowing slots concurrent requests
+func NewScheduler(slots int) *Scheduler {
+	return &Scheduler{free: slots, turns: make(map[string]uint64)}
+}
+
+// fairnessKey is who a request is scheduled fairly against: its tenant, or its job
+func fairnessKey(ctx context.Context) string {
+	md := reqctx.MetadataFrom(ctx)
+	if md.Tenant != "" {
+		return "tenant:" + md.Tenant
+	}
+	return "job:" + md.JobID
+}
+
+// Acquire waits for a slot for a request with ctx's priority. Every successful Acquire must be
+// followed by a Release.
+func (s *Scheduler) Acquire(ctx context.Context) error {
+	s.mu.Lock()
+	if s.free > 0 && len(s.waiting) == 0 {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	// A key's next request waits one turn behind its last; a key that had nothing waiting
+	// joins the current round instead of catching up on turns it didn't use
+	key := fairnessKey(ctx)
+	turn := max(s.turns[key]+1, s.round)
+	s.turns[key] = turn
+	w := &waiter{priority: PriorityFrom(ctx), turn: turn, arrival: s.arrival, ready: make(chan struct{})}
+	s.arrival++
+	heap.Push(&s.waiting, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if w.index < 0 {
+			// The slot was handed over while ctx was being cancelled; pass it on
+			s.release()
+		} else {
+			heap.Remove(&s.waiting, w.index)
+		}
+		return ctx.Err()
+	}
+}
+
+// Release returns a slot, handing it to the first waiting request if there is one
+func (s *Scheduler) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.release()
+}
+
+func (s *Scheduler) release() {
+	if len(s.waiting) == 0 {
+		s.free++
+		return
+	}
+	w := heap.Pop(&s.waiting).(*waiter)
+	s.round = max(s.round, w.turn)
+	if len(s.waiting) == 0 {
+		clear(s.turns)
+	}
+	close(w.ready)
+}
+
+// Waiting returns the number of requests waiting for a slot
+func (s *Scheduler) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiting)
+}
+
+type waiter struct {
+	priority Priority
+	turn     uint64
+	arrival  uint64
+	ready    chan struct{}
+	index    int // position in the queue, -1 once granted
+}
+
+// waitQueue is a heap of waiters: highest priority, then earliest turn, then earliest arrival first
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	if q[i].turn != q[j].turn {
+		return q[i].turn < q[j].turn
+	}
+	return q[i].arrival < q[j].arrival
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *waitQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// SpeakerCache keeps the most recent speaker analyses by transcript hash, so re-runs of a
+// transcript at another ratio or after a failed job skip the analysis call. Only successful
+// analyses are stored. A nil *SpeakerCache is valid and caches nothing.
+type SpeakerCache struct {
+	mu       sync.Mutex
+	analyses map[string]string
+	order    []string
+	max      int
+}
+
+// NewSpeakerCache returns a cache holding at most max analyses
+func NewSpeakerCache(max int) *SpeakerCache {
+	return &SpeakerCache{analyses: make(map[string]string), max: max}
+}
+
+func speakerCacheKey(transcript string) string {
+	hash := sha256.Sum256([]byte(transcript))
+	return hex.EncodeToString(hash[:])
+}
+
+// Get returns the cached analysis of transcript
+func (c *SpeakerCache) Get(transcript string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	analysis, ok := c.analyses[speakerCacheKey(transcript)]
+	return analysis, ok
+}
+
+// Put stores the analysis of transcript, evicting the oldest analysis when the cache is full
+func (c *SpeakerCache) Put(transcript, analysis string) {
+	if c == nil {
+		return
+	}
+	key := speakerCacheKey(transcript)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.analyses[key]; !exists {
+		c.order = append(c.order, key)
+	}
+	c.analyses[key] = analysis
+	for len(c.order) > c.max {
+		delete(c.analyses, c.order[0])
+		c.order = c.order[1:]
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// TokenSource hands out OAuth access tokens (see gcpauth.TokenSource)
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// Vertex serves Gemini generations through Vertex AI in a Google Cloud project, authenticating
+// with a bearer token from Google Cloud credentials instead of an API key
+type Vertex struct {
+	Project    string
+	Location   string
+	Tokens     TokenSource
+	HTTPClient *http.Client
+}
+
+func (v *Vertex) GenerateContent(ctx context.Context, model string, request []byte) (*GeminiResponse, error) {
+	// Vertex AI requires a role on every turn, which the Gemini API defaults to "user"
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(request, &payload); err != nil {
+		return nil, fmt.Errorf("failed decode generate request: %w", err)
+	}
+	if _, ok := payload["cachedContent"]; ok {
+		return nil, fmt.Errorf("cached contexts are only supported by the Gemini API")
+	}
+	var contents []GeminiContent
+	if err := json.Unmarshal(payload["contents"], &contents); err != nil {
+		return nil, fmt.Errorf("failed decode generate request contents: %w", err)
+	}
+	for i := range contents {
+		if contents[i].Role == "" {
+			contents[i].Role = "user"
+		}
+	}
+	encoded, err := json.Marshal(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshal API payload: %w", err)
+	}
+	payload["contents"] = encoded
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshal API payload: %w", err)
+	}
+
+	token, err := v.Tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed get access token: %w", err)
+	}
+	endpoint := fmt.Sprintf("https://%s-aiplatform.googleapis.com/v1/projects/%s/locations/%s/publishers/google/models/%s:generateContent",
+		v.Location, url.PathEscape(v.Project), v.Location, url.PathEscape(model))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed create API request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var response GeminiResponse
+	if err := doJSON(v.HTTPClient, req, model, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -0,0 +1,105 @@
+// Package archive reads zip uploads of multiple documents and packs the processed outputs back into a zip.
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/textenc"
+)
+
+// MaxMemberSize caps the uncompressed size of a single member to guard against zip bombs
+const MaxMemberSize = 10 << 20 // 10 MB
+
+// textExtensions are the member types that are processed; everything else is skipped
+var textExtensions = map[string]bool{".txt": true, ".md": true, ".markdown": true}
+
+// Member is one document inside an archive, addressed by its slash-separated path
+type Member struct {
+	Path string
+	Text string
+}
+
+// Read extracts the text members of a zip archive in archive order. Directories, hidden files
+// and unsupported types are skipped. It fails if more than maxFiles text members are found.
+func Read(data []byte, maxFiles int) ([]Member, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	var members []Member
+	for _, file := range reader.File {
+		name, ok := cleanPath(file.Name)
+		if !ok || file.FileInfo().IsDir() {
+			continue
+		}
+		if !textExtensions[strings.ToLower(path.Ext(name))] {
+			log.Printf("Skipping unsupported archive member '%s'", name)
+			continue
+		}
+		if maxFiles > 0 && len(members) >= maxFiles {
+			return nil, fmt.Errorf("archive contains more than %d documents", maxFiles)
+		}
+
+		text, err := readMember(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", name, err)
+		}
+		members = append(members, Member{Path: name, Text: text})
+	}
+	return members, nil
+}
+
+// Write packs members into a zip archive, keeping their paths
+func Write(w io.Writer, members []Member) error {
+	zw := zip.NewWriter(w)
+	for _, member := range members {
+		fw, err := zw.Create(member.Path)
+		if err != nil {
+			return fmt.Errorf("failed to add '%s': %w", member.Path, err)
+		}
+		if _, err := io.WriteString(fw, member.Text); err != nil {
+			return fmt.Errorf("failed to write '%s': %w", member.Path, err)
+		}
+	}
+	return zw.Close()
+}
+
+func readMember(file *zip.File) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, MaxMemberSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > MaxMemberSize {
+		return "", fmt.Errorf("exceeds %d bytes", MaxMemberSize)
+	}
+	// Members are converted to UTF-8 like text file uploads
+	text, _, err := textenc.Decode(data, "")
+	return text, err
+}
+
+// cleanPath normalizes a member name and rejects absolute, escaping and hidden paths
+func cleanPath(name string) (string, bool) {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || strings.HasPrefix(name, "/") || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return "", false
+		}
+	}
+	return name, true
+}
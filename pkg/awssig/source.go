@@ -0,0 +1,145 @@
+package awssig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	containerHost = "http://169.254.170.2"
+	imdsURL       = "http://169.254.169.254/latest"
+	// refreshMargin is how long before their expiry temporary credentials are replaced
+	refreshMargin = 5 * time.Minute
+)
+
+// Source hands out AWS credentials: a fixed key pair from the environment, or temporary
+// credentials from a metadata endpoint, cached and refreshed shortly before they expire
+type Source struct {
+	client *http.Client
+	static Credentials
+	// containerURL is the container credentials endpoint; when empty, credentials come from the
+	// instance metadata service
+	containerURL string
+
+	mu     sync.Mutex
+	creds  Credentials
+	expiry time.Time
+}
+
+// FromEnvironment finds credentials the way AWS's SDKs do, short of profiles and web identity:
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY (used as is), the container credentials endpoint
+// of ECS or EKS Pod Identity named by AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or
+// AWS_CONTAINER_CREDENTIALS_FULL_URI, and finally the instance metadata service (IMDSv2) of the
+// EC2 instance the process runs on.
+func FromEnvironment(client *http.Client) *Source {
+	if creds := FromEnv(); creds.Valid() {
+		return &Source{client: client, static: creds}
+	}
+	source := &Source{client: client}
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		source.containerURL = containerHost + relative
+	} else {
+		source.containerURL = os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	}
+	return source
+}
+
+// Retrieve returns valid credentials, fetching new ones when the cached ones are about to expire
+func (s *Source) Retrieve(ctx context.Context) (Credentials, error) {
+	if s.static.Valid() {
+		return s.static, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.creds.Valid() && time.Until(s.expiry) > refreshMargin {
+		return s.creds, nil
+	}
+
+	var data []byte
+	var err error
+	if s.containerURL != "" {
+		data, err = s.fromContainer(ctx)
+	} else {
+		data, err = s.fromInstance(ctx)
+	}
+	if err != nil {
+		return Credentials{}, err
+	}
+	var out struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return Credentials{}, fmt.Errorf("failed decode credentials response: %w", err)
+	}
+	creds := Credentials{AccessKey: out.AccessKeyID, SecretKey: out.SecretAccessKey, SessionToken: out.Token}
+	if !creds.Valid() {
+		return Credentials{}, errors.New("no access key in credentials response")
+	}
+	s.creds, s.expiry = creds, out.Expiration
+	return s.creds, nil
+}
+
+// fromContainer fetches credentials from the container endpoint, authorized by
+// AWS_CONTAINER_AUTHORIZATION_TOKEN or the file named by AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE
+func (s *Source) fromContainer(ctx context.Context) ([]byte, error) {
+	header := make(http.Header)
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed read container authorization token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		header.Set("Authorization", token)
+	}
+	return s.fetch(ctx, "GET", s.containerURL, header)
+}
+
+// fromInstance fetches the credentials of the instance's role from IMDSv2
+func (s *Source) fromInstance(ctx context.Context) ([]byte, error) {
+	token, err := s.fetch(ctx, "PUT", imdsURL+"/api/token", http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"21600"}})
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {string(token)}}
+	roles, err := s.fetch(ctx, "GET", imdsURL+"/meta-data/iam/security-credentials/", header)
+	if err != nil {
+		return nil, err
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if role == "" {
+		return nil, errors.New("no IAM role attached to the instance")
+	}
+	return s.fetch(ctx, "GET", imdsURL+"/meta-data/iam/security-credentials/"+role, header)
+}
+
+func (s *Source) fetch(ctx context.Context, method, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed create credentials request: %w", err)
+	}
+	req.Header = header
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("credentials request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("credentials request failed: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+}
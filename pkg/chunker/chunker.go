@@ -1,146 +1,314 @@
 package chunker
 
 import (
-	"log"
+	"context"
+	"regexp"
 	"strings"
 	"unicode"
-)
-
-func ChunkText(content string, chunkSize int) ([]string, error) {
-	log.Printf("Starting text chunking with chunk size %d words", chunkSize)
+	"unicode/utf8"
 
-	content = strings.ReplaceAll(content, "\r\n", " ")
-	content = strings.ReplaceAll(content, "\n", " ")
-
-	sentences := splitIntoSentences(content)
-	log.Printf("Split content into %d sentences", len(sentences))
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
 
-	return createChunksFromSentences(sentences, chunkSize), nil
+// ChunkText groups sentences into chunks of roughly chunkSize words. Every chunk after the first
+// starts with the last whole sentences of the chunk before it, up to overlap words, so each
+// chunk has the context leading into it. A chunk also stays within a character budget, so
+// sentences too long for a chunk, or input with long unbroken runs, are split between words. The
+// word count of each chunk is returned with it, as counted while cutting.
+func ChunkText(ctx context.Context, content string, chunkSize int, overlap int) ([]string, []int, error) {
+	logger := reqctx.Debug(ctx)
+	logger.Printf("Starting text chunking with chunk size %d words and %d words overlap", chunkSize, overlap)
+
+	language := detectLanguage(content)
+	sentences := splitLongUnits(splitIntoUnits(ctx, strings.ReplaceAll(content, "\r\n", "\n"), segmentations[language]), chunkSize)
+	logger.Printf("Split content into %d sentences (language: %s)", len(sentences), language)
+
+	chunks, words := createChunksFromSentences(ctx, sentences, chunkSize, overlap)
+	return chunks, words, nil
 }
 
-func ChunkTextBySpace(content string, chunkSize int, overlap int) ([]string, error) {
-	log.Printf("Starting space-based text chunking with chunk size %d words and %d words overlap",
+// ChunkTextBySpace cuts content into chunks of chunkSize words between any words, each starting
+// with the last overlap words of the chunk before it. Chunks are slices of content rather than
+// copies, and are returned with their word counts. The whitespace inside a chunk is left as it is
+// in content: line breaks, CRLF included, and runs of spaces are not collapsed to single spaces.
+func ChunkTextBySpace(ctx context.Context, content string, chunkSize int, overlap int) ([]string, []int, error) {
+	logger := reqctx.Logger(ctx)
+	debug := reqctx.Debug(ctx)
+	debug.Printf("Starting space-based text chunking with chunk size %d words and %d words overlap",
 		chunkSize, overlap)
 
-	content = strings.ReplaceAll(content, "\r\n", " ")
-	content = strings.ReplaceAll(content, "\n", " ")
-
-	content = strings.Join(strings.Fields(content), " ")
-
-	words := strings.Fields(content)
-	log.Printf("Text contains %d words total", len(words))
+	words := wordSpans(content)
+	debug.Printf("Text contains %d words total", len(words))
 
 	var chunks []string
+	var counts []int
 
-	if len(words) <= chunkSize {
-		log.Printf("Text is smaller than chunk size, returning as single chunk")
-		return []string{content}, nil
+	budget := charBudget(chunkSize)
+	if len(words) <= chunkSize && chunkEnd(words, 0, chunkSize, budget) == len(words) {
+		debug.Printf("Text is smaller than chunk size, returning as single chunk")
+		return []string{strings.TrimSpace(content)}, []int{countWords(words)}, nil
 	}
 
-	for i := 0; i < len(words); i += (chunkSize - overlap) {
-		end := i + chunkSize
-		if end > len(words) {
-                        end = len(words)
-                }
+	for i := 0; i < len(words); {
+		end := chunkEnd(words, i, chunkSize, budget)
 
-		chunk := strings.Join(words[i:end], " ")
+		chunk := content[words[i].start:words[end-1].end]
 		chunks = append(chunks, chunk)
+		counts = append(counts, countWords(words[i:end]))
 
 		if i > 0 && i%1000 == 0 {
-			log.Printf("Created %d chunks so far", len(chunks))
+			debug.Printf("Created %d chunks so far", len(chunks))
 		}
 
 		if end == len(words) {
 			break
 		}
+		// The overlap is held to its own character budget, like the chunk
+		next := end
+		for next > i+1 && end-next < overlap && words[end-1].end-words[next-1].start <= charBudget(overlap) {
+			next--
+		}
+		i = next
 	}
 
-	log.Printf("Created %d chunks using space-based chunking", len(chunks))
-	return chunks, nil
+	logger.Printf("Created %d chunks using space-based chunking", len(chunks))
+	return chunks, counts, nil
 }
 
-func splitIntoSentences(text string) []string {
-	log.Printf("Splitting text into sentences, text length: %d characters", len(text))
-
-	text = replaceAbbreviations(text)
-
-	var sentences []string
-	var currentSentence strings.Builder
+// OverlapWords returns how many words next, a chunk of ChunkText or ChunkTextBySpace, repeats
+// from the end of previous, the chunk before it, up to the overlap they were cut with
+func OverlapWords(previous, next string, overlap int) int {
+	words := wordSpans(next)
+	words = words[:min(len(words), overlap)]
+	overlap = 0
+	for i, word := range words {
+		if word.end > len(previous) {
+			break
+		}
+		if strings.HasSuffix(previous, next[:word.end]) {
+			overlap = i + 1
+		}
+	}
+	return overlap
+}
 
-	for i := 0; i < len(text); i++ {
-		currentSentence.WriteByte(text[i])
+// ChunkByParagraph groups blank-line separated paragraphs into chunks of roughly chunkSize words
+// without splitting or reflowing any paragraph, so markdown structure survives a second pass.
+// Paragraphs are trimmed and joined by one blank line. A chunk whose paragraphs already are is a
+// slice of content rather than a copy.
+func ChunkByParagraph(ctx context.Context, content string, chunkSize int) []string {
+	logger := reqctx.Logger(ctx)
+	content = strings.ReplaceAll(content, "\r\n", "\n")
 
-		if (text[i] == '.' || text[i] == '!' || text[i] == '?') &&
-			(i == len(text)-1 || unicode.IsSpace(rune(text[i+1]))) {
+	var chunks []string
+	// current holds the trimmed paragraphs of the chunk being built
+	var current []span
+	currentWordCount, paragraphs := 0, 0
+	flush := func() {
+		chunks = append(chunks, joinParagraphs(content, current))
+		current, currentWordCount = current[:0], 0
+	}
 
-			sentence := strings.TrimSpace(currentSentence.String())
-			if len(strings.Fields(sentence)) > 0 {
-				sentences = append(sentences, sentence)
+	for offset := 0; ; {
+		paragraph, _, found := strings.Cut(content[offset:], "\n\n")
+		start := offset + len(paragraph) - len(strings.TrimLeftFunc(paragraph, unicode.IsSpace))
+		end := offset + len(strings.TrimRightFunc(paragraph, unicode.IsSpace))
+		offset += len(paragraph) + len("\n\n")
+		paragraphs++
+
+		if start < end {
+			paragraphWords := wordcount.Count(content[start:end])
+			if currentWordCount > 0 && currentWordCount+paragraphWords > chunkSize {
+				flush()
 			}
-			currentSentence.Reset()
+			current = append(current, span{start, end})
+			currentWordCount += paragraphWords
+		}
+		if !found {
+			break
 		}
 	}
 
-	if currentSentence.Len() > 0 {
-		sentence := strings.TrimSpace(currentSentence.String())
-		if len(strings.Fields(sentence)) > 0 {
-			sentences = append(sentences, sentence)
-		}
+	if currentWordCount > 0 {
+		flush()
 	}
 
-	log.Printf("Found %d sentences in text", len(sentences))
-	return sentences
+	logger.Printf("Created %d chunks from %d paragraphs", len(chunks), paragraphs)
+	return chunks
 }
 
-func createChunksFromSentences(sentences []string, targetChunkSize int) []string {
-	var chunks []string
-	var currentChunk strings.Builder
-	currentWordCount := 0
-
-	for i, sentence := range sentences {
-		sentenceWords := len(strings.Fields(sentence))
+// joinParagraphs joins the paragraphs of content at spans with one blank line between them,
+// slicing content when it already has them that way
+func joinParagraphs(content string, paragraphs []span) string {
+	first, last := paragraphs[0], paragraphs[len(paragraphs)-1]
+	joined := true
+	for i := 1; i < len(paragraphs); i++ {
+		if content[paragraphs[i-1].end:paragraphs[i].start] != "\n\n" {
+			joined = false
+			break
+		}
+	}
+	if joined {
+		return content[first.start:last.end]
+	}
+	var chunk strings.Builder
+	chunk.Grow(last.end - first.start)
+	for i, paragraph := range paragraphs {
+		if i > 0 {
+			chunk.WriteString("\n\n")
+		}
+		chunk.WriteString(content[paragraph.start:paragraph.end])
+	}
+	return chunk.String()
+}
 
-		if currentWordCount > 0 && currentWordCount+sentenceWords > targetChunkSize {
-			chunk := strings.TrimSpace(currentChunk.String())
-			chunks = append(chunks, chunk)
-			log.Printf("Created chunk with %d words", currentWordCount)
+// blockLineRegex matches list items and markdown table rows
+var blockLineRegex = regexp.MustCompile(`^\s*(?:[-*+•]|\d+[.)])\s+\S|^\s*\|.*\|\s*$`)
+
+// splitIntoUnits splits content into sentences by the rules of seg, except that runs of list
+// items or table rows stay whole, line breaks included, so they are never split or reflowed into
+// prose
+func splitIntoUnits(ctx context.Context, content string, seg segmentation) []string {
+	logger := reqctx.Debug(ctx)
+	var units, prose, block []string
+	blocks := 0
+	flushProse := func() {
+		if len(prose) > 0 {
+			units = append(units, splitIntoSentences(ctx, strings.Join(prose, " "), seg)...)
+			prose = nil
+		}
+	}
+	flushBlock := func() {
+		if len(block) > 0 {
+			units = append(units, strings.Join(block, "\n"))
+			blocks++
+			block = nil
+		}
+	}
 
-			currentChunk.Reset()
-			currentWordCount = 0
+	for _, line := range strings.Split(content, "\n") {
+		if blockLineRegex.MatchString(line) {
+			flushProse()
+			block = append(block, strings.TrimRight(line, " \t"))
+			continue
 		}
+		flushBlock()
+		prose = append(prose, line)
+	}
+	flushProse()
+	flushBlock()
+
+	if blocks > 0 {
+		logger.Printf("Kept %d list/table blocks intact", blocks)
+	}
+	return units
+}
 
-		currentChunk.WriteString(sentence + " ")
-		currentWordCount += sentenceWords
+func splitIntoSentences(ctx context.Context, text string, seg segmentation) []string {
+	logger := reqctx.Debug(ctx)
+	logger.Printf("Splitting text into sentences, text length: %d characters", len(text))
 
-		if i > 0 && i%100 == 0 {
-			log.Printf("Processed %d/%d sentences", i, len(sentences))
+	var sentences []string
+	add := func(sentence string) {
+		sentence = strings.TrimSpace(sentence)
+		if wordcount.Count(sentence) > 0 {
+			sentences = append(sentences, sentence)
 		}
 	}
 
-	if currentChunk.Len() > 0 {
-		chunk := strings.TrimSpace(currentChunk.String())
-		chunks = append(chunks, chunk)
-		log.Printf("Created final chunk with %d words", currentWordCount)
+	start := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !strings.ContainsRune(seg.terminators, r) {
+			i += size
+			continue
+		}
+		end := seg.sentenceEnd(text, i)
+		if end < 0 {
+			i += size
+			continue
+		}
+		add(text[start:end])
+		start, i = end, end
 	}
+	add(text[start:])
 
-	log.Printf("Created %d chunks from %d sentences", len(chunks), len(sentences))
-	return chunks
+	logger.Printf("Found %d sentences in text", len(sentences))
+	return sentences
 }
 
-func replaceAbbreviations(text string) string {
-	abbreviations := []string{
-		"Mr.", "Mrs.", "Ms.", "Dr.", "Prof.",
-		"Inc.", "Ltd.", "Co.", "Corp.",
-		"i.e.", "e.g.", "etc.",
-		"vs.", "a.m.", "p.m.",
-		"U.S.", "U.K.", "E.U.",
+// createChunksFromSentences groups sentences into chunks. The sentences are laid out once, one
+// space after each and list and table blocks on their own lines, and every chunk is a slice of
+// that text, so sentences carried into the next chunk are not copied again.
+func createChunksFromSentences(ctx context.Context, sentences []string, targetChunkSize int, overlap int) ([]string, []int) {
+	logger := reqctx.Logger(ctx)
+	debug := reqctx.Debug(ctx)
+	var chunks []string
+	var counts []int
+	budget := charBudget(targetChunkSize)
+
+	// Sentence i is text[starts[i]:starts[i+1]], its separators included. Each sentence is
+	// counted once.
+	var layout strings.Builder
+	starts := make([]int, len(sentences)+1)
+	sentenceWords := make([]int, len(sentences))
+	for i, sentence := range sentences {
+		starts[i] = layout.Len()
+		if strings.Contains(sentence, "\n") {
+			// List and table blocks keep their own lines
+			layout.WriteByte('\n')
+			layout.WriteString(sentence)
+			layout.WriteByte('\n')
+		} else {
+			layout.WriteString(sentence)
+			layout.WriteByte(' ')
+		}
+		sentenceWords[i] = wordcount.Count(sentence)
+	}
+	starts[len(sentences)] = layout.Len()
+	text := layout.String()
+
+	// chunkStart is the first sentence of the current chunk, newWords counts the words not
+	// carried over from the previous chunk
+	chunkStart, newWords, currentWordCount := 0, 0, 0
+	cut := func(end int) {
+		chunks = append(chunks, strings.TrimSpace(text[starts[chunkStart]:starts[end]]))
+		counts = append(counts, currentWordCount)
+	}
+
+	for i, sentence := range sentences {
+		if newWords > 0 && (currentWordCount+sentenceWords[i] > targetChunkSize || starts[i]-starts[chunkStart]+len(sentence) > budget) {
+			cut(i)
+			debug.Printf("Created chunk with %d words", currentWordCount)
+
+			// Carry over trailing sentences, never the whole chunk
+			carry, carried, carriedChars := i, 0, 0
+			for carry > chunkStart+1 {
+				words := sentenceWords[carry-1]
+				if carried+words > overlap || carriedChars+len(sentences[carry-1]) > charBudget(overlap) {
+					break
+				}
+				carry--
+				carried += words
+				carriedChars += len(sentences[carry])
+			}
+			chunkStart, newWords, currentWordCount = carry, 0, carried
+		}
+
+		currentWordCount += sentenceWords[i]
+		newWords += sentenceWords[i]
+
+		if i > 0 && i%100 == 0 {
+			debug.Printf("Processed %d/%d sentences", i, len(sentences))
+		}
 	}
 
-	result := text
-	for _, abbr := range abbreviations {
-		placeholder := strings.ReplaceAll(abbr, ".", "·")
-		result = strings.ReplaceAll(result, abbr, placeholder)
+	if len(sentences) > 0 {
+		cut(len(sentences))
+		debug.Printf("Created final chunk with %d words", currentWordCount)
 	}
 
-	return result
+	logger.Printf("Created %d chunks from %d sentences", len(chunks), len(sentences))
+	return chunks, counts
 }
@@ -0,0 +1,169 @@
+package chunker
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestChunkByParagraph(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		chunkSize int
+		want      []string
+	}{
+		{
+			name:      "fits in one chunk",
+			text:      "one two\n\nthree four",
+			chunkSize: 10,
+			want:      []string{"one two\n\nthree four"},
+		},
+		{
+			name:      "paragraphs grouped up to the size",
+			text:      "a b\n\nc d\n\ne f",
+			chunkSize: 4,
+			want:      []string{"a b\n\nc d", "e f"},
+		},
+		{
+			name:      "oversized paragraph kept whole",
+			text:      "a b c d e f\n\ng h",
+			chunkSize: 3,
+			want:      []string{"a b c d e f", "g h"},
+		},
+		{
+			name:      "paragraphs trimmed and blank runs collapsed",
+			text:      "\n\n  a b  \n\n\n\n\n c d \n",
+			chunkSize: 10,
+			want:      []string{"a b\n\nc d"},
+		},
+		{
+			name:      "line breaks inside a paragraph kept",
+			text:      "# Title\nline one\r\n\r\n- item",
+			chunkSize: 10,
+			want:      []string{"# Title\nline one\n\n- item"},
+		},
+		{
+			name:      "empty input",
+			text:      " \n\n ",
+			chunkSize: 10,
+			want:      nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ChunkByParagraph(context.Background(), tt.text, tt.chunkSize); !slices.Equal(got, tt.want) {
+				t.Errorf("ChunkByParagraph(%q, %d) = %q, want %q", tt.text, tt.chunkSize, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkTextBySpace(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		chunkSize int
+		overlap   int
+		want      []string
+		wantWords []int
+	}{
+		{
+			name:      "single chunk",
+			text:      "  one two three  ",
+			chunkSize: 5,
+			want:      []string{"one two three"},
+			wantWords: []int{3},
+		},
+		{
+			name:      "no overlap",
+			text:      "a b c d e",
+			chunkSize: 2,
+			want:      []string{"a b", "c d", "e"},
+			wantWords: []int{2, 2, 1},
+		},
+		{
+			name:      "overlap repeats the last words",
+			text:      "a b c d e f",
+			chunkSize: 3,
+			overlap:   1,
+			want:      []string{"a b c", "c d e", "e f"},
+			wantWords: []int{3, 3, 2},
+		},
+		{
+			name:      "whitespace inside a chunk kept",
+			text:      "a\n\nb  c d",
+			chunkSize: 3,
+			want:      []string{"a\n\nb  c", "d"},
+			wantWords: []int{3, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, words, err := ChunkTextBySpace(context.Background(), tt.text, tt.chunkSize, tt.overlap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("chunks = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(words, tt.wantWords) {
+				t.Errorf("word counts = %v, want %v", words, tt.wantWords)
+			}
+		})
+	}
+}
+
+func TestChunkTextOverlap(t *testing.T) {
+	var sentences []string
+	for _, word := range strings.Fields("alpha bravo charlie delta echo foxtrot golf hotel india juliet") {
+		sentences = append(sentences, "The word is "+word+".")
+	}
+	text := strings.Join(sentences, " ")
+
+	chunks, words, err := ChunkText(context.Background(), text, 12, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 || len(words) != len(chunks) {
+		t.Fatalf("got %d chunks and %d word counts, want several of each", len(chunks), len(words))
+	}
+	for i, chunk := range chunks {
+		if !strings.HasSuffix(chunk, ".") {
+			t.Errorf("chunk %d doesn't end on a sentence: %q", i, chunk)
+		}
+		if words[i] > 12+4 {
+			t.Errorf("chunk %d has %d words, want at most the size plus the overlap", i, words[i])
+		}
+		if i > 0 && OverlapWords(chunks[i-1], chunk, 4) != 4 {
+			t.Errorf("chunk %d doesn't start with the last sentence of chunk %d:\n%q\n%q", i, i-1, chunks[i-1], chunk)
+		}
+	}
+	if !strings.HasSuffix(chunks[len(chunks)-1], "juliet.") {
+		t.Errorf("last chunk %q doesn't end the text", chunks[len(chunks)-1])
+	}
+}
+
+func TestOverlapWords(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous string
+		next     string
+		overlap  int
+		want     int
+	}{
+		{"repeated words", "a b c d", "c d e f", 3, 2},
+		{"nothing repeated", "a b c", "d e f", 3, 0},
+		{"capped by the overlap", "a b c d", "b c d e", 2, 0},
+		{"whole previous chunk", "a b", "a b c", 5, 2},
+		{"partial word isn't repeated", "a bc", "b c", 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OverlapWords(tt.previous, tt.next, tt.overlap); got != tt.want {
+				t.Errorf("OverlapWords(%q, %q, %d) = %d, want %d", tt.previous, tt.next, tt.overlap, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package chunker
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+const (
+	// maxCharsPerWord is the average word length the character budget of a chunk allows for.
+	// Prose averages about 6 characters a word, so only input with long unbroken runs (minified
+	// JSON, base64, URLs) reaches the budget before the word limit.
+	maxCharsPerWord = 15
+	// maxRunChars is the longest run without whitespace kept whole; longer runs are cut into
+	// pieces of this size so they can be split between chunks
+	maxRunChars = 500
+)
+
+// charBudget is the most characters a chunk of chunkSize words may hold
+func charBudget(chunkSize int) int {
+	return chunkSize * maxCharsPerWord
+}
+
+// span is the byte offsets of a word in the text it was found in. Chunks are cut from the text
+// by these offsets, so they share its memory instead of being joined from copied words.
+type span struct {
+	start, end int
+}
+
+// wordSpans finds the words of text as strings.Fields does, with runs longer than maxRunChars
+// cut into pieces
+func wordSpans(text string) []span {
+	words := make([]span, 0, wordcount.Count(text))
+	start := -1
+	for i, r := range text {
+		switch {
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		case unicode.IsSpace(r) && start >= 0:
+			words = appendCut(words, text, start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = appendCut(words, text, start, len(text))
+	}
+	return words
+}
+
+// appendCut appends the word text[start:end], cut into runs of at most maxRunChars
+func appendCut(words []span, text string, start, end int) []span {
+	for end-start > maxRunChars {
+		cut := start + maxRunChars
+		for cut > start && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		words = append(words, span{start, cut})
+		start = cut
+	}
+	return append(words, span{start, end})
+}
+
+// countWords is the number of whitespace-separated words words cover: the pieces a long run was
+// cut into by appendCut touch and count as one
+func countWords(words []span) int {
+	count := 0
+	for i, word := range words {
+		if i == 0 || words[i-1].end != word.start {
+			count++
+		}
+	}
+	return count
+}
+
+// packWords groups the words of text into pieces of at most maxWords words and maxChars
+// characters, each a slice of text
+func packWords(text string, words []span, maxWords, maxChars int) []string {
+	var pieces []string
+	for start := 0; start < len(words); {
+		end := chunkEnd(words, start, maxWords, maxChars)
+		pieces = append(pieces, text[words[start].start:words[end-1].end])
+		start = end
+	}
+	return pieces
+}
+
+// splitLongUnits cuts sentences longer than chunkSize words or its character budget into pieces
+// between words. List and table blocks are left whole.
+func splitLongUnits(units []string, chunkSize int) []string {
+	budget := charBudget(chunkSize)
+	var split []string
+	for _, unit := range units {
+		if strings.Contains(unit, "\n") || (len(unit) <= budget && wordcount.Count(unit) <= chunkSize) {
+			split = append(split, unit)
+			continue
+		}
+		split = append(split, packWords(unit, wordSpans(unit), chunkSize, budget)...)
+	}
+	return split
+}
+
+// chunkEnd is the end of the chunk of words starting at start, which holds at least one word and
+// otherwise at most chunkSize words and budget characters. Characters are those of the slice the
+// words are cut as, so the whitespace between them counts as it is.
+func chunkEnd(words []span, start, chunkSize, budget int) int {
+	end := start
+	for end < len(words) && end-start < chunkSize {
+		if end > start && words[end].end-words[start].start > budget {
+			break
+		}
+		end++
+	}
+	return end
+}
@@ -0,0 +1,235 @@
+package chunker
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// segmentation is how a language marks the end of a sentence
+type segmentation struct {
+	// abbreviations end in a period that does not end the sentence. Entries may span words,
+	// like "z. B.", and are only matched at the start of a word.
+	abbreviations []string
+	// terminators end a sentence
+	terminators string
+	// closers are closing quotes and brackets kept with the sentence they end
+	closers string
+	// spacedClosers allows a space before a closer, as in French "« Oui. »"
+	spacedClosers bool
+	// dateOrdinals are words before which a number followed by a period is an ordinal ("am
+	// 3. Mai") rather than the end of a sentence
+	dateOrdinals []string
+}
+
+// segmentations are the sentence rules by language (see detectLanguage)
+var segmentations = map[string]segmentation{
+	"en": {
+		abbreviations: []string{
+			"Mr.", "Mrs.", "Ms.", "Dr.", "Prof.",
+			"Inc.", "Ltd.", "Co.", "Corp.",
+			"i.e.", "e.g.", "etc.",
+			"vs.", "a.m.", "p.m.",
+			"U.S.", "U.K.", "E.U.",
+		},
+		terminators: ".!?",
+		closers:     `"')]”’`,
+	},
+	"es": {
+		abbreviations: []string{
+			"Sr.", "Sra.", "Srta.", "Dr.", "Dra.", "Ud.", "Uds.", "Vd.", "Vds.",
+			"p. ej.", "etc.", "aprox.", "pág.", "págs.", "núm.", "tel.",
+			"EE. UU.", "S.A.", "a. C.", "d. C.",
+		},
+		terminators: ".!?",
+		closers:     `"')]»”’`,
+	},
+	"de": {
+		abbreviations: []string{
+			"Hr.", "Fr.", "Dr.", "Prof.", "Nr.", "Str.", "St.",
+			"z. B.", "d. h.", "u. a.", "o. ä.", "bzw.", "usw.", "vgl.", "ca.", "evtl.", "ggf.", "inkl.", "etc.",
+			"Jh.", "v. Chr.", "n. Chr.", "S.",
+		},
+		terminators: ".!?",
+		closers:     `"')]“‘«»`,
+		dateOrdinals: []string{
+			"Januar", "Februar", "März", "April", "Mai", "Juni",
+			"Juli", "August", "September", "Oktober", "November", "Dezember", "Jahrhundert",
+		},
+	},
+	"fr": {
+		abbreviations: []string{
+			"M.", "MM.", "Mme.", "Mlle.", "Dr.", "Pr.", "St.",
+			"p. ex.", "c.-à-d.", "cf.", "etc.", "env.", "av. J.-C.", "apr. J.-C.", "p.",
+		},
+		terminators:   ".!?",
+		closers:       `"')]»”’`,
+		spacedClosers: true,
+	},
+	"hi": {
+		abbreviations: []string{"डॉ.", "श्री.", "Dr.", "Mr."},
+		terminators:   "।॥.!?",
+		closers:       `"')]”’`,
+	},
+	"zh": {
+		terminators: "。！？!?",
+		closers:     "”’」』）)",
+	},
+	"ja": {
+		terminators: "。！？!?",
+		closers:     "」』）”’)",
+	},
+}
+
+// stopwords are frequent short words that tell the Latin-script languages apart
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "that", "in", "it", "for", "with", "was", "on", "this"},
+	"es": {"el", "la", "los", "las", "que", "y", "de", "del", "una", "por", "con", "para", "es", "se"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "mit", "den", "sich", "auch"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "un", "que", "du", "pour", "dans", "pas", "qui"},
+}
+
+// languageSample is how much of the input detectLanguage looks at
+const languageSample = 20000
+
+// detectLanguage guesses the language of text for sentence segmentation: by script for Hindi,
+// Chinese and Japanese, and by stopwords for English, Spanish, German and French. English is the
+// fallback.
+func detectLanguage(text string) string {
+	if len(text) > languageSample {
+		text = text[:languageSample]
+		for len(text) > 0 && !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+
+	var letters, kana, han, devanagari int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Devanagari, r):
+			devanagari++
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	switch {
+	case letters == 0:
+		return "en"
+	case kana*10 > letters:
+		return "ja"
+	case (han+kana)*3 > letters:
+		// Chinese has no kana; Japanese text with few of them is still mostly Han
+		if kana > 0 {
+			return "ja"
+		}
+		return "zh"
+	case devanagari*3 > letters:
+		return "hi"
+	}
+
+	counts := make(map[string]int)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		word = strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) })
+		for language, words := range stopwords {
+			for _, stopword := range words {
+				if word == stopword {
+					counts[language]++
+				}
+			}
+		}
+	}
+	best := "en"
+	for _, language := range []string{"es", "de", "fr"} {
+		if counts[language] > counts[best] {
+			best = language
+		}
+	}
+	return best
+}
+
+// sentenceEnd returns where the sentence ending with the terminator at text[i:] ends, including
+// any further terminators and closers, or -1 when the terminator does not end a sentence
+func (s segmentation) sentenceEnd(text string, i int) int {
+	end := i
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if strings.ContainsRune(s.terminators, r) || strings.ContainsRune(s.closers, r) {
+			end += size
+			continue
+		}
+		if s.spacedClosers && (r == ' ' || r == '\u00a0' || r == '\u202f') {
+			next, nextSize := utf8.DecodeRuneInString(text[end+size:])
+			if strings.ContainsRune(s.closers, next) {
+				end += size + nextSize
+				continue
+			}
+		}
+		break
+	}
+
+	if text[i] == '.' && (s.isAbbreviation(text, i) || s.isDateOrdinal(text, i, end)) {
+		return -1
+	}
+	if end == len(text) {
+		return end
+	}
+	// ASCII terminators also appear inside numbers and names, so only whitespace after them ends
+	// the sentence. Full-width terminators and the danda need none.
+	next, _ := utf8.DecodeRuneInString(text[end:])
+	if unicode.IsSpace(next) || text[i] >= utf8.RuneSelf {
+		return end
+	}
+	return -1
+}
+
+// isAbbreviation reports whether the period at text[i] is part of one of the abbreviations
+func (s segmentation) isAbbreviation(text string, i int) bool {
+	for _, abbreviation := range s.abbreviations {
+		for offset := 0; offset < len(abbreviation); offset++ {
+			if abbreviation[offset] != '.' {
+				continue
+			}
+			start := i - offset
+			if start < 0 || start+len(abbreviation) > len(text) || text[start:start+len(abbreviation)] != abbreviation {
+				continue
+			}
+			if start == 0 {
+				return true
+			}
+			before, _ := utf8.DecodeLastRuneInString(text[:start])
+			if unicode.IsSpace(before) || strings.ContainsRune(`"'(«„“‘`, before) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isDateOrdinal reports whether the period at text[i] follows a number of at most two digits and
+// comes before one of dateOrdinals, as in "am 3. Mai"
+func (s segmentation) isDateOrdinal(text string, i, end int) bool {
+	if len(s.dateOrdinals) == 0 || end != i+1 {
+		return false
+	}
+	digits := 0
+	for digits < i && digits < 3 && text[i-1-digits] >= '0' && text[i-1-digits] <= '9' {
+		digits++
+	}
+	if digits == 0 || digits > 2 {
+		return false
+	}
+	rest := strings.TrimLeftFunc(text[end:], unicode.IsSpace)
+	word, _, _ := strings.Cut(rest[:min(len(rest), 20)], " ")
+	word = strings.TrimRight(word, ".,;:!?")
+	for _, ordinal := range s.dateOrdinals {
+		if word == ordinal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package chunker
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+var (
+	// speakerTurnRegex matches a line opening a "Name: speech" turn, with an optional bold name
+	speakerTurnRegex = regexp.MustCompile(`^\s*(\*\*)?(\p{L}[\p{L}\p{N} .'’-]{0,40}?)(\*\*)?\s*:(\s+\S|\s*$)`)
+	// cueTimingRegex matches an SRT or WebVTT cue timing line
+	cueTimingRegex = regexp.MustCompile(`^\s*(\d{1,2}:)?\d{2}:\d{2}[.,]\d{3}\s*-->`)
+)
+
+// minTurns is how many speaker turns or subtitle cues input needs before it is chunked by turn
+const minTurns = 3
+
+// ChunkByTurns chunks a transcript that already has "Name:" lines or subtitle cues so that
+// chunks only break between turns. Every chunk after the first starts with the last whole
+// turns of the chunk before it, up to overlap words. A single turn longer than chunkSize is
+// split by words, with the speaker's name repeated on each piece. Chunks are returned with their
+// word counts; the bool is false when the input has no recognizable turns.
+func ChunkByTurns(ctx context.Context, content string, chunkSize int, overlap int) ([]string, []int, bool) {
+	logger := reqctx.Logger(ctx)
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	units, kind := subtitleCues(content), "subtitle cues"
+	if len(units) < minTurns {
+		units, kind = speakerTurns(content), "speaker turns"
+	}
+	if len(units) < minTurns {
+		return nil, nil, false
+	}
+
+	var pieces []string
+	for _, unit := range units {
+		pieces = append(pieces, splitLongTurn(unit, chunkSize)...)
+	}
+	chunks, words := groupTurns(pieces, chunkSize, overlap)
+	logger.Printf("Created %d chunks from %d %s", len(chunks), len(units), kind)
+	return chunks, words, true
+}
+
+// speakerTurns splits content into turns starting at "Name:" lines. Lines before the first
+// turn are their own unit; too few turn lines for the size of the input means it isn't one.
+func speakerTurns(content string) []string {
+	var turns, current []string
+	lines, turnLines := 0, 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines++
+		if speakerTurnRegex.MatchString(line) {
+			turnLines++
+			if len(current) > 0 {
+				turns = append(turns, strings.Join(current, " "))
+			}
+			current = nil
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		turns = append(turns, strings.Join(current, " "))
+	}
+	// Prose with the odd "Note:" line is not a transcript
+	if turnLines*5 < lines {
+		return nil
+	}
+	return turns
+}
+
+// subtitleCues splits SRT or WebVTT content into one unit per cue, each flattened onto one line
+func subtitleCues(content string) []string {
+	var cues []string
+	for _, block := range strings.Split(content, "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		timed := false
+		for _, line := range lines {
+			if cueTimingRegex.MatchString(line) {
+				timed = true
+				break
+			}
+		}
+		if !timed {
+			continue // WEBVTT header, NOTE and STYLE blocks
+		}
+		cues = append(cues, strings.Join(strings.Fields(strings.Join(lines, " ")), " "))
+	}
+	return cues
+}
+
+// splitLongTurn cuts a turn longer than chunkSize words or its character budget into pieces,
+// repeating the speaker tag at the start of each so the speech stays attributed
+func splitLongTurn(turn string, chunkSize int) []string {
+	words := wordSpans(turn)
+	budget := charBudget(chunkSize)
+	if len(words) <= chunkSize && len(turn) <= budget {
+		return []string{turn}
+	}
+	tag, speech := "", turn
+	if match := speakerTurnRegex.FindStringSubmatch(turn); match != nil {
+		tag = strings.TrimSpace(turn[:len(match[0])-len(match[4])])
+		speech = turn[len(tag):]
+		words = wordSpans(speech)
+	}
+
+	pieces := packWords(speech, words, max(chunkSize-wordcount.Count(tag), 1), max(budget-len(tag)-1, 1))
+	if tag != "" {
+		for i := range pieces {
+			pieces[i] = tag + " " + pieces[i]
+		}
+	}
+	return pieces
+}
+
+// groupTurns packs turns into chunks of roughly chunkSize words and at most its character
+// budget, one turn per line, carrying trailing turns up to overlap words into the next chunk.
+// Chunks are returned with their word counts.
+func groupTurns(turns []string, chunkSize int, overlap int) ([]string, []int) {
+	var chunks, current []string
+	var counts []int
+	currentWords, currentChars, newTurns, start := 0, 0, 0, 0
+	budget := charBudget(chunkSize)
+	turnWords := make([]int, len(turns))
+	for i, turn := range turns {
+		turnWords[i] = wordcount.Count(turn)
+	}
+	for i, turn := range turns {
+		words := turnWords[i]
+		if newTurns > 0 && (currentWords+words > chunkSize || currentChars+len(turn) > budget) {
+			chunks, counts = append(chunks, strings.Join(current, "\n")), append(counts, currentWords)
+
+			// Carry over trailing turns, never the whole chunk
+			carry, carried, carriedChars := i, 0, 0
+			for carry > start+1 {
+				if carried+turnWords[carry-1] > overlap || carriedChars+len(turns[carry-1]) > charBudget(overlap) {
+					break
+				}
+				carry--
+				carried += turnWords[carry]
+				carriedChars += len(turns[carry]) + 1
+			}
+			current, currentWords, newTurns, start = append([]string(nil), turns[carry:i]...), carried, 0, carry
+			currentChars = len(strings.Join(current, "\n"))
+		}
+		current = append(current, turn)
+		currentWords += words
+		currentChars += len(turn) + 1
+		newTurns++
+	}
+	if len(current) > 0 {
+		chunks, counts = append(chunks, strings.Join(current, "\n")), append(counts, currentWords)
+	}
+	return chunks, counts
+}
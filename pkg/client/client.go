@@ -0,0 +1,1049 @@
+// Package client is a typed Go client for the cutcrap HTTP API (see openapi.json).
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/eval"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+	"github.com/arnnvv/cutcrap/pkg/textdiff"
+	"github.com/arnnvv/cutcrap/pkg/transcript"
+)
+
+// Client talks to one cutcrap server
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// APIKey, when set, is sent as a bearer token: one of the server's API_KEYS, or of its
+	// ADMIN_API_KEYS for the admin methods
+	APIKey string
+}
+
+// New returns a Client for baseURL (e.g. "http://localhost:8080"). A nil httpClient uses a
+// client with a 10 minute timeout, long enough for large transcripts.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Minute}
+	}
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTPClient: httpClient}
+}
+
+// ProcessRequest is the input of /process. Exactly one of Text, Document, Upload, Archive or
+// Audio is set.
+type ProcessRequest struct {
+	Text        string
+	Document    string // hash of a document already in the server's document store
+	Upload      string // ID of a complete resumable upload (see UploadFile)
+	Archive     []byte // zip of .txt/.md documents
+	Audio       []byte // .mp3, .wav or .m4a recording, transcribed by the server
+	AudioName   string // file name of Audio; its extension gives the format
+	Ratio       float64
+	Mode        string // "document" (default), "transcript" or "speaker_summary"
+	TwoTrack    bool
+	TagTone     bool
+	TranslateTo string // ISO 639-1 code such as "de", or the language's English name
+	Seed        *int64
+	EmailTo     string // only used by ProcessAsync
+	WebhookURL  string // only used by ProcessAsync
+	Profile     string // server-configured profile; supplies Ratio and Mode when they are unset
+
+	// KeepSections are heading patterns of sections passed through verbatim (document mode)
+	KeepSections []string
+	// PruneReferences drops reference list entries the condensed document no longer cites
+	PruneReferences bool
+	// SkipSpeakerAnalysis skips the speaker analysis call for transcripts that already have clean
+	// "Name:" tags (transcript and speaker_summary modes)
+	SkipSpeakerAnalysis bool
+	// SpeakerAliases are "Canonical Name=alias, alias" entries naming the forms of a speaker's
+	// name to write as one (transcript mode)
+	SpeakerAliases []string
+	// KeepSpeakerNames turns off the automatic unification of titled and short forms of speaker
+	// names (transcript mode)
+	KeepSpeakerNames bool
+	// Priority is "low", "normal" (default) or "high"; it orders model calls when the server is busy
+	Priority string
+	// Output is "json" for a transcript returned as speaker turns instead of markdown, "srt" or
+	// "vtt" for subtitles re-timed from subtitle input, or "podlove_chapters" (Podlove Simple
+	// Chapters JSON) or "id3_chapters" (an FFmpeg metadata file of ID3v2 chapters) for the
+	// chapters of subtitle input
+	Output string
+	// Revises is the DocumentHash of a previous version of the document; its unchanged chunks
+	// keep their output instead of being condensed again (document mode)
+	Revises string
+	// SpeakerStyle ("bold" or "plain"), SpeakerSeparator ("colon" or "dash") and TurnSpacing
+	// ("blank_line" or "newline") lay out a transcript (transcript mode)
+	SpeakerStyle     string
+	SpeakerSeparator string
+	TurnSpacing      string
+	// IdempotencyKey is sent as the Idempotency-Key header: retrying the call with the same key
+	// gets the first response, and its job, instead of processing the input again
+	IdempotencyKey string
+}
+
+// ProcessResult is a finished /process response
+type ProcessResult struct {
+	JobID        string
+	JobIDs       []string // set for archive uploads
+	DocumentHash string
+	ContentType  string
+	Filename     string
+	Body         []byte
+
+	// Decoded JSON bodies, set for two_track, tag_tone and output=json requests respectively
+	TwoTrack   *TwoTrackResult
+	Transcript *TranscriptResult
+	Turns      *TranscriptTurnsResult
+}
+
+// Text returns the body as a string; for JSON results it is the condensed or tagged transcript
+func (r *ProcessResult) Text() string {
+	switch {
+	case r.TwoTrack != nil:
+		return r.TwoTrack.Condensed
+	case r.Transcript != nil:
+		return r.Transcript.Transcript
+	case r.Turns != nil:
+		lines := make([]string, len(r.Turns.Turns))
+		for i, turn := range r.Turns.Turns {
+			lines[i] = fmt.Sprintf("**%s**: %s", turn.Speaker, turn.Text)
+		}
+		return strings.Join(lines, "\n\n")
+	}
+	return string(r.Body)
+}
+
+// TwoTrackResult is the JSON response of a two_track request
+type TwoTrackResult struct {
+	Full             string              `json:"full"`
+	Condensed        string              `json:"condensed"`
+	FullMetrics      metrics.Report      `json:"full_metrics"`
+	CondensedMetrics metrics.Report      `json:"condensed_metrics"`
+	Stats            metrics.PoolSummary `json:"stats"`
+}
+
+// TranscriptResult is the JSON response of a tag_tone request
+type TranscriptResult struct {
+	Transcript string              `json:"transcript"`
+	Turns      []transcript.Turn   `json:"turns"`
+	Metrics    metrics.Report      `json:"metrics"`
+	Stats      metrics.PoolSummary `json:"stats"`
+}
+
+// TranscriptTurnsResult is the JSON response of an output=json request
+type TranscriptTurnsResult struct {
+	Speakers []string            `json:"speakers"`
+	Turns    []transcript.Turn   `json:"turns"`
+	Stats    metrics.PoolSummary `json:"stats"`
+}
+
+// Accepted is the response to an async request
+type Accepted struct {
+	Status     string `json:"status"`
+	EmailTo    string `json:"email_to"`
+	WebhookURL string `json:"webhook_url"`
+	JobID      string `json:"job_id"`
+}
+
+// Stream is an undecoded /process response whose body is read incrementally
+type Stream struct {
+	JobID        string
+	DocumentHash string
+	ContentType  string
+	Filename     string
+	Body         io.ReadCloser
+}
+
+// APIError is a non-success response from the server
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("cutcrap: status %d: %s", e.StatusCode, e.Message)
+}
+
+// Process runs a request and waits for the whole result
+func (c *Client) Process(ctx context.Context, req ProcessRequest) (*ProcessResult, error) {
+	req.EmailTo = ""
+	stream, err := c.ProcessStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Body.Close()
+
+	body, err := io.ReadAll(stream.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	result := &ProcessResult{
+		JobID:        stream.JobID,
+		DocumentHash: stream.DocumentHash,
+		ContentType:  stream.ContentType,
+		Filename:     stream.Filename,
+		Body:         body,
+	}
+
+	if strings.HasPrefix(stream.ContentType, "application/json") {
+		if req.TwoTrack {
+			result.TwoTrack = &TwoTrackResult{}
+			err = json.Unmarshal(body, result.TwoTrack)
+		} else if req.Output == "json" {
+			result.Turns = &TranscriptTurnsResult{}
+			err = json.Unmarshal(body, result.Turns)
+		} else {
+			result.Transcript = &TranscriptResult{}
+			err = json.Unmarshal(body, result.Transcript)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// ProcessStream runs a request and returns as soon as the response headers arrive, so large
+// results (PDFs, archives) can be copied without buffering. The caller closes Body.
+func (c *Client) ProcessStream(ctx context.Context, req ProcessRequest) (*Stream, error) {
+	resp, err := c.postProcess(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, readAPIError(resp)
+	}
+
+	stream := &Stream{
+		JobID:        resp.Header.Get("X-Job-ID"),
+		DocumentHash: resp.Header.Get("X-Document-Hash"),
+		ContentType:  resp.Header.Get("Content-Type"),
+		Body:         resp.Body,
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		stream.Filename = params["filename"]
+	}
+	return stream, nil
+}
+
+// ProcessArchive runs an archive request and also returns the job ID of every document
+func (c *Client) ProcessArchive(ctx context.Context, req ProcessRequest) (*ProcessResult, error) {
+	resp, err := c.postProcess(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	result := &ProcessResult{ContentType: resp.Header.Get("Content-Type"), Filename: "processed_documents.zip", Body: body}
+	if ids := resp.Header.Get("X-Job-IDs"); ids != "" {
+		result.JobIDs = strings.Split(ids, ",")
+	}
+	return result, nil
+}
+
+// ProcessAsync submits a request whose result is emailed to req.EmailTo and/or posted to
+// req.WebhookURL when it finishes. The server must have the delivery method enabled; use
+// webhook.Verify to check the signature of deliveries.
+func (c *Client) ProcessAsync(ctx context.Context, req ProcessRequest) (*Accepted, error) {
+	if req.EmailTo == "" && req.WebhookURL == "" {
+		return nil, fmt.Errorf("cutcrap: ProcessAsync requires EmailTo or WebhookURL")
+	}
+	resp, err := c.postProcess(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, readAPIError(resp)
+	}
+
+	var accepted Accepted
+	if err := json.NewDecoder(resp.Body).Decode(&accepted); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &accepted, nil
+}
+
+// Job fetches the reproducibility record of a job
+func (c *Client) Job(ctx context.Context, id string) (*jobs.Job, error) {
+	resp, err := c.do(ctx, "GET", "/v1/jobs/"+id, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var job jobs.Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	return &job, nil
+}
+
+// AdminJob is a job as the admin API reports it. Status is "running", "finished" or "cancelled".
+type AdminJob struct {
+	jobs.Job
+	Status string `json:"status"`
+}
+
+// AdminJobs lists the running and stored jobs, newest first, on the admin API (the client's
+// key must be one of the server's ADMIN_API_KEYS). status ("" for all) filters them and limit
+// (0 for the server's default) caps the list.
+func (c *Client) AdminJobs(ctx context.Context, status string, limit int) ([]AdminJob, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	resp, err := c.do(ctx, "GET", "/v1/admin/jobs?"+query.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var listing struct {
+		Jobs []AdminJob `json:"jobs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, fmt.Errorf("failed to decode jobs: %w", err)
+	}
+	return listing.Jobs, nil
+}
+
+// AdminJob fetches a running or stored job with its status from the admin API
+func (c *Client) AdminJob(ctx context.Context, id string) (*AdminJob, error) {
+	resp, err := c.do(ctx, "GET", "/v1/admin/jobs/"+id, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var job AdminJob
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	return &job, nil
+}
+
+// CancelJob cancels a running job through the admin API
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, "POST", "/v1/admin/jobs/"+id+"/cancel", nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return readAPIError(resp)
+	}
+	return nil
+}
+
+// RetryJob runs a finished or cancelled job again in the background through the admin API. The
+// new job's ID is in the returned Accepted.
+func (c *Client) RetryJob(ctx context.Context, id string) (*Accepted, error) {
+	resp, err := c.do(ctx, "POST", "/v1/admin/jobs/"+id+"/retry", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, readAPIError(resp)
+	}
+
+	var accepted Accepted
+	if err := json.NewDecoder(resp.Body).Decode(&accepted); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &accepted, nil
+}
+
+// Artifact is one format a job's result can be downloaded in
+type Artifact struct {
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	// Generated is false for a format the server converts on its first download
+	Generated bool   `json:"generated"`
+	Size      int64  `json:"size,omitempty"`
+	URL       string `json:"url"`
+}
+
+// Artifacts lists the formats a job's result can be downloaded in
+func (c *Client) Artifacts(ctx context.Context, id string) ([]Artifact, error) {
+	resp, err := c.do(ctx, "GET", "/v1/jobs/"+id+"/artifacts", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var listing struct {
+		Artifacts []Artifact `json:"artifacts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return nil, fmt.Errorf("failed to decode artifacts: %w", err)
+	}
+	return listing.Artifacts, nil
+}
+
+// DownloadArtifact downloads a job's result in format (e.g. "docx" or "pdf"). The caller closes
+// Body.
+func (c *Client) DownloadArtifact(ctx context.Context, id, format string) (*Stream, error) {
+	resp, err := c.do(ctx, "GET", "/v1/jobs/"+id+"/artifacts/"+format, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, readAPIError(resp)
+	}
+
+	stream := &Stream{JobID: id, ContentType: resp.Header.Get("Content-Type"), Body: resp.Body}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		stream.Filename = params["filename"]
+	}
+	return stream, nil
+}
+
+// SharedDownload is a signed link to an artifact that downloads without an API key
+type SharedDownload struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ShareArtifact signs a download link to a job's result in format, valid for ttl (0 uses the
+// server's default of a day), on servers with DOWNLOAD_SIGNING_SECRET set
+func (c *Client) ShareArtifact(ctx context.Context, id, format string, ttl time.Duration) (*SharedDownload, error) {
+	form := url.Values{}
+	if ttl > 0 {
+		form.Set("expires_in", strconv.Itoa(int(ttl.Seconds())))
+	}
+	resp, err := c.do(ctx, "POST", "/v1/jobs/"+id+"/artifacts/"+format+"/share", strings.NewReader(form.Encode()), "application/x-www-form-urlencoded")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var shared SharedDownload
+	if err := json.NewDecoder(resp.Body).Decode(&shared); err != nil {
+		return nil, fmt.Errorf("failed to decode shared download: %w", err)
+	}
+	return &shared, nil
+}
+
+// Upload is a resumable upload of a large source file, processed by setting ProcessRequest.Upload
+// once Complete
+type Upload struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	Complete  bool      `json:"complete"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// uploadChunkSize is how many bytes UploadFile sends per request
+const uploadChunkSize = 8 << 20 // 8 MB
+
+// CreateUpload starts a resumable upload of length bytes and returns its ID. The filename's
+// extension decides how the server reads it: .zip as an archive, audio formats as audio and
+// anything else as a text file.
+func (c *Client) CreateUpload(ctx context.Context, filename string, length int64) (string, error) {
+	header := http.Header{
+		"Tus-Resumable":   {"1.0.0"},
+		"Upload-Length":   {strconv.FormatInt(length, 10)},
+		"Upload-Metadata": {"filename " + base64.StdEncoding.EncodeToString([]byte(filename))},
+	}
+	resp, err := c.send(ctx, "POST", "/v1/uploads", nil, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", readAPIError(resp)
+	}
+	location := resp.Header.Get("Location")
+	return location[strings.LastIndex(location, "/")+1:], nil
+}
+
+// UploadStatus describes an upload, including how many bytes the server has
+func (c *Client) UploadStatus(ctx context.Context, id string) (*Upload, error) {
+	resp, err := c.do(ctx, "GET", "/v1/uploads/"+id, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var upload Upload
+	if err := json.NewDecoder(resp.Body).Decode(&upload); err != nil {
+		return nil, fmt.Errorf("failed to decode upload: %w", err)
+	}
+	return &upload, nil
+}
+
+// AppendUpload sends the next piece of an upload, which must start at offset, the number of
+// bytes the server has. It returns the new offset.
+func (c *Client) AppendUpload(ctx context.Context, id string, offset int64, piece io.Reader) (int64, error) {
+	header := http.Header{
+		"Tus-Resumable": {"1.0.0"},
+		"Content-Type":  {"application/offset+octet-stream"},
+		"Upload-Offset": {strconv.FormatInt(offset, 10)},
+	}
+	resp, err := c.send(ctx, "PATCH", "/v1/uploads/"+id, piece, header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, readAPIError(resp)
+	}
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
+
+// UploadFile uploads size bytes of data as filename in pieces and returns the upload ID. With a
+// non-empty id it resumes that upload from the offset the server reports instead of starting
+// a new one. A failed piece is retried from the server's offset up to three times.
+func (c *Client) UploadFile(ctx context.Context, id, filename string, data io.ReaderAt, size int64) (string, error) {
+	if id == "" {
+		var err error
+		if id, err = c.CreateUpload(ctx, filename, size); err != nil {
+			return "", err
+		}
+	}
+	status, err := c.UploadStatus(ctx, id)
+	if err != nil {
+		return id, err
+	}
+	offset, failures := status.Offset, 0
+	for offset < size {
+		piece := io.NewSectionReader(data, offset, min(uploadChunkSize, size-offset))
+		next, err := c.AppendUpload(ctx, id, offset, piece)
+		if err == nil {
+			offset, failures = next, 0
+			continue
+		}
+		if failures++; failures > 3 || ctx.Err() != nil {
+			return id, err
+		}
+		if status, err = c.UploadStatus(ctx, id); err != nil {
+			return id, err
+		}
+		offset = status.Offset
+	}
+	return id, nil
+}
+
+// DeleteUpload discards an upload
+func (c *Client) DeleteUpload(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, "DELETE", "/v1/uploads/"+id, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return readAPIError(resp)
+	}
+	return nil
+}
+
+// SearchResults is the response of /search
+type SearchResults struct {
+	Query   string         `json:"query"`
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+}
+
+// SearchResult is a job whose output matches a search
+type SearchResult struct {
+	JobID        string    `json:"job_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Mode         string    `json:"mode"`
+	DocumentHash string    `json:"document_hash"`
+	Score        float64   `json:"score"`
+	// Snippet is HTML with the matched words wrapped in <mark>
+	Snippet string `json:"snippet"`
+}
+
+// Search finds recorded jobs whose output contains every word of query. limit 0 uses the
+// server's default.
+func (c *Client) Search(ctx context.Context, query string, limit int) (*SearchResults, error) {
+	return c.search(ctx, "/v1/search", query, limit)
+}
+
+func (c *Client) search(ctx context.Context, path, query string, limit int) (*SearchResults, error) {
+	params := url.Values{"q": {query}}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	resp, err := c.do(ctx, "GET", path+"?"+params.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var results SearchResults
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("failed to decode search results: %w", err)
+	}
+	return &results, nil
+}
+
+// SemanticSearch finds recorded jobs whose output is closest in meaning to query, on servers
+// with EMBEDDING_MODEL configured. limit 0 uses the server's default.
+func (c *Client) SemanticSearch(ctx context.Context, query string, limit int) (*SearchResults, error) {
+	return c.search(ctx, "/v1/search/semantic", query, limit)
+}
+
+// Metrics is the process-wide worker pool state served at /metrics
+type Metrics struct {
+	Chunks           metrics.PoolSummary    `json:"chunks"`
+	SchedulerWaiting int                    `json:"scheduler_waiting"`
+	Janitor          metrics.JanitorSummary `json:"janitor"`
+}
+
+// Metrics fetches chunk latency, token throughput and failure stats across all jobs
+func (c *Client) Metrics(ctx context.Context) (*Metrics, error) {
+	resp, err := c.do(ctx, "GET", "/metrics", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var m Metrics
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode metrics: %w", err)
+	}
+	return &m, nil
+}
+
+// Reprocess runs a stored job again with the same source, settings and seed
+func (c *Client) Reprocess(ctx context.Context, id string) (*ProcessResult, error) {
+	resp, err := c.do(ctx, "POST", "/v1/jobs/"+id+"/reprocess", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return &ProcessResult{
+		JobID:        resp.Header.Get("X-Job-ID"),
+		DocumentHash: resp.Header.Get("X-Document-Hash"),
+		ContentType:  resp.Header.Get("Content-Type"),
+		Body:         body,
+	}, nil
+}
+
+// Refine condenses the output of a finished job further, to ratio of the original source.
+// ratio must be below the job's own ratio.
+func (c *Client) Refine(ctx context.Context, id string, ratio float64) (*ProcessResult, error) {
+	form := url.Values{"ratio": {strconv.FormatFloat(ratio, 'f', -1, 64)}}
+	resp, err := c.do(ctx, "POST", "/v1/jobs/"+id+"/refine", strings.NewReader(form.Encode()), "application/x-www-form-urlencoded")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return &ProcessResult{
+		JobID:        resp.Header.Get("X-Job-ID"),
+		DocumentHash: resp.Header.Get("X-Document-Hash"),
+		ContentType:  resp.Header.Get("Content-Type"),
+		Body:         body,
+	}, nil
+}
+
+// AskResult is the answer to a question about a job's processed document
+type AskResult struct {
+	JobID    string `json:"job_id"`
+	Question string `json:"question"`
+	// Answer cites chunks inline as [n]
+	Answer    string     `json:"answer"`
+	Citations []Citation `json:"citations"`
+}
+
+// Citation is a processed chunk an answer cites, numbered from 1 in document order
+type Citation struct {
+	Chunk int    `json:"chunk"`
+	Text  string `json:"text"`
+}
+
+// Ask answers a question grounded in the stored processed chunks of a recorded document job, on
+// servers with EMBEDDING_MODEL and the document store configured
+func (c *Client) Ask(ctx context.Context, id, question string) (*AskResult, error) {
+	form := url.Values{"question": {question}}
+	resp, err := c.do(ctx, "POST", "/v1/jobs/"+id+"/ask", strings.NewReader(form.Encode()), "application/x-www-form-urlencoded")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var result AskResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode answer: %w", err)
+	}
+	return &result, nil
+}
+
+// CompareDocumentsRequest is the input of /compare/documents: 2 to 5 recorded jobs and text files
+type CompareDocumentsRequest struct {
+	JobIDs []string
+	Files  []File
+	// Ratio the files are condensed at; the server defaults to 0.3
+	Ratio float64
+}
+
+// File is a named text file upload
+type File struct {
+	Name string
+	Data []byte
+}
+
+// DocumentComparison is the response of /compare/documents. Documents are numbered from 1, jobs
+// first, then files.
+type DocumentComparison struct {
+	Documents []struct {
+		Document int    `json:"document"`
+		JobID    string `json:"job_id"`
+		Filename string `json:"filename"`
+		Words    int    `json:"words"`
+	} `json:"documents"`
+	Agreements  []string `json:"agreements"`
+	Differences []string `json:"differences"`
+	Unique      []struct {
+		Document int      `json:"document"`
+		Points   []string `json:"points"`
+	} `json:"unique"`
+}
+
+// CompareDocuments summarizes what several documents agree on, where they differ and what only
+// one of them says. Files are condensed as new jobs first.
+func (c *Client) CompareDocuments(ctx context.Context, req CompareDocumentsRequest) (*DocumentComparison, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, id := range req.JobIDs {
+		if err := mw.WriteField("job", id); err != nil {
+			return nil, fmt.Errorf("failed to encode job: %w", err)
+		}
+	}
+	if req.Ratio != 0 {
+		if err := mw.WriteField("ratio", strconv.FormatFloat(req.Ratio, 'f', -1, 64)); err != nil {
+			return nil, fmt.Errorf("failed to encode ratio: %w", err)
+		}
+	}
+	for _, file := range req.Files {
+		fw, err := mw.CreateFormFile("files", file.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", file.Name, err)
+		}
+		fw.Write(file.Data)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	resp, err := c.do(ctx, "POST", "/v1/compare/documents", &body, mw.FormDataContentType())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var result DocumentComparison
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// CompareSide overrides the parameters of one side of a comparison; zero fields keep the
+// values of the request
+type CompareSide struct {
+	Ratio   float64
+	Profile string
+	Style   string
+	Model   string // must be a model configured on the server
+}
+
+// CompareResult is the response of /compare
+type CompareResult struct {
+	A    CompareOutput `json:"a"`
+	B    CompareOutput `json:"b"`
+	Diff []textdiff.Op `json:"diff"`
+}
+
+// CompareOutput is the output of one side of a comparison, recorded as its own job
+type CompareOutput struct {
+	JobID    string         `json:"job_id"`
+	Settings jobs.Settings  `json:"settings"`
+	Output   string         `json:"output"`
+	Metrics  metrics.Report `json:"metrics"`
+}
+
+// Compare runs req with two parameter sets and returns both outputs and their diff. req must
+// set Ratio or Profile; two_track, tag_tone, archives and email are not supported.
+func (c *Client) Compare(ctx context.Context, req ProcessRequest, a, b CompareSide) (*CompareResult, error) {
+	extra := make(map[string]string)
+	for prefix, side := range map[string]CompareSide{"a_": a, "b_": b} {
+		if side.Ratio != 0 {
+			extra[prefix+"ratio"] = strconv.FormatFloat(side.Ratio, 'f', -1, 64)
+		}
+		extra[prefix+"profile"], extra[prefix+"style"], extra[prefix+"model"] = side.Profile, side.Style, side.Model
+	}
+	resp, err := c.postForm(ctx, "/v1/compare", req, extra)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var result CompareResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// EvalRequest is the input of /eval: one set of settings and the items to process and score
+type EvalRequest struct {
+	Mode    string     `json:"mode,omitempty"`
+	Ratio   float64    `json:"ratio,omitempty"`
+	Profile string     `json:"profile,omitempty"`
+	Style   string     `json:"style,omitempty"`
+	Model   string     `json:"model,omitempty"`
+	Seed    *int64     `json:"seed,omitempty"`
+	Items   []EvalItem `json:"items"`
+	// Priority defaults to "low" on the server
+	Priority string `json:"priority,omitempty"`
+}
+
+// EvalItem is one source with an optional reference summary; an item with Output set is only scored
+type EvalItem struct {
+	ID        string `json:"id,omitempty"`
+	Text      string `json:"text"`
+	Reference string `json:"reference,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// EvalResult is the response of /eval
+type EvalResult struct {
+	Settings jobs.Settings `json:"settings"`
+	Items    []struct {
+		ID     string      `json:"id"`
+		JobID  string      `json:"job_id"`
+		Output string      `json:"output"`
+		Scores eval.Scores `json:"scores"`
+		Error  string      `json:"error"`
+	} `json:"items"`
+	Mean eval.Scores `json:"mean"`
+}
+
+// Evaluate processes a batch of items and scores the outputs against their references
+func (c *Client) Evaluate(ctx context.Context, req EvalRequest) (*EvalResult, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	resp, err := c.do(ctx, "POST", "/v1/eval", bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var result EvalResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// postProcess encodes req as the multipart form expected by /process
+func (c *Client) postProcess(ctx context.Context, req ProcessRequest) (*http.Response, error) {
+	return c.postForm(ctx, "/v1/process", req, nil)
+}
+
+// postForm posts req, plus extra fields, as a /process multipart form to path
+func (c *Client) postForm(ctx context.Context, path string, req ProcessRequest, extra map[string]string) (*http.Response, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	fields := map[string]string{
+		"text":         req.Text,
+		"document":     req.Document,
+		"upload":       req.Upload,
+		"mode":         req.Mode,
+		"translate_to": req.TranslateTo,
+		"email_to":     req.EmailTo,
+		"webhook_url":  req.WebhookURL,
+		"profile":      req.Profile,
+		"priority":     req.Priority,
+		"output":       req.Output,
+		"revises":      req.Revises,
+
+		"speaker_style":     req.SpeakerStyle,
+		"speaker_separator": req.SpeakerSeparator,
+		"turn_spacing":      req.TurnSpacing,
+	}
+	for name, value := range extra {
+		fields[name] = value
+	}
+	if req.Ratio != 0 {
+		fields["ratio"] = strconv.FormatFloat(req.Ratio, 'f', -1, 64)
+	}
+	if req.TwoTrack {
+		fields["two_track"] = "true"
+	}
+	if req.TagTone {
+		fields["tag_tone"] = "true"
+	}
+	if req.PruneReferences {
+		fields["prune_references"] = "true"
+	}
+	if req.SkipSpeakerAnalysis {
+		fields["skip_speaker_analysis"] = "true"
+	}
+	if req.KeepSpeakerNames {
+		fields["keep_speaker_names"] = "true"
+	}
+	if req.Seed != nil {
+		fields["seed"] = strconv.FormatInt(*req.Seed, 10)
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := mw.WriteField(name, value); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+	}
+
+	for _, pattern := range req.KeepSections {
+		if err := mw.WriteField("keep_sections", pattern); err != nil {
+			return nil, fmt.Errorf("failed to encode keep_sections: %w", err)
+		}
+	}
+	for _, entry := range req.SpeakerAliases {
+		if err := mw.WriteField("speaker_aliases", entry); err != nil {
+			return nil, fmt.Errorf("failed to encode speaker_aliases: %w", err)
+		}
+	}
+
+	if req.Archive != nil {
+		fw, err := mw.CreateFormFile("archive", "documents.zip")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode archive: %w", err)
+		}
+		fw.Write(req.Archive)
+	}
+	if req.Audio != nil {
+		fw, err := mw.CreateFormFile("audio", req.AudioName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode audio: %w", err)
+		}
+		fw.Write(req.Audio)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	header := http.Header{"Content-Type": {mw.FormDataContentType()}}
+	if req.IdempotencyKey != "" {
+		header.Set("Idempotency-Key", req.IdempotencyKey)
+	}
+	return c.send(ctx, "POST", path, &body, header)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return c.send(ctx, method, path, body, header)
+}
+
+// send is do with any request headers
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	return resp, nil
+}
+
+func readAPIError(resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+}
@@ -4,17 +4,212 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
 )
 
 type Config struct {
 	Port           string
 	OpenRouterKey  string
+	GeminiBaseURL  string
+	LLMRecordMode  string
+	LLMRecordDir   string
 	MaxConcurrent  int
 	RequestTimeout time.Duration
+	// JobTimeoutMax caps the deadline of a job, which is otherwise RequestTimeout for each wave
+	// of MaxConcurrent chunks plus two for the calls around them
+	JobTimeoutMax  time.Duration
 	ChunkSize      int
 	ChunkOverlap   int
 	Pdf_api        string
+	JobStoreMax    int
+	DocumentDir    string
+	PostProcessors []string
+	PreHooks       []string
+	PostHooks      []string
+	HookTimeout    time.Duration
+
+	// HTTPMaxIdleConnsPerHost is how many idle connections to each upstream host (the model API,
+	// PDF_API, hooks) are kept for reuse
+	HTTPMaxIdleConnsPerHost int
+
+	// GlobalMaxConcurrent bounds the model calls in flight across all jobs, which get free slots
+	// by request priority (0 disables)
+	GlobalMaxConcurrent int
+
+	// Logging: LogLevel is debug, info, warn or error; LogFormat is text or json; LogOutput is
+	// stderr, stdout, syslog or a file path, rotated past LogMaxSizeMB keeping LogMaxBackups files
+	LogLevel      string
+	LogFormat     string
+	LogOutput     string
+	LogMaxSizeMB  int
+	LogMaxBackups int
+
+	// MaxChunks caps the chunks per job: larger inputs get a bigger chunk size, up to
+	// MaxChunkSize words, and inputs that still don't fit are rejected (0 disables)
+	MaxChunks    int
+	MaxChunkSize int
+
+	// SmallInputWords sends inputs shorter than this many words to the model in one call with a
+	// whole-document prompt, skipping chunking and the worker pool (0, the default, disables)
+	SmallInputWords int
+
+	// StreamMinWords streams document results to the client as chunks are combined for inputs of at
+	// least this many words, instead of building the whole output in memory (0 disables)
+	StreamMinWords int
+
+	// Keep-alive output for long synchronous requests, picked by response type: event streams get
+	// a comment every HeartbeatInterval. With HeartbeatMode "whitespace", plain-text and JSON
+	// responses get a newline too; that is opt-in, as the first newline commits a 200 status and a
+	// later failure can then only be reported in the body. "sse" (the default) keeps only the
+	// event stream comments, and "off" disables both.
+	HeartbeatInterval time.Duration
+	HeartbeatMode     string
+
+	// Profiles are named processing defaults selectable with the profile form field, as
+	// "name:key=value,key=value;name:..." with keys mode, ratio, style, model and format
+	Profiles string
+
+	// ArchiveMaxFiles caps the number of documents processed from one zip upload
+	ArchiveMaxFiles int
+
+	// SMTP settings for email_to delivery; disabled when SMTPHost is empty
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// Webhook delivery for webhook_url; disabled when WebhookSecret (the HMAC signing key) is
+	// empty. Deliveries are retried up to WebhookMaxAttempts times, and ones that still fail are
+	// appended to WebhookDeadLetterFile when it is set.
+	WebhookSecret         string
+	WebhookMaxAttempts    int
+	WebhookTimeout        time.Duration
+	WebhookDeadLetterFile string
+
+	// APIKeys are the keys accepted as bearer tokens or X-API-Key on the API (empty disables
+	// authentication). RateLimitPerMinute caps the requests of each key, or each address without
+	// keys, allowing bursts of RateLimitBurst (0 disables).
+	APIKeys            []string
+	RateLimitPerMinute int
+	RateLimitBurst     int
+
+	// AdminAPIKeys are the keys accepted on the admin API (/v1/admin), which lists, cancels and
+	// retries jobs; empty disables it
+	AdminAPIKeys []string
+
+	// Signed download links for job artifacts; disabled when DownloadSigningSecret (the HMAC
+	// signing key) is empty. Links are valid for at most DownloadURLMaxTTL.
+	DownloadSigningSecret string
+	DownloadURLMaxTTL     time.Duration
+
+	// ArtifactCacheMaxMB caps the job results and converted artifacts kept in memory when the
+	// document store is not enabled; the oldest are dropped first (0 for no limit)
+	ArtifactCacheMaxMB int
+
+	// IdempotencyTTL is how long the response to a POST with an Idempotency-Key is replayed to
+	// retries with the same key (0 disables), and IdempotencyMaxMB caps the size of the
+	// responses kept for them (0 for no limit)
+	IdempotencyTTL   time.Duration
+	IdempotencyMaxMB int
+
+	// Chat integrations (Slack, Telegram) process with these settings unless the message overrides them
+	IntegrationMode    string
+	IntegrationRatio   float64
+	SlackSigningSecret string
+	SlackBotToken      string
+	SlackAPIURL        string
+	TelegramBotToken   string
+	TelegramAPIURL     string
+
+	// Audio uploads are transcribed by TranscribeBackend: "whisper-cpp" runs TranscribeCommand (a
+	// whisper.cpp CLI with its model arguments), "api" posts to an OpenAI-compatible
+	// TranscribeAPIURL; empty disables audio uploads
+	TranscribeBackend string
+	TranscribeCommand string
+	TranscribeAPIURL  string
+	TranscribeAPIKey  string
+	TranscribeModel   string
+	TranscribeTimeout time.Duration
+
+	// KeepSections are heading patterns whose sections are passed through verbatim in document mode
+	KeepSections []string
+	// ReferenceSections are heading patterns of reference lists, passed through verbatim (and
+	// pruned on request) in document mode. "none" turns reference lists into ordinary sections.
+	ReferenceSections []string
+
+	// DensityStrength shifts each chunk's share of the word budget towards information-dense
+	// chunks: 0 (the default) keeps a uniform target per chunk, 1 scales fully by relative density
+	DensityStrength float64
+
+	// ContextCacheMinChunks enables Gemini context caching of the instructions and the document for
+	// jobs with at least this many chunks routed to FAST_MODEL, which then use the cache; chunks
+	// routed to STRONG_MODEL still get the full prompt (0 disables)
+	ContextCacheMinChunks int
+	ContextCacheTTL       time.Duration
+
+	// SpeakerCacheSize is how many speaker analyses are kept in memory by transcript hash, so
+	// re-running a transcript skips the analysis call (0 disables)
+	SpeakerCacheSize int
+	// SpeakerNames is how markdown-significant characters (asterisks, brackets, colons) in
+	// speaker names are written in transcripts: "escape", "strip" or "off"
+	SpeakerNames string
+
+	// ResultRetention is how long finished jobs and stored results are kept before the janitor
+	// deletes them (0 keeps them forever); JanitorInterval is how often it runs
+	ResultRetention time.Duration
+	JanitorInterval time.Duration
+
+	// UploadDir keeps resumable uploads of large source files (empty disables them); uploads
+	// are deleted UploadExpiry after they were started, complete or not
+	UploadDir    string
+	UploadExpiry time.Duration
+	// UploadMaxPerKey caps the uploads one API key and tenant may hold at once, and
+	// UploadMaxTotalMB the declared size of all uploads together (0 for no limit)
+	UploadMaxPerKey  int
+	UploadMaxTotalMB int
+
+	// Model routing: chunks go to FastModel unless they exceed the routing thresholds
+	FastModel                string
+	StrongModel              string
+	RouteWordThreshold       int
+	RouteComplexityThreshold float64
+
+	// Provider is the model backend: "gemini", "vertex" (Gemini on Vertex AI, authenticated with
+	// Google Cloud application default credentials), "azure" (Azure OpenAI chat completions) or
+	// "bedrock" (AWS Bedrock Converse). ProviderModels maps the Gemini model names used by the
+	// prompts to the backend's, as "gemini-model=backend-model,..."; unmapped models go to
+	// AzureDeployment or BedrockModelID. An empty AzureAPIVersion uses api.DefaultAzureAPIVersion.
+	Provider        string
+	ProviderModels  string
+	AzureEndpoint   string
+	AzureAPIKey     string
+	AzureAPIVersion string
+	AzureDeployment string
+	BedrockRegion   string
+	BedrockModelID  string
+	VertexProject   string
+	VertexLocation  string
+
+	// Hooks on every model API request: ProviderHeaders are extra headers as
+	// "Name: value; Name: value", ProviderAllowedHosts (when set) are the only hosts requests may
+	// go to, and ProviderAuditLog is a file getting a JSON line per request. Requests for Vertex
+	// or Bedrock credentials (Google's token and metadata endpoints, AWS's metadata endpoints)
+	// are not model API requests and skip the hooks.
+	ProviderHeaders      string
+	ProviderAllowedHosts []string
+	ProviderAuditLog     string
+
+	// MaxInputTokens is the estimated token size past which a chunk is split in half before it
+	// is sent, as it would exceed the model's context (0 only splits chunks the model rejects)
+	MaxInputTokens int
+
+	// EmbeddingModel is the Gemini embedding model job outputs are indexed with for
+	// /search/semantic and job sources for /jobs/{id}/ask (empty disables both)
+	EmbeddingModel string
 }
 
 func Load() *Config {
@@ -23,34 +218,359 @@ func Load() *Config {
 	port := getEnv("PORT", "8080")
 	log.Printf("PORT: %s", port)
 
+	secrets := newSecretProvider()
+	secretsPrefix := getEnv("SECRETS_PREFIX", "")
+
 	pdf_api := getEnv("PDF_API", "")
-	apiKey := getEnv("OPENROUTER_API_KEY", "")
+	apiKey := getSecret(secrets, secretsPrefix, "OPENROUTER_API_KEY")
 	if apiKey == "" {
-		log.Printf("WARNING: OPENROUTER_API_KEY not set")
+		logging.Warnf("OPENROUTER_API_KEY not set")
 	} else {
 		log.Printf("OPENROUTER_API_KEY: [REDACTED]")
 	}
 
+	geminiBaseURL := getEnv("GEMINI_BASE_URL", "")
+	log.Printf("GEMINI_BASE_URL: %s", geminiBaseURL)
+
+	provider := getEnv("PROVIDER", "gemini")
+	providerModels := getEnv("PROVIDER_MODELS", "")
+	log.Printf("PROVIDER: %s, PROVIDER_MODELS: %s", provider, providerModels)
+	azureEndpoint := getEnv("AZURE_OPENAI_ENDPOINT", "")
+	azureAPIKey := getSecret(secrets, secretsPrefix, "AZURE_OPENAI_API_KEY")
+	azureAPIVersion := getEnv("AZURE_OPENAI_API_VERSION", "")
+	azureDeployment := getEnv("AZURE_OPENAI_DEPLOYMENT", "")
+	if provider == "azure" {
+		log.Printf("AZURE_OPENAI_ENDPOINT: %s, AZURE_OPENAI_API_KEY: [REDACTED], AZURE_OPENAI_API_VERSION: %s, AZURE_OPENAI_DEPLOYMENT: %s",
+			azureEndpoint, azureAPIVersion, azureDeployment)
+	}
+	bedrockRegion := getEnv("BEDROCK_REGION", getEnv("AWS_REGION", ""))
+	bedrockModelID := getEnv("BEDROCK_MODEL_ID", "")
+	if provider == "bedrock" {
+		log.Printf("BEDROCK_REGION: %s, BEDROCK_MODEL_ID: %s", bedrockRegion, bedrockModelID)
+	}
+	providerHeaders := getEnv("PROVIDER_HEADERS", "")
+	providerAllowedHosts := getEnvAsList("PROVIDER_ALLOWED_HOSTS", nil)
+	providerAuditLog := getEnv("PROVIDER_AUDIT_LOG", "")
+	if providerHeaders != "" {
+		// Header values are often gateway credentials
+		log.Printf("PROVIDER_HEADERS: [REDACTED]")
+	}
+	log.Printf("PROVIDER_ALLOWED_HOSTS: %v, PROVIDER_AUDIT_LOG: %s", providerAllowedHosts, providerAuditLog)
+	vertexProject := getEnv("VERTEX_PROJECT", getEnv("GOOGLE_CLOUD_PROJECT", ""))
+	vertexLocation := getEnv("VERTEX_LOCATION", "us-central1")
+	if provider == "vertex" {
+		log.Printf("VERTEX_PROJECT: %s, VERTEX_LOCATION: %s", vertexProject, vertexLocation)
+	}
+
+	llmRecordMode := getEnv("LLM_RECORD_MODE", "")
+	llmRecordDir := getEnv("LLM_RECORD_DIR", "testdata/llm")
+	if llmRecordMode != "" {
+		log.Printf("LLM_RECORD_MODE: %s, LLM_RECORD_DIR: %s", llmRecordMode, llmRecordDir)
+	}
+
 	maxConcurrent := getEnvAsInt("MAX_CONCURRENT", 10)
 	log.Printf("MAX_CONCURRENT: %d", maxConcurrent)
 
-	requestTimeout := getEnvAsDuration("REQUEST_TIMEOUT", 30*time.Second)
-	log.Printf("REQUEST_TIMEOUT: %v", requestTimeout)
+	globalMaxConcurrent := getEnvAsInt("GLOBAL_MAX_CONCURRENT", 30)
+	log.Printf("GLOBAL_MAX_CONCURRENT: %d", globalMaxConcurrent)
+
+	httpMaxIdleConnsPerHost := getEnvAsInt("HTTP_MAX_IDLE_CONNS_PER_HOST", 64)
+	log.Printf("HTTP_MAX_IDLE_CONNS_PER_HOST: %d", httpMaxIdleConnsPerHost)
+
+	requestTimeout := getEnvAsDuration("REQUEST_TIMEOUT", 60*time.Second)
+	jobTimeoutMax := getEnvAsDuration("JOB_TIMEOUT_MAX", 30*time.Minute)
+	log.Printf("REQUEST_TIMEOUT: %v, JOB_TIMEOUT_MAX: %v", requestTimeout, jobTimeoutMax)
 
 	chunkSize := getEnvAsInt("CHUNK_SIZE", 900)
 	log.Printf("CHUNK_SIZE: %d", chunkSize)
 
-	chunkOverlap := getEnvAsInt("CHUNK_OVERLAP", 100)
+	chunkOverlap := getEnvAsInt("CHUNK_OVERLAP", 0)
 	log.Printf("CHUNK_OVERLAP: %d", chunkOverlap)
 
+	jobStoreMax := getEnvAsInt("JOB_STORE_MAX", 100)
+	log.Printf("JOB_STORE_MAX: %d", jobStoreMax)
+
+	documentDir := getEnv("DOCUMENT_STORE_DIR", "")
+	log.Printf("DOCUMENT_STORE_DIR: %s", documentDir)
+
+	maxChunks := getEnvAsInt("MAX_CHUNKS", 200)
+	maxChunkSize := getEnvAsInt("MAX_CHUNK_SIZE", 3000)
+	log.Printf("MAX_CHUNKS: %d, MAX_CHUNK_SIZE: %d", maxChunks, maxChunkSize)
+	maxInputTokens := getEnvAsInt("MAX_INPUT_TOKENS", 0)
+	log.Printf("MAX_INPUT_TOKENS: %d", maxInputTokens)
+
+	smallInputWords := getEnvAsInt("SMALL_INPUT_WORDS", 0)
+	log.Printf("SMALL_INPUT_WORDS: %d", smallInputWords)
+
+	streamMinWords := getEnvAsInt("STREAM_MIN_WORDS", 50000)
+	log.Printf("STREAM_MIN_WORDS: %d", streamMinWords)
+
+	heartbeatInterval := getEnvAsDuration("HEARTBEAT_INTERVAL", 20*time.Second)
+	heartbeatMode := getEnv("HEARTBEAT_MODE", "sse")
+	log.Printf("HEARTBEAT_INTERVAL: %v, HEARTBEAT_MODE: %s", heartbeatInterval, heartbeatMode)
+
+	profiles := getEnv("PROFILES", "exec-summary:ratio=0.05,style=professional;study-notes:ratio=0.3,style=simple")
+	log.Printf("PROFILES: %s", profiles)
+
+	archiveMaxFiles := getEnvAsInt("ARCHIVE_MAX_FILES", 50)
+	log.Printf("ARCHIVE_MAX_FILES: %d", archiveMaxFiles)
+
+	smtpHost := getEnv("SMTP_HOST", "")
+	smtpPort := getEnv("SMTP_PORT", "587")
+	smtpUsername := getEnv("SMTP_USERNAME", "")
+	smtpPassword := getSecret(secrets, secretsPrefix, "SMTP_PASSWORD")
+	smtpFrom := getEnv("SMTP_FROM", smtpUsername)
+	if smtpHost != "" {
+		log.Printf("SMTP_HOST: %s, SMTP_PORT: %s, SMTP_FROM: %s", smtpHost, smtpPort, smtpFrom)
+	}
+
+	webhookSecret := getSecret(secrets, secretsPrefix, "WEBHOOK_SECRET")
+	webhookMaxAttempts := getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 5)
+	webhookTimeout := getEnvAsDuration("WEBHOOK_TIMEOUT", 30*time.Second)
+	webhookDeadLetterFile := getEnv("WEBHOOK_DEAD_LETTER_FILE", "")
+	if webhookSecret != "" {
+		log.Printf("WEBHOOK_SECRET: [REDACTED], WEBHOOK_MAX_ATTEMPTS: %d, WEBHOOK_TIMEOUT: %v, WEBHOOK_DEAD_LETTER_FILE: %s",
+			webhookMaxAttempts, webhookTimeout, webhookDeadLetterFile)
+	}
+
+	var apiKeys []string
+	for _, key := range strings.Split(getSecret(secrets, secretsPrefix, "API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			apiKeys = append(apiKeys, key)
+		}
+	}
+	rateLimitPerMinute := getEnvAsInt("RATE_LIMIT_PER_MINUTE", 0)
+	rateLimitBurst := getEnvAsInt("RATE_LIMIT_BURST", rateLimitPerMinute)
+	log.Printf("API_KEYS: %d configured, RATE_LIMIT_PER_MINUTE: %d, RATE_LIMIT_BURST: %d", len(apiKeys), rateLimitPerMinute, rateLimitBurst)
+
+	var adminAPIKeys []string
+	for _, key := range strings.Split(getSecret(secrets, secretsPrefix, "ADMIN_API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			adminAPIKeys = append(adminAPIKeys, key)
+		}
+	}
+	log.Printf("ADMIN_API_KEYS: %d configured", len(adminAPIKeys))
+
+	downloadSigningSecret := getSecret(secrets, secretsPrefix, "DOWNLOAD_SIGNING_SECRET")
+	downloadURLMaxTTL := getEnvAsDuration("DOWNLOAD_URL_MAX_TTL", 7*24*time.Hour)
+	if downloadSigningSecret != "" {
+		log.Printf("DOWNLOAD_SIGNING_SECRET: [REDACTED], DOWNLOAD_URL_MAX_TTL: %v", downloadURLMaxTTL)
+	}
+	artifactCacheMaxMB := getEnvAsInt("ARTIFACT_CACHE_MAX_MB", 256)
+	log.Printf("ARTIFACT_CACHE_MAX_MB: %d", artifactCacheMaxMB)
+
+	idempotencyTTL := getEnvAsDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	idempotencyMaxMB := getEnvAsInt("IDEMPOTENCY_MAX_MB", 64)
+	log.Printf("IDEMPOTENCY_TTL: %v, IDEMPOTENCY_MAX_MB: %d", idempotencyTTL, idempotencyMaxMB)
+
+	integrationMode := getEnv("INTEGRATION_MODE", "transcript")
+	integrationRatio := getEnvAsFloat("INTEGRATION_RATIO", 0.5)
+	log.Printf("INTEGRATION_MODE: %s, INTEGRATION_RATIO: %.2f", integrationMode, integrationRatio)
+
+	slackSigningSecret := getSecret(secrets, secretsPrefix, "SLACK_SIGNING_SECRET")
+	slackBotToken := getSecret(secrets, secretsPrefix, "SLACK_BOT_TOKEN")
+	slackAPIURL := getEnv("SLACK_API_URL", "")
+	if slackSigningSecret != "" {
+		log.Printf("SLACK_SIGNING_SECRET: [REDACTED], SLACK_API_URL: %s", slackAPIURL)
+	}
+
+	telegramBotToken := getSecret(secrets, secretsPrefix, "TELEGRAM_BOT_TOKEN")
+	telegramAPIURL := getEnv("TELEGRAM_API_URL", "")
+	if telegramBotToken != "" {
+		log.Printf("TELEGRAM_BOT_TOKEN: [REDACTED], TELEGRAM_API_URL: %s", telegramAPIURL)
+	}
+
+	transcribeBackend := getEnv("TRANSCRIBE_BACKEND", "")
+	transcribeCommand := getEnv("TRANSCRIBE_COMMAND", "")
+	transcribeAPIURL := getEnv("TRANSCRIBE_API_URL", "https://api.openai.com/v1/audio/transcriptions")
+	transcribeAPIKey := getSecret(secrets, secretsPrefix, "TRANSCRIBE_API_KEY")
+	transcribeModel := getEnv("TRANSCRIBE_MODEL", "whisper-1")
+	transcribeTimeout := getEnvAsDuration("TRANSCRIBE_TIMEOUT", 15*time.Minute)
+	if transcribeBackend != "" {
+		log.Printf("TRANSCRIBE_BACKEND: %s, TRANSCRIBE_COMMAND: %s, TRANSCRIBE_API_URL: %s, TRANSCRIBE_MODEL: %s, TRANSCRIBE_TIMEOUT: %v",
+			transcribeBackend, transcribeCommand, transcribeAPIURL, transcribeModel, transcribeTimeout)
+	}
+
+	// Post-processors are opt-in: any of them turns off streaming (see Engine.CanStream)
+	postProcessors := noneAsEmpty(getEnvAsList("POST_PROCESSORS", nil))
+	log.Printf("POST_PROCESSORS: %v", postProcessors)
+
+	preHooks := getEnvAsList("PRE_HOOKS", nil)
+	postHooks := getEnvAsList("POST_HOOKS", nil)
+	log.Printf("PRE_HOOKS: %d configured, POST_HOOKS: %d configured", len(preHooks), len(postHooks))
+
+	hookTimeout := getEnvAsDuration("HOOK_TIMEOUT", 30*time.Second)
+	log.Printf("HOOK_TIMEOUT: %v", hookTimeout)
+
+	keepSections := getEnvAsList("KEEP_SECTIONS", nil)
+	log.Printf("KEEP_SECTIONS: %v", keepSections)
+
+	referenceSections := noneAsEmpty(getEnvAsList("REFERENCE_SECTIONS", []string{"References", "Bibliography", "Works Cited", "Literature Cited", "Sources", "Notes", "Footnotes", "Endnotes"}))
+	log.Printf("REFERENCE_SECTIONS: %v", referenceSections)
+
+	densityStrength := getEnvAsFloat("DENSITY_STRENGTH", 0)
+	log.Printf("DENSITY_STRENGTH: %.2f", densityStrength)
+
+	contextCacheMinChunks := getEnvAsInt("CONTEXT_CACHE_MIN_CHUNKS", 0)
+	contextCacheTTL := getEnvAsDuration("CONTEXT_CACHE_TTL", 10*time.Minute)
+	log.Printf("CONTEXT_CACHE_MIN_CHUNKS: %d, CONTEXT_CACHE_TTL: %v", contextCacheMinChunks, contextCacheTTL)
+
+	speakerCacheSize := getEnvAsInt("SPEAKER_CACHE_SIZE", 100)
+	speakerNames := getEnv("SPEAKER_NAMES", "escape")
+	log.Printf("SPEAKER_CACHE_SIZE: %d, SPEAKER_NAMES: %s", speakerCacheSize, speakerNames)
+
+	resultRetention := getEnvAsDuration("RESULT_RETENTION", 0)
+	janitorInterval := getEnvAsDuration("JANITOR_INTERVAL", time.Hour)
+	log.Printf("RESULT_RETENTION: %v, JANITOR_INTERVAL: %v", resultRetention, janitorInterval)
+
+	uploadDir := getEnv("UPLOAD_DIR", "")
+	uploadExpiry := getEnvAsDuration("UPLOAD_EXPIRY", 24*time.Hour)
+	uploadMaxPerKey := getEnvAsInt("UPLOAD_MAX_PER_KEY", 5)
+	uploadMaxTotalMB := getEnvAsInt("UPLOAD_MAX_TOTAL_MB", 2048)
+	log.Printf("UPLOAD_DIR: %s, UPLOAD_EXPIRY: %v, UPLOAD_MAX_PER_KEY: %d, UPLOAD_MAX_TOTAL_MB: %d",
+		uploadDir, uploadExpiry, uploadMaxPerKey, uploadMaxTotalMB)
+
+	fastModel := getEnv("MODEL_FAST", "gemini-1.5-flash")
+	strongModel := getEnv("MODEL_STRONG", "")
+	routeWordThreshold := getEnvAsInt("ROUTE_WORD_THRESHOLD", 0)
+	routeComplexityThreshold := getEnvAsFloat("ROUTE_COMPLEXITY_THRESHOLD", 0.3)
+	log.Printf("MODEL_FAST: %s, MODEL_STRONG: %s, ROUTE_WORD_THRESHOLD: %d, ROUTE_COMPLEXITY_THRESHOLD: %.2f",
+		fastModel, strongModel, routeWordThreshold, routeComplexityThreshold)
+
+	logLevel := getEnv("LOG_LEVEL", "info")
+	logFormat := getEnv("LOG_FORMAT", "text")
+	logOutput := getEnv("LOG_OUTPUT", "stderr")
+	logMaxSizeMB := getEnvAsInt("LOG_MAX_SIZE_MB", 100)
+	logMaxBackups := getEnvAsInt("LOG_MAX_BACKUPS", 5)
+	log.Printf("LOG_LEVEL: %s, LOG_FORMAT: %s, LOG_OUTPUT: %s", logLevel, logFormat, logOutput)
+
+	embeddingModel := getEnv("EMBEDDING_MODEL", "")
+	log.Printf("EMBEDDING_MODEL: %s", embeddingModel)
+
 	return &Config{
 		Port:           port,
 		OpenRouterKey:  apiKey,
+		GeminiBaseURL:  geminiBaseURL,
+		LLMRecordMode:  llmRecordMode,
+		LLMRecordDir:   llmRecordDir,
 		MaxConcurrent:  maxConcurrent,
 		RequestTimeout: requestTimeout,
+		JobTimeoutMax:  jobTimeoutMax,
 		ChunkSize:      chunkSize,
 		ChunkOverlap:   chunkOverlap,
 		Pdf_api:        pdf_api,
+		JobStoreMax:    jobStoreMax,
+		DocumentDir:    documentDir,
+		PostProcessors: postProcessors,
+		PreHooks:       preHooks,
+		PostHooks:      postHooks,
+		HookTimeout:    hookTimeout,
+
+		GlobalMaxConcurrent: globalMaxConcurrent,
+
+		HTTPMaxIdleConnsPerHost: httpMaxIdleConnsPerHost,
+
+		LogLevel:      logLevel,
+		LogFormat:     logFormat,
+		LogOutput:     logOutput,
+		LogMaxSizeMB:  logMaxSizeMB,
+		LogMaxBackups: logMaxBackups,
+
+		MaxChunks:    maxChunks,
+		MaxChunkSize: maxChunkSize,
+
+		SmallInputWords: smallInputWords,
+
+		StreamMinWords: streamMinWords,
+
+		HeartbeatInterval: heartbeatInterval,
+		HeartbeatMode:     heartbeatMode,
+
+		Profiles: profiles,
+
+		ArchiveMaxFiles: archiveMaxFiles,
+
+		SMTPHost:     smtpHost,
+		SMTPPort:     smtpPort,
+		SMTPUsername: smtpUsername,
+		SMTPPassword: smtpPassword,
+		SMTPFrom:     smtpFrom,
+
+		WebhookSecret:         webhookSecret,
+		WebhookMaxAttempts:    webhookMaxAttempts,
+		WebhookTimeout:        webhookTimeout,
+		WebhookDeadLetterFile: webhookDeadLetterFile,
+
+		APIKeys:            apiKeys,
+		RateLimitPerMinute: rateLimitPerMinute,
+		RateLimitBurst:     rateLimitBurst,
+
+		AdminAPIKeys: adminAPIKeys,
+
+		DownloadSigningSecret: downloadSigningSecret,
+		DownloadURLMaxTTL:     downloadURLMaxTTL,
+		ArtifactCacheMaxMB:    artifactCacheMaxMB,
+
+		IdempotencyTTL:   idempotencyTTL,
+		IdempotencyMaxMB: idempotencyMaxMB,
+
+		IntegrationMode:    integrationMode,
+		IntegrationRatio:   integrationRatio,
+		SlackSigningSecret: slackSigningSecret,
+		SlackBotToken:      slackBotToken,
+		SlackAPIURL:        slackAPIURL,
+		TelegramBotToken:   telegramBotToken,
+		TelegramAPIURL:     telegramAPIURL,
+
+		TranscribeBackend: transcribeBackend,
+		TranscribeCommand: transcribeCommand,
+		TranscribeAPIURL:  transcribeAPIURL,
+		TranscribeAPIKey:  transcribeAPIKey,
+		TranscribeModel:   transcribeModel,
+		TranscribeTimeout: transcribeTimeout,
+
+		KeepSections:      keepSections,
+		ReferenceSections: referenceSections,
+
+		DensityStrength: densityStrength,
+
+		ContextCacheMinChunks: contextCacheMinChunks,
+		ContextCacheTTL:       contextCacheTTL,
+
+		SpeakerCacheSize: speakerCacheSize,
+		SpeakerNames:     speakerNames,
+
+		ResultRetention: resultRetention,
+		JanitorInterval: janitorInterval,
+
+		UploadDir:        uploadDir,
+		UploadExpiry:     uploadExpiry,
+		UploadMaxPerKey:  uploadMaxPerKey,
+		UploadMaxTotalMB: uploadMaxTotalMB,
+
+		FastModel:                fastModel,
+		StrongModel:              strongModel,
+		RouteWordThreshold:       routeWordThreshold,
+		RouteComplexityThreshold: routeComplexityThreshold,
+
+		Provider:        provider,
+		ProviderModels:  providerModels,
+		AzureEndpoint:   azureEndpoint,
+		AzureAPIKey:     azureAPIKey,
+		AzureAPIVersion: azureAPIVersion,
+		AzureDeployment: azureDeployment,
+		BedrockRegion:   bedrockRegion,
+		BedrockModelID:  bedrockModelID,
+		VertexProject:   vertexProject,
+		VertexLocation:  vertexLocation,
+
+		ProviderHeaders:      providerHeaders,
+		ProviderAllowedHosts: providerAllowedHosts,
+		ProviderAuditLog:     providerAuditLog,
+
+		MaxInputTokens: maxInputTokens,
+
+		EmbeddingModel: embeddingModel,
 	}
 }
 
@@ -77,6 +597,20 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		log.Printf("Failed to parse %s as float: %v, using default: %v", key, err, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	valueStr := getEnv(key, "")
 	if valueStr == "" {
@@ -90,3 +624,27 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	}
 	return value
 }
+
+// noneAsEmpty turns the list "none" into an empty list, so a list setting with a default can be
+// switched off
+func noneAsEmpty(values []string) []string {
+	if len(values) == 1 && strings.EqualFold(values[0], "none") {
+		return nil
+	}
+	return values
+}
+
+func getEnvAsList(key string, defaultValue []string) []string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	var values []string
+	for _, item := range strings.Split(valueStr, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
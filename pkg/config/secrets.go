@@ -0,0 +1,183 @@
+package config
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/awssig"
+	"github.com/arnnvv/cutcrap/pkg/gcpauth"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// SecretProvider looks up a secret by name in an external secret manager
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// errSecretNotFound is returned by providers for secrets that don't exist, which is expected
+// for optional integrations
+var errSecretNotFound = errors.New("secret not found")
+
+// secretLookupTimeout bounds each secret manager call during startup
+const secretLookupTimeout = 10 * time.Second
+
+// newSecretProvider returns the provider selected by SECRETS_PROVIDER, or nil when secrets
+// come only from the environment
+func newSecretProvider() SecretProvider {
+	switch provider := strings.ToLower(getEnv("SECRETS_PROVIDER", "")); provider {
+	case "":
+		return nil
+	case "aws":
+		region := cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+		log.Printf("SECRETS_PROVIDER: aws (region %s)", region)
+		return &awsSecrets{region: region, creds: awssig.FromEnv(), client: &http.Client{Timeout: secretLookupTimeout}}
+	case "gcp":
+		project := getEnv("SECRETS_GCP_PROJECT", "")
+		log.Printf("SECRETS_PROVIDER: gcp (project %s)", project)
+		client := &http.Client{Timeout: secretLookupTimeout}
+		tokens, err := gcpauth.FromEnvironment(client)
+		if err != nil {
+			logging.Warnf("invalid Google Cloud credentials, reading secrets from the environment only: %v", err)
+			return nil
+		}
+		return &gcpSecrets{project: project, tokens: tokens, client: client}
+	default:
+		logging.Warnf("unknown SECRETS_PROVIDER %q, reading secrets from the environment only", provider)
+		return nil
+	}
+}
+
+// getSecret reads a secret from the file named by key_FILE (Docker secrets), then the key
+// itself, then the secret provider under SECRETS_PREFIX+key. The value is never logged.
+func getSecret(provider SecretProvider, prefix, key string) string {
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logging.Errorf("failed to read %s_FILE: %v", key, err)
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	if provider == nil {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretLookupTimeout)
+	defer cancel()
+	value, err := provider.Secret(ctx, prefix+key)
+	if errors.Is(err, errSecretNotFound) {
+		log.Printf("%s not found in secret manager", key)
+		return ""
+	}
+	if err != nil {
+		logging.Errorf("failed to load %s from secret manager: %v", key, err)
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+// awsSecrets reads from AWS Secrets Manager with SigV4-signed requests, using the standard
+// AWS_* credential variables
+type awsSecrets struct {
+	region string
+	creds  awssig.Credentials
+	client *http.Client
+}
+
+func (a *awsSecrets) Secret(ctx context.Context, name string) (string, error) {
+	if a.region == "" || !a.creds.Valid() {
+		return "", fmt.Errorf("AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return "", err
+	}
+	host := "secretsmanager." + a.region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awssig.Sign(req, body, a.region, "secretsmanager", a.creds, time.Now())
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := doJSON(a.client, req, &out); err != nil {
+		return "", err
+	}
+	return out.SecretString, nil
+}
+
+// gcpSecrets reads the latest version of a secret from GCP Secret Manager, authenticating
+// with application default credentials (see gcpauth.FromEnvironment)
+type gcpSecrets struct {
+	project string
+	tokens  *gcpauth.TokenSource
+	client  *http.Client
+}
+
+func (g *gcpSecrets) Secret(ctx context.Context, name string) (string, error) {
+	if g.project == "" {
+		return "", fmt.Errorf("SECRETS_GCP_PROJECT is required")
+	}
+	token, err := g.tokens.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("https://secretmanager.googleapis.com/v1/projects/%s/secrets/%s/versions/latest:access",
+		url.PathEscape(g.project), url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var out struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := doJSON(g.client, req, &out); err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(out.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("failed decode secret payload: %w", err)
+	}
+	return string(data), nil
+}
+
+// doJSON sends req and decodes a JSON response. Error bodies are only inspected for a missing
+// secret and never included, since secret managers may echo request details.
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if resp.StatusCode == http.StatusNotFound || bytes.Contains(errBody, []byte("ResourceNotFoundException")) {
+			return errSecretNotFound
+		}
+		return fmt.Errorf("non-OK status: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
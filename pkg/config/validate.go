@@ -0,0 +1,132 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// Validate reports every inconsistent or missing setting at once, so misconfiguration fails
+// startup instead of surfacing when the first request half-fails. Settings owned by other
+// packages (post-processors, hooks, profiles, KEEP_SECTIONS, REFERENCE_SECTIONS) are checked
+// where they are built.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.OpenRouterKey != "" || c.LLMRecordMode == "replay" || c.Provider != "gemini",
+		"OPENROUTER_API_KEY is required (set it, OPENROUTER_API_KEY_FILE or SECRETS_PROVIDER)")
+	check(c.Provider == "gemini" || c.Provider == "vertex" || c.Provider == "azure" || c.Provider == "bedrock",
+		"PROVIDER must be gemini, vertex, azure or bedrock, got %q", c.Provider)
+	check(c.Provider != "vertex" || (c.VertexProject != "" && c.VertexLocation != ""),
+		"VERTEX_PROJECT (or GOOGLE_CLOUD_PROJECT) and VERTEX_LOCATION are required with PROVIDER=vertex")
+	check(c.Provider != "azure" || (c.AzureEndpoint != "" && c.AzureAPIKey != "" && c.AzureDeployment != ""),
+		"AZURE_OPENAI_ENDPOINT, AZURE_OPENAI_API_KEY and AZURE_OPENAI_DEPLOYMENT are required with PROVIDER=azure")
+	check(c.Provider != "bedrock" || (c.BedrockRegion != "" && c.BedrockModelID != ""),
+		"BEDROCK_REGION (or AWS_REGION) and BEDROCK_MODEL_ID are required with PROVIDER=bedrock")
+	check(c.EmbeddingModel == "" || c.Provider == "gemini",
+		"EMBEDDING_MODEL is only supported with the Gemini API, got PROVIDER=%s", c.Provider)
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port < 65536, "PORT must be a port number, got %q", c.Port)
+
+	check(c.MaxConcurrent > 0, "MAX_CONCURRENT must be positive, got %d", c.MaxConcurrent)
+	check(c.GlobalMaxConcurrent >= 0, "GLOBAL_MAX_CONCURRENT must not be negative, got %d", c.GlobalMaxConcurrent)
+	check(c.RequestTimeout > 0, "REQUEST_TIMEOUT must be positive, got %v", c.RequestTimeout)
+	check(c.HTTPMaxIdleConnsPerHost > 0, "HTTP_MAX_IDLE_CONNS_PER_HOST must be positive, got %d", c.HTTPMaxIdleConnsPerHost)
+	check(c.JobTimeoutMax >= c.RequestTimeout, "JOB_TIMEOUT_MAX must be at least REQUEST_TIMEOUT, got %v", c.JobTimeoutMax)
+	check(c.ChunkSize > 0, "CHUNK_SIZE must be positive, got %d", c.ChunkSize)
+	check(c.ChunkOverlap >= 0 && c.ChunkOverlap < c.ChunkSize,
+		"CHUNK_OVERLAP must be at least 0 and below CHUNK_SIZE (%d), got %d", c.ChunkSize, c.ChunkOverlap)
+	check(c.MaxChunks >= 0, "MAX_CHUNKS must not be negative, got %d", c.MaxChunks)
+	check(c.MaxChunks == 0 || c.MaxChunkSize >= c.ChunkSize,
+		"MAX_CHUNK_SIZE must be at least CHUNK_SIZE (%d), got %d", c.ChunkSize, c.MaxChunkSize)
+	check(c.MaxInputTokens >= 0, "MAX_INPUT_TOKENS must not be negative, got %d", c.MaxInputTokens)
+	check(c.SmallInputWords >= 0, "SMALL_INPUT_WORDS must not be negative, got %d", c.SmallInputWords)
+	check(c.JobStoreMax > 0, "JOB_STORE_MAX must be positive, got %d", c.JobStoreMax)
+	check(c.ArchiveMaxFiles > 0, "ARCHIVE_MAX_FILES must be positive, got %d", c.ArchiveMaxFiles)
+	check(c.HookTimeout > 0, "HOOK_TIMEOUT must be positive, got %v", c.HookTimeout)
+
+	for _, setting := range [][2]string{
+		{"PDF_API", c.Pdf_api},
+		{"GEMINI_BASE_URL", c.GeminiBaseURL},
+		{"AZURE_OPENAI_ENDPOINT", c.AzureEndpoint},
+		{"SLACK_API_URL", c.SlackAPIURL},
+		{"TELEGRAM_API_URL", c.TelegramAPIURL},
+		{"TRANSCRIBE_API_URL", c.TranscribeAPIURL},
+	} {
+		if setting[1] != "" {
+			if err := checkURL(setting[1]); err != nil {
+				errs = append(errs, fmt.Errorf("%s is not a valid URL: %w", setting[0], err))
+			}
+		}
+	}
+
+	check(c.LLMRecordMode == "" || c.LLMRecordMode == "record" || c.LLMRecordMode == "replay",
+		"LLM_RECORD_MODE must be record or replay, got %q", c.LLMRecordMode)
+	check(c.HeartbeatMode == "sse" || c.HeartbeatMode == "whitespace" || c.HeartbeatMode == "off",
+		"HEARTBEAT_MODE must be sse, whitespace or off, got %q", c.HeartbeatMode)
+	check(c.HeartbeatMode == "off" || c.HeartbeatInterval > 0,
+		"HEARTBEAT_INTERVAL must be positive unless HEARTBEAT_MODE is off, got %v", c.HeartbeatInterval)
+
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %w", err))
+	}
+	check(c.LogFormat == "text" || c.LogFormat == "json", "LOG_FORMAT must be text or json, got %q", c.LogFormat)
+	check(c.LogMaxSizeMB >= 0 && c.LogMaxBackups >= 0, "LOG_MAX_SIZE_MB and LOG_MAX_BACKUPS must not be negative")
+
+	check(c.IntegrationMode == "document" || c.IntegrationMode == "transcript" || c.IntegrationMode == "speaker_summary",
+		"INTEGRATION_MODE must be document, transcript or speaker_summary, got %q", c.IntegrationMode)
+	check(c.IntegrationRatio > 0 && c.IntegrationRatio <= 1, "INTEGRATION_RATIO must be in (0, 1], got %v", c.IntegrationRatio)
+	check(c.DensityStrength >= 0 && c.DensityStrength <= 1, "DENSITY_STRENGTH must be between 0 and 1, got %v", c.DensityStrength)
+	check(c.ContextCacheMinChunks >= 0, "CONTEXT_CACHE_MIN_CHUNKS must not be negative, got %d", c.ContextCacheMinChunks)
+	check(c.ContextCacheMinChunks == 0 || c.ContextCacheTTL > 0, "CONTEXT_CACHE_TTL must be positive when caching is enabled")
+	check(c.SpeakerCacheSize >= 0, "SPEAKER_CACHE_SIZE must not be negative, got %d", c.SpeakerCacheSize)
+	check(c.SpeakerNames == "escape" || c.SpeakerNames == "strip" || c.SpeakerNames == "off",
+		"SPEAKER_NAMES must be escape, strip or off, got %q", c.SpeakerNames)
+	check(c.ResultRetention >= 0, "RESULT_RETENTION must not be negative, got %v", c.ResultRetention)
+	check((c.ResultRetention == 0 && c.UploadDir == "") || c.JanitorInterval > 0, "JANITOR_INTERVAL must be positive when RESULT_RETENTION or UPLOAD_DIR is set")
+	check(c.FastModel != "", "MODEL_FAST is required")
+	check(c.RouteWordThreshold >= 0 && c.RouteComplexityThreshold >= 0, "ROUTE_WORD_THRESHOLD and ROUTE_COMPLEXITY_THRESHOLD must not be negative")
+
+	check(c.SMTPHost == "" || c.SMTPFrom != "", "SMTP_FROM (or SMTP_USERNAME) is required with SMTP_HOST")
+	check(c.WebhookSecret == "" || c.WebhookMaxAttempts > 0, "WEBHOOK_MAX_ATTEMPTS must be positive, got %d", c.WebhookMaxAttempts)
+	check(c.WebhookSecret == "" || c.WebhookTimeout > 0, "WEBHOOK_TIMEOUT must be positive, got %v", c.WebhookTimeout)
+	check(c.RateLimitPerMinute >= 0, "RATE_LIMIT_PER_MINUTE must not be negative, got %d", c.RateLimitPerMinute)
+	check(c.RateLimitPerMinute == 0 || c.RateLimitBurst > 0, "RATE_LIMIT_BURST must be positive when RATE_LIMIT_PER_MINUTE is set, got %d", c.RateLimitBurst)
+	check(c.ArtifactCacheMaxMB >= 0, "ARTIFACT_CACHE_MAX_MB must not be negative, got %d", c.ArtifactCacheMaxMB)
+	check(c.IdempotencyTTL >= 0, "IDEMPOTENCY_TTL must not be negative, got %v", c.IdempotencyTTL)
+	check(c.IdempotencyMaxMB >= 0, "IDEMPOTENCY_MAX_MB must not be negative, got %d", c.IdempotencyMaxMB)
+	check(c.UploadDir == "" || c.UploadExpiry > 0, "UPLOAD_EXPIRY must be positive, got %v", c.UploadExpiry)
+	check(c.UploadMaxPerKey >= 0 && c.UploadMaxTotalMB >= 0, "UPLOAD_MAX_PER_KEY and UPLOAD_MAX_TOTAL_MB must not be negative")
+	check(c.DownloadSigningSecret == "" || c.DownloadURLMaxTTL > 0, "DOWNLOAD_URL_MAX_TTL must be positive, got %v", c.DownloadURLMaxTTL)
+	check(c.SlackSigningSecret == "" || c.SlackBotToken != "", "SLACK_BOT_TOKEN is required with SLACK_SIGNING_SECRET")
+
+	check(c.TranscribeBackend == "" || c.TranscribeBackend == "whisper-cpp" || c.TranscribeBackend == "api",
+		"TRANSCRIBE_BACKEND must be whisper-cpp or api, got %q", c.TranscribeBackend)
+	check(c.TranscribeBackend != "whisper-cpp" || c.TranscribeCommand != "", "TRANSCRIBE_COMMAND is required with TRANSCRIBE_BACKEND=whisper-cpp")
+	check(c.TranscribeBackend == "" || c.TranscribeTimeout > 0, "TRANSCRIBE_TIMEOUT must be positive, got %v", c.TranscribeTimeout)
+
+	return errors.Join(errs...)
+}
+
+// checkURL requires an absolute http or https URL
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
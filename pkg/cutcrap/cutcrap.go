@@ -0,0 +1,923 @@
+// Package cutcrap is the library entry point to the condensing pipeline. It has no HTTP
+// dependencies in the processing path, so other Go programs can embed it directly:
+//
+//	engine, err := cutcrap.New(config.Load())
+//	condensed, err := engine.CondenseDocument(ctx, text, cutcrap.Options{Ratio: 0.3})
+package cutcrap
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/chunker"
+	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/httpclient"
+	"github.com/arnnvv/cutcrap/pkg/postprocess"
+	"github.com/arnnvv/cutcrap/pkg/recorder"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/sections"
+	"github.com/arnnvv/cutcrap/pkg/transcript"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+	"github.com/arnnvv/cutcrap/pkg/workers"
+)
+
+// Processing modes accepted by Condense
+const (
+	ModeDocument       = "document"
+	ModeTranscript     = "transcript"
+	ModeSpeakerSummary = "speaker_summary"
+	ModeOutline        = "outline"
+)
+
+var (
+	// ErrChunking is returned when the input could not be split into chunks
+	ErrChunking = errors.New("text chunking failed")
+	// ErrEmptySummary is returned when speaker summary generation produced nothing
+	ErrEmptySummary = errors.New("speaker summary generation failed")
+	// ErrPreHook wraps failures of the configured pre-processing hooks
+	ErrPreHook = errors.New("pre-processing hook failed")
+	// ErrEmptyExecutiveSummary is returned when the executive summary pass produced nothing
+	ErrEmptyExecutiveSummary = errors.New("executive summary generation failed")
+	// ErrNoFlashcards is returned when flashcard generation produced no cards
+	ErrNoFlashcards = errors.New("flashcard generation failed")
+	// ErrTooLarge is returned for inputs that would need more than MAX_CHUNKS chunks even at MAX_CHUNK_SIZE
+	ErrTooLarge = errors.New("input too large")
+)
+
+// Options are the per-call processing parameters
+type Options struct {
+	// Ratio is the target output length relative to the input, in (0, 1]
+	Ratio float64
+	// TranslateTo translates the final output to this language when set
+	TranslateTo string
+	// Seed is sent with every generation request. It is ignored when ctx already carries an
+	// api.RunInfo with its own seed.
+	Seed *int64
+	// Style is the writing style of the output, a key of api.Styles ("simple" when empty)
+	Style string
+	// Model replaces the routed model for every chunk when set
+	Model string
+	// Format is api.FormatBullets for hierarchical bullet points instead of prose (document mode)
+	Format string
+	// KeepSections are heading patterns whose sections are passed through verbatim in document
+	// mode, in addition to the configured KEEP_SECTIONS
+	KeepSections []string
+	// PruneReferences drops the entries of a final reference list that the condensed document no
+	// longer cites (document mode)
+	PruneReferences bool
+	// Glossary appends a glossary of the document's key terms with simple definitions, extracted
+	// chunk by chunk from the source (document mode)
+	Glossary bool
+	// SkipSpeakerAnalysis processes transcripts without the speaker analysis call, labelling
+	// speakers generically (transcript and speaker summary modes)
+	SkipSpeakerAnalysis bool
+	// SpeakerAliases are "Canonical Name=alias, alias" entries (see transcript.ParseAliases)
+	// naming the forms of a speaker's name the transcript should write as one, in addition to the
+	// titled and short forms unified unless KeepSpeakerNames is set (transcript mode)
+	SpeakerAliases []string
+	// KeepSpeakerNames turns off the automatic unification of titled and short forms of speaker
+	// names; SpeakerAliases still apply (transcript mode)
+	KeepSpeakerNames bool
+	// RunInfo, when set, records the generation requests of this call instead of the api.RunInfo
+	// in ctx. Compare uses it to tell the two sides apart.
+	RunInfo *api.RunInfo
+	// Reuse are the chunk outputs of a previous version of the document, condensed with the same
+	// options. The text is chunked so its unchanged parts keep their previous chunks, whose
+	// outputs are spliced in instead of being condensed again (document mode).
+	Reuse []ChunkOutput
+	// Chunks, when set, receives the output of every chunk in order, to be passed as Reuse when
+	// a revision of the document is condensed (document mode)
+	Chunks *[]ChunkOutput
+	// TranscriptFormat is the layout of the formatted transcript (transcript mode). It is applied
+	// last, after the post-processors and translation.
+	TranscriptFormat transcript.Format
+}
+
+// Engine runs the condensing pipeline: pre-hooks, chunked model calls, post-processors and translation
+type Engine struct {
+	cfg      *config.Config
+	client   *api.Client
+	preHooks postprocess.Pipeline
+	pipeline postprocess.Pipeline
+	keep     sections.KeepList
+	// references are the headings of reference lists (REFERENCE_SECTIONS)
+	references sections.KeepList
+}
+
+// New builds an Engine from cfg, including the Gemini client (with record/replay when
+// LLM_RECORD_MODE is set) and the configured post-processors and hooks
+func New(cfg *config.Config) (*Engine, error) {
+	var httpClient *http.Client
+	var transport http.RoundTripper = httpclient.Transport
+	if cfg.LLMRecordMode != "" {
+		recording, err := recorder.New(cfg.LLMRecordMode, cfg.LLMRecordDir, httpclient.Transport)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LLM_RECORD_MODE configuration: %w", err)
+		}
+		log.Printf("LLM interactions will be %sed (dir: %s)", cfg.LLMRecordMode, cfg.LLMRecordDir)
+		transport = recording
+		httpClient = &http.Client{Transport: transport}
+	}
+	hooks, err := newProviderHooks(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if hooks != nil {
+		httpClient = &http.Client{Transport: hooks.Transport(transport)}
+	}
+	client := api.New(cfg.OpenRouterKey, cfg.GeminiBaseURL, httpClient)
+	client.CallTimeout = cfg.RequestTimeout
+	client.MaxInputTokens = cfg.MaxInputTokens
+	provider, err := newProvider(cfg, client.HTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	client.Provider = provider
+	if cfg.GlobalMaxConcurrent > 0 {
+		client.Scheduler = api.NewScheduler(cfg.GlobalMaxConcurrent)
+	}
+	if cfg.SpeakerCacheSize > 0 {
+		client.SpeakerCache = api.NewSpeakerCache(cfg.SpeakerCacheSize)
+	}
+	return NewWithClient(cfg, client)
+}
+
+// NewWithClient builds an Engine around an existing API client
+func NewWithClient(cfg *config.Config, client *api.Client) (*Engine, error) {
+	pipeline, err := postprocess.Build(cfg.PostProcessors)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POST_PROCESSORS configuration: %w", err)
+	}
+	postHooks, err := postprocess.BuildHooks(cfg.PostHooks, cfg.HookTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POST_HOOKS configuration: %w", err)
+	}
+	preHooks, err := postprocess.BuildHooks(cfg.PreHooks, cfg.HookTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PRE_HOOKS configuration: %w", err)
+	}
+	keep, err := sections.CompileKeepList(cfg.KeepSections)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KEEP_SECTIONS configuration: %w", err)
+	}
+	references, err := sections.CompileKeepList(cfg.ReferenceSections)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REFERENCE_SECTIONS configuration: %w", err)
+	}
+	return &Engine{cfg: cfg, client: client, preHooks: preHooks, pipeline: append(pipeline, postHooks...), keep: keep, references: references}, nil
+}
+
+// Client returns the API client used by the engine
+func (e *Engine) Client() *api.Client { return e.client }
+
+// CondenseDocument condenses prose to roughly opts.Ratio of its length
+func (e *Engine) CondenseDocument(ctx context.Context, text string, opts Options) (string, error) {
+	return e.Condense(ctx, ModeDocument, text, opts)
+}
+
+// CondenseTranscript cleans up and condenses a transcript into bold "**Name**: speech" turns
+func (e *Engine) CondenseTranscript(ctx context.Context, text string, opts Options) (string, error) {
+	return e.Condense(ctx, ModeTranscript, text, opts)
+}
+
+// SummarizeSpeakers produces a per-speaker summary of a transcript
+func (e *Engine) SummarizeSpeakers(ctx context.Context, text string, opts Options) (string, error) {
+	return e.Condense(ctx, ModeSpeakerSummary, text, opts)
+}
+
+// Outline returns the heading hierarchy of a document with a one-line gist per section, from
+// one small call per section. opts.Ratio is not used.
+func (e *Engine) Outline(ctx context.Context, text string, opts Options) (string, error) {
+	return e.Condense(ctx, ModeOutline, text, opts)
+}
+
+// Condense runs one of the plain-text modes followed by post-processing and translation.
+// A returned error is ctx.Err() or wraps one of the package errors.
+func (e *Engine) Condense(ctx context.Context, mode, text string, opts Options) (string, error) {
+	ctx = withOptions(ctx, opts)
+	text, err := e.preProcess(ctx, mode, text)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := e.sizeConfig(ctx, text)
+	if err != nil {
+		return "", err
+	}
+
+	var result string
+	switch mode {
+	case ModeTranscript:
+		// An empty result may be a valid outcome (e.g. empty input); only ctx.Err() marks a failure.
+		result = workers.ProcessTranscript(ctx, e.client, text, cfg, opts.Ratio)
+	case ModeSpeakerSummary:
+		result = workers.ProcessSpeakerSummary(ctx, e.client, text, cfg, opts.Ratio)
+		if result == "" && ctx.Err() == nil {
+			return "", ErrEmptySummary
+		}
+	case ModeOutline:
+		result = workers.Outline(ctx, e.client, text, cfg)
+	case ModeDocument:
+		var parts []string
+		err := e.condenseDocument(ctx, cfg, text, opts, func(part string) error {
+			parts = append(parts, part)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		result = strings.Join(parts, "\n\n")
+	default:
+		return "", fmt.Errorf("unknown mode '%s'", mode)
+	}
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Processing (%s) failed due to context error: %v", mode, ctx.Err())
+		return "", ctx.Err()
+	}
+
+	result = e.finish(ctx, mode, opts, result)
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Post-processing (%s) failed due to context error: %v", mode, ctx.Err())
+		return "", ctx.Err()
+	}
+	return result, nil
+}
+
+// CanStream reports whether CondenseTo writes a mode's output incrementally. Only document
+// chunks are independent of each other, and the post-processors and translation need the
+// whole text.
+func (e *Engine) CanStream(mode string, opts Options) bool {
+	return mode == ModeDocument && len(e.pipeline) == 0 && opts.TranslateTo == ""
+}
+
+// CondenseStream is Condense with the output passed to emit piece by piece. When the mode can
+// stream (see CanStream) each processed chunk is emitted in order as soon as it and every chunk
+// before it are done; other modes emit the whole result once. An error can follow emitted
+// chunks, in which case the output is incomplete.
+func (e *Engine) CondenseStream(ctx context.Context, mode, text string, opts Options, emit func(chunk string) error) error {
+	if !e.CanStream(mode, opts) {
+		result, err := e.Condense(ctx, mode, text, opts)
+		if err != nil {
+			return err
+		}
+		return emit(result)
+	}
+
+	ctx = withOptions(ctx, opts)
+	text, err := e.preProcess(ctx, mode, text)
+	if err != nil {
+		return err
+	}
+	cfg, err := e.sizeConfig(ctx, text)
+	if err != nil {
+		return err
+	}
+	if err := e.condenseDocument(ctx, cfg, text, opts, emit); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Processing (%s) failed due to context error: %v", mode, ctx.Err())
+		return ctx.Err()
+	}
+	return nil
+}
+
+// condenseDocument condenses prose chunk by chunk and passes the outputs to emit in order.
+// Sections on the keep list, tables, figure captions, code, math and reference lists are emitted
+// verbatim in their place and take no part of the budget. With opts.Glossary the glossary is
+// emitted last.
+func (e *Engine) condenseDocument(ctx context.Context, cfg *config.Config, text string, opts Options, emit func(part string) error) error {
+	doc, err := e.prepareDocument(ctx, cfg, text, opts)
+	if err != nil {
+		return err
+	}
+	if err := e.runDocument(ctx, cfg, doc, opts, emit); err != nil || !opts.Glossary || ctx.Err() != nil {
+		return err
+	}
+	// Extraction runs after condensing so the job stays within its MAX_CONCURRENT calls
+	if terms := workers.ExtractGlossary(ctx, e.client, doc.chunks, cfg); len(terms) > 0 && ctx.Err() == nil {
+		return emit(workers.FormatGlossary(terms))
+	}
+	return nil
+}
+
+// preparedDocument is a document cut into the chunks sent to the model and the verbatim
+// segments around them. It does not depend on the ratio, style or model, so Compare shares it.
+type preparedDocument struct {
+	chunks []string
+	// words[i] is the word count of chunk i
+	words []int
+	// kept[i] holds the verbatim segments that come before chunk i; the last entry holds the
+	// ones after the final chunk
+	kept      [][]sections.Segment
+	protected sections.Protected
+	// overlaps[i] is the number of words chunk i repeats from the end of chunk i-1 (CHUNK_OVERLAP)
+	overlaps []int
+}
+
+// prepareDocument protects code and math, splits out the verbatim segments and chunks the prose
+func (e *Engine) prepareDocument(ctx context.Context, cfg *config.Config, text string, opts Options) (*preparedDocument, error) {
+	logger := reqctx.Logger(ctx)
+	keep := e.keep
+	if len(opts.KeepSections) > 0 {
+		extra, err := sections.CompileKeepList(opts.KeepSections)
+		if err != nil {
+			return nil, err
+		}
+		keep = append(append(sections.KeepList(nil), keep...), extra...)
+	}
+
+	// Code and math never go to the model: they are replaced by placeholders and put back in each part
+	doc := &preparedDocument{kept: make([][]sections.Segment, 1)}
+	text, doc.protected = sections.Protect(text)
+	small := workers.IsSmallInput(cfg, text)
+	if doc.protected.Len() > 0 {
+		logger.Printf("Holding %d code blocks and %d math expressions out of the prompt", len(doc.protected.Code), len(doc.protected.Math))
+	}
+
+	for _, segment := range sections.Split(text, keep, e.references) {
+		switch segment.Kind {
+		case sections.Kept:
+			logger.Printf("Keeping section %q verbatim (%d words)", segment.Heading, wordcount.Count(segment.Text))
+		case sections.Table:
+			logger.Printf("Passing table through verbatim (%d rows)", strings.Count(segment.Text, "\n")+1)
+		case sections.Caption:
+			logger.Printf("Keeping caption %q", strings.SplitN(segment.Text, "\n", 2)[0])
+		case sections.References:
+			logger.Printf("Passing reference list %q through verbatim", segment.Heading)
+		}
+		if segment.Verbatim() {
+			doc.kept[len(doc.chunks)] = append(doc.kept[len(doc.chunks)], segment)
+			continue
+		}
+		if small {
+			// Small inputs go to the model whole, see runDocument
+			doc.chunks = append(doc.chunks, strings.TrimSpace(segment.Text))
+			doc.words = append(doc.words, wordcount.Count(segment.Text))
+			doc.overlaps = append(doc.overlaps, 0)
+			doc.kept = append(doc.kept, nil)
+			continue
+		}
+		var segmentChunks []string
+		var segmentWords []int
+		var err error
+		if len(opts.Reuse) > 0 {
+			segmentChunks, segmentWords, err = alignChunks(ctx, segment.Text, cfg, opts.Reuse)
+		} else {
+			segmentChunks, segmentWords, err = chunker.ChunkText(ctx, segment.Text, cfg.ChunkSize, cfg.ChunkOverlap) // Use sentence chunking for documents
+		}
+		if err != nil {
+			logger.Printf("Text chunking failed: %v", err)
+			return nil, fmt.Errorf("%w: %v", ErrChunking, err)
+		}
+		for i := range segmentChunks {
+			overlap := 0
+			if i > 0 && cfg.ChunkOverlap > 0 {
+				overlap = chunker.OverlapWords(segmentChunks[i-1], segmentChunks[i], cfg.ChunkOverlap)
+			}
+			doc.overlaps = append(doc.overlaps, overlap)
+		}
+		doc.chunks = append(doc.chunks, segmentChunks...)
+		doc.words = append(doc.words, segmentWords...)
+		doc.kept = append(doc.kept, make([][]sections.Segment, len(segmentChunks))...)
+	}
+	return doc, nil
+}
+
+// runDocument condenses the chunks of a prepared document with cfg's concurrency and emits them
+// in order between the verbatim segments
+func (e *Engine) runDocument(ctx context.Context, cfg *config.Config, doc *preparedDocument, opts Options, emit func(part string) error) error {
+	logger := reqctx.Logger(ctx)
+	chunks, kept, protected := doc.chunks, doc.kept, doc.protected
+
+	// Reference lists after the last chunk are pruned against what the condensed text still
+	// cites; lists in the middle of the document are left whole
+	var sourceCites, outputCites sections.Citations
+	if opts.PruneReferences {
+		sourceCites, outputCites = sections.FindCitations(strings.Join(chunks, "\n")), make(sections.Citations)
+	}
+
+	next := 0
+	emitKept := func(upTo int) error {
+		for ; next <= upTo; next++ {
+			for _, segment := range kept[next] {
+				text := segment.Text
+				if segment.Kind == sections.References && opts.PruneReferences && next == len(chunks) {
+					var dropped int
+					text, dropped = sections.PruneReferences(text, sourceCites, outputCites)
+					logger.Printf("Pruned %d uncited entries from reference list %q", dropped, segment.Heading)
+					if text == "" {
+						continue
+					}
+				}
+				if err := emit(protected.Restore(text, text)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	// Chunks unchanged since the previous version of the document keep their output
+	reuse := make(map[string]string, len(opts.Reuse))
+	for _, chunk := range opts.Reuse {
+		reuse[chunk.Text] = chunk.Output
+	}
+	if len(chunks) > 0 {
+		// Chunks that overlap the previous one drop the share of their output that covers the
+		// repeated words, so each word counts against the budget once
+		previousIndex := -1
+		emitChunk := func(index int, content string) error {
+			if opts.Chunks != nil {
+				*opts.Chunks = append(*opts.Chunks, ChunkOutput{Text: chunks[index], Output: content})
+			}
+			if err := emitKept(index); err != nil {
+				return err
+			}
+			if doc.overlaps[index] > 0 && previousIndex == index-1 {
+				share := float64(doc.overlaps[index]) / float64(max(doc.words[index], 1))
+				if trimmed := workers.TrimOverlap(content, share); len(trimmed) < len(content) {
+					reqctx.Debug(ctx).Printf("Dropped %d repeated bytes at the start of chunk %d", len(content)-len(trimmed), index)
+					content = trimmed
+				}
+				if content == "" {
+					previousIndex = index
+					return nil
+				}
+			}
+			previousIndex = index
+			if opts.Format == api.FormatBullets {
+				content = postprocess.NormalizeBullets(content)
+			}
+			if opts.PruneReferences {
+				for key := range sections.FindCitations(content) {
+					outputCites[key] = true
+				}
+			}
+			return emit(protected.Restore(content, chunks[index]))
+		}
+
+		if content, ok := reuse[chunks[0]]; ok && len(chunks) == 1 {
+			logger.Printf("Reusing the output of the previous version (document unchanged)")
+			if err := emitChunk(0, content); err != nil {
+				return err
+			}
+		} else if len(chunks) == 1 && workers.IsSmallInput(cfg, chunks[0]) {
+			content, err := workers.ProcessWhole(ctx, e.client, chunks[0], cfg, opts.Ratio, ModeDocument, nil)
+			if err != nil || ctx.Err() != nil {
+				return err
+			}
+			if content = strings.TrimSpace(content); content != "" {
+				if err := emitChunk(0, content); err != nil {
+					return err
+				}
+			}
+		} else {
+			var changed []string
+			var changedWords, changedIndexes []int
+			for i, chunk := range chunks {
+				if _, ok := reuse[chunk]; !ok {
+					changed, changedIndexes = append(changed, chunk), append(changedIndexes, i)
+					changedWords = append(changedWords, doc.words[i])
+				}
+			}
+			if len(reuse) > 0 {
+				logger.Printf("Reusing the output of %d of %d chunks from the previous version", len(chunks)-len(changed), len(chunks))
+			}
+			// Reused outputs are emitted in their place between the condensed ones
+			pending := 0
+			emitReused := func(upTo int) error {
+				for ; pending < upTo; pending++ {
+					if content, ok := reuse[chunks[pending]]; ok {
+						if err := emitChunk(pending, content); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			}
+			if len(changed) > 0 {
+				// Pass nil for the speaker map in document mode
+				err := workers.StreamChunks(ctx, e.client, changed, changedWords, cfg, opts.Ratio, ModeDocument, nil, func(i int, content string) error {
+					index := changedIndexes[i]
+					if err := emitReused(index); err != nil {
+						return err
+					}
+					pending = index + 1
+					return emitChunk(index, content)
+				})
+				if err != nil || ctx.Err() != nil {
+					return err
+				}
+			}
+			if err := emitReused(len(chunks)); err != nil {
+				return err
+			}
+		}
+	}
+	return emitKept(len(chunks))
+}
+
+// Compare condenses text with two sets of options concurrently and returns both results. The
+// work that doesn't depend on the ratio, style or model runs once and is shared: pre-hooks, and
+// the sectioning and chunking of documents or the speaker analysis of transcripts. Options that
+// shape that work (KeepSections, SkipSpeakerAnalysis) are taken from a. Speaker summaries share only the pre-hooks.
+func (e *Engine) Compare(ctx context.Context, mode, text string, a, b Options) (resultA, resultB string, err error) {
+	text, err = e.preProcess(ctx, mode, text)
+	if err != nil {
+		return "", "", err
+	}
+	cfg, err := e.sizeConfig(ctx, text)
+	if err != nil {
+		return "", "", err
+	}
+	sides, opts := [2]context.Context{withOptions(ctx, a), withOptions(ctx, b)}, [2]Options{a, b}
+	var results [2]string
+
+	// Each side gets half of the concurrency, so a comparison makes as many parallel calls as one job
+	half := *cfg
+	half.MaxConcurrent = max(1, cfg.MaxConcurrent/2)
+	var errs [2]error
+	var wg sync.WaitGroup
+	run := func(side func(i int) (string, error)) {
+		for i := range sides {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], errs[i] = side(i)
+			}()
+		}
+		wg.Wait()
+	}
+
+	switch mode {
+	case ModeDocument:
+		doc, err := e.prepareDocument(ctx, cfg, text, a)
+		if err != nil {
+			return "", "", err
+		}
+		run(func(i int) (string, error) {
+			var parts []string
+			err := e.runDocument(sides[i], &half, doc, opts[i], func(part string) error {
+				parts = append(parts, part)
+				return nil
+			})
+			return strings.Join(parts, "\n\n"), err
+		})
+	case ModeTranscript:
+		if a.SkipSpeakerAnalysis {
+			ctx = workers.WithoutSpeakerAnalysis(ctx)
+		}
+		results = workers.ProcessTranscriptCompare(ctx, e.client, text, cfg, sides, [2]float64{a.Ratio, b.Ratio})
+	case ModeSpeakerSummary:
+		run(func(i int) (string, error) {
+			result := workers.ProcessSpeakerSummary(sides[i], e.client, text, &half, opts[i].Ratio)
+			if result == "" && ctx.Err() == nil {
+				return "", ErrEmptySummary
+			}
+			return result, nil
+		})
+	default:
+		return "", "", fmt.Errorf("unknown mode '%s'", mode)
+	}
+	if err := cmp.Or(errs[0], errs[1]); err != nil {
+		return "", "", err
+	}
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Compare (%s) failed due to context error: %v", mode, ctx.Err())
+		return "", "", ctx.Err()
+	}
+
+	run(func(i int) (string, error) { return e.finish(sides[i], mode, opts[i], results[i]), nil })
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Post-processing (%s) failed due to context error: %v", mode, ctx.Err())
+		return "", "", ctx.Err()
+	}
+	return results[0], results[1], nil
+}
+
+// CondenseTo is CondenseStream writing to w, with chunks separated the way Condense joins them,
+// so very large outputs never have to be held in memory as a whole
+func (e *Engine) CondenseTo(ctx context.Context, mode, text string, opts Options, w io.Writer) error {
+	separator := ""
+	return e.CondenseStream(ctx, mode, text, opts, func(chunk string) error {
+		if _, err := io.WriteString(w, separator+chunk); err != nil {
+			return err
+		}
+		separator = "\n\n"
+		return nil
+	})
+}
+
+// CondenseTranscriptTwoTrack returns both a lightly cleaned full transcript and a condensed one
+func (e *Engine) CondenseTranscriptTwoTrack(ctx context.Context, text string, opts Options) (full, condensed string, err error) {
+	ctx = withOptions(ctx, opts)
+	text, err = e.preProcess(ctx, ModeTranscript, text)
+	if err != nil {
+		return "", "", err
+	}
+	cfg, err := e.sizeConfig(ctx, text)
+	if err != nil {
+		return "", "", err
+	}
+
+	full, condensed = workers.ProcessTranscriptTwoTrack(ctx, e.client, text, cfg, opts.Ratio)
+	full, condensed = e.finish(ctx, ModeTranscript, opts, full), e.finish(ctx, ModeTranscript, opts, condensed)
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Two-track transcript processing failed due to context error: %v", ctx.Err())
+		return "", "", ctx.Err()
+	}
+	return full, condensed, nil
+}
+
+// CondenseTranscriptTurns is CondenseTranscript returning the speaker turns instead of the
+// formatted transcript. Turns keep the subtitle timings they were given unless post-processing
+// or translation changed how many turns there are.
+func (e *Engine) CondenseTranscriptTurns(ctx context.Context, text string, opts Options) ([]transcript.Turn, error) {
+	ctx = withOptions(ctx, opts)
+	text, err := e.preProcess(ctx, ModeTranscript, text)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := e.sizeConfig(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	turns := workers.ProcessTranscriptTurns(ctx, e.client, text, cfg, opts.Ratio)
+	if len(turns) == 0 || ctx.Err() != nil {
+		if ctx.Err() != nil {
+			reqctx.Logger(ctx).Printf("Transcript turn processing failed due to context error: %v", ctx.Err())
+		}
+		return nil, ctx.Err()
+	}
+	if cleared := transcript.CheckTimings(turns, transcript.ParseCues(text)); cleared > 0 {
+		reqctx.Logger(ctx).Printf("Dropped the timings of %d of %d turns that don't match the input's subtitles", cleared, len(turns))
+	}
+	if len(e.pipeline) == 0 && opts.TranslateTo == "" {
+		return turns, nil
+	}
+
+	// Turns are returned structured, so the transcript stays in the format ParseTurns reads
+	opts.TranscriptFormat = transcript.Format{Names: e.cfg.SpeakerNames}
+	finished := transcript.ParseTurns(e.finish(ctx, ModeTranscript, opts, transcript.FormatTurns(ctx, turns, opts.TranscriptFormat)))
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Post-processing (transcript turns) failed due to context error: %v", ctx.Err())
+		return nil, ctx.Err()
+	}
+	if len(finished) != len(turns) {
+		reqctx.Logger(ctx).Printf("Post-processing changed the turn count from %d to %d; dropping turn timings", len(turns), len(finished))
+		return finished, nil
+	}
+	for i := range finished {
+		finished[i].Start, finished[i].End = turns[i].Start, turns[i].End
+	}
+	return finished, nil
+}
+
+// CondenseWithExecutiveSummary condenses a document like CondenseDocument and then writes a
+// one-paragraph executive summary of the condensed text in a second pass, with the job's model or
+// FAST_MODEL, so both come from a single run over the chunks
+func (e *Engine) CondenseWithExecutiveSummary(ctx context.Context, text string, opts Options) (summary, full string, err error) {
+	full, err = e.Condense(ctx, ModeDocument, text, opts)
+	if err != nil {
+		return "", "", err
+	}
+	if full == "" {
+		return "", "", ErrEmptyExecutiveSummary
+	}
+	summary, err = e.client.ExecutiveSummary(withOptions(ctx, opts), cmp.Or(opts.Model, e.cfg.FastModel), full)
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Executive summary failed due to context error: %v", ctx.Err())
+		return "", "", ctx.Err()
+	}
+	if err != nil || summary == "" {
+		reqctx.Logger(ctx).Printf("Executive summary failed: %v", err)
+		return "", "", ErrEmptyExecutiveSummary
+	}
+	return summary, full, nil
+}
+
+// TagTones fills in the sentiment and tone of each turn in place, with the job's model or
+// FAST_MODEL
+func (e *Engine) TagTones(ctx context.Context, turns []transcript.Turn, opts Options) error {
+	ctx = withOptions(ctx, opts)
+	workers.TagTurnTones(ctx, e.client, turns, e.cfg)
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Tone tagging failed due to context error: %v", ctx.Err())
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Chapters splits the timed turns of a transcript into titled chapters. The first chapter starts
+// at the beginning of the episode and each ends where the next starts, the last where the last
+// timed turn ends. Without timed turns there are none. Long transcripts are chaptered in parts of
+// about CHUNK_SIZE words, one after the other, with the job's model or FAST_MODEL.
+func (e *Engine) Chapters(ctx context.Context, turns []transcript.Turn, opts Options) ([]transcript.Chapter, error) {
+	ctx = withOptions(ctx, opts)
+	model := cmp.Or(opts.Model, e.cfg.FastModel)
+	var lines []string
+	var starts []time.Duration
+	var end time.Duration
+	for _, turn := range turns {
+		start, startOK := transcript.ParseTimestamp(turn.Start)
+		turnEnd, endOK := transcript.ParseTimestamp(turn.End)
+		if !startOK || !endOK || turnEnd <= start {
+			continue
+		}
+		lines = append(lines, turn.Speaker+": "+turn.Text)
+		starts = append(starts, start)
+		end = max(end, turnEnd)
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	var marks []api.ChapterMark
+	for first := 0; first < len(lines); {
+		last, words := first, 0
+		for last < len(lines) && (last == first || words+wordcount.Count(lines[last]) <= e.cfg.ChunkSize) {
+			words += wordcount.Count(lines[last])
+			last++
+		}
+		part, err := e.client.Chapters(ctx, model, lines[first:last], first > 0)
+		if ctx.Err() != nil {
+			reqctx.Logger(ctx).Printf("Chapterization failed due to context error: %v", ctx.Err())
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, mark := range part {
+			mark.Turn += first
+			marks = append(marks, mark)
+		}
+		first = last
+	}
+	chapters := make([]transcript.Chapter, len(marks))
+	for i, mark := range marks {
+		chapters[i] = transcript.Chapter{End: end, Title: mark.Title}
+		if i > 0 {
+			chapters[i].Start = starts[mark.Turn]
+			chapters[i-1].End = chapters[i].Start
+		}
+	}
+	return chapters, nil
+}
+
+// Embed returns the EMBEDDING_MODEL embedding of each of texts, for taskType api.EmbedDocument
+// or api.EmbedQuery
+func (e *Engine) Embed(ctx context.Context, taskType string, texts []string) ([][]float32, error) {
+	if e.cfg.EmbeddingModel == "" {
+		return nil, fmt.Errorf("EMBEDDING_MODEL is not configured")
+	}
+	return e.client.Embed(ctx, e.cfg.EmbeddingModel, taskType, texts)
+}
+
+// AnswerQuestion answers a question from numbered passages of a document, citing the ones it
+// uses, with the job's model or FAST_MODEL
+func (e *Engine) AnswerQuestion(ctx context.Context, question string, passages map[int]string, opts Options) (api.Answer, error) {
+	answer, err := e.client.AnswerQuestion(ctx, cmp.Or(opts.Model, e.cfg.FastModel), question, passages)
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Question answering failed due to context error: %v", ctx.Err())
+		return api.Answer{}, ctx.Err()
+	}
+	return answer, err
+}
+
+// CompareDocuments summarizes the agreements, differences and unique points of several documents
+// with FAST_MODEL. The documents may come from jobs with different models, so no job's is used.
+func (e *Engine) CompareDocuments(ctx context.Context, docs []string) (api.DocumentComparison, error) {
+	comparison, err := e.client.CompareDocuments(ctx, e.cfg.FastModel, docs)
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Document comparison failed due to context error: %v", ctx.Err())
+		return api.DocumentComparison{}, ctx.Err()
+	}
+	return comparison, err
+}
+
+// Flashcards derives study question/answer pairs from processed output, with the job's model or
+// FAST_MODEL
+func (e *Engine) Flashcards(ctx context.Context, output string, opts Options) ([]api.Flashcard, error) {
+	ctx = withOptions(ctx, opts)
+	cards := workers.MakeFlashcards(ctx, e.client, output, e.cfg)
+	if ctx.Err() != nil {
+		reqctx.Logger(ctx).Printf("Flashcard generation failed due to context error: %v", ctx.Err())
+		return nil, ctx.Err()
+	}
+	if len(cards) == 0 {
+		return nil, ErrNoFlashcards
+	}
+	return cards, nil
+}
+
+// sizeConfig returns the configuration to process text with. When text would need more than
+// MAX_CHUNKS chunks, the chunk size is scaled up so it fits, as long as that stays within
+// MAX_CHUNK_SIZE; beyond that the input is rejected with ErrTooLarge.
+func (e *Engine) sizeConfig(ctx context.Context, text string) (*config.Config, error) {
+	if e.cfg.MaxChunks <= 0 {
+		return e.cfg, nil
+	}
+	words := wordcount.Count(text)
+	step := max(e.cfg.ChunkSize-e.cfg.ChunkOverlap, 1)
+	if (words+step-1)/step <= e.cfg.MaxChunks {
+		return e.cfg, nil
+	}
+
+	chunkSize := (words+e.cfg.MaxChunks-1)/e.cfg.MaxChunks + e.cfg.ChunkOverlap
+	maxChunkSize := max(e.cfg.MaxChunkSize, e.cfg.ChunkSize)
+	if chunkSize > maxChunkSize {
+		limit := e.cfg.MaxChunks * (maxChunkSize - e.cfg.ChunkOverlap)
+		reqctx.Logger(ctx).Printf("Rejecting input of %d words (limit %d)", words, limit)
+		return nil, fmt.Errorf("%w: %d words is more than the limit of %d words (%d chunks of at most %d words)",
+			ErrTooLarge, words, limit, e.cfg.MaxChunks, maxChunkSize)
+	}
+	reqctx.Logger(ctx).Printf("Input of %d words: scaling chunk size from %d to %d words to stay within %d chunks",
+		words, e.cfg.ChunkSize, chunkSize, e.cfg.MaxChunks)
+	scaled := *e.cfg
+	scaled.ChunkSize = chunkSize
+	return &scaled, nil
+}
+
+// preProcess runs the configured pre-hooks over the input
+func (e *Engine) preProcess(ctx context.Context, mode, text string) (string, error) {
+	if len(e.preHooks) == 0 {
+		return text, nil
+	}
+	doc, err := e.preHooks.Run(ctx, postprocess.Document{Mode: mode, Text: text})
+	if err != nil {
+		reqctx.Error(ctx).Printf("PRE-HOOK FAILED: %v", err)
+		return "", fmt.Errorf("%w: %v", ErrPreHook, err)
+	}
+	return doc.Text, nil
+}
+
+// finish runs the configured post-processors, then the final translation pass when TranslateTo is set
+func (e *Engine) finish(ctx context.Context, mode string, opts Options, result string) string {
+	if result == "" || ctx.Err() != nil {
+		return result
+	}
+	doc, err := e.pipeline.Run(ctx, postprocess.Document{Mode: mode, Text: result})
+	if err != nil {
+		reqctx.Logger(ctx).Printf("Post-processing failed, using unprocessed output: %v", err)
+	} else {
+		result = doc.Text
+	}
+	if opts.TranslateTo != "" {
+		reqctx.Logger(ctx).Printf("Translating %d words of output to '%s'", wordcount.Count(result), opts.TranslateTo)
+		result = workers.TranslateResult(ctx, e.client, result, e.cfg, opts.TranslateTo)
+	}
+	if mode == ModeTranscript {
+		// Speaker names are sanitized as the server is configured, whatever the layout
+		format := opts.TranscriptFormat
+		format.Names = e.cfg.SpeakerNames
+		result = transcript.Reformat(result, format)
+	}
+	return result
+}
+
+// withOptions attaches the per-call options that apply to every API call
+func withOptions(ctx context.Context, opts Options) context.Context {
+	if opts.RunInfo != nil {
+		ctx = api.WithRunInfo(ctx, opts.RunInfo)
+	}
+	if opts.Style != "" || opts.Model != "" || opts.Format != "" {
+		ctx = api.WithOverrides(ctx, api.Overrides{Model: opts.Model, Style: opts.Style, Format: opts.Format})
+	}
+	if opts.SkipSpeakerAnalysis {
+		ctx = workers.WithoutSpeakerAnalysis(ctx)
+	}
+	if len(opts.SpeakerAliases) > 0 || opts.KeepSpeakerNames {
+		rules := transcript.NameRules{Manual: opts.KeepSpeakerNames}
+		aliases, err := transcript.ParseAliases(opts.SpeakerAliases)
+		if err != nil {
+			reqctx.Warn(ctx).Printf("Ignoring invalid speaker aliases: %v", err)
+		} else {
+			rules.Aliases = aliases
+		}
+		ctx = workers.WithSpeakerNameRules(ctx, rules)
+	}
+	return withSeed(ctx, opts.Seed)
+}
+
+// withSeed attaches a RunInfo carrying seed unless ctx already has one
+func withSeed(ctx context.Context, seed *int64) context.Context {
+	if seed == nil {
+		return ctx
+	}
+	if info := api.RunInfoFrom(ctx); info != nil {
+		if info.Seed == nil {
+			info.Seed = seed
+		}
+		return ctx
+	}
+	return api.WithRunInfo(ctx, &api.RunInfo{Seed: seed})
+}
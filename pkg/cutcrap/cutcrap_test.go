@@ -0,0 +1,85 @@
+package cutcrap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/fakeprovider"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// newFakeEngine builds an Engine whose model calls go to a fakeprovider server, with small
+// chunks and no single-call path for small inputs, so a short text takes several calls
+func newFakeEngine(t *testing.T) (*Engine, *fakeprovider.Handler) {
+	t.Helper()
+	provider := &fakeprovider.Handler{}
+	server := fakeprovider.NewServerWith(provider)
+	t.Cleanup(server.Close)
+
+	cfg := config.Load()
+	cfg.ChunkSize, cfg.ChunkOverlap, cfg.MaxConcurrent, cfg.SmallInputWords = 100, 0, 4, 0
+	cfg.PreHooks, cfg.PostHooks, cfg.PostProcessors, cfg.KeepSections = nil, nil, nil, nil
+	client := api.New("fake-key", server.URL, server.Client())
+	engine, err := NewWithClient(cfg, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine, provider
+}
+
+func TestCondenseDocumentEndToEnd(t *testing.T) {
+	engine, provider := newFakeEngine(t)
+	var paragraphs []string
+	for i := range 6 {
+		paragraphs = append(paragraphs, strings.Repeat(fmt.Sprintf("Paragraph %d says something worth keeping. ", i+1), 8))
+	}
+	text := strings.Join(paragraphs, "\n\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	seed := int64(1)
+	output, err := engine.CondenseDocument(ctx, text, Options{Ratio: 0.5, Seed: &seed})
+	if err != nil {
+		t.Fatalf("CondenseDocument: %v", err)
+	}
+	if output == "" {
+		t.Fatal("CondenseDocument returned no output")
+	}
+	if in, out := wordcount.Count(text), wordcount.Count(output); out >= in {
+		t.Errorf("output has %d words, want fewer than the input's %d", out, in)
+	}
+	// The fake keeps the first words of each chunk, two paragraphs long
+	for _, start := range []string{"Paragraph 1", "Paragraph 3", "Paragraph 5"} {
+		if !strings.Contains(output, start) {
+			t.Errorf("output lost the chunk starting with %q:\n%s", start, output)
+		}
+	}
+	if calls := provider.Calls(); calls < 2 {
+		t.Errorf("provider answered %d calls, want one per chunk", calls)
+	}
+}
+
+func TestCondenseTranscriptTurnsEndToEnd(t *testing.T) {
+	engine, _ := newFakeEngine(t)
+	text := "Host: Welcome to the show, today we talk about rivers.\nGuest: Thanks, rivers are my favourite topic.\nHost: Why rivers?\nGuest: They carry everything downstream."
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	turns, err := engine.CondenseTranscriptTurns(ctx, text, Options{Ratio: 0.5})
+	if err != nil {
+		t.Fatalf("CondenseTranscriptTurns: %v", err)
+	}
+	if len(turns) != 4 {
+		t.Fatalf("got %d turns, want 4: %+v", len(turns), turns)
+	}
+	for i, speaker := range []string{"Host", "Guest", "Host", "Guest"} {
+		if turns[i].Speaker != speaker {
+			t.Errorf("turn %d is by %q, want %q", i, turns[i].Speaker, speaker)
+		}
+	}
+}
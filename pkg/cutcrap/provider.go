@@ -0,0 +1,113 @@
+package cutcrap
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/awssig"
+	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/gcpauth"
+	"github.com/arnnvv/cutcrap/pkg/httpclient"
+)
+
+// credentialsTimeout bounds a request for cloud credentials
+const credentialsTimeout = 10 * time.Second
+
+// credentialsClient is the client cloud credentials are fetched with. It bypasses the provider
+// hooks, so PROVIDER_ALLOWED_HOSTS needn't list the token and metadata endpoints, and the
+// recorder.
+func credentialsClient() *http.Client {
+	return &http.Client{Transport: httpclient.Transport, Timeout: credentialsTimeout}
+}
+
+// newProvider builds the model backend selected by PROVIDER, or nil for the Gemini API
+func newProvider(cfg *config.Config, httpClient *http.Client) (api.Provider, error) {
+	models, err := parseProviderModels(cfg.ProviderModels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROVIDER_MODELS configuration: %w", err)
+	}
+	switch cfg.Provider {
+	case "azure":
+		return &api.AzureOpenAI{
+			Endpoint:    cfg.AzureEndpoint,
+			APIKey:      cfg.AzureAPIKey,
+			APIVersion:  cfg.AzureAPIVersion,
+			Deployment:  cfg.AzureDeployment,
+			Deployments: models,
+			HTTPClient:  httpClient,
+		}, nil
+	case "vertex":
+		tokens, err := gcpauth.FromEnvironment(credentialsClient())
+		if err != nil {
+			return nil, fmt.Errorf("invalid Google Cloud credentials: %w", err)
+		}
+		return &api.Vertex{Project: cfg.VertexProject, Location: cfg.VertexLocation, Tokens: tokens, HTTPClient: httpClient}, nil
+	case "bedrock":
+		// Credentials come from the environment or, refreshed as they expire, from the container
+		// or instance metadata endpoint
+		return &api.Bedrock{
+			Region:      cfg.BedrockRegion,
+			Credentials: awssig.FromEnvironment(credentialsClient()),
+			ModelID:     cfg.BedrockModelID,
+			Models:      models,
+			HTTPClient:  httpClient,
+		}, nil
+	}
+	return nil, nil
+}
+
+// newProviderHooks builds the hooks for PROVIDER_HEADERS, PROVIDER_ALLOWED_HOSTS and
+// PROVIDER_AUDIT_LOG, or nil when none is set
+func newProviderHooks(cfg *config.Config) (*api.Hooks, error) {
+	hooks := &api.Hooks{}
+	if cfg.ProviderHeaders != "" {
+		headers := make(http.Header)
+		for _, header := range strings.Split(cfg.ProviderHeaders, ";") {
+			name, value, ok := strings.Cut(header, ":")
+			if name = strings.TrimSpace(name); !ok || name == "" {
+				return nil, fmt.Errorf("invalid PROVIDER_HEADERS configuration: expected Name: value, got %q", header)
+			}
+			headers.Add(name, strings.TrimSpace(value))
+		}
+		hooks.OnRequest = append(hooks.OnRequest, api.HeaderHook(headers))
+	}
+	if len(cfg.ProviderAllowedHosts) > 0 {
+		hosts := make([]string, len(cfg.ProviderAllowedHosts))
+		for i, host := range cfg.ProviderAllowedHosts {
+			hosts[i] = strings.ToLower(host)
+		}
+		hooks.OnRequest = append(hooks.OnRequest, api.AllowHostsHook(hosts))
+	}
+	if cfg.ProviderAuditLog != "" {
+		file, err := os.OpenFile(cfg.ProviderAuditLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PROVIDER_AUDIT_LOG configuration: %w", err)
+		}
+		hooks.OnResponse = append(hooks.OnResponse, api.AuditHook(file))
+	}
+	if len(hooks.OnRequest) == 0 && len(hooks.OnResponse) == 0 {
+		return nil, nil
+	}
+	return hooks, nil
+}
+
+// parseProviderModels parses "gemini-model=backend-model,..."
+func parseProviderModels(spec string) (map[string]string, error) {
+	models := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		gemini, backend, ok := strings.Cut(pair, "=")
+		gemini, backend = strings.TrimSpace(gemini), strings.TrimSpace(backend)
+		if !ok || gemini == "" || backend == "" {
+			return nil, fmt.Errorf("expected gemini-model=backend-model, got %q", pair)
+		}
+		models[gemini] = backend
+	}
+	return models, nil
+}
@@ -0,0 +1,124 @@
+package cutcrap
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/arnnvv/cutcrap/pkg/chunker"
+	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// ChunkOutput is the model output for one chunk of a document
+type ChunkOutput struct {
+	Text   string `json:"text"`
+	Output string `json:"output"`
+}
+
+// anchorWords is how many leading words locate a previous chunk in a revised text. Shorter
+// chunks are not looked for.
+const anchorWords = 8
+
+// chunkMatch is a previous chunk found unchanged in a revised text, as a word range
+type chunkMatch struct {
+	start, end int
+	chunk      int
+}
+
+// alignChunks chunks a revised prose segment so the unchanged parts keep the chunks of the
+// previous version, whose outputs can then be reused. Previous chunks found word for word in text
+// are kept as they were; the changed stretches between them are chunked afresh. Without any
+// match the result is the normal chunking. The chunks' word counts are returned with them.
+func alignChunks(ctx context.Context, text string, cfg *config.Config, previous []ChunkOutput) ([]string, []int, error) {
+	words := wordSpans(text)
+	previousWords := make([][]string, len(previous))
+	byAnchor := make(map[string][]int)
+	for i, chunk := range previous {
+		previousWords[i] = strings.Fields(chunk.Text)
+		if len(previousWords[i]) >= anchorWords {
+			anchor := strings.Join(previousWords[i][:anchorWords], " ")
+			byAnchor[anchor] = append(byAnchor[anchor], i)
+		}
+	}
+
+	// Matches are taken left to right; each must reach past the one before. Consecutive previous
+	// chunks overlap by CHUNK_OVERLAP words, so their matches do too.
+	var matches []chunkMatch
+	lastStart, lastEnd := -1, 0
+	anchor := make([]string, anchorWords)
+	for i := 0; i+anchorWords <= len(words); i++ {
+		for j := range anchor {
+			anchor[j] = text[words[i+j][0]:words[i+j][1]]
+		}
+		best := chunkMatch{chunk: -1}
+		for _, candidate := range byAnchor[strings.Join(anchor, " ")] {
+			end := i + len(previousWords[candidate])
+			if end > len(words) || end <= best.end || !sameWords(text, words[i:end], previousWords[candidate]) {
+				continue
+			}
+			best = chunkMatch{start: i, end: end, chunk: candidate}
+		}
+		if best.chunk >= 0 && best.start > lastStart && best.end > lastEnd {
+			matches = append(matches, best)
+			lastStart, lastEnd = best.start, best.end
+		}
+	}
+	if len(matches) == 0 {
+		return chunker.ChunkText(ctx, text, cfg.ChunkSize, cfg.ChunkOverlap)
+	}
+
+	var chunks []string
+	var chunkWords []int
+	cursor := 0
+	chunkGap := func(from, to int) error {
+		if from >= to {
+			return nil
+		}
+		gap, gapWords, err := chunker.ChunkText(ctx, text[words[from][0]:words[to-1][1]], cfg.ChunkSize, cfg.ChunkOverlap)
+		chunks, chunkWords = append(chunks, gap...), append(chunkWords, gapWords...)
+		return err
+	}
+	for _, match := range matches {
+		if err := chunkGap(cursor, match.start); err != nil {
+			return nil, nil, err
+		}
+		chunks = append(chunks, previous[match.chunk].Text)
+		chunkWords = append(chunkWords, wordcount.Count(previous[match.chunk].Text))
+		cursor = max(cursor, match.end)
+	}
+	if err := chunkGap(cursor, len(words)); err != nil {
+		return nil, nil, err
+	}
+	return chunks, chunkWords, nil
+}
+
+// wordSpans returns the byte range of every whitespace-separated word of text
+func wordSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// sameWords reports whether the words of text at spans are words
+func sameWords(text string, spans [][2]int, words []string) bool {
+	for i, span := range spans {
+		if text[span[0]:span[1]] != words[i] {
+			return false
+		}
+	}
+	return true
+}
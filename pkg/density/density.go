@@ -0,0 +1,89 @@
+// Package density scores how much information a chunk carries, so the condensing budget can
+// favour dense chunks over filler.
+package density
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+var (
+	numberRegex  = regexp.MustCompile(`\d+(?:[.,]\d+)*%?`)
+	headingRegex = regexp.MustCompile(`(?m)^\s*#{1,6}\s+\S`)
+)
+
+// Weight bounds keep a very dense or very empty chunk from taking or losing the whole budget
+const (
+	minWeight = 0.25
+	maxWeight = 3.0
+)
+
+// Score returns the information density of a chunk: named entities, numbers and headings per
+// word. Numbers count double and headings five times, since they mark data and structure.
+func Score(text string) float64 {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return 0
+	}
+	entities := 0
+	for i, word := range words {
+		first := []rune(strings.TrimLeft(word, `"'([`))
+		if len(first) == 0 || !unicode.IsUpper(first[0]) {
+			continue
+		}
+		// A capital after a sentence end is just the start of the next sentence
+		if i > 0 && !strings.ContainsAny(words[i-1][len(words[i-1])-1:], ".!?:") {
+			entities++
+		}
+	}
+	numbers := len(numberRegex.FindAllString(text, -1))
+	headings := len(headingRegex.FindAllString(text, -1))
+	return float64(entities+2*numbers+5*headings) / float64(len(words))
+}
+
+// Targets splits a budget of ratio times the total word count over the chunks, in proportion to
+// each chunk's length weighted by its density relative to the average. strength 0 weights every
+// chunk the same, 1 scales it fully by its relative density. The targets still add up to the
+// global budget.
+func Targets(chunks []string, ratio, strength float64) []int {
+	words := make([]int, len(chunks))
+	scores := make([]float64, len(chunks))
+	totalWords, weightedScore := 0, 0.0
+	for i, chunk := range chunks {
+		words[i] = wordcount.Count(chunk)
+		scores[i] = Score(chunk)
+		totalWords += words[i]
+		weightedScore += scores[i] * float64(words[i])
+	}
+
+	targets := make([]int, len(chunks))
+	if totalWords == 0 {
+		for i := range targets {
+			targets[i] = 1
+		}
+		return targets
+	}
+	mean := weightedScore / float64(totalWords)
+
+	raw := make([]float64, len(chunks))
+	rawTotal := 0.0
+	for i := range chunks {
+		weight := 1.0
+		if mean > 0 {
+			weight = 1 + strength*(scores[i]/mean-1)
+		}
+		weight = math.Max(minWeight, math.Min(maxWeight, weight))
+		raw[i] = float64(words[i]) * weight
+		rawTotal += raw[i]
+	}
+
+	budget := ratio * float64(totalWords)
+	for i := range chunks {
+		targets[i] = max(1, int(math.Round(budget*raw[i]/rawTotal)))
+	}
+	return targets
+}
@@ -0,0 +1,149 @@
+// Package eval scores condensed outputs against reference summaries, so prompt and model
+// changes can be compared on more than impressions.
+package eval
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// Scores are the evaluation metrics of one output. Fields that need a reference are zero when
+// none was given.
+type Scores struct {
+	// RougeL is the F1 of the longest common word subsequence of output and reference
+	RougeL          float64 `json:"rouge_l"`
+	RougeLPrecision float64 `json:"rouge_l_precision"`
+	RougeLRecall    float64 `json:"rouge_l_recall"`
+	// Compression is the output length in words relative to the source
+	Compression float64 `json:"compression"`
+	// EntityRecall is the share of the entities and numbers of the reference (or the source,
+	// without a reference) that the output still mentions
+	EntityRecall float64 `json:"entity_recall"`
+}
+
+// maxLCSCells bounds the ROUGE-L table; longer texts are compared by their first words only
+const maxLCSCells = 4 << 20
+
+// Evaluate scores output against source and, when not empty, reference
+func Evaluate(source, output, reference string) Scores {
+	var s Scores
+	if sourceWords := wordcount.Count(source); sourceWords > 0 {
+		s.Compression = float64(wordcount.Count(output)) / float64(sourceWords)
+	}
+	if reference != "" {
+		s.RougeLPrecision, s.RougeLRecall, s.RougeL = RougeL(output, reference)
+		s.EntityRecall = EntityRecall(reference, output)
+	} else {
+		s.EntityRecall = EntityRecall(source, output)
+	}
+	return s
+}
+
+// Mean averages scores
+func Mean(scores []Scores) Scores {
+	var m Scores
+	if len(scores) == 0 {
+		return m
+	}
+	for _, s := range scores {
+		m.RougeL += s.RougeL
+		m.RougeLPrecision += s.RougeLPrecision
+		m.RougeLRecall += s.RougeLRecall
+		m.Compression += s.Compression
+		m.EntityRecall += s.EntityRecall
+	}
+	n := float64(len(scores))
+	m.RougeL, m.RougeLPrecision, m.RougeLRecall = m.RougeL/n, m.RougeLPrecision/n, m.RougeLRecall/n
+	m.Compression, m.EntityRecall = m.Compression/n, m.EntityRecall/n
+	return m
+}
+
+// RougeL returns the precision, recall and F1 of the longest common subsequence of the words
+// of candidate and reference, ignoring case and punctuation
+func RougeL(candidate, reference string) (precision, recall, f1 float64) {
+	c, r := tokens(candidate), tokens(reference)
+	if len(c) == 0 || len(r) == 0 {
+		return 0, 0, 0
+	}
+	for len(c)*len(r) > maxLCSCells {
+		c, r = c[:len(c)*3/4], r[:len(r)*3/4]
+	}
+
+	// Two rows of the LCS table are enough for its length
+	prev, curr := make([]int32, len(r)+1), make([]int32, len(r)+1)
+	for i := range c {
+		for j := range r {
+			if c[i] == r[j] {
+				curr[j+1] = prev[j] + 1
+			} else {
+				curr[j+1] = max(prev[j+1], curr[j])
+			}
+		}
+		prev, curr = curr, prev
+	}
+	lcs := float64(prev[len(r)])
+	if lcs == 0 {
+		return 0, 0, 0
+	}
+	precision, recall = lcs/float64(len(c)), lcs/float64(len(r))
+	return precision, recall, 2 * precision * recall / (precision + recall)
+}
+
+// tokens returns the lowercase words of text without surrounding punctuation
+func tokens(text string) []string {
+	var words []string
+	for _, field := range strings.Fields(text) {
+		word := strings.ToLower(strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}))
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+var (
+	// A run of capitalized words, e.g. "New York Times"; the first word of a sentence only
+	// counts when another capitalized word follows
+	entityRegex = regexp.MustCompile(`\p{Lu}[\p{L}\d'’-]*(?:\s+\p{Lu}[\p{L}\d'’-]*)*`)
+	numberRegex = regexp.MustCompile(`\d+(?:[.,]\d+)*%?`)
+)
+
+// Entities returns the distinct named entities and numbers of text, lowercased
+func Entities(text string) map[string]bool {
+	entities := make(map[string]bool)
+	for _, loc := range entityRegex.FindAllStringIndex(text, -1) {
+		entity := text[loc[0]:loc[1]]
+		before := strings.TrimRight(text[:loc[0]], " \t\"'“(")
+		sentenceStart := before == "" || strings.ContainsAny(before[len(before)-1:], ".!?:\n#*")
+		if sentenceStart && !strings.ContainsAny(entity, " \t\n") {
+			continue
+		}
+		entities[strings.ToLower(strings.Join(strings.Fields(entity), " "))] = true
+	}
+	for _, number := range numberRegex.FindAllString(text, -1) {
+		entities[number] = true
+	}
+	return entities
+}
+
+// EntityRecall returns the share of the entities of reference that output mentions, 1 when
+// reference has none
+func EntityRecall(reference, output string) float64 {
+	want := Entities(reference)
+	if len(want) == 0 {
+		return 1
+	}
+	lower := strings.ToLower(output)
+	found := 0
+	for entity := range want {
+		if strings.Contains(lower, entity) {
+			found++
+		}
+	}
+	return float64(found) / float64(len(want))
+}
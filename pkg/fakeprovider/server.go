@@ -0,0 +1,304 @@
+// Package fakeprovider is an in-process stand-in for the Gemini API. It returns canned,
+// deterministic responses so the pipeline can run end to end without network access:
+//
+//	server := fakeprovider.NewServer()
+//	defer server.Close()
+//	client := api.New("fake-key", server.URL, server.Client())
+package fakeprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+var (
+	targetWordsRegex = regexp.MustCompile(`approximately (\d+) words`)
+	numberedLine     = regexp.MustCompile(`(?m)^\[(\d+)\] `)
+	speakerLine      = regexp.MustCompile(`^([^:]{1,40}):\s*(.+)$`)
+	documentStart    = regexp.MustCompile(`--- DOCUMENT (\d+) START ---\n(.*)`)
+	cueTiming        = regexp.MustCompile(`^((?:\d+:)?\d{2}:\d{2}[.,]\d{3})\s*-->\s*((?:\d+:)?\d{2}:\d{2}[.,]\d{3})`)
+	cueNumber        = regexp.MustCompile(`^\d+$`)
+)
+
+// Handler serves the subset of the Gemini API used by pkg/api
+type Handler struct {
+	// Latency, when set, delays each generateContent answer like a real model would: Latency
+	// plus PerOutputWord for every word answered, varied by up to ±Jitter (a fraction, e.g. 0.2)
+	Latency       time.Duration
+	PerOutputWord time.Duration
+	Jitter        float64
+
+	calls    atomic.Int64
+	inFlight atomic.Int64
+	peak     atomic.Int64
+}
+
+// NewServer starts an httptest server backed by a new Handler
+func NewServer() *httptest.Server {
+	return NewServerWith(&Handler{})
+}
+
+// NewServerWith starts an httptest server backed by h, so its counters can be read
+func NewServerWith(h *Handler) *httptest.Server {
+	return httptest.NewServer(h)
+}
+
+// Calls returns how many API requests the handler has answered
+func (h *Handler) Calls() int64 {
+	return h.calls.Load()
+}
+
+// PeakInFlight returns the most requests the handler has served at once
+func (h *Handler) PeakInFlight() int64 {
+	return h.peak.Load()
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls.Add(1)
+	inFlight := h.inFlight.Add(1)
+	defer h.inFlight.Add(-1)
+	for {
+		peak := h.peak.Load()
+		if inFlight <= peak || h.peak.CompareAndSwap(peak, inFlight) {
+			break
+		}
+	}
+	switch {
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, ":generateContent"):
+		h.generateContent(w, r)
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, ":batchEmbedContents"):
+		h.batchEmbedContents(w, r)
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/cachedContents"):
+		writeJSON(w, map[string]string{"name": "cachedContents/fake"})
+	case r.Method == "DELETE" && strings.Contains(r.URL.Path, "/cachedContents/"):
+		writeJSON(w, map[string]string{})
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+type request struct {
+	Contents []struct {
+		Parts []struct {
+			Text string `json:"text"`
+		} `json:"parts"`
+	} `json:"contents"`
+	GenerationConfig struct {
+		ResponseMimeType string `json:"responseMimeType"`
+		ResponseSchema   any    `json:"responseSchema"`
+	} `json:"generationConfig"`
+}
+
+func (h *Handler) generateContent(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var prompt strings.Builder
+	for _, content := range req.Contents {
+		for _, part := range content.Parts {
+			prompt.WriteString(part.Text)
+		}
+	}
+	text := respond(prompt.String(), req.GenerationConfig.ResponseSchema != nil)
+	if !h.simulateLatency(r, wordcount.Count(text)) {
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"candidates": []map[string]any{{
+			"content":      map[string]any{"parts": []map[string]string{{"text": text}}, "role": "model"},
+			"finishReason": "STOP",
+		}},
+		"usageMetadata": map[string]int{
+			"promptTokenCount":     wordcount.Count(prompt.String()),
+			"candidatesTokenCount": wordcount.Count(text),
+			"totalTokenCount":      wordcount.Count(prompt.String()) + wordcount.Count(text),
+		},
+		"modelVersion": "fake",
+	})
+}
+
+// simulateLatency waits out the configured latency of an answer of words words. It returns
+// false when the client gave up first.
+func (h *Handler) simulateLatency(r *http.Request, words int) bool {
+	delay := h.Latency + time.Duration(words)*h.PerOutputWord
+	if delay <= 0 {
+		return true
+	}
+	if h.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + h.Jitter*(2*rand.Float64()-1)))
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// embeddingDimensions is the length of the fake embeddings
+const embeddingDimensions = 64
+
+// batchEmbedContents embeds each text as its hashed bag of lowercased words, so texts sharing
+// words are similar
+func (h *Handler) batchEmbedContents(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Requests []struct {
+			Content struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"content"`
+		} `json:"requests"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	embeddings := make([]map[string][]float32, len(req.Requests))
+	for i, request := range req.Requests {
+		values := make([]float32, embeddingDimensions)
+		for _, part := range request.Content.Parts {
+			for _, word := range strings.Fields(strings.ToLower(part.Text)) {
+				hash := fnv.New32a()
+				hash.Write([]byte(strings.Trim(word, ".,;:!?\"'()")))
+				values[hash.Sum32()%embeddingDimensions]++
+			}
+		}
+		embeddings[i] = map[string][]float32{"values": values}
+	}
+	writeJSON(w, map[string]any{"embeddings": embeddings})
+}
+
+// respond picks a canned answer based on which prompt pkg/api sent
+func respond(prompt string, structured bool) string {
+	switch {
+	case strings.Contains(prompt, "identify the speakers"):
+		return "- Total Speakers: 2\n- Host: Host, Leads the conversation\n- Guest 1: Guest, Answers questions"
+
+	case strings.Contains(prompt, "--- PASSAGES START ---"):
+		// Cites the first passage given
+		citations := []int{}
+		if match := numberedLine.FindStringSubmatch(prompt); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			citations = append(citations, number)
+		}
+		body, _ := json.Marshal(map[string]any{"answer": "The document says so.", "citations": citations})
+		return string(body)
+
+	case strings.Contains(prompt, "--- DOCUMENT 1 START ---"):
+		// Agrees on nothing and finds each document's first words unique to it
+		var unique []map[string]any
+		for _, match := range documentStart.FindAllStringSubmatch(prompt, -1) {
+			number, _ := strconv.Atoi(match[1])
+			words := strings.Fields(match[2])
+			unique = append(unique, map[string]any{"document": number, "points": []string{strings.Join(words[:min(5, len(words))], " ")}})
+		}
+		body, _ := json.Marshal(map[string]any{"agreements": []string{}, "differences": []string{"The documents differ."}, "unique": unique})
+		return string(body)
+
+	case strings.Contains(prompt, "--- EPISODE TURNS START ---"):
+		// Starts a chapter every other turn
+		var chapters []map[string]any
+		for _, match := range numberedLine.FindAllStringSubmatch(prompt, -1) {
+			if index, _ := strconv.Atoi(match[1]); index%2 == 0 {
+				chapters = append(chapters, map[string]any{"turn": index, "title": fmt.Sprintf("Chapter %d", index/2+1)})
+			}
+		}
+		body, _ := json.Marshal(chapters)
+		return string(body)
+
+	case structured && strings.Contains(prompt, "--- SUBTITLES START ---"):
+		return transcriptTurns(between(prompt, "--- SUBTITLES START ---", "--- SUBTITLES END ---"))
+
+	case structured:
+		return transcriptTurns(between(prompt, "--- CURRENT CHUNK START ---", "--- CURRENT CHUNK END ---"))
+
+	case strings.Contains(prompt, "--- TURNS START ---"):
+		var tags []map[string]any
+		for _, match := range numberedLine.FindAllStringSubmatch(prompt, -1) {
+			index, _ := strconv.Atoi(match[1])
+			tags = append(tags, map[string]any{"index": index, "sentiment": "neutral", "tone": "calm"})
+		}
+		body, _ := json.Marshal(tags)
+		return string(body)
+
+	case strings.Contains(prompt, "--- TEXT TO CONDENSE START ---"):
+		words := strings.Fields(between(prompt, "--- TEXT TO CONDENSE START ---", "--- TEXT TO CONDENSE END ---"))
+		if match := targetWordsRegex.FindStringSubmatch(prompt); match != nil {
+			if target, _ := strconv.Atoi(match[1]); target < len(words) {
+				words = words[:target]
+			}
+		}
+		return strings.Join(words, " ")
+
+	case strings.Contains(prompt, "--- TEXT START ---"):
+		return between(prompt, "--- TEXT START ---", "--- TEXT END ---")
+
+	case strings.Contains(prompt, "--- TRANSCRIPT START ---"):
+		return "# Host's key questions\n- What happened?\n\n# What Guest argued\n- It went well."
+	}
+	return "Fake response."
+}
+
+// transcriptTurns converts "Name: speech" lines into the structured turn array. Subtitle cue
+// numbers are dropped and each cue's timing is copied onto the turn of its first line.
+func transcriptTurns(chunk string) string {
+	var turns []map[string]string
+	var timing []string
+	for _, line := range strings.Split(chunk, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || cueNumber.MatchString(line) {
+			continue
+		}
+		if match := cueTiming.FindStringSubmatch(line); match != nil {
+			timing = match
+			continue
+		}
+		turn := map[string]string{"speaker": "Speaker 1", "text": line}
+		if match := speakerLine.FindStringSubmatch(line); match != nil {
+			turn = map[string]string{"speaker": strings.TrimSpace(match[1]), "text": match[2]}
+		}
+		if timing != nil {
+			turn["start"], turn["end"] = timing[1], timing[2]
+			timing = nil
+		}
+		turns = append(turns, turn)
+	}
+	body, _ := json.Marshal(turns)
+	return string(body)
+}
+
+func between(s, start, end string) string {
+	i := strings.Index(s, start)
+	if i < 0 {
+		return ""
+	}
+	s = s[i+len(start):]
+	if j := strings.Index(s, end); j >= 0 {
+		s = s[:j]
+	}
+	return strings.TrimSpace(s)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, fmt.Sprintf("encode failed: %v", err), http.StatusInternalServerError)
+	}
+}
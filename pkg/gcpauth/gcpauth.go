@@ -0,0 +1,229 @@
+// Package gcpauth gets OAuth access tokens for Google Cloud APIs from application default
+// credentials, without pulling in the Google SDKs. Tokens are cached and refreshed shortly
+// before they expire.
+package gcpauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope grants access to every Google Cloud API the credentials' roles allow
+const Scope = "https://www.googleapis.com/auth/cloud-platform"
+
+const (
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+	metadataURL     = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	// refreshMargin is how long before its expiry a token is replaced
+	refreshMargin = time.Minute
+)
+
+// credentialsFile is a service account key or a gcloud user credentials file
+type credentialsFile struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenSource hands out access tokens from one set of credentials
+type TokenSource struct {
+	client *http.Client
+	// static is a fixed token from GCP_ACCESS_TOKEN
+	static string
+	// creds is nil when tokens come from the metadata server
+	creds *credentialsFile
+	key   *rsa.PrivateKey
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// FromEnvironment finds credentials the way Google's libraries do: GCP_ACCESS_TOKEN (used as
+// is), the file named by GOOGLE_APPLICATION_CREDENTIALS, gcloud's application default
+// credentials file, and finally the metadata server of the instance the process runs on.
+func FromEnvironment(client *http.Client) (*TokenSource, error) {
+	if token := os.Getenv("GCP_ACCESS_TOKEN"); token != "" {
+		return &TokenSource{client: client, static: token}, nil
+	}
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			wellKnown := filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(wellKnown); err == nil {
+				path = wellKnown
+			}
+		}
+	}
+	if path == "" {
+		return &TokenSource{client: client}, nil
+	}
+	return FromFile(path, client)
+}
+
+// FromFile reads a service account key or a gcloud "authorized_user" credentials file
+func FromFile(path string, client *http.Client) (*TokenSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed read credentials: %w", err)
+	}
+	var creds credentialsFile
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed decode credentials %s: %w", path, err)
+	}
+	if creds.TokenURI == "" {
+		creds.TokenURI = defaultTokenURL
+	}
+	source := &TokenSource{client: client, creds: &creds}
+	switch creds.Type {
+	case "service_account":
+		if source.key, err = parseKey(creds.PrivateKey); err != nil {
+			return nil, fmt.Errorf("invalid private key in %s: %w", path, err)
+		}
+	case "authorized_user":
+		if creds.RefreshToken == "" {
+			return nil, fmt.Errorf("no refresh_token in %s", path)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported credentials type %q in %s", creds.Type, path)
+	}
+	return source, nil
+}
+
+// Token returns a valid access token, fetching a new one when the cached token is about to expire
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	if s.static != "" {
+		return s.static, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Until(s.expiry) > refreshMargin {
+		return s.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	switch {
+	case s.creds == nil:
+		req, err = http.NewRequestWithContext(ctx, "GET", metadataURL, nil)
+		if err == nil {
+			req.Header.Set("Metadata-Flavor", "Google")
+		}
+	case s.key != nil:
+		var assertion string
+		if assertion, err = s.assertion(time.Now()); err == nil {
+			req, err = tokenRequest(ctx, s.creds.TokenURI, url.Values{
+				"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+				"assertion":  {assertion},
+			})
+		}
+	default:
+		req, err = tokenRequest(ctx, s.creds.TokenURI, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {s.creds.ClientID},
+			"client_secret": {s.creds.ClientSecret},
+			"refresh_token": {s.creds.RefreshToken},
+		})
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed create token request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("token request failed: %s", resp.Status)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed decode token response: %w", err)
+	}
+	if out.AccessToken == "" {
+		return "", errors.New("no access token in token response")
+	}
+	s.token, s.expiry = out.AccessToken, time.Now().Add(time.Duration(out.ExpiresIn)*time.Second)
+	return s.token, nil
+}
+
+func tokenRequest(ctx context.Context, tokenURL string, form url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// assertion is the signed JWT a service account exchanges for an access token
+func (s *TokenSource) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.creds.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   s.creds.ClientEmail,
+		"scope": Scope,
+		"aud":   s.creds.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed sign assertion: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseKey decodes the PEM private key of a service account, PKCS #8 or PKCS #1
+func parseKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,43 @@
+// Package httpclient holds the transport shared by every outgoing HTTP call (model, PDF, hook,
+// webhook and chat APIs), so concurrent calls reuse pooled connections, multiplexed over HTTP/2
+// where the server supports it, instead of each opening its own.
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultMaxIdleConnsPerHost is the idle connections kept per host until Configure is called
+const DefaultMaxIdleConnsPerHost = 64
+
+// Transport is the shared transport. It honors HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+var Transport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          4 * DefaultMaxIdleConnsPerHost,
+	MaxIdleConnsPerHost:   DefaultMaxIdleConnsPerHost,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// Default is a client on Transport without a timeout, for callers that bound each request
+// through its context
+var Default = &http.Client{Transport: Transport}
+
+// Configure sizes the idle connection pool. It must be called before the first request.
+func Configure(maxIdleConnsPerHost int) {
+	Transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	Transport.MaxIdleConns = 4 * maxIdleConnsPerHost
+}
+
+// New returns a client on Transport with a timeout for whole requests
+func New(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: Transport, Timeout: timeout}
+}
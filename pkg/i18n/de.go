@@ -0,0 +1,91 @@
+package i18n
+
+var german = map[string]string{
+	// Request format
+	"Invalid request format: Expected multipart/form-data": "Ungültiges Anfrageformat: multipart/form-data erwartet",
+	"Invalid form data":                    "Ungültige Formulardaten",
+	"Request is too large (at most %d MB)": "Die Anfrage ist zu groß (höchstens %d MB)",
+	"Text field is missing or empty":       "Das Textfeld fehlt oder ist leer",
+	"Invalid text field: %v":               "Ungültiges Textfeld: %v",
+	"Text is too large (at most %d MB)":    "Der Text ist zu groß (höchstens %d MB)",
+
+	// Uploads
+	"file cannot be combined with text or document":                                "file kann nicht mit text oder document kombiniert werden",
+	"files cannot be combined with text, document or file":                         "files kann nicht mit text, document oder file kombiniert werden",
+	"Too many files to merge (at most %d)":                                         "Zu viele Dateien zum Zusammenführen (höchstens %d)",
+	"Text file '%s' is too large":                                                  "Die Textdatei '%s' ist zu groß",
+	"Failed to read text file '%s'":                                                "Die Textdatei '%s' konnte nicht gelesen werden",
+	"Unsupported text file '%s': %v":                                               "Nicht unterstützte Textdatei '%s': %v",
+	"Archive is too large":                                                         "Das Archiv ist zu groß",
+	"Failed to read archive":                                                       "Das Archiv konnte nicht gelesen werden",
+	"Unsupported audio format (expected %s)":                                       "Nicht unterstütztes Audioformat (erwartet: %s)",
+	"Audio file is too large":                                                      "Die Audiodatei ist zu groß",
+	"Failed to read audio file":                                                    "Die Audiodatei konnte nicht gelesen werden",
+	"audio cannot be combined with text, document or archive":                      "audio kann nicht mit text, document oder archive kombiniert werden",
+	"upload cannot be combined with text, document, file, files, archive or audio": "upload kann nicht mit text, document, file, files, archive oder audio kombiniert werden",
+	"Resumable uploads are not enabled on this server":                             "Fortsetzbare Uploads sind auf diesem Server nicht aktiviert",
+	"Upload not found":                                                             "Upload nicht gefunden",
+	"Upload is incomplete (%d of %d bytes received)":                               "Der Upload ist unvollständig (%d von %d Bytes empfangen)",
+	"Failed to read upload":                                                        "Der Upload konnte nicht gelesen werden",
+	"Audio transcription is not enabled on this server":                            "Audio-Transkription ist auf diesem Server nicht aktiviert",
+	"Audio transcription failed":                                                   "Die Audio-Transkription ist fehlgeschlagen",
+	"No speech found in the audio file":                                            "In der Audiodatei wurde keine Sprache gefunden",
+	"Document references are not enabled on this server":                           "Dokumentverweise sind auf diesem Server nicht aktiviert",
+	"Referenced document not found":                                                "Das referenzierte Dokument wurde nicht gefunden",
+	"Document revisions are not enabled on this server":                            "Dokumentrevisionen sind auf diesem Server nicht aktiviert",
+	"Revised document not found":                                                   "Das überarbeitete Dokument wurde nicht gefunden",
+	"Email delivery is not enabled on this server":                                 "E-Mail-Zustellung ist auf diesem Server nicht aktiviert",
+	"Webhook delivery is not enabled on this server":                               "Webhook-Zustellung ist auf diesem Server nicht aktiviert",
+	"Invalid email_to address":                                                     "Ungültige email_to-Adresse",
+	"Invalid webhook_url (must be an http or https URL)":                           "Ungültige webhook_url (muss eine http- oder https-URL sein)",
+	"Invalid webhook_url (must be a public address)":                               "Ungültige webhook_url (muss eine öffentliche Adresse sein)",
+	"Invalid seed value (must be an integer)":                                      "Ungültiger seed-Wert (muss eine ganze Zahl sein)",
+	"Invalid priority value: %v":                                                   "Ungültiger priority-Wert: %v",
+	"Unknown profile '%s'":                                                         "Unbekanntes Profil '%s'",
+	"Invalid ratio value (must be > 0 and <= 1)":                                   "Ungültiger ratio-Wert (muss > 0 und <= 1 sein)",
+	"Invalid keep_sections value: %v":                                              "Ungültiger keep_sections-Wert: %v",
+	"Invalid speaker_aliases value: %v":                                            "Ungültiger speaker_aliases-Wert: %v",
+	"Invalid format value (must be 'prose' or 'bullets')":                          "Ungültiger format-Wert (muss 'prose' oder 'bullets' sein)",
+	"Invalid flashcards value (must be 'csv', 'tsv' or 'json')":                    "Ungültiger flashcards-Wert (muss 'csv', 'tsv' oder 'json' sein)",
+	"flashcards is not supported in outline mode":                                  "flashcards wird im Modus outline nicht unterstützt",
+	"flashcards cannot be combined with two_track, tag_tone or executive_summary":  "flashcards kann nicht mit two_track, tag_tone oder executive_summary kombiniert werden",
+	"Invalid output value (must be 'markdown', 'json', 'srt', 'vtt', 'podlove_chapters' or 'id3_chapters')": "Ungültiger output-Wert (muss 'markdown', 'json', 'srt', 'vtt', 'podlove_chapters' oder 'id3_chapters' sein)",
+
+	// Modes
+	"Invalid mode value (must be 'document', 'transcript', 'speaker_summary' or 'outline')":                               "Ungültiger mode-Wert (muss 'document', 'transcript', 'speaker_summary' oder 'outline' sein)",
+	"files is only supported in document and outline modes":                                                               "files wird nur in den Modi document und outline unterstützt",
+	"audio uploads are only supported in transcript and speaker_summary modes":                                            "Audio-Uploads werden nur in den Modi transcript und speaker_summary unterstützt",
+	"keep_sections is only supported in document mode":                                                                    "keep_sections wird nur im Modus document unterstützt",
+	"prune_references is only supported in document mode":                                                                 "prune_references wird nur im Modus document unterstützt",
+	"format is only supported in document mode":                                                                           "format wird nur im Modus document unterstützt",
+	"glossary is only supported in document mode":                                                                         "glossary wird nur im Modus document unterstützt",
+	"executive_summary is only supported in document mode":                                                                "executive_summary wird nur im Modus document unterstützt",
+	"skip_speaker_analysis is only supported in transcript and speaker_summary modes":                                     "skip_speaker_analysis wird nur in den Modi transcript und speaker_summary unterstützt",
+	"speaker_aliases is only supported in transcript mode":                                                                "speaker_aliases wird nur im Modus transcript unterstützt",
+	"keep_speaker_names is only supported in transcript mode":                                                             "keep_speaker_names wird nur im Modus transcript unterstützt",
+	"two_track is only supported in transcript mode":                                                                      "two_track wird nur im Modus transcript unterstützt",
+	"tag_tone is only supported in transcript mode without two_track":                                                     "tag_tone wird nur im Modus transcript ohne two_track unterstützt",
+	"two_track, tag_tone, executive_summary and flashcards are not supported for archive uploads":                         "two_track, tag_tone, executive_summary und flashcards werden für Archiv-Uploads nicht unterstützt",
+	"Output formats other than markdown are only supported in transcript mode":                                            "Andere output-Formate als markdown werden nur im Modus transcript unterstützt",
+	"output=%s cannot be combined with two_track, flashcards or archive uploads":                                          "output=%s kann nicht mit two_track, flashcards oder Archiven kombiniert werden",
+	"output=%s cannot be combined with tag_tone":                                                                          "output=%s kann nicht mit tag_tone kombiniert werden",
+	"revises is only supported in document mode":                                                                          "revises wird nur im Modus document unterstützt",
+	"revises cannot be combined with archive uploads":                                                                     "revises kann nicht mit Archiven kombiniert werden",
+	"Invalid %s value (must be '%s' or '%s')":                                                                             "Ungültiger Wert für %s (muss '%s' oder '%s' sein)",
+	"speaker_style, speaker_separator and turn_spacing are only supported in transcript mode":                             "speaker_style, speaker_separator und turn_spacing werden nur im Modus transcript unterstützt",
+	"speaker_style, speaker_separator and turn_spacing cannot be combined with tag_tone or an output other than markdown": "speaker_style, speaker_separator und turn_spacing können nicht mit tag_tone oder einem anderen output als markdown kombiniert werden",
+
+	// Processing
+	"Document":        "Dokument",
+	"Transcript":      "Transkript",
+	"Speaker summary": "Sprecherzusammenfassung",
+	"Outline":         "Gliederung",
+	"%s processing timed out or was cancelled": "%s: Die Verarbeitung hat das Zeitlimit überschritten oder wurde abgebrochen",
+	"%s processing failed":                     "%s: Die Verarbeitung ist fehlgeschlagen",
+	"Pre-processing hook failed":               "Der Vorverarbeitungs-Hook ist fehlgeschlagen",
+	"Input is too large to process: %s":        "Die Eingabe ist zu groß für die Verarbeitung: %s",
+	"Text chunking failed":                     "Die Aufteilung des Textes ist fehlgeschlagen",
+	"Speaker summary generation failed":        "Die Sprecherzusammenfassung konnte nicht erstellt werden",
+	"Executive summary generation failed":      "Die Kurzzusammenfassung konnte nicht erstellt werden",
+	"Flashcard generation failed":              "Die Lernkarten konnten nicht erstellt werden",
+}
@@ -0,0 +1,91 @@
+package i18n
+
+var spanish = map[string]string{
+	// Request format
+	"Invalid request format: Expected multipart/form-data": "Formato de solicitud no válido: se esperaba multipart/form-data",
+	"Invalid form data":                    "Datos de formulario no válidos",
+	"Request is too large (at most %d MB)": "La solicitud es demasiado grande (como máximo %d MB)",
+	"Text field is missing or empty":       "Falta el campo de texto o está vacío",
+	"Invalid text field: %v":               "Campo de texto no válido: %v",
+	"Text is too large (at most %d MB)":    "El texto es demasiado grande (como máximo %d MB)",
+
+	// Uploads
+	"file cannot be combined with text or document":                                "file no se puede combinar con text ni document",
+	"files cannot be combined with text, document or file":                         "files no se puede combinar con text, document ni file",
+	"Too many files to merge (at most %d)":                                         "Demasiados archivos para unir (como máximo %d)",
+	"Text file '%s' is too large":                                                  "El archivo de texto '%s' es demasiado grande",
+	"Failed to read text file '%s'":                                                "No se pudo leer el archivo de texto '%s'",
+	"Unsupported text file '%s': %v":                                               "Archivo de texto no compatible '%s': %v",
+	"Archive is too large":                                                         "El archivo comprimido es demasiado grande",
+	"Failed to read archive":                                                       "No se pudo leer el archivo comprimido",
+	"Unsupported audio format (expected %s)":                                       "Formato de audio no compatible (se esperaba %s)",
+	"Audio file is too large":                                                      "El archivo de audio es demasiado grande",
+	"Failed to read audio file":                                                    "No se pudo leer el archivo de audio",
+	"audio cannot be combined with text, document or archive":                      "audio no se puede combinar con text, document ni archive",
+	"upload cannot be combined with text, document, file, files, archive or audio": "upload no se puede combinar con text, document, file, files, archive ni audio",
+	"Resumable uploads are not enabled on this server":                             "Las subidas reanudables no están habilitadas en este servidor",
+	"Upload not found":                                                             "Subida no encontrada",
+	"Upload is incomplete (%d of %d bytes received)":                               "La subida está incompleta (%d de %d bytes recibidos)",
+	"Failed to read upload":                                                        "No se pudo leer la subida",
+	"Audio transcription is not enabled on this server":                            "La transcripción de audio no está habilitada en este servidor",
+	"Audio transcription failed":                                                   "La transcripción del audio falló",
+	"No speech found in the audio file":                                            "No se encontró voz en el archivo de audio",
+	"Document references are not enabled on this server":                           "Las referencias a documentos no están habilitadas en este servidor",
+	"Referenced document not found":                                                "No se encontró el documento referenciado",
+	"Document revisions are not enabled on this server":                            "Las revisiones de documentos no están habilitadas en este servidor",
+	"Revised document not found":                                                   "No se encontró el documento revisado",
+	"Email delivery is not enabled on this server":                                 "El envío por correo electrónico no está habilitado en este servidor",
+	"Webhook delivery is not enabled on this server":                               "El envío por webhook no está habilitado en este servidor",
+	"Invalid email_to address":                                                     "Dirección email_to no válida",
+	"Invalid webhook_url (must be an http or https URL)":                           "webhook_url no válida (debe ser una URL http o https)",
+	"Invalid webhook_url (must be a public address)":                               "webhook_url no válida (debe ser una dirección pública)",
+	"Invalid seed value (must be an integer)":                                      "Valor de seed no válido (debe ser un número entero)",
+	"Invalid priority value: %v":                                                   "Valor de priority no válido: %v",
+	"Unknown profile '%s'":                                                         "Perfil desconocido '%s'",
+	"Invalid ratio value (must be > 0 and <= 1)":                                   "Valor de ratio no válido (debe ser > 0 y <= 1)",
+	"Invalid keep_sections value: %v":                                              "Valor de keep_sections no válido: %v",
+	"Invalid speaker_aliases value: %v":                                            "Valor de speaker_aliases no válido: %v",
+	"Invalid format value (must be 'prose' or 'bullets')":                          "Valor de format no válido (debe ser 'prose' o 'bullets')",
+	"Invalid flashcards value (must be 'csv', 'tsv' or 'json')":                    "Valor de flashcards no válido (debe ser 'csv', 'tsv' o 'json')",
+	"flashcards is not supported in outline mode":                                  "flashcards no es compatible con el modo outline",
+	"flashcards cannot be combined with two_track, tag_tone or executive_summary":  "flashcards no se puede combinar con two_track, tag_tone ni executive_summary",
+	"Invalid output value (must be 'markdown', 'json', 'srt', 'vtt', 'podlove_chapters' or 'id3_chapters')": "Valor de output no válido (debe ser 'markdown', 'json', 'srt', 'vtt', 'podlove_chapters' o 'id3_chapters')",
+
+	// Modes
+	"Invalid mode value (must be 'document', 'transcript', 'speaker_summary' or 'outline')":                               "Valor de mode no válido (debe ser 'document', 'transcript', 'speaker_summary' u 'outline')",
+	"files is only supported in document and outline modes":                                                               "files solo es compatible con los modos document y outline",
+	"audio uploads are only supported in transcript and speaker_summary modes":                                            "La subida de audio solo es compatible con los modos transcript y speaker_summary",
+	"keep_sections is only supported in document mode":                                                                    "keep_sections solo es compatible con el modo document",
+	"prune_references is only supported in document mode":                                                                 "prune_references solo es compatible con el modo document",
+	"format is only supported in document mode":                                                                           "format solo es compatible con el modo document",
+	"glossary is only supported in document mode":                                                                         "glossary solo es compatible con el modo document",
+	"executive_summary is only supported in document mode":                                                                "executive_summary solo es compatible con el modo document",
+	"skip_speaker_analysis is only supported in transcript and speaker_summary modes":                                     "skip_speaker_analysis solo es compatible con los modos transcript y speaker_summary",
+	"speaker_aliases is only supported in transcript mode":                                                                "speaker_aliases solo es compatible con el modo transcript",
+	"keep_speaker_names is only supported in transcript mode":                                                             "keep_speaker_names solo es compatible con el modo transcript",
+	"two_track is only supported in transcript mode":                                                                      "two_track solo es compatible con el modo transcript",
+	"tag_tone is only supported in transcript mode without two_track":                                                     "tag_tone solo es compatible con el modo transcript sin two_track",
+	"two_track, tag_tone, executive_summary and flashcards are not supported for archive uploads":                         "two_track, tag_tone, executive_summary y flashcards no son compatibles con la subida de archivos comprimidos",
+	"Output formats other than markdown are only supported in transcript mode":                                            "Los formatos de output distintos de markdown solo son compatibles con el modo transcript",
+	"output=%s cannot be combined with two_track, flashcards or archive uploads":                                          "output=%s no se puede combinar con two_track, flashcards ni archivos comprimidos",
+	"output=%s cannot be combined with tag_tone":                                                                          "output=%s no se puede combinar con tag_tone",
+	"revises is only supported in document mode":                                                                          "revises solo se admite en el modo document",
+	"revises cannot be combined with archive uploads":                                                                     "revises no se puede combinar con archivos comprimidos",
+	"Invalid %s value (must be '%s' or '%s')":                                                                             "Valor de %s no válido (debe ser '%s' o '%s')",
+	"speaker_style, speaker_separator and turn_spacing are only supported in transcript mode":                             "speaker_style, speaker_separator y turn_spacing solo se admiten en el modo transcript",
+	"speaker_style, speaker_separator and turn_spacing cannot be combined with tag_tone or an output other than markdown": "speaker_style, speaker_separator y turn_spacing no se pueden combinar con tag_tone ni con un output distinto de markdown",
+
+	// Processing
+	"Document":        "Documento",
+	"Transcript":      "Transcripción",
+	"Speaker summary": "Resumen por participante",
+	"Outline":         "Esquema",
+	"%s processing timed out or was cancelled": "%s: el procesamiento superó el tiempo límite o fue cancelado",
+	"%s processing failed":                     "%s: el procesamiento falló",
+	"Pre-processing hook failed":               "Falló el hook de preprocesamiento",
+	"Input is too large to process: %s":        "La entrada es demasiado grande para procesarla: %s",
+	"Text chunking failed":                     "Falló la división del texto",
+	"Speaker summary generation failed":        "No se pudo generar el resumen por participante",
+	"Executive summary generation failed":      "No se pudo generar el resumen ejecutivo",
+	"Flashcard generation failed":              "No se pudieron generar las tarjetas de estudio",
+}
@@ -0,0 +1,91 @@
+package i18n
+
+var french = map[string]string{
+	// Request format
+	"Invalid request format: Expected multipart/form-data": "Format de requête invalide : multipart/form-data attendu",
+	"Invalid form data":                    "Données de formulaire invalides",
+	"Request is too large (at most %d MB)": "La requête est trop volumineuse (%d Mo au maximum)",
+	"Text field is missing or empty":       "Le champ texte est manquant ou vide",
+	"Invalid text field: %v":               "Champ texte invalide : %v",
+	"Text is too large (at most %d MB)":    "Le texte est trop volumineux (%d Mo au maximum)",
+
+	// Uploads
+	"file cannot be combined with text or document":                                "file ne peut pas être combiné avec text ou document",
+	"files cannot be combined with text, document or file":                         "files ne peut pas être combiné avec text, document ou file",
+	"Too many files to merge (at most %d)":                                         "Trop de fichiers à fusionner (%d au maximum)",
+	"Text file '%s' is too large":                                                  "Le fichier texte '%s' est trop volumineux",
+	"Failed to read text file '%s'":                                                "Impossible de lire le fichier texte '%s'",
+	"Unsupported text file '%s': %v":                                               "Fichier texte non pris en charge '%s' : %v",
+	"Archive is too large":                                                         "L'archive est trop volumineuse",
+	"Failed to read archive":                                                       "Impossible de lire l'archive",
+	"Unsupported audio format (expected %s)":                                       "Format audio non pris en charge (attendu : %s)",
+	"Audio file is too large":                                                      "Le fichier audio est trop volumineux",
+	"Failed to read audio file":                                                    "Impossible de lire le fichier audio",
+	"audio cannot be combined with text, document or archive":                      "audio ne peut pas être combiné avec text, document ou archive",
+	"upload cannot be combined with text, document, file, files, archive or audio": "upload ne peut pas être combiné avec text, document, file, files, archive ou audio",
+	"Resumable uploads are not enabled on this server":                             "Les envois reprenables ne sont pas activés sur ce serveur",
+	"Upload not found":                                                             "Envoi introuvable",
+	"Upload is incomplete (%d of %d bytes received)":                               "L'envoi est incomplet (%d octets reçus sur %d)",
+	"Failed to read upload":                                                        "Impossible de lire l'envoi",
+	"Audio transcription is not enabled on this server":                            "La transcription audio n'est pas activée sur ce serveur",
+	"Audio transcription failed":                                                   "La transcription audio a échoué",
+	"No speech found in the audio file":                                            "Aucune parole trouvée dans le fichier audio",
+	"Document references are not enabled on this server":                           "Les références de documents ne sont pas activées sur ce serveur",
+	"Referenced document not found":                                                "Document référencé introuvable",
+	"Document revisions are not enabled on this server":                            "Les révisions de documents ne sont pas activées sur ce serveur",
+	"Revised document not found":                                                   "Document révisé introuvable",
+	"Email delivery is not enabled on this server":                                 "L'envoi par e-mail n'est pas activé sur ce serveur",
+	"Webhook delivery is not enabled on this server":                               "L'envoi par webhook n'est pas activé sur ce serveur",
+	"Invalid email_to address":                                                     "Adresse email_to invalide",
+	"Invalid webhook_url (must be an http or https URL)":                           "webhook_url invalide (doit être une URL http ou https)",
+	"Invalid webhook_url (must be a public address)":                               "webhook_url invalide (doit être une adresse publique)",
+	"Invalid seed value (must be an integer)":                                      "Valeur de seed invalide (doit être un entier)",
+	"Invalid priority value: %v":                                                   "Valeur de priority invalide : %v",
+	"Unknown profile '%s'":                                                         "Profil inconnu '%s'",
+	"Invalid ratio value (must be > 0 and <= 1)":                                   "Valeur de ratio invalide (doit être > 0 et <= 1)",
+	"Invalid keep_sections value: %v":                                              "Valeur de keep_sections invalide : %v",
+	"Invalid speaker_aliases value: %v":                                            "Valeur de speaker_aliases invalide : %v",
+	"Invalid format value (must be 'prose' or 'bullets')":                          "Valeur de format invalide (doit être 'prose' ou 'bullets')",
+	"Invalid flashcards value (must be 'csv', 'tsv' or 'json')":                    "Valeur de flashcards invalide (doit être 'csv', 'tsv' ou 'json')",
+	"flashcards is not supported in outline mode":                                  "flashcards n'est pas pris en charge en mode outline",
+	"flashcards cannot be combined with two_track, tag_tone or executive_summary":  "flashcards ne peut pas être combiné avec two_track, tag_tone ou executive_summary",
+	"Invalid output value (must be 'markdown', 'json', 'srt', 'vtt', 'podlove_chapters' or 'id3_chapters')": "Valeur de output invalide (doit être 'markdown', 'json', 'srt', 'vtt', 'podlove_chapters' ou 'id3_chapters')",
+
+	// Modes
+	"Invalid mode value (must be 'document', 'transcript', 'speaker_summary' or 'outline')":                               "Valeur de mode invalide (doit être 'document', 'transcript', 'speaker_summary' ou 'outline')",
+	"files is only supported in document and outline modes":                                                               "files n'est pris en charge qu'en modes document et outline",
+	"audio uploads are only supported in transcript and speaker_summary modes":                                            "L'envoi de fichiers audio n'est pris en charge qu'en modes transcript et speaker_summary",
+	"keep_sections is only supported in document mode":                                                                    "keep_sections n'est pris en charge qu'en mode document",
+	"prune_references is only supported in document mode":                                                                 "prune_references n'est pris en charge qu'en mode document",
+	"format is only supported in document mode":                                                                           "format n'est pris en charge qu'en mode document",
+	"glossary is only supported in document mode":                                                                         "glossary n'est pris en charge qu'en mode document",
+	"executive_summary is only supported in document mode":                                                                "executive_summary n'est pris en charge qu'en mode document",
+	"skip_speaker_analysis is only supported in transcript and speaker_summary modes":                                     "skip_speaker_analysis n'est pris en charge qu'en modes transcript et speaker_summary",
+	"speaker_aliases is only supported in transcript mode":                                                                "speaker_aliases n'est pris en charge qu'en mode transcript",
+	"keep_speaker_names is only supported in transcript mode":                                                             "keep_speaker_names n'est pris en charge qu'en mode transcript",
+	"two_track is only supported in transcript mode":                                                                      "two_track n'est pris en charge qu'en mode transcript",
+	"tag_tone is only supported in transcript mode without two_track":                                                     "tag_tone n'est pris en charge qu'en mode transcript sans two_track",
+	"two_track, tag_tone, executive_summary and flashcards are not supported for archive uploads":                         "two_track, tag_tone, executive_summary et flashcards ne sont pas pris en charge pour les archives",
+	"Output formats other than markdown are only supported in transcript mode":                                            "Les formats de output autres que markdown ne sont pris en charge qu'en mode transcript",
+	"output=%s cannot be combined with two_track, flashcards or archive uploads":                                          "output=%s ne peut pas être combiné avec two_track, flashcards ou des archives",
+	"output=%s cannot be combined with tag_tone":                                                                          "output=%s ne peut pas être combiné avec tag_tone",
+	"revises is only supported in document mode":                                                                          "revises n'est pris en charge qu'en mode document",
+	"revises cannot be combined with archive uploads":                                                                     "revises ne peut pas être combiné avec des archives",
+	"Invalid %s value (must be '%s' or '%s')":                                                                             "Valeur de %s invalide (doit être '%s' ou '%s')",
+	"speaker_style, speaker_separator and turn_spacing are only supported in transcript mode":                             "speaker_style, speaker_separator et turn_spacing ne sont pris en charge qu'en mode transcript",
+	"speaker_style, speaker_separator and turn_spacing cannot be combined with tag_tone or an output other than markdown": "speaker_style, speaker_separator et turn_spacing ne peuvent pas être combinés avec tag_tone ou un output autre que markdown",
+
+	// Processing
+	"Document":        "Document",
+	"Transcript":      "Transcription",
+	"Speaker summary": "Résumé par intervenant",
+	"Outline":         "Plan",
+	"%s processing timed out or was cancelled": "%s : le traitement a expiré ou a été annulé",
+	"%s processing failed":                     "%s : le traitement a échoué",
+	"Pre-processing hook failed":               "Le hook de prétraitement a échoué",
+	"Input is too large to process: %s":        "L'entrée est trop volumineuse pour être traitée : %s",
+	"Text chunking failed":                     "Le découpage du texte a échoué",
+	"Speaker summary generation failed":        "La génération du résumé par intervenant a échoué",
+	"Executive summary generation failed":      "La génération de la synthèse a échoué",
+	"Flashcard generation failed":              "La génération des fiches a échoué",
+}
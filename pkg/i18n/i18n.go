@@ -0,0 +1,71 @@
+// Package i18n translates the error messages sent to end users. Messages are looked up by their
+// English format string, so a message without a translation is sent in English unchanged.
+package i18n
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// English is the language messages are written in and the fallback of Negotiate
+const English = "en"
+
+// catalogs maps a language to translations of English format strings. A translation must keep
+// the verbs of its original, in the same order.
+var catalogs = map[string]map[string]string{
+	"de": german,
+	"es": spanish,
+	"fr": french,
+}
+
+// Negotiate returns the supported language the client prefers most by an Accept-Language header
+// value, or English. Regional variants match their base language, so "pt-BR" would be served by
+// "pt".
+func Negotiate(acceptLanguage string) string {
+	type preference struct {
+		lang string
+		q    float64
+	}
+	var preferences []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if base != "" && q > 0 {
+			preferences = append(preferences, preference{base, q})
+		}
+	}
+	slices.SortStableFunc(preferences, func(a, b preference) int { return cmp.Compare(b.q, a.q) })
+	for _, p := range preferences {
+		if p.lang == English {
+			return English
+		}
+		if _, ok := catalogs[p.lang]; ok {
+			return p.lang
+		}
+	}
+	return English
+}
+
+// Sprintf formats the translation of format in lang, or format itself when it has none
+func Sprintf(lang, format string, args ...any) string {
+	return fmt.Sprintf(Text(lang, format), args...)
+}
+
+// Text returns the translation of a message in lang, or the message itself when it has none
+func Text(lang, message string) string {
+	if translated, ok := catalogs[lang][message]; ok {
+		return translated
+	}
+	return message
+}
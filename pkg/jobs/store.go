@@ -0,0 +1,197 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+)
+
+// Settings are the processing parameters of a job. Together with the source text and
+// seed they are everything needed to run the job again.
+type Settings struct {
+	Mode        string  `json:"mode"`
+	Ratio       float64 `json:"ratio"`
+	TwoTrack    bool    `json:"two_track,omitempty"`
+	TagTone     bool    `json:"tag_tone,omitempty"`
+	TranslateTo string  `json:"translate_to,omitempty"`
+	Style       string  `json:"style,omitempty"`
+	Model       string  `json:"model,omitempty"`
+	Format      string  `json:"format,omitempty"`
+	Seed        int64   `json:"seed"`
+
+	// KeepSections are heading patterns of sections passed through verbatim
+	KeepSections []string `json:"keep_sections,omitempty"`
+
+	// PruneReferences drops reference list entries the condensed document no longer cites
+	PruneReferences bool `json:"prune_references,omitempty"`
+
+	// ExecutiveSummary returns a one-paragraph executive summary together with the condensed document
+	ExecutiveSummary bool `json:"executive_summary,omitempty"`
+
+	// Glossary appends a glossary of key terms to the condensed document
+	Glossary bool `json:"glossary,omitempty"`
+
+	// Flashcards is the export format (csv, tsv or json) of study flashcards made from the
+	// output, which are then the job's result
+	Flashcards string `json:"flashcards,omitempty"`
+
+	// SkipSpeakerAnalysis processes a transcript without the speaker analysis call
+	SkipSpeakerAnalysis bool `json:"skip_speaker_analysis,omitempty"`
+
+	// SpeakerAliases are "Name=alias, alias" entries unifying the forms of a speaker's name
+	SpeakerAliases []string `json:"speaker_aliases,omitempty"`
+
+	// KeepSpeakerNames turns off the automatic unification of speaker names
+	KeepSpeakerNames bool `json:"keep_speaker_names,omitempty"`
+
+	// Output is "json" for transcript turns returned as JSON instead of markdown, "srt" or "vtt"
+	// for the turns re-flowed across the subtitle timings of the input, or "podlove_chapters" or
+	// "id3_chapters" for the chapters of a timed transcript
+	Output string `json:"output,omitempty"`
+
+	// SpeakerStyle, SpeakerSeparator and TurnSpacing lay out a formatted transcript; empty
+	// values keep the default "**Name**: speech" turns separated by blank lines
+	SpeakerStyle     string `json:"speaker_style,omitempty"`
+	SpeakerSeparator string `json:"speaker_separator,omitempty"`
+	TurnSpacing      string `json:"turn_spacing,omitempty"`
+}
+
+// Job is the record kept for each processed request
+type Job struct {
+	ID            string        `json:"id"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Duration      time.Duration `json:"duration_ns"`
+	Settings      Settings      `json:"settings"`
+	ModelVersions []string      `json:"model_versions"`
+	PromptHashes  []string      `json:"prompt_hashes"`
+	ReprocessOf   string        `json:"reprocess_of,omitempty"`
+	DocumentHash  string        `json:"document_hash,omitempty"`
+
+	// Stats are the job's worker pool chunk latencies and token counts
+	Stats *metrics.PoolSummary `json:"stats,omitempty"`
+
+	// RefinedFrom is the job whose output this job condensed further
+	RefinedFrom string `json:"refined_from,omitempty"`
+
+	// Revises is the hash of the stored previous version of the document, whose unchanged
+	// chunks kept their output
+	Revises string `json:"revises,omitempty"`
+
+	// Cancelled is set when an operator cancelled the job while it ran
+	Cancelled bool `json:"cancelled,omitempty"`
+
+	// Owner identifies the API key and tenant that ran the job; only they find it by search
+	Owner string `json:"-"`
+
+	// Source is the input text, kept so the job can be reprocessed
+	Source string `json:"-"`
+	// Output is the plain-text result, kept so the job can be refined. It is empty for JSON
+	// and streamed results.
+	Output string `json:"-"`
+}
+
+// Store keeps the most recent jobs in memory, evicting the oldest past max
+type Store struct {
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	order []string
+	max   int
+
+	// OnEvict, when set, is called with the ID of each job dropped by eviction or Expire. It
+	// runs with the store locked and must not call back into it.
+	OnEvict func(id string)
+}
+
+// NewStore returns a store holding at most max jobs
+func NewStore(max int) *Store {
+	return &Store{jobs: make(map[string]*Job), max: max}
+}
+
+// Put saves a job, evicting the oldest job when the store is full
+func (s *Store) Put(job *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[job.ID]; !exists {
+		s.order = append(s.order, job.ID)
+	}
+	s.jobs[job.ID] = job
+
+	for len(s.order) > s.max && s.max > 0 {
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		delete(s.jobs, oldest)
+		s.evicted(oldest)
+		log.Printf("Job store full, evicted job %s", oldest)
+	}
+}
+
+// Expire drops the jobs created before cutoff and returns how many were dropped
+func (s *Store) Expire(cutoff time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.order[:0]
+	for _, id := range s.order {
+		if s.jobs[id].CreatedAt.Before(cutoff) {
+			delete(s.jobs, id)
+			s.evicted(id)
+			continue
+		}
+		kept = append(kept, id)
+	}
+	expired := len(s.order) - len(kept)
+	s.order = kept
+	return expired
+}
+
+func (s *Store) evicted(id string) {
+	if s.OnEvict != nil {
+		s.OnEvict(id)
+	}
+}
+
+// Get returns a job by ID
+func (s *Store) Get(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+// WithJob calls fn with a stored job while holding the store's lock, so the job can't be evicted
+// until fn returns, and reports whether the job was found. Like OnEvict, fn must not call back
+// into the store.
+func (s *Store) WithJob(id string, fn func(job *Job)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if ok {
+		fn(job)
+	}
+	return ok
+}
+
+// List returns the stored jobs, newest first
+func (s *Store) List() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*Job, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		list = append(list, s.jobs[s.order[i]])
+	}
+	return list
+}
+
+// NewID returns a random job ID
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format("150405.000000")))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,216 @@
+// Package logging configures where and how the standard logger writes: a minimum level, plain
+// text or JSON lines, and stderr, stdout, a rotated file or syslog. The code base keeps logging
+// through log.Printf and reqctx loggers; verbose lines go through Debug, warnings and errors
+// through Warn and Error, and everything else is info.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log line
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{LevelDebug: "debug", LevelInfo: "info", LevelWarn: "warn", LevelError: "error"}
+
+func (l Level) String() string { return levelNames[l] }
+
+// ParseLevel parses "debug", "info", "warn" or "error", in any case
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) || (level == LevelWarn && strings.EqualFold(name, "warning")) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", name)
+}
+
+var minLevel atomic.Int32
+
+func init() { minLevel.Store(int32(LevelInfo)) }
+
+// Enabled reports whether lines of a level are written
+func Enabled(level Level) bool { return level >= Level(minLevel.Load()) }
+
+// levelMarkers start the message of every line written through Debug, Warn and Error; lines
+// without one are info
+var levelMarkers = []struct {
+	level  Level
+	marker string
+}{{LevelDebug, "DEBUG: "}, {LevelWarn, "WARNING: "}, {LevelError, "ERROR: "}}
+
+var discard = log.New(io.Discard, "", 0)
+
+// leveled returns a logger that writes like logger with the marker of level, or discards
+// everything when level is below the configured one
+func leveled(logger *log.Logger, level Level) *log.Logger {
+	if !Enabled(level) {
+		return discard
+	}
+	for _, m := range levelMarkers {
+		if m.level == level {
+			return log.New(logger.Writer(), logger.Prefix()+m.marker, logger.Flags()|log.Lmsgprefix)
+		}
+	}
+	return logger
+}
+
+// Debug returns a logger for verbose lines (per-chunk progress and the like) that writes like
+// logger with a "DEBUG: " marker, or discards everything when the level is above debug
+func Debug(logger *log.Logger) *log.Logger { return leveled(logger, LevelDebug) }
+
+// Warn returns a logger for lines about something that went wrong without failing the request
+// (a fallback was taken, an optional step was skipped), marked "WARNING: "
+func Warn(logger *log.Logger) *log.Logger { return leveled(logger, LevelWarn) }
+
+// Error returns a logger for failed requests, deliveries and panics, marked "ERROR: "
+func Error(logger *log.Logger) *log.Logger { return leveled(logger, LevelError) }
+
+// Warnf writes a warning through the standard logger
+func Warnf(format string, v ...any) { Warn(log.Default()).Printf(format, v...) }
+
+// Errorf writes an error through the standard logger
+func Errorf(format string, v ...any) { Error(log.Default()).Printf(format, v...) }
+
+// Options configure the standard logger
+type Options struct {
+	Level Level
+	// Format is "text" (the standard log format) or "json" (one object per line)
+	Format string
+	// Output is "stderr", "stdout", "syslog" or the path of a log file
+	Output string
+	// MaxSizeMB and MaxBackups rotate a log file: past MaxSizeMB it is renamed to path.1 and
+	// at most MaxBackups old files are kept
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+// Setup points the standard logger at the configured sink. Loggers created earlier (e.g. by
+// reqctx) keep their old writer, so call it before serving requests.
+func Setup(opts Options) error {
+	if opts.Format != "text" && opts.Format != "json" {
+		return fmt.Errorf("unknown log format %q (expected text or json)", opts.Format)
+	}
+
+	var out sink
+	switch opts.Output {
+	case "", "stderr":
+		out = writerSink{os.Stderr}
+	case "stdout":
+		out = writerSink{os.Stdout}
+	case "syslog":
+		var err error
+		if out, err = newSyslogSink(); err != nil {
+			return err
+		}
+	default:
+		file, err := newRotatingFile(opts.Output, int64(opts.MaxSizeMB)<<20, opts.MaxBackups)
+		if err != nil {
+			return err
+		}
+		out = writerSink{file}
+	}
+
+	minLevel.Store(int32(opts.Level))
+	w := &levelWriter{out: out, json: opts.Format == "json"}
+	if w.json || opts.Output == "syslog" {
+		// The sink stamps the time itself
+		log.SetFlags(0)
+	}
+	log.SetOutput(w)
+	return nil
+}
+
+// sink receives complete log lines together with their level
+type sink interface {
+	write(level Level, line []byte) error
+}
+
+type writerSink struct{ io.Writer }
+
+func (s writerSink) write(_ Level, line []byte) error {
+	_, err := s.Write(line)
+	return err
+}
+
+// levelWriter filters lines by level and renders them as text or JSON
+type levelWriter struct {
+	mu   sync.Mutex
+	out  sink
+	json bool
+}
+
+var metadataRegex = regexp.MustCompile(`^\[((?:job|tenant)=[^\]]*)\] `)
+
+// lineLevel returns the level of a message by the marker Debug, Warn or Error put in front of
+// it, and the message without the marker
+func lineLevel(message string) (Level, string) {
+	for _, m := range levelMarkers {
+		if rest, ok := strings.CutPrefix(message, m.marker); ok {
+			return m.level, rest
+		}
+	}
+	return LevelInfo, message
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	line := Scrub(string(bytes.TrimRight(p, "\n")))
+	// Text lines start with the date and time of the standard flags
+	message := line
+	if !w.json {
+		if fields := strings.SplitN(line, " ", 3); len(fields) == 3 && strings.Count(fields[0], "/") == 2 {
+			message = fields[2]
+		}
+	}
+	metadata := metadataRegex.FindStringSubmatch(message)
+	if metadata != nil {
+		message = message[len(metadata[0]):]
+	}
+	level, message := lineLevel(message)
+	if !Enabled(level) {
+		return len(p), nil
+	}
+
+	out := []byte(line + "\n")
+	if w.json {
+		entry := map[string]string{"time": time.Now().Format(time.RFC3339Nano), "level": level.String(), "msg": message}
+		if metadata != nil {
+			for _, field := range strings.Fields(metadata[1]) {
+				if key, value, ok := strings.Cut(field, "="); ok {
+					entry[key] = value
+				}
+			}
+		}
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(entry); err != nil {
+			return 0, err
+		}
+		out = buf.Bytes()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.out.write(level, out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
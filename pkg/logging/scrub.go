@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// secretPatterns match credentials that end up in URLs, headers and provider error bodies
+var secretPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`([?&](?:key|api_key|apikey|access_token|token)=)[^&\s"'<>]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)((?:authorization|x-goog-api-key)["']?\s*[:=]\s*["']?(?:bearer\s+)?)[^\s"',}]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`/bot\d+:[\w-]+`), "/bot[REDACTED]"},
+	{regexp.MustCompile(`\bAIza[\w-]{35}\b|\bsk-[\w-]{16,}|\bxox[abpr]-[\w-]+`), "[REDACTED]"},
+}
+
+// Scrub masks API keys and tokens in s. Every line written through Setup's sink is scrubbed;
+// call it directly for text that leaves the process another way (e.g. error responses).
+func Scrub(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// maxExcerpt is how much of a payload or document text is logged outside of debug level
+const maxExcerpt = 200
+
+// Excerpt prepares document text or a provider payload for a log line: scrubbed, and cut to
+// its first 200 bytes unless the level is debug, so documents and prompts echoed in error
+// bodies don't land in production logs
+func Excerpt(s string) string {
+	s = Scrub(s)
+	if Enabled(LevelDebug) || len(s) <= maxExcerpt {
+		return s
+	}
+	cut := maxExcerpt
+	for cut > 0 && s[cut]&0xC0 == 0x80 { // don't split a UTF-8 sequence
+		cut--
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", s[:cut], len(s)-cut)
+}
@@ -0,0 +1,32 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// syslogSink sends each line to the local syslog daemon with the priority of its level
+type syslogSink struct{ w *syslog.Writer }
+
+func newSyslogSink() (sink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "cutcrap")
+	if err != nil {
+		return nil, fmt.Errorf("failed connect to syslog: %w", err)
+	}
+	return syslogSink{w}, nil
+}
+
+func (s syslogSink) write(level Level, line []byte) error {
+	message := string(line)
+	switch level {
+	case LevelDebug:
+		return s.w.Debug(message)
+	case LevelWarn:
+		return s.w.Warning(message)
+	case LevelError:
+		return s.w.Err(message)
+	}
+	return s.w.Info(message)
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// routeLatencyWindow is how many recent request latencies are kept per route
+const routeLatencyWindow = 1000
+
+// HTTPStats counts API requests by route pattern since startup
+type HTTPStats struct {
+	mu     sync.Mutex
+	routes map[string]*routeStats
+	panics int
+}
+
+type routeStats struct {
+	requests     int
+	clientErrors int
+	serverErrors int
+	latencies    []time.Duration
+	next         int
+}
+
+// HTTP is the process-wide request stats
+var HTTP = &HTTPStats{routes: make(map[string]*routeStats)}
+
+// HTTPSummary is a snapshot of HTTPStats
+type HTTPSummary struct {
+	Routes map[string]RouteSummary `json:"routes"`
+	// Panics is the number of requests whose handler panicked
+	Panics int `json:"panics"`
+}
+
+// RouteSummary is the requests served by one route pattern
+type RouteSummary struct {
+	Requests     int   `json:"requests"`
+	ClientErrors int   `json:"client_errors"`
+	ServerErrors int   `json:"server_errors"`
+	LatencyP50Ms int64 `json:"latency_p50_ms"`
+	LatencyP95Ms int64 `json:"latency_p95_ms"`
+}
+
+// RecordRequest records a response with status to a request matched by route
+func (s *HTTPStats) RecordRequest(route string, status int, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats, ok := s.routes[route]
+	if !ok {
+		stats = &routeStats{}
+		s.routes[route] = stats
+	}
+	stats.requests++
+	switch {
+	case status >= 500:
+		stats.serverErrors++
+	case status >= 400:
+		stats.clientErrors++
+	}
+	if len(stats.latencies) == routeLatencyWindow {
+		stats.latencies[stats.next] = latency
+		stats.next = (stats.next + 1) % routeLatencyWindow
+		return
+	}
+	stats.latencies = append(stats.latencies, latency)
+}
+
+// RecordPanic counts a request whose handler panicked
+func (s *HTTPStats) RecordPanic() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.panics++
+}
+
+// Summary returns the counts so far and the latency percentiles of each route
+func (s *HTTPStats) Summary() HTTPSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := HTTPSummary{Routes: make(map[string]RouteSummary, len(s.routes)), Panics: s.panics}
+	for route, stats := range s.routes {
+		sorted := slices.Clone(stats.latencies)
+		slices.Sort(sorted)
+		summary.Routes[route] = RouteSummary{
+			Requests:     stats.requests,
+			ClientErrors: stats.clientErrors,
+			ServerErrors: stats.serverErrors,
+			LatencyP50Ms: percentile(sorted, 50).Milliseconds(),
+			LatencyP95Ms: percentile(sorted, 95).Milliseconds(),
+		}
+	}
+	return summary
+}
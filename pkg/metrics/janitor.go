@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// JanitorStats counts what the retention janitor has deleted since startup
+type JanitorStats struct {
+	mu      sync.Mutex
+	summary JanitorSummary
+}
+
+// Janitor is the process-wide janitor stats
+var Janitor = &JanitorStats{}
+
+// JanitorSummary is a snapshot of JanitorStats
+type JanitorSummary struct {
+	Runs           int       `json:"runs"`
+	JobsExpired    int       `json:"jobs_expired"`
+	FilesDeleted   int       `json:"files_deleted"`
+	BytesReclaimed int64     `json:"bytes_reclaimed"`
+	LastRun        time.Time `json:"last_run,omitzero"`
+}
+
+// RecordRun adds one janitor pass
+func (s *JanitorStats) RecordRun(jobsExpired, filesDeleted int, bytesReclaimed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary.Runs++
+	s.summary.JobsExpired += jobsExpired
+	s.summary.FilesDeleted += filesDeleted
+	s.summary.BytesReclaimed += bytesReclaimed
+	s.summary.LastRun = time.Now()
+}
+
+// Summary returns the totals so far
+func (s *JanitorStats) Summary() JanitorSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.summary
+}
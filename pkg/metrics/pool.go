@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// poolLatencyWindow is how many recent chunk latencies the process-wide stats keep
+const poolLatencyWindow = 10000
+
+// PoolStats collects worker pool chunk latencies, model token counts and failed chunks.
+// A PoolStats attached to a context records the chunks of that job; Pool records every job.
+type PoolStats struct {
+	mu        sync.Mutex
+	window    int // latencies kept, 0 for all
+	latencies []time.Duration
+	next      int
+	chunks    int
+	failed    int
+	oversize  int
+
+	promptTokens int
+	outputTokens int
+	callTime     time.Duration
+
+	// usage is the tokens of each chunk, kept for job stats only
+	usage []ChunkUsage
+}
+
+// Pool is the process-wide stats over all jobs, with percentiles over the most recent chunks
+var Pool = &PoolStats{window: poolLatencyWindow}
+
+// PoolSummary is a snapshot of PoolStats. TokensPerSecond is output tokens per second of
+// model call time, so it measures generation speed independently of concurrency.
+type PoolSummary struct {
+	Chunks          int     `json:"chunks"`
+	Failed          int     `json:"failed"`
+	Oversize        int     `json:"oversize"`
+	LatencyP50Ms    int64   `json:"latency_p50_ms"`
+	LatencyP95Ms    int64   `json:"latency_p95_ms"`
+	LatencyP99Ms    int64   `json:"latency_p99_ms"`
+	PromptTokens    int     `json:"prompt_tokens"`
+	OutputTokens    int     `json:"output_tokens"`
+	TokensPerSecond float64 `json:"tokens_per_second"`
+
+	// ChunkUsage is the tokens spent on each chunk, by stage and chunk index
+	ChunkUsage []ChunkUsage `json:"chunk_usage,omitempty"`
+}
+
+// ChunkUsage is the model tokens spent on one worker pool chunk, over all of its calls
+type ChunkUsage struct {
+	// Stage is the pass the chunk belongs to, e.g. "document", "transcript_condensed" or "translate"
+	Stage        string `json:"stage"`
+	Chunk        int    `json:"chunk"`
+	Calls        int    `json:"calls"`
+	PromptTokens int    `json:"prompt_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	TotalTokens  int    `json:"total_tokens"`
+	Failed       bool   `json:"failed,omitempty"`
+}
+
+type chunkUsageKey struct{}
+
+// WithChunkUsage attaches usage to ctx so the model calls made with it add their tokens to it
+func WithChunkUsage(ctx context.Context, usage *ChunkUsage) context.Context {
+	return context.WithValue(ctx, chunkUsageKey{}, usage)
+}
+
+// chunkUsageFrom returns the ChunkUsage attached to ctx, or nil
+func chunkUsageFrom(ctx context.Context) *ChunkUsage {
+	usage, _ := ctx.Value(chunkUsageKey{}).(*ChunkUsage)
+	return usage
+}
+
+type poolStatsKey struct{}
+
+// WithPoolStats attaches stats to ctx so the chunks and model calls made with it are recorded
+func WithPoolStats(ctx context.Context, stats *PoolStats) context.Context {
+	return context.WithValue(ctx, poolStatsKey{}, stats)
+}
+
+// PoolStatsFrom returns the PoolStats attached to ctx, or nil
+func PoolStatsFrom(ctx context.Context) *PoolStats {
+	stats, _ := ctx.Value(poolStatsKey{}).(*PoolStats)
+	return stats
+}
+
+// RecordChunk records one worker pool chunk in Pool and in ctx's stats, together with the
+// ChunkUsage attached to ctx
+func RecordChunk(ctx context.Context, latency time.Duration, failed bool) {
+	Pool.recordChunk(latency, failed)
+	if stats := PoolStatsFrom(ctx); stats != nil {
+		stats.recordChunk(latency, failed)
+		if usage := chunkUsageFrom(ctx); usage != nil {
+			stats.recordChunkUsage(*usage, failed)
+		}
+	}
+}
+
+// RecordCall records the token counts and duration of one successful model call in Pool, in
+// ctx's stats and in ctx's ChunkUsage
+func RecordCall(ctx context.Context, promptTokens, outputTokens, totalTokens int, duration time.Duration) {
+	Pool.recordCall(promptTokens, outputTokens, duration)
+	if stats := PoolStatsFrom(ctx); stats != nil {
+		stats.recordCall(promptTokens, outputTokens, duration)
+	}
+	if usage := chunkUsageFrom(ctx); usage != nil {
+		// Calls of one chunk are sequential, so the chunk's worker is the only writer
+		usage.Calls++
+		usage.PromptTokens += promptTokens
+		usage.OutputTokens += outputTokens
+		usage.TotalTokens += cmp.Or(totalTokens, promptTokens+outputTokens)
+	}
+}
+
+// RecordOversize counts a chunk output that hit its token limit or ran well past its target, in
+// Pool and in ctx's stats
+func RecordOversize(ctx context.Context) {
+	Pool.recordOversize()
+	if stats := PoolStatsFrom(ctx); stats != nil {
+		stats.recordOversize()
+	}
+}
+
+func (s *PoolStats) recordOversize() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.oversize++
+}
+
+func (s *PoolStats) recordChunk(latency time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunks++
+	if failed {
+		s.failed++
+		return
+	}
+	if s.window > 0 && len(s.latencies) == s.window {
+		s.latencies[s.next] = latency
+		s.next = (s.next + 1) % s.window
+		return
+	}
+	s.latencies = append(s.latencies, latency)
+}
+
+func (s *PoolStats) recordChunkUsage(usage ChunkUsage, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage.Failed = failed
+	s.usage = append(s.usage, usage)
+}
+
+func (s *PoolStats) recordCall(promptTokens, outputTokens int, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.promptTokens += promptTokens
+	s.outputTokens += outputTokens
+	s.callTime += duration
+}
+
+// Summary returns the counts so far and the latency percentiles of the successful chunks
+func (s *PoolStats) Summary() PoolSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := PoolSummary{
+		Chunks:       s.chunks,
+		Failed:       s.failed,
+		Oversize:     s.oversize,
+		PromptTokens: s.promptTokens,
+		OutputTokens: s.outputTokens,
+	}
+	if s.callTime > 0 {
+		summary.TokensPerSecond = float64(s.outputTokens) / s.callTime.Seconds()
+	}
+	if len(s.latencies) > 0 {
+		sorted := slices.Clone(s.latencies)
+		slices.Sort(sorted)
+		summary.LatencyP50Ms = percentile(sorted, 50).Milliseconds()
+		summary.LatencyP95Ms = percentile(sorted, 95).Milliseconds()
+		summary.LatencyP99Ms = percentile(sorted, 99).Milliseconds()
+	}
+	if len(s.usage) > 0 {
+		// Chunks are recorded as they finish
+		summary.ChunkUsage = slices.Clone(s.usage)
+		slices.SortStableFunc(summary.ChunkUsage, func(a, b ChunkUsage) int {
+			return cmp.Or(cmp.Compare(a.Stage, b.Stage), cmp.Compare(a.Chunk, b.Chunk))
+		})
+	}
+	return summary
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
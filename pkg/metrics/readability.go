@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// wordsPerMinute is the average adult silent reading speed used for reading time estimates
+const wordsPerMinute = 238
+
+// TextMetrics holds readability and complexity measures for one piece of text
+type TextMetrics struct {
+	Words              int     `json:"words"`
+	Sentences          int     `json:"sentences"`
+	Syllables          int     `json:"syllables"`
+	FleschReadingEase  float64 `json:"flesch_reading_ease"`
+	FleschKincaidGrade float64 `json:"flesch_kincaid_grade"`
+	ReadingTimeSeconds float64 `json:"reading_time_seconds"`
+	LexicalDensity     float64 `json:"lexical_density"`
+}
+
+// Report compares the metrics of the input text with the processed output
+type Report struct {
+	Input  TextMetrics `json:"input"`
+	Output TextMetrics `json:"output"`
+}
+
+// NewReport analyzes both the input and the output text
+func NewReport(input, output string) Report {
+	return Report{Input: Analyze(input), Output: Analyze(output)}
+}
+
+// Analyze computes Flesch-Kincaid readability, reading time and lexical density.
+// Markdown markers are ignored because words are reduced to their letters and digits.
+func Analyze(text string) TextMetrics {
+	var m TextMetrics
+	contentWords := 0
+
+	for _, field := range strings.Fields(text) {
+		word := strings.ToLower(strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}))
+		if word == "" {
+			continue
+		}
+		m.Words++
+		m.Syllables += countSyllables(word)
+		if !functionWords[word] {
+			contentWords++
+		}
+		if strings.ContainsAny(field[len(field)-1:], ".!?") {
+			m.Sentences++
+		}
+	}
+
+	if m.Words == 0 {
+		return m
+	}
+	// Text without terminal punctuation (e.g. a heading-only outline) still counts as one sentence
+	if m.Sentences == 0 {
+		m.Sentences = 1
+	}
+
+	wordsPerSentence := float64(m.Words) / float64(m.Sentences)
+	syllablesPerWord := float64(m.Syllables) / float64(m.Words)
+	m.FleschReadingEase = round2(206.835 - 1.015*wordsPerSentence - 84.6*syllablesPerWord)
+	m.FleschKincaidGrade = round2(0.39*wordsPerSentence + 11.8*syllablesPerWord - 15.59)
+	m.ReadingTimeSeconds = round2(float64(m.Words) / wordsPerMinute * 60)
+	m.LexicalDensity = round2(float64(contentWords) / float64(m.Words))
+	return m
+}
+
+// countSyllables estimates syllables by counting vowel groups, dropping a silent trailing "e"
+func countSyllables(word string) int {
+	count := 0
+	prevVowel := false
+	for _, r := range word {
+		vowel := strings.ContainsRune("aeiouy", r)
+		if vowel && !prevVowel {
+			count++
+		}
+		prevVowel = vowel
+	}
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && count > 1 {
+		count--
+	}
+	if count == 0 {
+		count = 1
+	}
+	return count
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// functionWords are the grammatical words excluded from lexical density
+var functionWords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "but": true, "nor": true, "so": true, "yet": true,
+	"of": true, "in": true, "on": true, "at": true, "to": true, "for": true, "from": true, "by": true, "with": true,
+	"about": true, "as": true, "into": true, "like": true, "through": true, "after": true, "over": true, "between": true,
+	"out": true, "against": true, "during": true, "without": true, "before": true, "under": true, "around": true, "among": true,
+	"i": true, "me": true, "my": true, "we": true, "us": true, "our": true, "you": true, "your": true, "he": true, "him": true,
+	"his": true, "she": true, "her": true, "it": true, "its": true, "they": true, "them": true, "their": true,
+	"this": true, "that": true, "these": true, "those": true, "who": true, "whom": true, "which": true, "what": true,
+	"is": true, "am": true, "are": true, "was": true, "were": true, "be": true, "been": true, "being": true,
+	"have": true, "has": true, "had": true, "do": true, "does": true, "did": true, "will": true, "would": true,
+	"shall": true, "should": true, "can": true, "could": true, "may": true, "might": true, "must": true,
+	"not": true, "no": true, "if": true, "then": true, "than": true, "there": true, "here": true, "when": true,
+	"where": true, "why": true, "how": true, "all": true, "any": true, "some": true, "each": true, "very": true,
+	"just": true, "also": true, "too": true, "up": true, "down": true, "off": true, "because": true, "while": true,
+}
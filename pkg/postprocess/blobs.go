@@ -0,0 +1,22 @@
+package postprocess
+
+import (
+	"context"
+	"regexp"
+)
+
+// blobRegex matches runs of at least 200 base64, hex or URL characters: encoded data and
+// tracking URLs, which the model can't condense. Other runs without spaces are left alone, as
+// Chinese or Japanese prose has none.
+var blobRegex = regexp.MustCompile(`[A-Za-z0-9+/=_%.:?&#~-]{200,}`)
+
+// blobsProcessor replaces non-prose blobs with a short marker. It is meant as a pre-hook
+// ("PRE_HOOKS=strip_blobs"), so blobs neither fill the chunks nor reach the model.
+type blobsProcessor struct{}
+
+func (blobsProcessor) Name() string { return "strip_blobs" }
+
+func (blobsProcessor) Process(ctx context.Context, doc Document) (Document, error) {
+	doc.Text = blobRegex.ReplaceAllString(doc.Text, "[blob removed]")
+	return doc, nil
+}
@@ -0,0 +1,69 @@
+package postprocess
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dedupProcessor drops paragraphs that repeat the paragraph right before them,
+// which chunk overlap tends to produce at chunk boundaries
+type dedupProcessor struct{}
+
+func (dedupProcessor) Name() string { return "dedup" }
+
+func (dedupProcessor) Process(ctx context.Context, doc Document) (Document, error) {
+	paragraphs := strings.Split(doc.Text, "\n\n")
+	var kept []string
+	previous := ""
+	for _, paragraph := range paragraphs {
+		normalized := strings.Join(strings.Fields(strings.ToLower(paragraph)), " ")
+		if normalized != "" && normalized == previous {
+			continue
+		}
+		kept = append(kept, paragraph)
+		previous = normalized
+	}
+	doc.Text = strings.Join(kept, "\n\n")
+	return doc, nil
+}
+
+// tocProcessor prepends a table of contents built from markdown headings
+type tocProcessor struct{}
+
+var headingRegex = regexp.MustCompile(`(?m)^(#{1,6})\s+(.+?)\s*$`)
+
+func (tocProcessor) Name() string { return "toc" }
+
+func (tocProcessor) Process(ctx context.Context, doc Document) (Document, error) {
+	headings := headingRegex.FindAllStringSubmatch(doc.Text, -1)
+	if len(headings) < 2 {
+		return doc, nil
+	}
+
+	var toc strings.Builder
+	toc.WriteString("# Contents\n\n")
+	for _, heading := range headings {
+		indent := strings.Repeat("  ", len(heading[1])-1)
+		fmt.Fprintf(&toc, "%s- %s\n", indent, heading[2])
+	}
+	doc.Text = toc.String() + "\n" + doc.Text
+	return doc, nil
+}
+
+// redactProcessor masks email addresses and phone numbers
+type redactProcessor struct{}
+
+var (
+	emailRegex = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phoneRegex = regexp.MustCompile(`\+?\d[\d\s().-]{7,}\d`)
+)
+
+func (redactProcessor) Name() string { return "redact" }
+
+func (redactProcessor) Process(ctx context.Context, doc Document) (Document, error) {
+	doc.Text = emailRegex.ReplaceAllString(doc.Text, "[email redacted]")
+	doc.Text = phoneRegex.ReplaceAllString(doc.Text, "[phone redacted]")
+	return doc, nil
+}
@@ -0,0 +1,55 @@
+package postprocess
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// bulletsProcessor normalizes bullet markers and indentation, see NormalizeBullets
+type bulletsProcessor struct{}
+
+func (bulletsProcessor) Name() string { return "bullets" }
+
+func (bulletsProcessor) Process(ctx context.Context, doc Document) (Document, error) {
+	doc.Text = NormalizeBullets(doc.Text)
+	return doc, nil
+}
+
+var bulletLineRegex = regexp.MustCompile(`^([ \t]*)[-*+•◦▪‣–][ \t]+(.*)$`)
+
+// NormalizeBullets rewrites every bullet item as "- item", indented by two spaces per nesting
+// level. Models mix "*", "•" and "-" and indent by 2, 3 or 4 spaces or tabs; the level of an item
+// is taken from how its indentation compares to the items above it, so the result is the same
+// however the input was indented. Lines inside code fences are left alone.
+func NormalizeBullets(text string) string {
+	lines := strings.Split(text, "\n")
+	var indents []int // indentation widths of the open nesting levels
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		match := bulletLineRegex.FindStringSubmatch(line)
+		if match == nil {
+			// A heading or paragraph ends the list; blank lines inside it don't
+			if strings.TrimSpace(line) != "" {
+				indents = indents[:0]
+			}
+			continue
+		}
+		width := len(strings.ReplaceAll(match[1], "\t", "    "))
+		for len(indents) > 0 && indents[len(indents)-1] > width {
+			indents = indents[:len(indents)-1]
+		}
+		if len(indents) == 0 || indents[len(indents)-1] < width {
+			indents = append(indents, width)
+		}
+		lines[i] = strings.Repeat("  ", len(indents)-1) + "- " + strings.TrimSpace(match[2])
+	}
+	return strings.Join(lines, "\n")
+}
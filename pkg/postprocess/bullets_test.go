@@ -0,0 +1,64 @@
+package postprocess
+
+import "testing"
+
+func TestNormalizeBullets(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "mixed markers",
+			text: "* one\n• two\n+ three\n- four",
+			want: "- one\n- two\n- three\n- four",
+		},
+		{
+			name: "four-space nesting",
+			text: "- a\n    - b\n        - c\n- d",
+			want: "- a\n  - b\n    - c\n- d",
+		},
+		{
+			name: "tab nesting",
+			text: "- a\n\t- b\n- c",
+			want: "- a\n  - b\n- c",
+		},
+		{
+			name: "uneven indentation",
+			text: "- a\n   - b\n  - c\n- d",
+			want: "- a\n  - b\n  - c\n- d",
+		},
+		{
+			name: "blank line inside a list",
+			text: "- a\n    - b\n\n    - c",
+			want: "- a\n  - b\n\n  - c",
+		},
+		{
+			name: "paragraph ends the list",
+			text: "- a\n    - b\nText\n    - c",
+			want: "- a\n  - b\nText\n- c",
+		},
+		{
+			name: "extra spaces after the marker",
+			text: "-   spaced",
+			want: "- spaced",
+		},
+		{
+			name: "code fences left alone",
+			text: "```\n* literal\n```\n* item",
+			want: "```\n* literal\n```\n- item",
+		},
+		{
+			name: "dash without a space is not a bullet",
+			text: "-5 degrees",
+			want: "-5 degrees",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeBullets(tt.text); got != tt.want {
+				t.Errorf("NormalizeBullets(%q)\n got %q\nwant %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
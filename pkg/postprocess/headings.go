@@ -0,0 +1,113 @@
+package postprocess
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// headingsProcessor makes heading levels consistent across chunks, see NormalizeHeadings
+type headingsProcessor struct{}
+
+func (headingsProcessor) Name() string { return "headings" }
+
+func (headingsProcessor) Process(ctx context.Context, doc Document) (Document, error) {
+	doc.Text = NormalizeHeadings(doc.Text)
+	return doc, nil
+}
+
+// sectionNumberRegex matches section numbers like "3", "3.2." or "A.1" at the start of a heading.
+// Components have at most three digits so years aren't taken for section numbers, and a letter
+// only counts when a number follows it, so "A Brief History" isn't numbered.
+var sectionNumberRegex = regexp.MustCompile(`^(\d{1,3}(?:\.\d{1,3})*|[A-Z](?:\.\d{1,3})+)[.)]?\s+\S`)
+
+type markdownHeading struct {
+	line  int
+	level int // number of # in the input
+	depth int // components of the section number, 0 when unnumbered
+	title string
+}
+
+// NormalizeHeadings rewrites markdown heading levels so the same level is marked the same way
+// throughout. Each chunk is condensed on its own, so the model may start one chunk's sections
+// with "#" and the next one's with "##", which breaks the table of contents and PDF rendering.
+//   - Levels are renumbered by rank, so a document using only "##" and "####" gets "#" and "##".
+//   - When at least two headings are numbered, the number sets the level: "3.2 Methods" is one
+//     level below "3 Results", counted from the level of the first top-level numbered heading.
+//   - A heading is never more than one level below the heading before it.
+//
+// Lines inside code fences are left alone. Run it before toc so the contents use the new levels.
+func NormalizeHeadings(text string) string {
+	lines := strings.Split(text, "\n")
+	var headings []markdownHeading
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		match := headingRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		heading := markdownHeading{line: i, level: len(match[1]), title: match[2]}
+		if number := sectionNumberRegex.FindStringSubmatch(heading.title); number != nil {
+			heading.depth = strings.Count(number[1], ".") + 1
+		}
+		headings = append(headings, heading)
+	}
+	if len(headings) == 0 {
+		return text
+	}
+
+	// Rank the levels in use
+	var used []int
+	numbered := 0
+	for _, heading := range headings {
+		if !slices.Contains(used, heading.level) {
+			used = append(used, heading.level)
+		}
+		if heading.depth > 0 {
+			numbered++
+		}
+	}
+	slices.Sort(used)
+	rank := func(level int) int { return slices.Index(used, level) + 1 }
+
+	// Numbered top-level sections sit where the first of them does, below any title before it
+	base := 0
+	if numbered >= 2 {
+		for _, heading := range headings {
+			if heading.depth == 1 {
+				base = rank(heading.level)
+				break
+			}
+		}
+		if base == 0 {
+			// Only subsections are numbered; they sit under the shallowest of them
+			base = len(used) + 1
+			for _, heading := range headings {
+				if heading.depth > 0 {
+					base = min(base, rank(heading.level)-heading.depth+1)
+				}
+			}
+			base = max(base, 1)
+		}
+	}
+
+	previous := 0
+	for _, heading := range headings {
+		level := rank(heading.level)
+		if base > 0 && heading.depth > 0 {
+			level = base + heading.depth - 1
+		}
+		level = min(level, previous+1, 6)
+		lines[heading.line] = strings.Repeat("#", level) + " " + heading.title
+		previous = level
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,64 @@
+package postprocess
+
+import "testing"
+
+func TestNormalizeHeadings(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "no headings",
+			text: "Just a paragraph.\n\nAnd another.",
+			want: "Just a paragraph.\n\nAnd another.",
+		},
+		{
+			name: "levels renumbered by rank",
+			text: "## Intro\ntext\n#### Detail\ntext\n## Next",
+			want: "# Intro\ntext\n## Detail\ntext\n# Next",
+		},
+		{
+			name: "chunks starting at different levels",
+			text: "# Part one\n### Point\n## Part two",
+			want: "# Part one\n## Point\n## Part two",
+		},
+		{
+			name: "never more than one level deeper",
+			text: "# Title\n#### Deep",
+			want: "# Title\n## Deep",
+		},
+		{
+			name: "section numbers set the level",
+			text: "# Report\n## 1 Results\n# 1.1 Tables\n### 2 Discussion",
+			want: "# Report\n## 1 Results\n### 1.1 Tables\n## 2 Discussion",
+		},
+		{
+			name: "a single number doesn't count",
+			text: "## 3 Results\n### Detail",
+			want: "# 3 Results\n## Detail",
+		},
+		{
+			name: "years aren't section numbers",
+			text: "# 2024 Review\n# 2025 Outlook",
+			want: "# 2024 Review\n# 2025 Outlook",
+		},
+		{
+			name: "only subsections numbered",
+			text: "# Methods\n### 2.1 Sampling\n### 2.2 Analysis",
+			want: "# Methods\n## 2.1 Sampling\n## 2.2 Analysis",
+		},
+		{
+			name: "code fences left alone",
+			text: "## Setup\n```\n# comment\n```\n#### Step",
+			want: "# Setup\n```\n# comment\n```\n## Step",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeHeadings(tt.text); got != tt.want {
+				t.Errorf("NormalizeHeadings(%q)\n got %q\nwant %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
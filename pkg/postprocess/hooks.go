@@ -0,0 +1,158 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/httpclient"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// maxHookOutput caps how much a hook may return, so a misbehaving hook can't exhaust memory
+const maxHookOutput = 32 << 20 // 32 MB
+
+// commandHook pipes the document through an external command on stdin/stdout.
+// The command runs without a shell, in an empty temp directory, with only PATH in its environment.
+type commandHook struct {
+	args    []string
+	timeout time.Duration
+}
+
+func (h commandHook) Name() string { return "cmd:" + h.args[0] }
+
+func (h commandHook) Process(ctx context.Context, doc Document) (Document, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	workDir, err := os.MkdirTemp("", "cutcrap_hook_*")
+	if err != nil {
+		return doc, fmt.Errorf("failed create hook work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	cmd := exec.CommandContext(ctx, h.args[0], h.args[1:]...)
+	cmd.Dir = workDir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "CUTCRAP_MODE=" + doc.Mode}
+	cmd.Stdin = strings.NewReader(doc.Text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &limitedWriter{w: &stdout, remaining: maxHookOutput}
+	// A chatty hook is not a failed one: stderr past the budget is dropped
+	cmd.Stderr = &limitedWriter{w: &stderr, remaining: 4096, truncate: true}
+
+	if err := cmd.Run(); err != nil {
+		return doc, fmt.Errorf("hook command failed: %w (stderr: %s)", err, logging.Excerpt(strings.TrimSpace(stderr.String())))
+	}
+	doc.Text = stdout.String()
+	return doc, nil
+}
+
+// httpHook POSTs the document as JSON ({"mode", "text"}) and expects {"text"} back
+type httpHook struct {
+	url     string
+	timeout time.Duration
+}
+
+type hookPayload struct {
+	Mode string `json:"mode,omitempty"`
+	Text string `json:"text"`
+}
+
+func (h httpHook) Name() string { return "http:" + h.url }
+
+func (h httpHook) Process(ctx context.Context, doc Document) (Document, error) {
+	body, err := json.Marshal(hookPayload{Mode: doc.Mode, Text: doc.Text})
+	if err != nil {
+		return doc, fmt.Errorf("failed marshal hook payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", h.url, bytes.NewReader(body))
+	if err != nil {
+		return doc, fmt.Errorf("failed create hook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpclient.Default.Do(req)
+	if err != nil {
+		return doc, fmt.Errorf("hook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return doc, fmt.Errorf("hook returned status %s", resp.Status)
+	}
+
+	var result hookPayload
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxHookOutput)).Decode(&result); err != nil {
+		return doc, fmt.Errorf("failed decode hook response: %w", err)
+	}
+	doc.Text = result.Text
+	return doc, nil
+}
+
+// ParseHook builds a hook from its config spec: "cmd:<program> [args...]", an http(s) URL or the
+// name of a built-in processor (see Register)
+func ParseHook(spec string, timeout time.Duration) (PostProcessor, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case strings.HasPrefix(spec, "cmd:"):
+		args := strings.Fields(strings.TrimPrefix(spec, "cmd:"))
+		if len(args) == 0 {
+			return nil, fmt.Errorf("hook %q has no command", spec)
+		}
+		return commandHook{args: args, timeout: timeout}, nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return httpHook{url: spec, timeout: timeout}, nil
+	default:
+		if constructor, ok := registry[spec]; ok {
+			return constructor(), nil
+		}
+		return nil, fmt.Errorf("hook %q must start with cmd:, http:// or https://, or name a built-in processor", spec)
+	}
+}
+
+// BuildHooks parses every hook spec into a pipeline, in order
+func BuildHooks(specs []string, timeout time.Duration) (Pipeline, error) {
+	var pipeline Pipeline
+	for _, spec := range specs {
+		hook, err := ParseHook(spec, timeout)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, hook)
+	}
+	return pipeline, nil
+}
+
+// limitedWriter fails writes once the byte budget is used up, or with truncate silently drops
+// the bytes past it
+type limitedWriter struct {
+	w         io.Writer
+	remaining int
+	truncate  bool
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.remaining {
+		if !l.truncate {
+			return 0, fmt.Errorf("hook output exceeds limit")
+		}
+		if _, err := l.w.Write(p[:l.remaining]); err != nil {
+			return 0, err
+		}
+		l.remaining = 0
+		return len(p), nil
+	}
+	l.remaining -= len(p)
+	return l.w.Write(p)
+}
@@ -0,0 +1,85 @@
+package postprocess
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/transcript"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// Document is the processed output passed through the post-processing pipeline
+type Document struct {
+	Mode string
+	Text string
+	// Turns are the speaker turns of a transcript before TranscriptStages format them into Text
+	Turns []transcript.Turn
+}
+
+// PostProcessor transforms a processed document. Implementations must not mutate shared state.
+type PostProcessor interface {
+	Name() string
+	Process(ctx context.Context, doc Document) (Document, error)
+}
+
+// Pipeline runs post-processors in order, feeding each one the previous output
+type Pipeline []PostProcessor
+
+// Run applies every processor in order. The first error stops the pipeline.
+func (p Pipeline) Run(ctx context.Context, doc Document) (Document, error) {
+	for _, processor := range p {
+		if err := ctx.Err(); err != nil {
+			return doc, err
+		}
+		startTime := time.Now()
+		inputWords := wordcount.Count(doc.Text)
+
+		next, err := processor.Process(ctx, doc)
+		if err != nil {
+			return doc, fmt.Errorf("post-processor %s failed: %w", processor.Name(), err)
+		}
+		if inputTurns := len(doc.Turns); inputWords == 0 && inputTurns > 0 {
+			reqctx.Logger(ctx).Printf("Post-processor %s completed in %v (%d -> %d turns)", processor.Name(), time.Since(startTime), inputTurns, len(next.Turns))
+		} else {
+			reqctx.Logger(ctx).Printf("Post-processor %s completed in %v (%d -> %d words)", processor.Name(), time.Since(startTime), inputWords, wordcount.Count(next.Text))
+		}
+		doc = next
+	}
+	return doc, nil
+}
+
+// registry maps config names to post-processor constructors
+var registry = map[string]func() PostProcessor{
+	"dedup":       func() PostProcessor { return dedupProcessor{} },
+	"toc":         func() PostProcessor { return tocProcessor{} },
+	"redact":      func() PostProcessor { return redactProcessor{} },
+	"bullets":     func() PostProcessor { return bulletsProcessor{} },
+	"headings":    func() PostProcessor { return headingsProcessor{} },
+	"strip_blobs": func() PostProcessor { return blobsProcessor{} },
+}
+
+// Register adds a named post-processor so it can be enabled from config.
+// It must be called before Build, typically from an init function.
+func Register(name string, constructor func() PostProcessor) {
+	registry[name] = constructor
+}
+
+// Build assembles a pipeline from the configured processor names, in order
+func Build(names []string) (Pipeline, error) {
+	var pipeline Pipeline
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		constructor, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown post-processor %q", name)
+		}
+		pipeline = append(pipeline, constructor())
+	}
+	return pipeline, nil
+}
@@ -0,0 +1,62 @@
+package postprocess
+
+import (
+	"context"
+
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/transcript"
+)
+
+// TranscriptStages are the stages that turn the turns collected from a transcript's processed
+// chunks (Document.Turns) into the transcript: speaker_names, merge_turns and, when format is not
+// nil, format_turns, which writes the turns to Document.Text. roles is the role->name map of the
+// speaker analysis.
+func TranscriptStages(roles map[string]string, rules transcript.NameRules, format *transcript.Format) Pipeline {
+	stages := Pipeline{speakerNamesProcessor{roles: roles, rules: rules}, mergeTurnsProcessor{}}
+	if format != nil {
+		stages = append(stages, formatTurnsProcessor{format: *format})
+	}
+	return stages
+}
+
+// speakerNamesProcessor replaces role labels left as speakers with the analysed names, then
+// unifies the forms of one person's name (see transcript.UnifyNames)
+type speakerNamesProcessor struct {
+	roles map[string]string
+	rules transcript.NameRules
+}
+
+func (speakerNamesProcessor) Name() string { return "speaker_names" }
+
+func (p speakerNamesProcessor) Process(ctx context.Context, doc Document) (Document, error) {
+	logger := reqctx.Logger(ctx)
+	if renamed := transcript.EnforceSpeakerNames(doc.Turns, p.roles); renamed > 0 {
+		logger.Printf("Replaced role labels with speaker names on %d turns", renamed)
+	}
+	if renamed := transcript.UnifySpeakers(doc.Turns, p.rules); renamed > 0 {
+		logger.Printf("Unified the speaker names of %d turns", renamed)
+	}
+	return doc, nil
+}
+
+// mergeTurnsProcessor merges consecutive turns by the same speaker
+type mergeTurnsProcessor struct{}
+
+func (mergeTurnsProcessor) Name() string { return "merge_turns" }
+
+func (mergeTurnsProcessor) Process(ctx context.Context, doc Document) (Document, error) {
+	doc.Turns = transcript.MergeTurns(doc.Turns)
+	return doc, nil
+}
+
+// formatTurnsProcessor writes the turns as the transcript text
+type formatTurnsProcessor struct {
+	format transcript.Format
+}
+
+func (formatTurnsProcessor) Name() string { return "format_turns" }
+
+func (p formatTurnsProcessor) Process(ctx context.Context, doc Document) (Document, error) {
+	doc.Text = transcript.FormatTurns(ctx, doc.Turns, p.format)
+	return doc, nil
+}
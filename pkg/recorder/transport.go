@@ -0,0 +1,146 @@
+// Package recorder captures LLM HTTP interactions to disk and replays them, so prompt
+// changes can be debugged deterministically without spending real API calls.
+package recorder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+const (
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+// Transport is an http.RoundTripper that records responses from Next (record mode)
+// or serves them from Dir without touching the network (replay mode).
+// Interactions are keyed by a hash of the method, path and request body; the API key
+// query parameter is never part of the key or the stored file.
+type Transport struct {
+	Mode string
+	Dir  string
+	Next http.RoundTripper
+}
+
+// interaction is the on-disk form of one recorded request/response pair
+type interaction struct {
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	Request     json.RawMessage `json:"request,omitempty"`
+	StatusCode  int             `json:"status_code"`
+	ContentType string          `json:"content_type"`
+	Response    string          `json:"response"`
+}
+
+// New returns a recording or replaying transport. next defaults to http.DefaultTransport.
+func New(mode, dir string, next http.RoundTripper) (*Transport, error) {
+	if mode != ModeRecord && mode != ModeReplay {
+		return nil, fmt.Errorf("unknown record mode %q (must be %q or %q)", mode, ModeRecord, ModeReplay)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed create record dir: %w", err)
+	}
+	return &Transport{Mode: mode, Dir: dir, Next: next}, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	key := Key(req.Method, req.URL.Path, body)
+	path := filepath.Join(t.Dir, key+".json")
+
+	if t.Mode == ModeReplay {
+		return t.replay(req, path)
+	}
+	return t.record(req, path, body)
+}
+
+func (t *Transport) replay(req *http.Request, path string) (*http.Response, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no recorded interaction for %s %s (%s): %w", req.Method, req.URL.Path, filepath.Base(path), err)
+	}
+	var recorded interaction
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return nil, fmt.Errorf("failed decode recorded interaction %s: %w", path, err)
+	}
+	log.Printf("Replaying recorded interaction %s", filepath.Base(path))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{recorded.ContentType}},
+		Body:          io.NopCloser(bytes.NewReader([]byte(recorded.Response))),
+		ContentLength: int64(len(recorded.Response)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) record(req *http.Request, path string, body []byte) (*http.Response, error) {
+	resp, err := t.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	recorded := interaction{
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Response:    string(respBody),
+	}
+	if json.Valid(body) {
+		recorded.Request = body
+	}
+
+	data, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		logging.Warnf("Failed to encode recorded interaction: %v", err)
+		return resp, nil
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		logging.Warnf("Failed to write recorded interaction %s: %v", path, err)
+		return resp, nil
+	}
+	log.Printf("Recorded interaction %s (status %d)", filepath.Base(path), resp.StatusCode)
+	return resp, nil
+}
+
+// Key is the replay key for a request: a hash of method, path and body
+func Key(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
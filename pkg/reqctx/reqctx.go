@@ -0,0 +1,77 @@
+// Package reqctx carries request-scoped metadata (job ID, tenant) and a logger through a context,
+// so log lines from deep in the pipeline can be attributed to the request that caused them.
+package reqctx
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+type metadataKey struct{}
+type loggerKey struct{}
+
+// Metadata identifies the request a context belongs to
+type Metadata struct {
+	JobID  string
+	Tenant string
+}
+
+// WithMetadata attaches md to ctx together with a logger whose lines are prefixed with it
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	ctx = context.WithValue(ctx, metadataKey{}, md)
+	return WithLogger(ctx, log.New(log.Writer(), md.prefix(), log.Flags()|log.Lmsgprefix))
+}
+
+// MetadataFrom returns the metadata attached to ctx, or the zero value
+func MetadataFrom(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
+
+// WithLogger attaches a logger to ctx
+func WithLogger(ctx context.Context, logger *log.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the logger attached to ctx, falling back to the standard logger
+func Logger(ctx context.Context) *log.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*log.Logger); ok {
+			return logger
+		}
+	}
+	return log.Default()
+}
+
+// Debug returns the logger for verbose lines of ctx, which discards them unless LOG_LEVEL is debug
+func Debug(ctx context.Context) *log.Logger {
+	return logging.Debug(Logger(ctx))
+}
+
+// Warn returns the logger for warnings of ctx
+func Warn(ctx context.Context) *log.Logger {
+	return logging.Warn(Logger(ctx))
+}
+
+// Error returns the logger for errors of ctx
+func Error(ctx context.Context) *log.Logger {
+	return logging.Error(Logger(ctx))
+}
+
+// prefix renders the metadata as "[job=… tenant=…] "
+func (md Metadata) prefix() string {
+	var parts []string
+	if md.JobID != "" {
+		parts = append(parts, "job="+md.JobID)
+	}
+	if md.Tenant != "" {
+		parts = append(parts, "tenant="+md.Tenant)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(parts, " ") + "] "
+}
@@ -0,0 +1,77 @@
+package router
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// Router picks a model per chunk: short, plain chunks go to the fast model and long or
+// structurally dense chunks (tables, code, math) go to the strong model.
+type Router struct {
+	FastModel   string
+	StrongModel string
+
+	// WordThreshold routes chunks with more words than this to the strong model (0 disables)
+	WordThreshold int
+	// ComplexityThreshold routes chunks whose Complexity score reaches this to the strong model
+	ComplexityThreshold float64
+}
+
+var (
+	tableLineRegex = regexp.MustCompile(`(?m)^\s*\|.*\|\s*$`)
+	codeLineRegex  = regexp.MustCompile("(?m)^(```|    \\S|\\t\\S)")
+	mathRegex      = regexp.MustCompile(`\$[^$\n]+\$|\\\[|\\\(|\\(frac|sum|int|sqrt|alpha|beta)\b`)
+	numberRegex    = regexp.MustCompile(`\d+(?:[.,]\d+)*%?`)
+)
+
+// New returns a router. With no strong model configured every chunk uses the fast model.
+func New(fastModel, strongModel string, wordThreshold int, complexityThreshold float64) *Router {
+	return &Router{
+		FastModel:           fastModel,
+		StrongModel:         strongModel,
+		WordThreshold:       wordThreshold,
+		ComplexityThreshold: complexityThreshold,
+	}
+}
+
+// Route returns the model to use for a chunk
+func (r *Router) Route(text string) string {
+	if r.StrongModel == "" || r.StrongModel == r.FastModel {
+		return r.FastModel
+	}
+
+	words := wordcount.Count(text)
+	if r.WordThreshold > 0 && words > r.WordThreshold {
+		logging.Debug(log.Default()).Printf("Router: %d words exceeds threshold %d, using %s", words, r.WordThreshold, r.StrongModel)
+		return r.StrongModel
+	}
+
+	if score := Complexity(text); r.ComplexityThreshold > 0 && score >= r.ComplexityThreshold {
+		logging.Debug(log.Default()).Printf("Router: complexity %.2f reaches threshold %.2f, using %s", score, r.ComplexityThreshold, r.StrongModel)
+		return r.StrongModel
+	}
+	return r.FastModel
+}
+
+// Complexity scores how structurally dense a chunk is, roughly between 0 and 1.
+// Table rows, code lines and math expressions weigh most; numeric density adds a little.
+func Complexity(text string) float64 {
+	lines := strings.Count(text, "\n") + 1
+	words := wordcount.Count(text)
+	if words == 0 {
+		return 0
+	}
+
+	structuredLines := len(tableLineRegex.FindAllString(text, -1)) + len(codeLineRegex.FindAllString(text, -1))
+	mathHits := len(mathRegex.FindAllString(text, -1))
+	numbers := len(numberRegex.FindAllString(text, -1))
+
+	score := float64(structuredLines)/float64(lines) +
+		float64(mathHits)*20/float64(words) +
+		float64(numbers)/float64(words)
+	return min(score, 1)
+}
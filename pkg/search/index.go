@@ -0,0 +1,246 @@
+// Package search indexes job outputs in memory. Index is a full-text index: queries match
+// documents that contain every query term, ranked by BM25, with a highlighted snippet around the
+// first match. VectorIndex ranks documents by the embedding similarity of their passages.
+package search
+
+import (
+	"html"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// snippetWords is how many words a snippet shows around its first match
+const snippetWords = 30
+
+// Index maps terms to the documents containing them. It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*document
+	postings map[string]map[string]int // term -> document ID -> occurrences
+	words    int                       // total terms over all documents
+}
+
+type document struct {
+	owner string
+	text  string
+	terms map[string]int
+	words int
+}
+
+// Hit is a document matching a query
+type Hit struct {
+	ID    string
+	Score float64
+	// Snippet is a passage around the first match, HTML-escaped, with the matched words wrapped
+	// in <mark>
+	Snippet string
+}
+
+// NewIndex returns an empty index
+func NewIndex() *Index {
+	return &Index{docs: make(map[string]*document), postings: make(map[string]map[string]int)}
+}
+
+// Add indexes text under id for owner, replacing what was indexed under it before
+func (idx *Index) Add(id, owner, text string) {
+	terms := make(map[string]int)
+	words := 0
+	for _, token := range tokenize(text) {
+		terms[token.term]++
+		words++
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+	idx.docs[id] = &document{owner: owner, text: text, terms: terms, words: words}
+	idx.words += words
+	for term, count := range terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]int)
+		}
+		idx.postings[term][id] = count
+	}
+}
+
+// Remove drops the document indexed under id, if any
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.words -= doc.words
+	delete(idx.docs, id)
+}
+
+// Len is the number of indexed documents
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Search returns the documents of owner containing every term of query, best first, and the
+// total number of matches. At most limit hits are returned.
+func (idx *Index) Search(query, owner string, limit int) ([]Hit, int) {
+	var terms []string
+	for _, token := range tokenize(query) {
+		if !slices.Contains(terms, token.term) {
+			terms = append(terms, token.term)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, 0
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// Start from the rarest term's postings so the intersection stays small
+	sort.Slice(terms, func(i, j int) bool { return len(idx.postings[terms[i]]) < len(idx.postings[terms[j]]) })
+	var hits []Hit
+	averageWords := float64(idx.words) / float64(max(1, len(idx.docs)))
+	for id := range idx.postings[terms[0]] {
+		doc := idx.docs[id]
+		if doc.owner != owner {
+			continue
+		}
+		score := 0.0
+		for _, term := range terms {
+			count := doc.terms[term]
+			if count == 0 {
+				score = -1
+				break
+			}
+			matching := float64(len(idx.postings[term]))
+			idf := math.Log(1 + (float64(len(idx.docs))-matching+0.5)/(matching+0.5))
+			tf := float64(count)
+			score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(doc.words)/averageWords))
+		}
+		if score >= 0 {
+			hits = append(hits, Hit{ID: id, Score: score})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	total := len(hits)
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		hits[i].Snippet = snippet(idx.docs[hits[i].ID].text, terms)
+	}
+	return hits, total
+}
+
+// token is a word of a text with its byte offsets
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lowercased runs of letters and digits
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start < 0 {
+			start = i
+		} else if !word && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+// snippet returns about snippetWords words of text starting a few words before the first match,
+// with every match wrapped in <mark> and the text escaped so the snippet is safe to show as HTML
+func snippet(text string, terms []string) string {
+	tokens := tokenize(text)
+	first := 0
+	for i, token := range tokens {
+		if slices.Contains(terms, token.term) {
+			first = i
+			break
+		}
+	}
+	from := max(0, first-snippetWords/4)
+	to := min(len(tokens), from+snippetWords)
+	if from >= to {
+		return ""
+	}
+
+	var sb strings.Builder
+	if from > 0 {
+		sb.WriteString("…")
+	}
+	last := tokens[from].start
+	for _, token := range tokens[from:to] {
+		sb.WriteString(html.EscapeString(collapseSpace(text[last:token.start])))
+		if slices.Contains(terms, token.term) {
+			sb.WriteString("<mark>" + html.EscapeString(text[token.start:token.end]) + "</mark>")
+		} else {
+			sb.WriteString(html.EscapeString(text[token.start:token.end]))
+		}
+		last = token.end
+	}
+	if to < len(tokens) {
+		sb.WriteString("…")
+	} else {
+		sb.WriteString(html.EscapeString(strings.TrimSpace(collapseSpace(text[last:]))))
+	}
+	return sb.String()
+}
+
+// collapseSpace replaces each run of whitespace in s, such as line breaks, with one space
+func collapseSpace(s string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			sb.WriteByte(' ')
+			space = false
+		}
+		sb.WriteRune(r)
+	}
+	if space {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
@@ -0,0 +1,181 @@
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Passage is a piece of an indexed document with its embedding
+type Passage struct {
+	Text   string
+	Vector []float32
+}
+
+// VectorIndex keeps the embedded passages of each document and finds the documents closest to
+// a query embedding. It is safe for concurrent use.
+type VectorIndex struct {
+	mu   sync.RWMutex
+	docs map[string]vectorDocument
+}
+
+type vectorDocument struct {
+	owner    string
+	passages []Passage
+}
+
+// NewVectorIndex returns an empty index
+func NewVectorIndex() *VectorIndex {
+	return &VectorIndex{docs: make(map[string]vectorDocument)}
+}
+
+// Add indexes passages under id for owner, replacing what was indexed under it before. Vectors
+// are normalized in place so similarity is a dot product.
+func (idx *VectorIndex) Add(id, owner string, passages []Passage) {
+	for _, passage := range passages {
+		normalize(passage.Vector)
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs[id] = vectorDocument{owner: owner, passages: passages}
+}
+
+// Remove drops the document indexed under id, if any
+func (idx *VectorIndex) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	delete(idx.docs, id)
+}
+
+// Len is the number of indexed documents
+func (idx *VectorIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Search returns the documents of owner whose best passage is closest to query by cosine
+// similarity, best first, with that passage as the HTML-escaped snippet, and the total number of
+// matches. At most limit hits are returned.
+func (idx *VectorIndex) Search(query []float32, owner string, limit int) ([]Hit, int) {
+	query = normalize(append([]float32(nil), query...))
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	hits := make([]Hit, 0, len(idx.docs))
+	for id, doc := range idx.docs {
+		if doc.owner != owner {
+			continue
+		}
+		passages := doc.passages
+		best, bestScore := -1, math.Inf(-1)
+		for i, passage := range passages {
+			if score := dot(query, passage.Vector); score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best >= 0 {
+			hits = append(hits, Hit{ID: id, Score: bestScore, Snippet: html.EscapeString(passages[best].Text)})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	total := len(hits)
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, total
+}
+
+// Passages splits text into passages of at most maxWords words for embedding. Paragraphs are
+// kept together where they fit; longer ones are cut between words.
+func Passages(text string, maxWords int) []string {
+	var passages []string
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			passages = append(passages, strings.Join(current, " "))
+			current = nil
+		}
+	}
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		words := strings.Fields(paragraph)
+		if len(current)+len(words) > maxWords {
+			flush()
+		}
+		for len(words) > maxWords {
+			passages = append(passages, strings.Join(words[:maxWords], " "))
+			words = words[maxWords:]
+		}
+		current = append(current, words...)
+	}
+	flush()
+	return passages
+}
+
+// normalize scales v to unit length in place and returns it
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// dot is the dot product of a and b over their common length
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range min(len(a), len(b)) {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// Match is a passage of one document close to a query
+type Match struct {
+	// Passage is the passage's position in the document, from 0
+	Passage int
+	Text    string
+	Score   float64
+}
+
+// Nearest returns the k passages of the document indexed under id closest to query, best first,
+// or none when id isn't indexed
+func (idx *VectorIndex) Nearest(id string, query []float32, k int) []Match {
+	query = normalize(append([]float32(nil), query...))
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	passages := idx.docs[id].passages
+	matches := make([]Match, len(passages))
+	for i, passage := range passages {
+		matches[i] = Match{Passage: i, Text: passage.Text, Score: dot(query, passage.Vector)}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if k > 0 && len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+// Has reports whether a document is indexed under id
+func (idx *VectorIndex) Has(id string) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	_, ok := idx.docs[id]
+	return ok
+}
@@ -0,0 +1,133 @@
+package sections
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Citations are the citation keys found in a text: "n:12" for numeric markers, "fn:key" for
+// markdown footnotes and "ay:smith:2020" for author-year citations
+type Citations map[string]bool
+
+var (
+	// sectionNumberRegex matches the number in front of a heading such as "7. References"
+	sectionNumberRegex      = regexp.MustCompile(`^\d+\.?\s+`)
+	footnoteDefinitionRegex = regexp.MustCompile(`^\s*\[\^[^\]\s]+\]:`)
+
+	numericCiteRegex   = regexp.MustCompile(`\[(\d+(?:\s*[-–,]\s*\d+)*)\]`)
+	footnoteCiteRegex  = regexp.MustCompile(`\[\^([^\]\s]+)\]`)
+	authorYearRegex    = regexp.MustCompile(`\(([^()]*\b(?:1[5-9]|20)\d\d[a-z]?)\)`)
+	narrativeCiteRegex = regexp.MustCompile(`(\p{Lu}[\p{L}'’-]+)(?:\s+et al\.?|\s+(?:and|&)\s+\p{Lu}[\p{L}'’-]+)?\s+\(((?:1[5-9]|20)\d\d)[a-z]?\)`)
+	surnameRegex       = regexp.MustCompile(`\p{Lu}[\p{L}'’-]+`)
+	yearRegex          = regexp.MustCompile(`\b(?:1[5-9]|20)\d\d\b`)
+
+	entryStartRegex    = regexp.MustCompile(`^(?:\s*(?:\[\^?[^\]]+\]:?|\d+[.)]|[-*•])\s|\p{Lu}[\p{L}'’-]+,)`)
+	entryNumberRegex   = regexp.MustCompile(`^\s*(?:\[(\d+)\]|(\d+)[.)])\s`)
+	entryFootnoteRegex = regexp.MustCompile(`^\s*\[\^([^\]\s]+)\]:`)
+)
+
+// isBibliography reports whether a heading, numbered or not, is on the list of reference
+// section headings
+func isBibliography(references KeepList, title string) bool {
+	return references.Matches(sectionNumberRegex.ReplaceAllString(strings.TrimSpace(title), ""))
+}
+
+// FindCitations collects the citation keys of a text
+func FindCitations(text string) Citations {
+	cites := make(Citations)
+	for _, m := range numericCiteRegex.FindAllStringSubmatch(text, -1) {
+		for _, part := range strings.Split(m[1], ",") {
+			bounds := strings.FieldsFunc(part, func(r rune) bool { return r == '-' || r == '–' })
+			if len(bounds) == 0 {
+				continue
+			}
+			from, _ := strconv.Atoi(strings.TrimSpace(bounds[0]))
+			to, _ := strconv.Atoi(strings.TrimSpace(bounds[len(bounds)-1]))
+			for n := from; n <= to && n-from < 100; n++ {
+				cites["n:"+strconv.Itoa(n)] = true
+			}
+		}
+	}
+	for _, m := range footnoteCiteRegex.FindAllStringSubmatch(text, -1) {
+		cites["fn:"+strings.ToLower(m[1])] = true
+	}
+	// "(Smith, 2020; Jones et al. 2019)" names one source per part
+	for _, m := range authorYearRegex.FindAllStringSubmatch(text, -1) {
+		for _, part := range strings.Split(m[1], ";") {
+			if name, year := surnameRegex.FindString(part), yearRegex.FindString(part); name != "" && year != "" {
+				cites[authorYearKey(name, year)] = true
+			}
+		}
+	}
+	for _, m := range narrativeCiteRegex.FindAllStringSubmatch(text, -1) {
+		cites[authorYearKey(m[1], m[2])] = true
+	}
+	return cites
+}
+
+func authorYearKey(name, year string) string {
+	return "ay:" + strings.ToLower(name) + ":" + year
+}
+
+// entryKeys returns the keys a reference list entry can be cited by
+func entryKeys(entry string) []string {
+	var keys []string
+	if m := entryFootnoteRegex.FindStringSubmatch(entry); m != nil {
+		return []string{"fn:" + strings.ToLower(m[1])}
+	}
+	if m := entryNumberRegex.FindStringSubmatch(entry); m != nil {
+		keys = append(keys, "n:"+m[1]+m[2])
+		entry = entry[len(m[0]):]
+	}
+	entry = strings.TrimLeft(strings.TrimSpace(entry), "-*• ")
+	if name, year := surnameRegex.FindString(entry), yearRegex.FindString(entry); name != "" && year != "" &&
+		strings.HasPrefix(entry, name) {
+		keys = append(keys, authorYearKey(name, year))
+	}
+	return keys
+}
+
+// PruneReferences drops the entries of a reference list that source cites but output no longer
+// does. Entries that cannot be linked to a citation in source are kept, as are heading lines.
+// It returns the pruned list and the number of entries dropped.
+func PruneReferences(list string, source, output Citations) (string, int) {
+	var entries [][]string
+	for _, line := range strings.Split(list, "\n") {
+		switch {
+		case strings.TrimSpace(line) == "":
+			entries = append(entries, nil)
+		case len(entries) == 0 || entries[len(entries)-1] == nil || entryStartRegex.MatchString(line):
+			entries = append(entries, []string{line})
+		default:
+			entries[len(entries)-1] = append(entries[len(entries)-1], line)
+		}
+	}
+
+	var kept []string
+	dropped := 0
+	for _, entry := range entries {
+		if entry == nil {
+			if len(kept) > 0 && kept[len(kept)-1] != "" {
+				kept = append(kept, "")
+			}
+			continue
+		}
+		text := strings.Join(entry, "\n")
+		if cited(entryKeys(text), source) && !cited(entryKeys(text), output) {
+			dropped++
+			continue
+		}
+		kept = append(kept, text)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n")), dropped
+}
+
+func cited(keys []string, cites Citations) bool {
+	for _, key := range keys {
+		if cites[key] {
+			return true
+		}
+	}
+	return false
+}
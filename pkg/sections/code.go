@@ -0,0 +1,55 @@
+package sections
+
+import (
+	"regexp"
+	"strings"
+)
+
+var fenceRegex = regexp.MustCompile("^\\s*(```|~~~)")
+
+// extractCode replaces fenced code blocks and indented code blocks (lines indented by four
+// spaces or a tab after a blank line) with placeholders on their own line, so code is never
+// sent to the model. Indented lines with no blank line before them, including at the very start
+// of the text, are an indented paragraph rather than code. It returns the rewritten text and the blocks, numbered from 1.
+func extractCode(text string) (string, []string) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var out, blocks []string
+	addBlock := func(block []string) {
+		blocks = append(blocks, strings.Join(block, "\n"))
+		out = append(out, "", Placeholder(CodeKind, len(blocks)), "")
+	}
+
+	for i := 0; i < len(lines); i++ {
+		if m := fenceRegex.FindStringSubmatch(lines[i]); m != nil {
+			end := i + 1
+			for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), m[1]) {
+				end++
+			}
+			end = min(end, len(lines)-1) // an unclosed fence runs to the end
+			addBlock(lines[i : end+1])
+			i = end
+			continue
+		}
+		if isIndented(lines[i]) && strings.TrimSpace(lines[i]) != "" && i > 0 && strings.TrimSpace(lines[i-1]) == "" {
+			end := i
+			for end+1 < len(lines) && (isIndented(lines[end+1]) || strings.TrimSpace(lines[end+1]) == "") {
+				end++
+			}
+			for strings.TrimSpace(lines[end]) == "" {
+				end--
+			}
+			addBlock(lines[i : end+1])
+			i = end
+			continue
+		}
+		out = append(out, lines[i])
+	}
+	if len(blocks) == 0 {
+		return text, nil
+	}
+	return strings.Join(out, "\n"), blocks
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")
+}
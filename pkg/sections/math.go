@@ -0,0 +1,48 @@
+package sections
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	displayMathRegex = regexp.MustCompile(`(?s)\$\$.+?\$\$|\\\[.+?\\\]|\\begin\{(?:equation|align|gather|multline)\*?\}.+?\\end\{(?:equation|align|gather|multline)\*?\}`)
+	inlineMathRegex  = regexp.MustCompile(`\\\(.+?\\\)|\$[^\s$](?:[^$\n]*[^\s$\\])?\$`)
+)
+
+// extractMath replaces LaTeX math with placeholders: display math ($$...$$, \[...\] and
+// equation-like environments) on its own line, inline math (\(...\) and $...$) in place. A $
+// pair only counts as math when it hugs its content and the closing $ isn't followed by a
+// digit, so prices like "$5 and $10" are left alone.
+func extractMath(text string) (string, []string) {
+	var spans []string
+	replace := func(text string, re *regexp.Regexp, display bool) string {
+		var b strings.Builder
+		last := 0
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if !display && text[loc[0]] == '$' && loc[1] < len(text) && unicode.IsDigit(rune(text[loc[1]])) {
+				continue
+			}
+			spans = append(spans, text[loc[0]:loc[1]])
+			b.WriteString(text[last:loc[0]])
+			if display {
+				b.WriteString("\n\n" + Placeholder(MathKind, len(spans)) + "\n\n")
+			} else {
+				b.WriteString(Placeholder(MathKind, len(spans)))
+			}
+			last = loc[1]
+		}
+		b.WriteString(text[last:])
+		return b.String()
+	}
+
+	text = replace(text, displayMathRegex, true)
+	text = replace(text, inlineMathRegex, false)
+	return text, spans
+}
+
+// isDisplayMath reports whether a math span is set on its own line
+func isDisplayMath(span string) bool {
+	return strings.HasPrefix(span, "$$") || strings.HasPrefix(span, `\[`) || strings.HasPrefix(span, `\begin`)
+}
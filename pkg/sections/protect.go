@@ -0,0 +1,78 @@
+package sections
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Placeholder kinds
+const (
+	CodeKind = "CODE"
+	MathKind = "MATH"
+)
+
+var placeholderRegex = regexp.MustCompile(`(\s*)\[\[(CODE|MATH)_(\d+)\]\](\s*)`)
+
+// Placeholder is the text that stands in for protected span n of a kind in the prompt
+func Placeholder(kind string, n int) string { return fmt.Sprintf("[[%s_%d]]", kind, n) }
+
+// Protected holds the spans taken out of a text so they are never sent to the model: code
+// blocks and LaTeX math, numbered from 1 per kind
+type Protected struct {
+	Code []string
+	Math []string
+}
+
+// Protect replaces code blocks and then math in text with placeholders
+func Protect(text string) (string, Protected) {
+	var p Protected
+	text, p.Code = extractCode(text)
+	text, p.Math = extractMath(text)
+	return text, p
+}
+
+// Len returns the number of protected spans
+func (p Protected) Len() int { return len(p.Code) + len(p.Math) }
+
+// Restore puts the protected spans back in place of their placeholders. Code blocks and display
+// math go on their own lines; inline math stays in its sentence. Spans whose placeholder appears
+// in source but was dropped from output are appended, so nothing is lost.
+func (p Protected) Restore(output, source string) string {
+	if p.Len() == 0 {
+		return output
+	}
+	restored := make(map[string]bool)
+	span := func(kind, number string) (string, bool) {
+		n, _ := strconv.Atoi(number)
+		spans := p.Code
+		if kind == MathKind {
+			spans = p.Math
+		}
+		if n < 1 || n > len(spans) {
+			return "", false
+		}
+		return spans[n-1], true
+	}
+
+	output = placeholderRegex.ReplaceAllStringFunc(output, func(match string) string {
+		m := placeholderRegex.FindStringSubmatch(match)
+		text, ok := span(m[2], m[3])
+		if !ok {
+			return match
+		}
+		restored[m[2]+m[3]] = true
+		if m[2] == CodeKind || isDisplayMath(text) {
+			return "\n\n" + text + "\n\n"
+		}
+		return m[1] + text + m[4]
+	})
+	for _, m := range placeholderRegex.FindAllStringSubmatch(source, -1) {
+		if text, ok := span(m[2], m[3]); ok && !restored[m[2]+m[3]] {
+			output += "\n\n" + text
+			restored[m[2]+m[3]] = true
+		}
+	}
+	return strings.Trim(output, "\r\n") // spaces may be indentation of a code block
+}
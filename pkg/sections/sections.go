@@ -0,0 +1,255 @@
+// Package sections splits a document into the parts that are condensed and the parts that are
+// passed through verbatim.
+package sections
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// Segment kinds. Only prose is condensed; the others are passed through unchanged and left
+// out of the word budget.
+const (
+	Prose = ""
+	Kept  = "kept"  // a section on the keep list
+	Table = "table" // a markdown or column-aligned table
+	// References is a bibliography section or a block of footnote definitions
+	References = "references"
+	Caption    = "caption" // a figure or table caption such as "Figure 3: ..."
+)
+
+// Segment is a consecutive part of a document
+type Segment struct {
+	Text string
+	Kind string
+	// Heading is the heading of a kept or references section
+	Heading string
+}
+
+// Verbatim reports whether the segment is passed through unchanged
+func (s Segment) Verbatim() bool { return s.Kind != Prose }
+
+// KeepList matches the headings of sections that must not be condensed
+type KeepList []*regexp.Regexp
+
+// CompileKeepList compiles heading patterns. Each pattern is a case-insensitive regular
+// expression matched against the whole heading text, so a plain name like "Abstract" matches
+// that heading exactly.
+func CompileKeepList(patterns []string) (KeepList, error) {
+	var keep KeepList
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		// Compiled on its own first so errors refer to the pattern as written
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid keep pattern %q: %w", pattern, err)
+		}
+		keep = append(keep, regexp.MustCompile(`(?i)^(?:`+pattern+`)$`))
+	}
+	return keep, nil
+}
+
+// Matches reports whether a heading is on the keep list
+func (k KeepList) Matches(heading string) bool {
+	for _, re := range k {
+		if re.MatchString(heading) {
+			return true
+		}
+	}
+	return false
+}
+
+var markdownHeadingRegex = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// heading returns the title and level of a heading line. Markdown headings use their level;
+// a short standalone line without closing punctuation counts as a top-level heading.
+func heading(lines []string, i int) (string, int, bool) {
+	line := strings.TrimSpace(lines[i])
+	if m := markdownHeadingRegex.FindStringSubmatch(line); m != nil {
+		return m[2], len(m[1]), true
+	}
+	if line == "" || wordcount.Count(line) > 8 || strings.ContainsAny(line[len(line)-1:], ".,;:!?") ||
+		placeholderRegex.MatchString(line) || captionRegex.MatchString(line) {
+		return "", 0, false
+	}
+	blankBefore := i == 0 || strings.TrimSpace(lines[i-1]) == ""
+	blankAfter := i == len(lines)-1 || strings.TrimSpace(lines[i+1]) == ""
+	if !blankBefore || !blankAfter {
+		return "", 0, false
+	}
+	return strings.TrimRight(line, " :"), 1, true
+}
+
+var (
+	pipeRowRegex = regexp.MustCompile(`^\s*\|.*\|\s*$`)
+	// pipeDelimiterRegex matches the row under a markdown table's header, such as |---|:--:|
+	pipeDelimiterRegex = regexp.MustCompile(`^\s*\|(?:\s*:?-+:?\s*\|)+\s*$`)
+	columnGapRegex     = regexp.MustCompile(`\S(?: {2,}|\t+)\S`)
+	// columnRuleRegex matches the dashed rule under a column-aligned table's header, one run of
+	// dashes per column
+	columnRuleRegex = regexp.MustCompile(`^\s*-{2,}(?:[ \t]+-{2,}){2,}\s*$`)
+)
+
+// tableRows returns the number of table rows starting at line i. A table needs a delimiter row
+// under its header: markdown pipe rows with a |---|---| row second, or lines of at least three
+// columns separated by runs of spaces or tabs with a rule of dashes second and at least one row
+// after it. Text that merely lines up is not a table.
+func tableRows(lines []string, i int) int {
+	if i+1 >= len(lines) {
+		return 0
+	}
+	n := 2
+	if pipeRowRegex.MatchString(lines[i]) && pipeDelimiterRegex.MatchString(lines[i+1]) {
+		for i+n < len(lines) && pipeRowRegex.MatchString(lines[i+n]) {
+			n++
+		}
+		return n
+	}
+	if len(columnGapRegex.FindAllString(lines[i], -1)) < 2 || !columnRuleRegex.MatchString(lines[i+1]) {
+		return 0
+	}
+	for i+n < len(lines) && len(columnGapRegex.FindAllString(lines[i+n], -1)) >= 2 {
+		n++
+	}
+	if n >= 3 {
+		return n
+	}
+	return 0
+}
+
+var captionRegex = regexp.MustCompile(`^(?:Figure|Fig\.|Table|Chart|Exhibit|Plate|Diagram)\s+[A-Z]?\d+[a-z]?(?:\.\d+)*\s*[:.—–-]\s*\S`)
+
+// maxCaptionWords bounds a caption wrapped over several lines; past it only the first line
+// is taken as the caption
+const maxCaptionWords = 80
+
+// captionLines returns the number of caption lines starting at line i. Extracted captions
+// often sit inside a paragraph, so a caption wrapped over several lines ends at the first line
+// ending a sentence, or at a blank line.
+func captionLines(lines []string, i int) int {
+	if !captionRegex.MatchString(strings.TrimSpace(lines[i])) {
+		return 0
+	}
+	n, words := 0, 0
+	for i+n < len(lines) {
+		line := strings.TrimSpace(lines[i+n])
+		if line == "" {
+			break
+		}
+		words += wordcount.Count(line)
+		n++
+		if strings.ContainsAny(line[len(line)-1:], ".!?") {
+			break
+		}
+	}
+	if words > maxCaptionWords {
+		return 1
+	}
+	return n
+}
+
+// Split cuts text into segments. A section whose heading is on the keep list, up to the next
+// heading of the same or a higher level, becomes one kept segment including its heading; a
+// section whose heading is on the references list ("References", "Notes", ...) becomes a
+// references segment the same way. Tables, figure captions and blocks of footnote definitions
+// outside those sections become segments of their own.
+func Split(text string, keep, references KeepList) []Segment {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var segments []Segment
+	var current []string
+	currentKind, currentHeading, keptLevel := Prose, "", 0
+
+	flush := func() {
+		segmentText := strings.TrimSpace(strings.Join(current, "\n"))
+		if segmentText != "" {
+			segments = append(segments, Segment{Text: segmentText, Kind: currentKind, Heading: currentHeading})
+		}
+		current = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		if title, level, ok := heading(lines, i); ok {
+			if currentKind != Prose && level <= keptLevel {
+				flush()
+				currentKind, currentHeading = Prose, ""
+			}
+			if currentKind == Prose && keep.Matches(title) {
+				flush()
+				currentKind, currentHeading, keptLevel = Kept, title, level
+			} else if currentKind == Prose && isBibliography(references, title) {
+				flush()
+				currentKind, currentHeading, keptLevel = References, title, level
+			}
+		}
+		if currentKind == Prose {
+			if rows := tableRows(lines, i); rows > 0 {
+				flush()
+				current, currentKind = lines[i:i+rows], Table
+				flush()
+				currentKind = Prose
+				i += rows - 1
+				continue
+			}
+			if n := captionLines(lines, i); n > 0 {
+				flush()
+				current, currentKind = lines[i:i+n], Caption
+				flush()
+				currentKind = Prose
+				i += n - 1
+				continue
+			}
+			if footnoteDefinitionRegex.MatchString(lines[i]) {
+				flush()
+				for ; i < len(lines) && (footnoteDefinitionRegex.MatchString(lines[i]) || strings.HasPrefix(lines[i], "    ")); i++ {
+					current = append(current, lines[i])
+				}
+				currentKind = References
+				flush()
+				currentKind = Prose
+				i--
+				continue
+			}
+		}
+		current = append(current, lines[i])
+	}
+	flush()
+	return segments
+}
+
+// Section is a heading with the text up to the next heading
+type Section struct {
+	Title string
+	Level int
+	Text  string
+}
+
+// Sections cuts text at every heading. Text before the first heading becomes a section without
+// a title; a document without headings is one untitled section.
+func Sections(text string) []Section {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var sections []Section
+	current := Section{Level: 1}
+	var body []string
+	flush := func() {
+		current.Text = strings.TrimSpace(strings.Join(body, "\n"))
+		if current.Title != "" || current.Text != "" {
+			sections = append(sections, current)
+		}
+		body = nil
+	}
+	for i := range lines {
+		if title, level, ok := heading(lines, i); ok {
+			flush()
+			current = Section{Title: title, Level: level}
+			continue
+		}
+		body = append(body, lines[i])
+	}
+	flush()
+	return sections
+}
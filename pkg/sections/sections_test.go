@@ -0,0 +1,166 @@
+package sections
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSections(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Section
+	}{
+		{
+			name: "no headings",
+			text: "One paragraph.\n\nAnother paragraph.",
+			want: []Section{{Level: 1, Text: "One paragraph.\n\nAnother paragraph."}},
+		},
+		{
+			name: "markdown headings",
+			text: "# Intro\nHello.\n## Detail\nMore.",
+			want: []Section{{Title: "Intro", Level: 1, Text: "Hello."}, {Title: "Detail", Level: 2, Text: "More."}},
+		},
+		{
+			name: "text before the first heading",
+			text: "Preamble.\n# Body\nText.",
+			want: []Section{{Level: 1, Text: "Preamble."}, {Title: "Body", Level: 1, Text: "Text."}},
+		},
+		{
+			name: "closing hashes dropped",
+			text: "## Title ##\nText.",
+			want: []Section{{Title: "Title", Level: 2, Text: "Text."}},
+		},
+		{
+			name: "standalone short line",
+			text: "Background\n\nThe text of the section.",
+			want: []Section{{Title: "Background", Level: 1, Text: "The text of the section."}},
+		},
+		{
+			name: "short line inside a paragraph",
+			text: "First line\nsecond line of the same paragraph.",
+			want: []Section{{Level: 1, Text: "First line\nsecond line of the same paragraph."}},
+		},
+		{
+			name: "short sentence isn't a heading",
+			text: "Thanks.\n\nThe rest.",
+			want: []Section{{Level: 1, Text: "Thanks.\n\nThe rest."}},
+		},
+		{
+			name: "heading without text",
+			text: "# Part\n## Chapter\nText.",
+			want: []Section{{Title: "Part", Level: 1}, {Title: "Chapter", Level: 2, Text: "Text."}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sections(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Sections(%q)\n got %+v\nwant %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	keep, err := CompileKeepList([]string{"Abstract"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	references, err := CompileKeepList([]string{"References"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		text string
+		want []Segment
+	}{
+		{
+			name: "prose only",
+			text: "Just prose.",
+			want: []Segment{{Text: "Just prose."}},
+		},
+		{
+			name: "kept section up to the next heading of its level",
+			text: "# Abstract\nKeep this.\n## Note\nAnd this.\n# Body\nCondense this.",
+			want: []Segment{
+				{Text: "# Abstract\nKeep this.\n## Note\nAnd this.", Kind: Kept, Heading: "Abstract"},
+				{Text: "# Body\nCondense this.", Kind: Prose},
+			},
+		},
+		{
+			name: "numbered references heading",
+			text: "# Body\nText.\n# 5 References\n[1] A paper.",
+			want: []Segment{
+				{Text: "# Body\nText.", Kind: Prose},
+				{Text: "# 5 References\n[1] A paper.", Kind: References, Heading: "5 References"},
+			},
+		},
+		{
+			name: "pipe table",
+			text: "Before.\n| a | b |\n|---|---|\n| 1 | 2 |\nAfter.",
+			want: []Segment{
+				{Text: "Before."},
+				{Text: "| a | b |\n|---|---|\n| 1 | 2 |", Kind: Table},
+				{Text: "After."},
+			},
+		},
+		{
+			name: "aligned lines without a rule aren't a table",
+			text: "Name    Age    City\nAnn     31     Oslo",
+			want: []Segment{{Text: "Name    Age    City\nAnn     31     Oslo"}},
+		},
+		{
+			name: "caption wrapped over two lines",
+			text: "Text.\nFigure 2: Growth of the\nmarket by year.\nMore text.",
+			want: []Segment{
+				{Text: "Text."},
+				{Text: "Figure 2: Growth of the\nmarket by year.", Kind: Caption},
+				{Text: "More text."},
+			},
+		},
+		{
+			name: "footnote definitions",
+			text: "Text.[^1]\n\n[^1]: The note.\n    Continued.",
+			want: []Segment{
+				{Text: "Text.[^1]"},
+				{Text: "[^1]: The note.\n    Continued.", Kind: References},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Split(tt.text, keep, references); !slices.Equal(got, tt.want) {
+				t.Errorf("Split(%q)\n got %+v\nwant %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileKeepList(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		heading  string
+		want     bool
+		wantErr  bool
+	}{
+		{name: "exact name", patterns: []string{"Abstract"}, heading: "Abstract", want: true},
+		{name: "case-insensitive", patterns: []string{"abstract"}, heading: "ABSTRACT", want: true},
+		{name: "whole heading only", patterns: []string{"Abstract"}, heading: "Abstract thoughts"},
+		{name: "regular expression", patterns: []string{"Appendix [A-Z]"}, heading: "Appendix B", want: true},
+		{name: "blank patterns skipped", patterns: []string{" ", ""}, heading: "Abstract"},
+		{name: "invalid pattern", patterns: []string{"(unclosed"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, err := CompileKeepList(tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CompileKeepList(%q) error = %v, want error %t", tt.patterns, err, tt.wantErr)
+			}
+			if got := keep.Matches(tt.heading); got != tt.want {
+				t.Errorf("Matches(%q) = %t, want %t", tt.heading, got, tt.want)
+			}
+		})
+	}
+}
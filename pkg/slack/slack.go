@@ -0,0 +1,215 @@
+// Package slack verifies Slack request signatures and talks to the Slack Web API.
+package slack
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/httpclient"
+)
+
+// DefaultBaseURL is the Slack Web API root
+const DefaultBaseURL = "https://slack.com/api"
+
+// MaxMessageLength is the longest text posted in a single message; Slack truncates beyond 40k characters
+const MaxMessageLength = 39000
+
+// maxSignatureAge rejects replayed requests, as recommended by Slack
+const maxSignatureAge = 5 * time.Minute
+
+// maxDownloadSize caps shared files fetched from Slack
+const maxDownloadSize = 10 << 20 // 10 MB
+
+// Verify checks the X-Slack-Signature of a request body against the signing secret
+func Verify(signingSecret, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid request timestamp '%s'", timestamp)
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return fmt.Errorf("request timestamp too old (%v)", age)
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// Client calls the Slack Web API with a bot token
+type Client struct {
+	Token      string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// New returns a Client; an empty baseURL uses DefaultBaseURL and a nil httpClient uses a 30s timeout client
+func New(token, baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if httpClient == nil {
+		httpClient = httpclient.New(30 * time.Second)
+	}
+	return &Client{Token: token, BaseURL: baseURL, HTTPClient: httpClient}
+}
+
+// File is the subset of a files.info response used to fetch and reply to a shared file
+type File struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Filetype           string `json:"filetype"`
+	Size               int64  `json:"size"`
+	URLPrivateDownload string `json:"url_private_download"`
+	Shares             struct {
+		Public  map[string][]Share `json:"public"`
+		Private map[string][]Share `json:"private"`
+	} `json:"shares"`
+}
+
+// Share is one posting of a file in a channel
+type Share struct {
+	TS string `json:"ts"`
+}
+
+// ThreadTS returns the timestamp of the message that shared the file in channel, if known
+func (f *File) ThreadTS(channel string) string {
+	for _, shares := range []map[string][]Share{f.Shares.Public, f.Shares.Private} {
+		if list := shares[channel]; len(list) > 0 {
+			return list[0].TS
+		}
+	}
+	return ""
+}
+
+// FileInfo looks up a shared file
+func (c *Client) FileInfo(ctx context.Context, fileID string) (*File, error) {
+	var resp struct {
+		File File `json:"file"`
+	}
+	if err := c.call(ctx, "files.info", url.Values{"file": {fileID}}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.File, nil
+}
+
+// Download fetches the content of a private file URL
+func (c *Client) Download(ctx context.Context, fileURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	if len(data) > maxDownloadSize {
+		return nil, fmt.Errorf("file exceeds %d bytes", maxDownloadSize)
+	}
+	return data, nil
+}
+
+// PostMessage posts text to a channel, in a thread when threadTS is set
+func (c *Client) PostMessage(ctx context.Context, channel, threadTS, text string) error {
+	params := url.Values{"channel": {channel}, "text": {Truncate(text)}}
+	if threadTS != "" {
+		params.Set("thread_ts", threadTS)
+	}
+	return c.call(ctx, "chat.postMessage", params, nil)
+}
+
+// Respond posts a slash command reply to its response_url. inChannel makes it visible to everyone.
+func (c *Client) Respond(ctx context.Context, responseURL, text string, inChannel bool) error {
+	responseType := "ephemeral"
+	if inChannel {
+		responseType = "in_channel"
+	}
+	body, _ := json.Marshal(map[string]string{"response_type": responseType, "text": Truncate(text)})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", responseURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("response_url request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("response_url returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Truncate shortens text to MaxMessageLength characters
+func Truncate(text string) string {
+	runes := []rune(text)
+	if len(runes) <= MaxMessageLength {
+		return text
+	}
+	return string(runes[:MaxMessageLength]) + "\n… (truncated)"
+}
+
+// call POSTs a form-encoded Web API method and decodes the response into out
+func (c *Client) call(ctx context.Context, method string, params url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/"+method, bytes.NewBufferString(params.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", method, err)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("invalid %s response (status %d): %w", method, resp.StatusCode, err)
+	}
+	if !status.OK {
+		return fmt.Errorf("%s failed: %s", method, status.Error)
+	}
+	if out != nil {
+		if err := json.Unmarshal(body, out); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", method, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+// Package store keeps uploaded source documents on disk addressed by their content hash,
+// along with the results produced for each parameter set.
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+var hashRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// DocumentStore is a content-addressable store rooted at a directory:
+//
+//	<dir>/sources/<sha256>.txt
+//	<dir>/results/<sha256>/<settings key>.<ext>
+//	<dir>/results/<sha256>/<settings key>.settings.json
+//	<dir>/results/<sha256>/<settings key>.chunks.json
+type DocumentStore struct {
+	dir string
+}
+
+// ResultVersion describes one stored result of a document
+type ResultVersion struct {
+	Key       string          `json:"key"`
+	File      string          `json:"file"`
+	Size      int64           `json:"size"`
+	CreatedAt time.Time       `json:"created_at"`
+	Settings  json.RawMessage `json:"settings"`
+}
+
+// NewDocumentStore creates the store directories under dir
+func NewDocumentStore(dir string) (*DocumentStore, error) {
+	for _, sub := range []string{"sources", "results"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed create store dir: %w", err)
+		}
+	}
+	return &DocumentStore{dir: dir}, nil
+}
+
+// Hash returns the content hash used to address a document
+func Hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Put stores a source document and returns its hash. Storing the same text twice only
+// refreshes its modification time, which retention is counted from.
+func (s *DocumentStore) Put(text string) (string, error) {
+	hash := Hash(text)
+	path := s.sourcePath(hash)
+	if _, err := os.Stat(path); err == nil {
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return hash, nil
+	}
+	if err := writeFileAtomic(path, []byte(text)); err != nil {
+		return "", fmt.Errorf("failed store document: %w", err)
+	}
+	log.Printf("Stored document %s (%d bytes)", hash[:12], len(text))
+	return hash, nil
+}
+
+// Get loads a source document by hash
+func (s *DocumentStore) Get(hash string) (string, error) {
+	if !hashRegex.MatchString(hash) {
+		return "", fmt.Errorf("invalid document hash %q", hash)
+	}
+	data, err := os.ReadFile(s.sourcePath(hash))
+	if err != nil {
+		return "", fmt.Errorf("document %s not found: %w", hash, err)
+	}
+	return string(data), nil
+}
+
+// SettingsKey derives a stable key for a parameter set from its JSON form
+func SettingsKey(settings any) (string, []byte, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed marshal settings: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), data, nil
+}
+
+// PutResult stores a result for a document under the key of its settings, replacing any
+// previous result for the same parameter set
+func (s *DocumentStore) PutResult(hash string, settings any, ext string, data []byte) (string, error) {
+	rw, err := s.CreateResult(hash, settings, ext)
+	if err != nil {
+		return "", err
+	}
+	if _, err := rw.Write(data); err != nil {
+		rw.Abort()
+		return "", fmt.Errorf("failed store result: %w", err)
+	}
+	return rw.Key, rw.Commit()
+}
+
+// ResultWriter writes a result incrementally. Readers only see it once Commit renames it into place.
+type ResultWriter struct {
+	Key  string
+	hash string
+	path string
+	file *os.File
+	size int64
+}
+
+// CreateResult starts writing a result for a document, like PutResult for output that is
+// produced in pieces. The caller must Commit or Abort the writer.
+func (s *DocumentStore) CreateResult(hash string, settings any, ext string) (*ResultWriter, error) {
+	key, settingsJSON, err := SettingsKey(settings)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(s.dir, "results", hash)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed create result dir: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, key+".settings.json"), settingsJSON); err != nil {
+		return nil, fmt.Errorf("failed store result settings: %w", err)
+	}
+	path := filepath.Join(dir, key+"."+ext)
+	file, err := createTemp(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed create result: %w", err)
+	}
+	return &ResultWriter{Key: key, hash: hash, path: path, file: file}, nil
+}
+
+func (rw *ResultWriter) Write(p []byte) (int, error) {
+	n, err := rw.file.Write(p)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Commit finishes the result and makes it visible
+func (rw *ResultWriter) Commit() error {
+	if err := rw.file.Close(); err != nil {
+		os.Remove(rw.file.Name())
+		return fmt.Errorf("failed store result: %w", err)
+	}
+	if err := os.Rename(rw.file.Name(), rw.path); err != nil {
+		os.Remove(rw.file.Name())
+		return fmt.Errorf("failed store result: %w", err)
+	}
+	log.Printf("Stored result %s for document %s (%d bytes)", rw.Key, rw.hash[:12], rw.size)
+	return nil
+}
+
+// Abort discards a partially written result
+func (rw *ResultWriter) Abort() {
+	rw.file.Close()
+	os.Remove(rw.file.Name())
+}
+
+// Results lists the stored result versions of a document, newest first
+func (s *DocumentStore) Results(hash string) ([]ResultVersion, error) {
+	if !hashRegex.MatchString(hash) {
+		return nil, fmt.Errorf("invalid document hash %q", hash)
+	}
+	dir := filepath.Join(s.dir, "results", hash)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed list results: %w", err)
+	}
+
+	var versions []ResultVersion
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".settings.json") || strings.HasSuffix(name, chunksSuffix) || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		key := strings.TrimSuffix(name, filepath.Ext(name))
+		settings, _ := os.ReadFile(filepath.Join(dir, key+".settings.json"))
+		versions = append(versions, ResultVersion{
+			Key:       key,
+			File:      name,
+			Size:      info.Size(),
+			CreatedAt: info.ModTime(),
+			Settings:  settings,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].CreatedAt.After(versions[j].CreatedAt) })
+	return versions, nil
+}
+
+// ResultPath returns the path of a stored result file, or "" if it doesn't exist
+func (s *DocumentStore) ResultPath(hash, file string) string {
+	if !hashRegex.MatchString(hash) || file != filepath.Base(file) {
+		return ""
+	}
+	path := filepath.Join(s.dir, "results", hash, file)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// chunksSuffix ends the file holding the chunk outputs of a result
+const chunksSuffix = ".chunks.json"
+
+// PutChunks stores the outputs of the chunks a result was made from, for condensing a revision of
+// the document with the same settings
+func (s *DocumentStore) PutChunks(hash string, settings any, data []byte) error {
+	key, _, err := SettingsKey(settings)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(s.dir, "results", hash)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed create result dir: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, key+chunksSuffix), data); err != nil {
+		return fmt.Errorf("failed store chunk outputs: %w", err)
+	}
+	return nil
+}
+
+// Chunks loads the chunk outputs stored by PutChunks for a document and settings
+func (s *DocumentStore) Chunks(hash string, settings any) ([]byte, error) {
+	if !hashRegex.MatchString(hash) {
+		return nil, fmt.Errorf("invalid document hash %q", hash)
+	}
+	key, _, err := SettingsKey(settings)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, "results", hash, key+chunksSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("no chunk outputs for document %s: %w", hash, err)
+	}
+	return data, nil
+}
+
+// ExpireStats counts what one Expire pass deleted
+type ExpireStats struct {
+	Files int
+	Bytes int64
+}
+
+// Expire deletes results and leftover temp files last modified before cutoff, then the sources
+// that are older than cutoff and have no results left
+func (s *DocumentStore) Expire(cutoff time.Time) (ExpireStats, error) {
+	var stats ExpireStats
+	remove := func(path string, info os.FileInfo) {
+		if err := os.Remove(path); err != nil {
+			logging.Warnf("Failed to delete expired %s: %v", path, err)
+			return
+		}
+		stats.Files++
+		stats.Bytes += info.Size()
+	}
+
+	resultsDir := filepath.Join(s.dir, "results")
+	docs, err := os.ReadDir(resultsDir)
+	if err != nil {
+		return stats, fmt.Errorf("failed list results: %w", err)
+	}
+	for _, doc := range docs {
+		dir := filepath.Join(resultsDir, doc.Name())
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			info, err := entry.Info()
+			if err != nil || strings.HasSuffix(name, ".settings.json") || !info.ModTime().Before(cutoff) {
+				continue
+			}
+			remove(filepath.Join(dir, name), info)
+			if !strings.HasSuffix(name, ".tmp") {
+				key := strings.TrimSuffix(name, filepath.Ext(name))
+				settingsPath := filepath.Join(dir, key+".settings.json")
+				if settingsInfo, err := os.Stat(settingsPath); err == nil {
+					remove(settingsPath, settingsInfo)
+				}
+			}
+		}
+		// Fails while results remain
+		os.Remove(dir)
+	}
+
+	sources, err := os.ReadDir(filepath.Join(s.dir, "sources"))
+	if err != nil {
+		return stats, fmt.Errorf("failed list sources: %w", err)
+	}
+	for _, entry := range sources {
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		hash := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if _, err := os.Stat(filepath.Join(resultsDir, hash)); err == nil {
+			continue
+		}
+		remove(filepath.Join(s.dir, "sources", entry.Name()), info)
+	}
+	return stats, nil
+}
+
+func (s *DocumentStore) sourcePath(hash string) string {
+	return filepath.Join(s.dir, "sources", hash+".txt")
+}
+
+// writeFileAtomic writes through a temp file and rename so readers never see partial files.
+// Each write gets its own temp file, so concurrent writers of one path don't interleave.
+func writeFileAtomic(path string, data []byte) error {
+	file, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// createTemp creates a uniquely named temp file for path in its directory, ending in ".tmp" so
+// listings skip it and Expire removes it when left behind
+func createTemp(path string) (*os.File, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,281 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// Errors of UploadStore operations
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadBusy       = errors.New("upload is being written by another request")
+	ErrOffsetMismatch   = errors.New("offset does not match the bytes received")
+	ErrUploadIncomplete = errors.New("upload is incomplete")
+	ErrUploadLimit      = errors.New("too many uploads in progress")
+	ErrUploadSpace      = errors.New("upload storage is full")
+)
+
+var uploadIDRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Upload is a file being uploaded in pieces. Offset is how many of its Length bytes have arrived.
+type Upload struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	// Owner identifies the API key and tenant that started the upload; nobody else can see it
+	Owner string `json:"owner"`
+}
+
+// Complete reports whether every byte of the upload has arrived
+func (u Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// UploadStore keeps resumable uploads on disk, so they survive dropped connections and
+// restarts:
+//
+//	<dir>/<id>.json  the Upload record
+//	<dir>/<id>.part  the bytes received so far
+//
+// It is safe for concurrent use; one request at a time may append to or delete an upload.
+type UploadStore struct {
+	dir     string
+	maxSize int64
+	// MaxPerOwner caps the uploads one owner holds and MaxTotal the declared bytes of all
+	// uploads together; 0 is no limit
+	MaxPerOwner int
+	MaxTotal    int64
+
+	mu      sync.Mutex
+	writing map[string]bool
+}
+
+// NewUploadStore creates dir and returns a store for uploads of at most maxSize bytes
+func NewUploadStore(dir string, maxSize int64) (*UploadStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed create upload dir: %w", err)
+	}
+	return &UploadStore{dir: dir, maxSize: maxSize, writing: make(map[string]bool)}, nil
+}
+
+// lock claims an upload for one writer, or reports that another holds it
+func (s *UploadStore) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writing[id] {
+		return false
+	}
+	s.writing[id] = true
+	return true
+}
+
+func (s *UploadStore) unlock(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.writing, id)
+}
+
+// MaxSize is the largest upload the store accepts, in bytes
+func (s *UploadStore) MaxSize() int64 {
+	return s.maxSize
+}
+
+// Create starts an upload of length bytes for owner, within the store's limits
+func (s *UploadStore) Create(filename string, length int64, owner string) (Upload, error) {
+	if length < 0 || length > s.maxSize {
+		return Upload{}, fmt.Errorf("upload length must be between 0 and %d bytes", s.maxSize)
+	}
+	// Uploads are created one at a time so two can't both fit the last of a quota
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.MaxPerOwner > 0 || s.MaxTotal > 0 {
+		uploads, err := s.list()
+		if err != nil {
+			return Upload{}, err
+		}
+		owned, total := 0, length
+		for _, upload := range uploads {
+			if upload.Owner == owner {
+				owned++
+			}
+			total += upload.Length
+		}
+		if s.MaxPerOwner > 0 && owned >= s.MaxPerOwner {
+			return Upload{}, ErrUploadLimit
+		}
+		if s.MaxTotal > 0 && total > s.MaxTotal {
+			return Upload{}, ErrUploadSpace
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return Upload{}, err
+	}
+	upload := Upload{ID: hex.EncodeToString(b), Filename: filename, Length: length, CreatedAt: time.Now().UTC(), Owner: owner}
+	record, err := json.Marshal(upload)
+	if err != nil {
+		return Upload{}, err
+	}
+	if err := os.WriteFile(s.path(upload.ID, ".part"), nil, 0o644); err != nil {
+		return Upload{}, fmt.Errorf("failed create upload: %w", err)
+	}
+	if err := writeFileAtomic(s.path(upload.ID, ".json"), record); err != nil {
+		os.Remove(s.path(upload.ID, ".part"))
+		return Upload{}, fmt.Errorf("failed create upload: %w", err)
+	}
+	log.Printf("Upload %s created: '%s' (%d bytes)", upload.ID, filename, length)
+	return upload, nil
+}
+
+// Get returns an upload of owner with the number of bytes received so far. Uploads of other
+// owners are not found.
+func (s *UploadStore) Get(id, owner string) (Upload, error) {
+	upload, err := s.get(id)
+	if err == nil && upload.Owner != owner {
+		return Upload{}, ErrUploadNotFound
+	}
+	return upload, err
+}
+
+func (s *UploadStore) get(id string) (Upload, error) {
+	if !uploadIDRegex.MatchString(id) {
+		return Upload{}, ErrUploadNotFound
+	}
+	record, err := os.ReadFile(s.path(id, ".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Upload{}, ErrUploadNotFound
+	} else if err != nil {
+		return Upload{}, err
+	}
+	var upload Upload
+	if err := json.Unmarshal(record, &upload); err != nil {
+		return Upload{}, fmt.Errorf("failed decode upload %s: %w", id, err)
+	}
+	info, err := os.Stat(s.path(id, ".part"))
+	if err != nil {
+		return Upload{}, ErrUploadNotFound
+	}
+	upload.Offset = info.Size()
+	return upload, nil
+}
+
+// Append writes the next piece of an upload of owner, which must start at offset, the number of
+// bytes received so far. Bytes past the upload's length are ignored. Whatever arrives before body
+// fails is kept, so the client can resume from the returned offset.
+func (s *UploadStore) Append(id, owner string, offset int64, body io.Reader) (Upload, error) {
+	if !s.lock(id) {
+		return Upload{}, ErrUploadBusy
+	}
+	defer s.unlock(id)
+
+	upload, err := s.Get(id, owner)
+	if err != nil {
+		return Upload{}, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+	file, err := os.OpenFile(s.path(id, ".part"), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return upload, err
+	}
+	written, copyErr := io.Copy(file, io.LimitReader(body, upload.Length-upload.Offset))
+	closeErr := file.Close()
+	upload.Offset += written
+	return upload, errors.Join(copyErr, closeErr)
+}
+
+// Read returns a complete upload of owner and its bytes
+func (s *UploadStore) Read(id, owner string) (Upload, []byte, error) {
+	upload, err := s.Get(id, owner)
+	if err != nil {
+		return Upload{}, nil, err
+	}
+	if !upload.Complete() {
+		return upload, nil, ErrUploadIncomplete
+	}
+	data, err := os.ReadFile(s.path(id, ".part"))
+	return upload, data, err
+}
+
+// Delete removes an upload of owner and the bytes received
+func (s *UploadStore) Delete(id, owner string) error {
+	if _, err := s.Get(id, owner); err != nil {
+		return err
+	}
+	if !s.lock(id) {
+		return ErrUploadBusy
+	}
+	defer s.unlock(id)
+	return s.remove(id)
+}
+
+func (s *UploadStore) remove(id string) error {
+	if err := os.Remove(s.path(id, ".part")); err != nil {
+		return err
+	}
+	return os.Remove(s.path(id, ".json"))
+}
+
+// Expire deletes the uploads created before cutoff, complete or not, and returns how many. An
+// upload being written is left for the next run.
+func (s *UploadStore) Expire(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	uploads, err := s.list()
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, upload := range uploads {
+		if !upload.CreatedAt.Before(cutoff) || !s.lock(upload.ID) {
+			continue
+		}
+		err := s.remove(upload.ID)
+		s.unlock(upload.ID)
+		if err != nil {
+			logging.Warnf("Failed to delete expired upload %s: %v", upload.ID, err)
+			continue
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// list returns every upload in the store
+func (s *UploadStore) list() ([]Upload, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed list uploads: %w", err)
+	}
+	var uploads []Upload
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if upload, err := s.get(id); err == nil {
+			uploads = append(uploads, upload)
+		}
+	}
+	return uploads, nil
+}
+
+func (s *UploadStore) path(id, ext string) string {
+	return filepath.Join(s.dir, id+ext)
+}
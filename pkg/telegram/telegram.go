@@ -0,0 +1,195 @@
+// Package telegram is a minimal Telegram Bot API client for long-polling bots.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/httpclient"
+)
+
+// DefaultBaseURL is the Bot API root
+const DefaultBaseURL = "https://api.telegram.org"
+
+// maxMessageLength is kept below Telegram's 4096 character limit for a single message
+const maxMessageLength = 4000
+
+// maxDownloadSize caps documents fetched from Telegram
+const maxDownloadSize = 10 << 20 // 10 MB
+
+// Client calls the Bot API for one bot token
+type Client struct {
+	Token      string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// New returns a Client; an empty baseURL uses DefaultBaseURL and a nil httpClient uses a
+// client whose timeout leaves room for long-polling
+func New(token, baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if httpClient == nil {
+		httpClient = httpclient.New(90 * time.Second)
+	}
+	return &Client{Token: token, BaseURL: strings.TrimRight(baseURL, "/"), HTTPClient: httpClient}
+}
+
+// Update is one incoming update; only messages are handled
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message"`
+}
+
+// Message is the subset of a Telegram message used by the bot
+type Message struct {
+	MessageID int64     `json:"message_id"`
+	Chat      Chat      `json:"chat"`
+	Text      string    `json:"text"`
+	Caption   string    `json:"caption"`
+	Document  *Document `json:"document"`
+}
+
+// Chat identifies the conversation to reply to
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// Document is a file sent to the bot
+type Document struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	FileSize int64  `json:"file_size"`
+}
+
+// GetUpdates long-polls for updates after offset, waiting up to timeout
+func (c *Client) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	var updates []Update
+	params := map[string]any{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}
+	if err := c.call(ctx, "getUpdates", params, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// SendMessage replies in a chat, splitting long text over several messages
+func (c *Client) SendMessage(ctx context.Context, chatID, replyTo int64, text string) error {
+	for _, part := range splitMessage(text) {
+		params := map[string]any{"chat_id": chatID, "text": part}
+		if replyTo != 0 {
+			params["reply_parameters"] = map[string]any{"message_id": replyTo, "allow_sending_without_reply": true}
+		}
+		if err := c.call(ctx, "sendMessage", params, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Download fetches the content of a document sent to the bot
+func (c *Client) Download(ctx context.Context, fileID string) ([]byte, error) {
+	var file struct {
+		FilePath string `json:"file_path"`
+	}
+	if err := c.call(ctx, "getFile", map[string]any{"file_id": fileID}, &file); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/file/bot%s/%s", c.BaseURL, c.Token, file.FilePath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed create request: %w", err)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %s", c.redact(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	if len(data) > maxDownloadSize {
+		return nil, fmt.Errorf("file exceeds %d bytes", maxDownloadSize)
+	}
+	return data, nil
+}
+
+// call POSTs a JSON Bot API method and decodes its result into out
+func (c *Client) call(ctx context.Context, method string, params any, out any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed marshal %s params: %w", method, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/bot%s/%s", c.BaseURL, c.Token, method), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %s", method, c.redact(err))
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid %s response (status %d): %w", method, resp.StatusCode, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("%s failed: %s", method, result.Description)
+	}
+	if out != nil {
+		if err := json.Unmarshal(result.Result, out); err != nil {
+			return fmt.Errorf("failed to decode %s result: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// redact removes the bot token, which is part of every request URL, from transport errors
+func (c *Client) redact(err error) string {
+	return strings.ReplaceAll(err.Error(), c.Token, "[REDACTED]")
+}
+
+// splitMessage breaks text into message-sized parts, preferring paragraph and line boundaries
+func splitMessage(text string) []string {
+	var parts []string
+	runes := []rune(text)
+	for len(runes) > maxMessageLength {
+		cut := maxMessageLength
+		window := string(runes[:maxMessageLength])
+		for _, sep := range []string{"\n\n", "\n"} {
+			if i := strings.LastIndex(window, sep); i >= 0 && len([]rune(window[:i])) > maxMessageLength/2 {
+				cut = len([]rune(window[:i]))
+				break
+			}
+		}
+		parts = append(parts, strings.TrimSpace(string(runes[:cut])))
+		runes = runes[cut:]
+	}
+	if rest := strings.TrimSpace(string(runes)); rest != "" || len(parts) == 0 {
+		parts = append(parts, rest)
+	}
+	return parts
+}
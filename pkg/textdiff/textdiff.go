@@ -0,0 +1,103 @@
+// Package textdiff computes a sentence-level diff between two texts, for comparing the outputs
+// of two processing runs.
+package textdiff
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Operation kinds
+const (
+	Equal  = "equal"
+	Delete = "delete" // only in the first text
+	Insert = "insert" // only in the second text
+)
+
+// Op is a run of consecutive sentences with the same kind
+type Op struct {
+	Kind string `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxCells bounds the size of the comparison table; larger inputs are reported as one
+// delete and one insert
+const maxCells = 4 << 20
+
+var sentenceEndRegex = regexp.MustCompile(`[.!?]["')\]]*\s+|\n+`)
+
+// Sentences splits text into sentences and lines, with surrounding whitespace trimmed
+func Sentences(text string) []string {
+	var sentences []string
+	last := 0
+	for _, loc := range sentenceEndRegex.FindAllStringIndex(text, -1) {
+		if sentence := strings.TrimSpace(text[last:loc[1]]); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		last = loc[1]
+	}
+	if sentence := strings.TrimSpace(text[last:]); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+	return sentences
+}
+
+// Diff returns the operations that turn a into b, sentence by sentence
+func Diff(a, b string) []Op {
+	x, y := Sentences(a), Sentences(b)
+	var ops []Op
+	add := func(kind, sentence string) {
+		if n := len(ops); n > 0 && ops[n-1].Kind == kind {
+			ops[n-1].Text += " " + sentence
+			return
+		}
+		ops = append(ops, Op{Kind: kind, Text: sentence})
+	}
+
+	if len(x)*len(y) > maxCells {
+		for _, sentence := range x {
+			add(Delete, sentence)
+		}
+		for _, sentence := range y {
+			add(Insert, sentence)
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int32, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			add(Equal, x[i])
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(Delete, x[i])
+			i++
+		default:
+			add(Insert, y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		add(Delete, x[i])
+	}
+	for ; j < len(y); j++ {
+		add(Insert, y[j])
+	}
+	return ops
+}
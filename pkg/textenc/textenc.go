@@ -0,0 +1,187 @@
+// Package textenc converts uploaded text to UTF-8. Word and Notepad exports are often
+// Windows-1252 or UTF-16, which would otherwise reach the model as U+FFFD replacement characters.
+package textenc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Charsets reported by Decode
+const (
+	UTF8        = "utf-8"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	Windows1252 = "windows-1252"
+	Latin1      = "iso-8859-1"
+)
+
+var (
+	// ErrBinary is returned for data that is not text in any supported charset
+	ErrBinary = errors.New("input looks like a binary file, not text")
+	// ErrCharset is returned for a declared charset that is not supported
+	ErrCharset = errors.New("unsupported charset")
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// windows1252 maps bytes 0x80-0x9F, where Windows-1252 differs from Latin-1. The five bytes it
+// leaves undefined keep their Latin-1 (C1 control) meaning.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// Decode returns data as UTF-8 text together with the charset it was read as. A byte order mark
+// wins over the declared charset (a Content-Type value or bare charset name, may be empty);
+// without either, valid UTF-8 is taken as is and anything else is read as Windows-1252.
+// Data with NUL or other non-text control bytes, or that sniffs as a known binary format such as
+// PDF or zip, fails with ErrBinary.
+func Decode(data []byte, declared string) (string, string, error) {
+	return decode(data, declared, false)
+}
+
+// DecodePasted is Decode for text pasted into a form field, which has no declared charset.
+// Control characters are dropped instead of rejected, since copying from PDFs and terminals
+// leaves them in otherwise good text.
+func DecodePasted(data []byte) (string, string, error) {
+	return decode(data, "", true)
+}
+
+// decode implements Decode, dropping control characters when strip is set
+func decode(data []byte, declared string, strip bool) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return decodeUTF8(data[len(bomUTF8):], strip)
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return decodeUTF16(data[len(bomUTF16LE):], binary.LittleEndian, UTF16LE, strip)
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return decodeUTF16(data[len(bomUTF16BE):], binary.BigEndian, UTF16BE, strip)
+	}
+
+	charset, err := declaredCharset(declared)
+	if err != nil {
+		return "", "", err
+	}
+	switch charset {
+	case UTF16LE:
+		return decodeUTF16(data, binary.LittleEndian, UTF16LE, strip)
+	case UTF16BE:
+		return decodeUTF16(data, binary.BigEndian, UTF16BE, strip)
+	}
+
+	// Only recognised formats are rejected here; other binary data fails on its control bytes
+	if sniffed := http.DetectContentType(data); !strings.HasPrefix(sniffed, "text/") && sniffed != "application/octet-stream" {
+		return "", "", fmt.Errorf("%w (detected %s)", ErrBinary, strings.SplitN(sniffed, ";", 2)[0])
+	}
+	switch charset {
+	case Latin1:
+		return checkText(decodeSingleByte(data, false), Latin1, strip)
+	case Windows1252:
+		return checkText(decodeSingleByte(data, true), Windows1252, strip)
+	case UTF8:
+		return decodeUTF8(data, strip)
+	}
+	if utf8.Valid(data) {
+		return decodeUTF8(data, strip)
+	}
+	return checkText(decodeSingleByte(data, true), Windows1252, strip)
+}
+
+// declaredCharset normalizes a charset from a Content-Type value or a bare name. It returns ""
+// when none is declared.
+func declaredCharset(declared string) (string, error) {
+	declared = strings.TrimSpace(declared)
+	if declared == "" {
+		return "", nil
+	}
+	if strings.Contains(declared, "/") {
+		_, params, err := mime.ParseMediaType(declared)
+		if err != nil {
+			return "", nil
+		}
+		declared = params["charset"]
+	}
+	switch strings.ToLower(strings.Trim(declared, `"' `)) {
+	case "":
+		return "", nil
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return UTF8, nil
+	case "utf-16le", "utf-16":
+		// UTF-16 without a BOM is little-endian in practice (Windows)
+		return UTF16LE, nil
+	case "utf-16be":
+		return UTF16BE, nil
+	case "windows-1252", "cp1252", "x-cp1252":
+		return Windows1252, nil
+	case "iso-8859-1", "latin1", "latin-1", "iso8859-1", "l1":
+		return Latin1, nil
+	}
+	return "", fmt.Errorf("%w %q (expected utf-8, utf-16, windows-1252 or iso-8859-1)", ErrCharset, declared)
+}
+
+func decodeUTF8(data []byte, strip bool) (string, string, error) {
+	if !utf8.Valid(data) {
+		return "", "", fmt.Errorf("%w (invalid UTF-8)", ErrBinary)
+	}
+	return checkText(string(data), UTF8, strip)
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder, charset string, strip bool) (string, string, error) {
+	if len(data)%2 != 0 {
+		return "", "", fmt.Errorf("%w (odd length for %s)", ErrBinary, charset)
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return checkText(string(utf16.Decode(units)), charset, strip)
+}
+
+// decodeSingleByte maps each byte to its Latin-1 code point, or its Windows-1252 one in 0x80-0x9F
+func decodeSingleByte(data []byte, cp1252 bool) string {
+	var b strings.Builder
+	b.Grow(len(data) + len(data)/8)
+	for _, c := range data {
+		if cp1252 && c >= 0x80 && c <= 0x9F {
+			b.WriteRune(windows1252[c-0x80])
+			continue
+		}
+		b.WriteRune(rune(c))
+	}
+	return b.String()
+}
+
+// checkText rejects decoded text containing control characters other than tab, line breaks
+// (Word uses vertical tab for manual ones) and form feed, which only binary files have. With
+// strip set they are dropped instead.
+func checkText(text, charset string, strip bool) (string, string, error) {
+	if i := strings.IndexFunc(text, isControl); i >= 0 {
+		if !strip {
+			r, _ := utf8.DecodeRuneInString(text[i:])
+			return "", "", fmt.Errorf("%w (control character %U)", ErrBinary, r)
+		}
+		text = strings.Map(func(r rune) rune {
+			if isControl(r) {
+				return -1
+			}
+			return r
+		}, text)
+	}
+	return text, charset, nil
+}
+
+func isControl(r rune) bool {
+	return (r < 0x20 && r != '\t' && r != '\n' && r != '\v' && r != '\r' && r != '\f') || r == 0x7F
+}
@@ -0,0 +1,80 @@
+package textenc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		declared    string
+		want        string
+		wantCharset string
+		wantErr     error
+	}{
+		{name: "plain UTF-8", data: []byte("héllo"), want: "héllo", wantCharset: UTF8},
+		{name: "UTF-8 BOM stripped", data: []byte("\xEF\xBB\xBFhi"), want: "hi", wantCharset: UTF8},
+		{name: "UTF-16LE BOM", data: []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, want: "hi", wantCharset: UTF16LE},
+		{name: "UTF-16BE BOM", data: []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, want: "hi", wantCharset: UTF16BE},
+		{name: "BOM wins over the declared charset", data: []byte{0xFF, 0xFE, 'h', 0}, declared: "windows-1252", want: "h", wantCharset: UTF16LE},
+		{name: "declared UTF-16 without a BOM", data: []byte{'h', 0, 'i', 0}, declared: "text/plain; charset=utf-16", want: "hi", wantCharset: UTF16LE},
+		{name: "invalid UTF-8 read as Windows-1252", data: []byte("\x93quoted\x94 caf\xE9"), want: "“quoted” café", wantCharset: Windows1252},
+		{name: "declared Latin-1", data: []byte("caf\xE9"), declared: "latin1", want: "café", wantCharset: Latin1},
+		{name: "declared charset in a Content-Type", data: []byte("caf\xE9"), declared: `text/plain; charset="ISO-8859-1"`, want: "café", wantCharset: Latin1},
+		{name: "line breaks and tabs allowed", data: []byte("a\tb\r\nc\vd\fe"), want: "a\tb\r\nc\vd\fe", wantCharset: UTF8},
+		{name: "declared UTF-8 must be valid", data: []byte("caf\xE9"), declared: "utf-8", wantErr: ErrBinary},
+		{name: "NUL bytes", data: []byte("a\x00b"), wantErr: ErrBinary},
+		{name: "PDF", data: []byte("%PDF-1.7\n"), wantErr: ErrBinary},
+		{name: "odd-length UTF-16", data: []byte{0xFF, 0xFE, 'h'}, wantErr: ErrBinary},
+		{name: "unsupported charset", data: []byte("hi"), declared: "shift_jis", wantErr: ErrCharset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, charset, err := Decode(tt.data, tt.declared)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode(%q, %q) error = %v, want %v", tt.data, tt.declared, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode(%q, %q): %v", tt.data, tt.declared, err)
+			}
+			if got != tt.want || charset != tt.wantCharset {
+				t.Errorf("Decode(%q, %q) = %q, %q, want %q, %q", tt.data, tt.declared, got, charset, tt.want, tt.wantCharset)
+			}
+		})
+	}
+}
+
+func TestDecodePasted(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr error
+	}{
+		{name: "control characters dropped", data: []byte("a\x00b\x1Bc\x7Fd"), want: "abcd"},
+		{name: "line breaks kept", data: []byte("a\r\nb\tc"), want: "a\r\nb\tc"},
+		{name: "binary formats still rejected", data: []byte("PK\x03\x04"), wantErr: ErrBinary},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := DecodePasted(tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DecodePasted(%q) error = %v, want %v", tt.data, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodePasted(%q): %v", tt.data, err)
+			}
+			if got != tt.want {
+				t.Errorf("DecodePasted(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package transcribe turns uploaded audio into transcript text, with a local whisper.cpp CLI or
+// an OpenAI-compatible speech-to-text API.
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/httpclient"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// Formats are the accepted audio file extensions
+var Formats = []string{".mp3", ".wav", ".m4a"}
+
+// Supported reports whether filename has one of the accepted audio extensions
+func Supported(filename string) bool {
+	return slices.Contains(Formats, strings.ToLower(filepath.Ext(filename)))
+}
+
+// Transcriber converts one audio file to plain text
+type Transcriber interface {
+	Transcribe(ctx context.Context, filename string, audio []byte) (string, error)
+}
+
+// WhisperCpp runs a whisper.cpp CLI (e.g. "whisper-cli -m models/ggml-base.en.bin") on the
+// audio. When ffmpeg is installed the input is first converted to the 16 kHz mono WAV that
+// whisper.cpp expects; without it only such WAV files work.
+type WhisperCpp struct {
+	Args    []string
+	Timeout time.Duration
+}
+
+// NewWhisperCpp returns a transcriber running command, split on spaces without a shell
+func NewWhisperCpp(command string, timeout time.Duration) (*WhisperCpp, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("whisper.cpp command is empty")
+	}
+	return &WhisperCpp{Args: args, Timeout: timeout}, nil
+}
+
+func (w *WhisperCpp) Transcribe(ctx context.Context, filename string, audio []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	workDir, err := os.MkdirTemp("", "cutcrap_audio_*")
+	if err != nil {
+		return "", fmt.Errorf("failed create transcription work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	input := filepath.Join(workDir, "input"+strings.ToLower(filepath.Ext(filename)))
+	if err := os.WriteFile(input, audio, 0o600); err != nil {
+		return "", fmt.Errorf("failed write audio: %w", err)
+	}
+	if ffmpeg, err := exec.LookPath("ffmpeg"); err == nil {
+		wav := filepath.Join(workDir, "audio.wav")
+		if err := run(ctx, ffmpeg, "-nostdin", "-loglevel", "error", "-i", input, "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", wav); err != nil {
+			return "", fmt.Errorf("audio conversion failed: %w", err)
+		}
+		input = wav
+	}
+
+	output := filepath.Join(workDir, "transcript")
+	args := append(slices.Clone(w.Args[1:]), "-f", input, "-otxt", "-of", output, "-np")
+	if err := run(ctx, w.Args[0], args...); err != nil {
+		return "", fmt.Errorf("whisper.cpp failed: %w", err)
+	}
+	text, err := os.ReadFile(output + ".txt")
+	if err != nil {
+		return "", fmt.Errorf("failed read whisper.cpp output: %w", err)
+	}
+	return strings.TrimSpace(string(text)), nil
+}
+
+// run runs a command, returning its stderr with the error
+func run(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w (stderr: %s)", err, logging.Excerpt(strings.TrimSpace(stderr.String())))
+	}
+	return nil
+}
+
+// API posts the audio to an OpenAI-compatible /audio/transcriptions endpoint
+type API struct {
+	URL        string
+	Key        string
+	Model      string
+	HTTPClient *http.Client
+}
+
+// NewAPI returns a transcriber for the endpoint at url. Requests are sent without
+// authentication when key is empty, e.g. for a self-hosted server.
+func NewAPI(url, key, model string, timeout time.Duration) *API {
+	return &API{URL: url, Key: key, Model: model, HTTPClient: httpclient.New(timeout)}
+}
+
+func (a *API) Transcribe(ctx context.Context, filename string, audio []byte) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filepath.Base(filename))
+	if err != nil {
+		return "", fmt.Errorf("failed encode audio: %w", err)
+	}
+	fw.Write(audio)
+	mw.WriteField("model", a.Model)
+	mw.WriteField("response_format", "text")
+	if err := mw.Close(); err != nil {
+		return "", fmt.Errorf("failed encode transcription request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.URL, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed create transcription request: %w", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if a.Key != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Key)
+	}
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	text, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed read transcription response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcription API returned %s: %s", resp.Status, logging.Excerpt(string(text)))
+	}
+	return strings.TrimSpace(string(text)), nil
+}
@@ -0,0 +1,44 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Chapter is a titled stretch of an episode
+type Chapter struct {
+	Start, End time.Duration
+	Title      string
+}
+
+// PodloveChapters renders chapters as Podlove Simple Chapters JSON: an array of {"start", "title"}
+// objects with normal play time starts such as "00:12:05.500"
+func PodloveChapters(chapters []Chapter) ([]byte, error) {
+	type podloveChapter struct {
+		Start string `json:"start"`
+		Title string `json:"title"`
+	}
+	entries := make([]podloveChapter, len(chapters))
+	for i, chapter := range chapters {
+		entries[i] = podloveChapter{Start: formatTimestamp(chapter.Start, '.'), Title: chapter.Title}
+	}
+	return json.MarshalIndent(entries, "", "  ")
+}
+
+// ffmetadataEscaper escapes the characters FFmpeg's metadata format reserves
+var ffmetadataEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+
+// FFMetadata renders chapters as an FFmpeg metadata file. Muxed into an MP3 with
+// "ffmpeg -i episode.mp3 -i chapters.txt -map_metadata 1 -codec copy out.mp3" they become ID3v2
+// CHAP frames with their titles.
+func FFMetadata(chapters []Chapter) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, chapter := range chapters {
+		fmt.Fprintf(&b, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			chapter.Start.Milliseconds(), chapter.End.Milliseconds(), ffmetadataEscaper.Replace(chapter.Title))
+	}
+	return b.String()
+}
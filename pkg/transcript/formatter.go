@@ -3,14 +3,20 @@
 package transcript
 
 import (
-	"fmt"
-	"log"
+	"cmp"
+	"context"
+	"encoding/json"
 	"regexp"
 	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
 )
 
-// parseSpeakerAnalysis remains the same (returns simple Role -> Name map)
-func ParseSpeakerAnalysis(analysis string) map[string]string {
+// parseSpeakerAnalysis remains the same (returns simple Role -> Name map), with the names
+// unified by rules
+func ParseSpeakerAnalysis(analysis string, rules NameRules) map[string]string {
 	// ... (keep implementation from previous version) ...
 	mapping := make(map[string]string) // Simple Role -> Name
 	if analysis == "" {
@@ -21,6 +27,7 @@ func ParseSpeakerAnalysis(analysis string) map[string]string {
 	lines := strings.Split(analysis, "\n")
 	pattern := regexp.MustCompile(`^\s*-\s*\**([^:]+?)\**\s*:\s*\**([^,\n*]+?)\**\s*(?:[,\n].*)?$`)
 	foundListStart := false
+	var names []string // in the order they are listed
 
 	// log.Println("Parsing speaker analysis for Role -> Name map...") // Less verbose
 	for _, line := range lines {
@@ -42,6 +49,7 @@ func ParseSpeakerAnalysis(analysis string) map[string]string {
 				if role != "" && name != "" && role != "Total Speakers" {
 					if _, exists := mapping[role]; !exists {
 						mapping[role] = name
+						names = append(names, name)
 						// log.Printf("Parsed mapping: Role '%s' -> Name '%s'", role, name) // Less verbose
 					} else {
 						// log.Printf("Warning: Duplicate role '%s' found during parsing. Keeping first.", role) // Less verbose
@@ -53,6 +61,14 @@ func ParseSpeakerAnalysis(analysis string) map[string]string {
 		}
 	}
 	// if len(mapping) == 0 { log.Println("Warning: Parsing speaker analysis resulted in an empty map.") } // Less verbose
+
+	// The analysis may name one person differently under several roles ("Dr. Jane Smith", "Jane")
+	renames := UnifyNames(names, rules)
+	for role, name := range mapping {
+		if unified, ok := renames[name]; ok {
+			mapping[role] = unified
+		}
+	}
 	return mapping
 }
 
@@ -62,101 +78,210 @@ func FormatTranscript(text string) string {
 	return strings.TrimSpace(text)
 }
 
-// --- CombineTranscriptChunks --- UPDATED TO MERGE CONSECUTIVE SPEAKERS ---
-func CombineTranscriptChunks(chunks []string) string {
-	log.Printf("Combining %d processed chunks, merging speakers, and applying final bolding", len(chunks))
+// CombineTranscriptChunks merges processed chunks into the final transcript written in format:
+// role labels are replaced with the names in speakerRoleNameMap and consecutive turns by the same
+// speaker are merged. The engine runs these steps as stages of a post-processing pipeline (see
+// postprocess.TranscriptStages), which also unifies the forms of speaker names.
+func CombineTranscriptChunks(ctx context.Context, chunks []string, speakerRoleNameMap map[string]string, format Format) string {
+	turns := CollectTurns(ctx, chunks)
+	EnforceSpeakerNames(turns, speakerRoleNameMap)
+	return FormatTurns(ctx, MergeTurns(turns), format)
+}
 
-	// --- Step 1: Combine chunks ---
-	var builder strings.Builder
-	for _, chunk := range chunks {
-		// Apply minimal formatting per chunk if needed
-		formattedChunk := FormatTranscript(chunk)
-		if formattedChunk != "" {
-			// Append the chunk content
-			builder.WriteString(formattedChunk)
-			// Ensure a single newline exists between joined chunk contents if needed
-			// This might create duplicate newlines initially, which we clean later
-			builder.WriteString("\n")
-		}
+// Format is the layout of a formatted transcript. The zero Format is the default that
+// ParseTurns, the post-processors and translation expect: "**Name**: speech" turns separated by
+// blank lines.
+type Format struct {
+	// PlainSpeaker writes speaker names without bold markers
+	PlainSpeaker bool
+	// Dash separates the name from the speech with " — " instead of ": "
+	Dash bool
+	// SingleNewline separates turns with one line break instead of a blank line
+	SingleNewline bool
+	// Names is how markdown-significant characters in speaker names are written: NamesEscape
+	// (the default when empty), NamesStrip or NamesOff
+	Names string
+}
+
+// Speaker name sanitizations. A name such as "Dr. O'Brien [Host]" or one holding asterisks or a
+// colon would otherwise break the bold speaker tag, render as a link, or split the "Name:" line
+// in the wrong place.
+const (
+	// NamesEscape backslash-escapes the characters, which markdown renders as written
+	NamesEscape = "escape"
+	// NamesStrip removes them, colons and underscores becoming spaces: "Dr. O'Brien [Host]" is
+	// written "Dr. O'Brien Host"
+	NamesStrip = "strip"
+	// NamesOff writes names as they are
+	NamesOff = "off"
+)
+
+// nameSpecials are the characters in speaker names that break a formatted turn
+const nameSpecials = "\\*_`[]:"
+
+var escapedNameRegex = regexp.MustCompile(`\\([\\*_` + "`" + `\[\]:])`)
+
+// sanitizeName writes a speaker name for a formatted turn
+func (f Format) sanitizeName(name string) string {
+	switch f.Names {
+	case NamesOff:
+		return name
+	case NamesStrip:
+		return strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+			if r == ':' || r == '_' {
+				return ' '
+			}
+			if strings.ContainsRune(nameSpecials, r) {
+				return -1
+			}
+			return r
+		}, name)), " ")
 	}
-	combined := builder.String()
-	// Normalize newlines and remove excessive blank lines created by joining
-	combined = regexp.MustCompile(`\r\n`).ReplaceAllString(combined, "\n")
-	combined = regexp.MustCompile(`\n{2,}`).ReplaceAllString(combined, "\n") // Reduce multiple newlines to one
-	combined = strings.TrimSpace(combined)
-
-	// --- Step 2: Merge Consecutive Speaker Lines and Apply Bolding ---
-	var finalLines []string // Stores the final formatted blocks
-	var currentSpeaker string = ""
-	var currentSpeech strings.Builder
-
-	speakerLineRegex := regexp.MustCompile(`^([^:]+):\s*(.*)$`) // Extracts name and speech
-	lines := strings.Split(combined, "\n")
-
-	// Function to flush the current speaker's buffered speech
-	flushSpeakerBlock := func() {
-		if currentSpeaker != "" && currentSpeech.Len() > 0 {
-			// Format the complete block for the previous speaker
-			formattedBlock := fmt.Sprintf("**%s**: %s", currentSpeaker, strings.TrimSpace(currentSpeech.String()))
-			finalLines = append(finalLines, formattedBlock)
-			currentSpeech.Reset() // Reset buffer for the next speaker block
+	var b strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune(nameSpecials, r) {
+			b.WriteByte('\\')
 		}
+		b.WriteRune(r)
 	}
+	return b.String()
+}
 
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-		if trimmedLine == "" {
-			continue // Skip empty lines between actual content lines
-		}
+// unescapeName reverses NamesEscape for a speaker name read back from a formatted turn
+func unescapeName(name string) string {
+	return escapedNameRegex.ReplaceAllString(name, "$1")
+}
 
-		matches := speakerLineRegex.FindStringSubmatch(trimmedLine)
-		if len(matches) == 3 {
-			// It's a speaker line (e.g., "Shandon: Speech")
-			speaker := strings.TrimSpace(matches[1])
-			speechPart := strings.TrimSpace(matches[2])
+// turn writes one turn in the format
+func (f Format) turn(speaker, text string) string {
+	speaker = f.sanitizeName(speaker)
+	if !f.PlainSpeaker {
+		speaker = "**" + speaker + "**"
+	}
+	if f.Dash {
+		return speaker + " — " + text
+	}
+	return speaker + ": " + text
+}
 
-			if speechPart == "" {
-				continue
-			} // Skip lines with speaker but no speech
+// separator is what goes between turns in the format
+func (f Format) separator() string {
+	if f.SingleNewline {
+		return "\n"
+	}
+	return "\n\n"
+}
 
-			if speaker == currentSpeaker {
-				// Same speaker continues, append speech
-				if currentSpeech.Len() > 0 {
-					currentSpeech.WriteString(" ") // Add space between merged lines
-				}
-				currentSpeech.WriteString(speechPart)
-			} else {
-				// New speaker starts
-				flushSpeakerBlock() // Write out the previous speaker's complete block
+// Reformat rewrites a transcript in the default format in format. Blocks without a bold speaker
+// tag, such as notes added by post-processors, are kept as they are.
+func Reformat(combined string, format Format) string {
+	if format == (Format{Names: format.Names}) {
+		return combined
+	}
+	blocks := strings.Split(combined, "\n\n")
+	for i, block := range blocks {
+		if matches := turnBlockRegex.FindStringSubmatch(strings.TrimSpace(block)); len(matches) == 3 {
+			blocks[i] = format.turn(unescapeName(strings.TrimSpace(matches[1])), strings.TrimSpace(matches[2]))
+		}
+	}
+	return strings.Join(blocks, format.separator())
+}
 
-				// Start the new speaker's block
-				currentSpeaker = speaker
-				currentSpeech.WriteString(speechPart) // Add the first line of speech for the new speaker
-			}
+// CollectTurns collects the turns of processed chunks in order. Chunks are expected to be JSON
+// arrays of {speaker, text} turns (structured model output); chunks that don't decode fall back
+// to "Name: speech" line parsing.
+func CollectTurns(ctx context.Context, chunks []string) []Turn {
+	logger := reqctx.Logger(ctx)
+	reqctx.Debug(ctx).Printf("Collecting the turns of %d processed chunks", len(chunks))
+
+	var turns []Turn
+	structuredChunks := 0
+	for _, chunk := range chunks {
+		chunkTurns, ok := decodeTurns(ctx, chunk)
+		if ok {
+			structuredChunks++
 		} else {
-			// Line doesn't match "Speaker: Speech" format.
-			// Could be orphaned speech or AI error.
-			// Option 1: Append to previous speaker if one exists? (Potentially risky)
-			// Option 2: Log and discard (Cleaner)
-			log.Printf("Warning: Skipping line without speaker tag during final merge: '%s'", trimmedLine)
-
-			// Option 1 Implementation (if chosen):
-			// if currentSpeaker != "" {
-			//     if currentSpeech.Len() > 0 { currentSpeech.WriteString(" ") }
-			//     currentSpeech.WriteString(trimmedLine)
-			//     log.Printf("Warning: Appended line without speaker tag to previous speaker '%s'", currentSpeaker)
-			// } else {
-			//     log.Printf("Warning: Skipping line without speaker tag before first speaker: '%s'", trimmedLine)
-			// }
+			chunkTurns = parseTurnLines(ctx, FormatTranscript(chunk))
 		}
-	} // End of loop through lines
+		turns = append(turns, chunkTurns...)
+	}
+	logger.Printf("Collected %d turns (%d/%d chunks structured)", len(turns), structuredChunks, len(chunks))
+	return turns
+}
 
-	// Flush the very last speaker block after the loop finishes
-	flushSpeakerBlock()
+// MergeTurns drops turns without a speaker or speech and merges consecutive turns by the same
+// speaker, keeping the start of the first and the end of the last
+func MergeTurns(turns []Turn) []Turn {
+	var merged []Turn
+	for _, turn := range turns {
+		turn.Speaker = strings.TrimSpace(turn.Speaker)
+		turn.Text = strings.Join(strings.Fields(turn.Text), " ")
+		if turn.Speaker == "" || turn.Text == "" {
+			continue // Skip turns with no speaker or no speech
+		}
 
-	// Join the final formatted blocks with double newlines
-	finalOutput := strings.Join(finalLines, "\n\n")
+		if last := len(merged) - 1; last >= 0 && merged[last].Speaker == turn.Speaker {
+			merged[last].Text += " " + turn.Text // Add space between merged turns
+			merged[last].Start = cmp.Or(merged[last].Start, turn.Start)
+			merged[last].End = cmp.Or(turn.End, merged[last].End)
+			continue
+		}
+		merged = append(merged, turn)
+	}
+	return merged
+}
+
+// FormatTurns writes turns in format, by default as "**Name**: speech" blocks separated by
+// blank lines
+func FormatTurns(ctx context.Context, turns []Turn, format Format) string {
+	blocks := make([]string, len(turns))
+	for i, turn := range turns {
+		blocks[i] = format.turn(turn.Speaker, turn.Text)
+	}
+	finalOutput := strings.Join(blocks, format.separator())
 
-	log.Printf("Successfully combined and formatted transcript. Final word count: %d", len(strings.Fields(finalOutput)))
+	reqctx.Logger(ctx).Printf("Successfully combined and formatted transcript. Final word count: %d", wordcount.Count(finalOutput))
 	return finalOutput
 }
+
+// decodeTurns decodes a structured chunk. Models sometimes wrap JSON in a markdown fence, so that is stripped first.
+func decodeTurns(ctx context.Context, chunk string) ([]Turn, bool) {
+	trimmed := strings.TrimSpace(chunk)
+	trimmed = strings.TrimPrefix(trimmed, "```json")
+	trimmed = strings.TrimPrefix(trimmed, "```")
+	trimmed = strings.TrimSuffix(trimmed, "```")
+	trimmed = strings.TrimSpace(trimmed)
+	if !strings.HasPrefix(trimmed, "[") {
+		return nil, false
+	}
+
+	var turns []Turn
+	if err := json.Unmarshal([]byte(trimmed), &turns); err != nil {
+		reqctx.Warn(ctx).Printf("Structured chunk failed to decode, falling back to line parsing: %v", err)
+		return nil, false
+	}
+	return turns, true
+}
+
+var speakerLineRegex = regexp.MustCompile(`^([^:]+):\s*(.*)$`) // Extracts name and speech
+
+// parseTurnLines is the fallback parser for free-text "Name: speech" chunk output
+func parseTurnLines(ctx context.Context, text string) []Turn {
+	warn := reqctx.Warn(ctx)
+	var turns []Turn
+	for _, line := range strings.Split(text, "\n") {
+		trimmedLine := strings.TrimSpace(line)
+		if trimmedLine == "" {
+			continue
+		}
+
+		matches := speakerLineRegex.FindStringSubmatch(trimmedLine)
+		if len(matches) != 3 {
+			// Line doesn't match "Speaker: Speech" format. Could be orphaned speech or AI error.
+			warn.Printf("Skipping line without speaker tag during final merge: '%s'", logging.Excerpt(trimmedLine))
+			continue
+		}
+		turns = append(turns, Turn{Speaker: strings.TrimSpace(matches[1]), Text: strings.TrimSpace(matches[2])})
+	}
+	return turns
+}
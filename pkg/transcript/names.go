@@ -0,0 +1,227 @@
+package transcript
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// honorifics are the titles set apart when matching speaker names, each with the form it is
+// compared in. Generational suffixes such as "Jr." stay part of the name.
+var honorifics = map[string]string{
+	"dr": "dr", "doctor": "dr", "mr": "mr", "mrs": "mrs", "ms": "ms", "miss": "miss", "mx": "mx",
+	"prof": "prof", "professor": "prof", "sir": "sir", "dame": "dame", "lord": "lord", "lady": "lady",
+	"rev": "rev", "reverend": "rev", "fr": "fr", "father": "fr", "rabbi": "rabbi", "imam": "imam",
+	"hon": "hon", "judge": "judge", "justice": "justice", "sen": "sen", "senator": "sen", "rep": "rep",
+	"gov": "gov", "governor": "gov", "mayor": "mayor", "president": "president", "minister": "minister",
+	"capt": "capt", "captain": "capt", "col": "col", "gen": "gen", "lt": "lt", "sgt": "sgt",
+	"phd": "phd", "md": "md", "esq": "esq",
+}
+
+// NameRules say how the forms of one person's name are unified
+type NameRules struct {
+	// Aliases is a table from ParseAliases
+	Aliases map[string]string
+	// Manual turns off the matching of short and titled forms; only Aliases apply
+	Manual bool
+}
+
+// parsedName is a name split into its words and its titles, in lower case without punctuation,
+// so that "Dr. Jane Smith" and "dr jane smith" parse the same
+type parsedName struct {
+	words, titles []string
+}
+
+func parseName(name string) parsedName {
+	var parsed parsedName
+	for _, word := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '’' && r != '-'
+	}) {
+		if word = strings.Trim(word, "'’-"); word == "" {
+			continue
+		}
+		if title, ok := honorifics[word]; ok {
+			parsed.titles = append(parsed.titles, title)
+		} else {
+			parsed.words = append(parsed.words, word)
+		}
+	}
+	slices.Sort(parsed.titles)
+	return parsed
+}
+
+// key identifies the person a name stands for: its words and, when it has any, its titles
+func (p parsedName) key() string {
+	key := strings.Join(p.words, " ")
+	if len(p.titles) > 0 && key != "" {
+		key += "|" + strings.Join(p.titles, " ")
+	}
+	return key
+}
+
+// wordKey is the words of the name alone
+func (p parsedName) wordKey() string {
+	return strings.Join(p.words, " ")
+}
+
+// covers reports whether p is a fuller form of other: it has every word and title of other and
+// more words, or the same words and a title other lacks. Names with different titles are
+// different people, and a titled name is only a form of names with the same titles.
+func (p parsedName) covers(other parsedName) bool {
+	for _, word := range other.words {
+		if !slices.Contains(p.words, word) {
+			return false
+		}
+	}
+	if len(other.titles) > 0 && !slices.Equal(p.titles, other.titles) {
+		return false
+	}
+	return len(p.words) > len(other.words) || (len(p.titles) > 0 && len(other.titles) == 0)
+}
+
+// ParseAliases reads a speaker alias table from "Canonical Name=alias, alias" entries. Aliases
+// are matched like speaker names, ignoring case; an alias with a title only matches names with
+// that title. The table maps the key of each alias to its canonical name.
+func ParseAliases(entries []string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	for _, entry := range entries {
+		canonical, list, ok := strings.Cut(entry, "=")
+		canonical = strings.TrimSpace(canonical)
+		if !ok || parseName(canonical).wordKey() == "" {
+			return nil, fmt.Errorf("%q is not of the form \"Name=alias, alias\"", entry)
+		}
+		for _, alias := range strings.Split(list, ",") {
+			key := parseName(alias).key()
+			if key == "" {
+				continue
+			}
+			if previous, ok := aliases[key]; ok && previous != canonical {
+				return nil, fmt.Errorf("alias %q is given for both %q and %q", strings.TrimSpace(alias), previous, canonical)
+			}
+			aliases[key] = canonical
+		}
+	}
+	if len(aliases) == 0 && len(entries) > 0 {
+		return nil, errors.New("no aliases given")
+	}
+	return aliases, nil
+}
+
+// lookupAlias returns the canonical name of name in aliases, matching its titles when the alias
+// has any
+func lookupAlias(aliases map[string]string, name parsedName) (string, bool) {
+	if canonical, ok := aliases[name.key()]; ok {
+		return canonical, true
+	}
+	canonical, ok := aliases[name.wordKey()]
+	return canonical, ok
+}
+
+// UnifyNames maps the forms of one person's name to a single one. A name in the aliases of
+// rules becomes its canonical name. Then, unless rules are Manual, a name whose words are all
+// among the words of exactly one fuller name is taken to be that person, so "Jane" and "Jane
+// Smith" become "Dr. Jane Smith"; a "Smith" shared by Jane and John Smith is left alone, and so
+// are names with different titles, such as "Mr. Smith" and "Mrs. Smith". Of several forms of one
+// name the canonical name of the aliases is kept, otherwise the longest, and canonical names are
+// never matched to fuller ones. Role labels such as "Host" or "Speaker 1" are never matched. The
+// result holds only the names that change.
+func UnifyNames(names []string, rules NameRules) map[string]string {
+	if rules.Manual {
+		renames := make(map[string]string)
+		for _, name := range names {
+			if canonical, ok := lookupAlias(rules.Aliases, parseName(name)); ok && canonical != name {
+				renames[name] = canonical
+			}
+		}
+		return renames
+	}
+
+	resolved := make(map[string]string, len(names))
+	// best is the form kept for each key, keys the keys in first seen order; the canonical names
+	// of the aliases come first and are kept as they are
+	best := make(map[string]string)
+	parsed := make(map[string]parsedName)
+	var keys []string
+	canonicals := slices.Sorted(maps.Values(rules.Aliases))
+	for _, canonical := range slices.Compact(canonicals) {
+		name := parseName(canonical)
+		key := name.key()
+		if _, ok := best[key]; !ok && !roleLabelRegex.MatchString(name.wordKey()) {
+			best[key], parsed[key] = canonical, name
+			keys = append(keys, key)
+		}
+	}
+	preferred := len(keys)
+	for _, name := range names {
+		target := name
+		if canonical, ok := lookupAlias(rules.Aliases, parseName(name)); ok {
+			target = canonical
+		}
+		resolved[name] = target
+		targetName := parseName(target)
+		key := targetName.key()
+		if key == "" || roleLabelRegex.MatchString(targetName.wordKey()) {
+			continue
+		}
+		if form, ok := best[key]; !ok {
+			best[key], parsed[key] = target, targetName
+			keys = append(keys, key)
+		} else if len(target) > len(form) && !slices.Contains(keys[:preferred], key) {
+			best[key] = target
+		}
+	}
+
+	// The fullest names are the ones no other name covers
+	var fullest []string
+	for _, key := range keys {
+		if !slices.ContainsFunc(keys, func(other string) bool { return parsed[other].covers(parsed[key]) }) {
+			fullest = append(fullest, key)
+		}
+	}
+	forms := make(map[string]string, len(keys))
+	for _, key := range keys {
+		forms[key] = best[key]
+		var matches []string
+		for _, full := range fullest {
+			if parsed[full].covers(parsed[key]) {
+				matches = append(matches, full)
+			}
+		}
+		// Canonical names of the aliases are final
+		if len(matches) == 1 && !slices.Contains(keys[:preferred], key) {
+			forms[key] = best[matches[0]]
+		}
+	}
+
+	renames := make(map[string]string)
+	for name, target := range resolved {
+		if form, ok := forms[parseName(target).key()]; ok {
+			target = form
+		}
+		if target != name {
+			renames[name] = target
+		}
+	}
+	return renames
+}
+
+// UnifySpeakers renames the speakers of turns that are forms of one person's name to a single
+// form, see UnifyNames. Returns the number of turns renamed.
+func UnifySpeakers(turns []Turn, rules NameRules) int {
+	speakers := make([]string, len(turns))
+	for i, turn := range turns {
+		speakers[i] = strings.TrimSpace(turn.Speaker)
+	}
+	renames := UnifyNames(speakers, rules)
+	renamed := 0
+	for i := range turns {
+		if name, ok := renames[speakers[i]]; ok {
+			turns[i].Speaker = name
+			renamed++
+		}
+	}
+	return renamed
+}
@@ -1,9 +1,11 @@
 package transcript
 
 import (
-	"log"
+	"context"
 	"regexp"
 	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
 )
 
 type SpeakerInfo struct {
@@ -12,8 +14,9 @@ type SpeakerInfo struct {
 	Occurrences   int
 }
 
-func DetectSpeakers(text string) map[string]string {
-	log.Println("Detecting speakers in transcript text")
+func DetectSpeakers(ctx context.Context, text string) map[string]string {
+	logger := reqctx.Debug(ctx)
+	logger.Println("Detecting speakers in transcript text")
 
 	patterns := []*regexp.Regexp{
 		regexp.MustCompile(`(?m)^([A-Za-z][A-Za-z\s\.]{0,20}):\s`),
@@ -54,16 +57,17 @@ func DetectSpeakers(text string) map[string]string {
 		}
 	}
 
-	log.Printf("Preserved %d speaker labels in transcript", len(result))
+	logger.Printf("Preserved %d speaker labels in transcript", len(result))
 	return result
 }
 
-func StandardizeSpeakers(text string, speakerMap map[string]string) string {
+func StandardizeSpeakers(ctx context.Context, text string, speakerMap map[string]string) string {
+	logger := reqctx.Debug(ctx)
 	if len(speakerMap) == 0 {
 		return text
 	}
 
-	log.Println("Standardizing speaker labels in transcript")
+	logger.Println("Standardizing speaker labels in transcript")
 
 	result := text
 	for original, standard := range speakerMap {
@@ -73,3 +77,41 @@ func StandardizeSpeakers(text string, speakerMap map[string]string) string {
 
 	return result
 }
+
+// roleLabelRegex matches a generic role label, e.g. "Host", "Guest 2" or "Speaker 1"
+var roleLabelRegex = regexp.MustCompile(`(?i)^(host|guest|speaker)(\s*\d+)?$`)
+
+// EnforceSpeakerNames replaces role labels left as turn speakers with the real names from the
+// role->name map of the speaker analysis. The prompt asks the model for names, but role labels
+// still leak into chunk outputs. A bare "Guest" is resolved when there is only one guest.
+// Returns the number of turns renamed.
+func EnforceSpeakerNames(turns []Turn, roleNames map[string]string) int {
+	names := make(map[string]string)
+	guests := 0
+	for role, name := range roleNames {
+		role = strings.ToLower(strings.Join(strings.Fields(role), " "))
+		if strings.HasPrefix(role, "guest") {
+			guests++
+		}
+		// Roles the analysis couldn't name map to themselves or to another role label
+		if !roleLabelRegex.MatchString(name) {
+			names[role] = name
+		}
+	}
+	if name, ok := names["guest 1"]; ok && guests == 1 {
+		names["guest"] = name
+	}
+
+	renamed := 0
+	for i, turn := range turns {
+		label := strings.ToLower(strings.Join(strings.Fields(strings.Trim(turn.Speaker, "*[]() ")), " "))
+		if !roleLabelRegex.MatchString(label) {
+			continue
+		}
+		if name, ok := names[label]; ok {
+			turns[i].Speaker = name
+			renamed++
+		}
+	}
+	return renamed
+}
@@ -0,0 +1,227 @@
+package transcript
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// Subtitle layout limits: cues are wrapped at maxLineLength characters and hold at most
+// maxCueLines lines, the usual broadcast limits
+const (
+	maxLineLength = 42
+	maxCueLines   = 2
+)
+
+// cueTimingLine matches an SRT or WebVTT cue timing line, capturing both times
+var cueTimingLine = regexp.MustCompile(`^\s*((?:\d+:)?\d{2}:\d{2}[.,]\d{3})\s*-->\s*((?:\d+:)?\d{2}:\d{2}[.,]\d{3})`)
+
+// Cue is one timed subtitle
+type Cue struct {
+	Start, End time.Duration
+	Text       string
+}
+
+// ParseTimestamp reads a subtitle time such as "00:01:02,500", "00:01:02.500" or "01:02.500"
+func ParseTimestamp(s string) (time.Duration, bool) {
+	s = strings.Replace(strings.TrimSpace(s), ",", ".", 1)
+	clock, fraction, ok := strings.Cut(s, ".")
+	if !ok || len(fraction) != 3 {
+		return 0, false
+	}
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	millis, err := strconv.Atoi(fraction)
+	if err != nil {
+		return 0, false
+	}
+	total := time.Duration(millis) * time.Millisecond
+	unit := time.Second
+	for i := len(parts) - 1; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		total += time.Duration(n) * unit
+		unit *= 60
+	}
+	return total, true
+}
+
+// ParseCues reads the timed cues of SRT or WebVTT content in order. Blocks without a timing line
+// (the WEBVTT header, NOTE and STYLE blocks) are skipped.
+func ParseCues(content string) []Cue {
+	var cues []Cue
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	for _, block := range strings.Split(content, "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		for i, line := range lines {
+			matches := cueTimingLine.FindStringSubmatch(line)
+			if matches == nil {
+				continue
+			}
+			start, startOK := ParseTimestamp(matches[1])
+			end, endOK := ParseTimestamp(matches[2])
+			if startOK && endOK && end > start {
+				cues = append(cues, Cue{Start: start, End: end, Text: strings.Join(strings.Fields(strings.Join(lines[i+1:], " ")), " ")})
+			}
+			break
+		}
+	}
+	return cues
+}
+
+// CheckTimings clears the timings of turns that don't match the source cues: a turn must start
+// where one cue starts and end, later, where one ends. Timings are copied from the input by the
+// model, which can misread or invent them. It returns how many turns lost their timings.
+func CheckTimings(turns []Turn, source []Cue) int {
+	starts := make(map[time.Duration]bool, len(source))
+	ends := make(map[time.Duration]bool, len(source))
+	for _, cue := range source {
+		starts[cue.Start], ends[cue.End] = true, true
+	}
+	cleared := 0
+	for i := range turns {
+		turn := &turns[i]
+		if turn.Start == "" && turn.End == "" {
+			continue
+		}
+		start, startOK := ParseTimestamp(turn.Start)
+		end, endOK := ParseTimestamp(turn.End)
+		if !startOK || !endOK || end <= start || !starts[start] || !ends[end] {
+			turn.Start, turn.End = "", ""
+			cleared++
+		}
+	}
+	return cleared
+}
+
+// Subtitles re-flows the text of timed turns across the source cues they span, so the cleaned
+// text keeps the original timings. A turn's words are shared among its cues in proportion to
+// how many words each cue had; pieces too long for one cue are split again with the time shared
+// by length. With speakerNames, each turn's first cue starts with "Name: ". Turns without
+// readable timings are left out.
+func Subtitles(turns []Turn, source []Cue, speakerNames bool) []Cue {
+	var cues []Cue
+	for _, turn := range turns {
+		start, startOK := ParseTimestamp(turn.Start)
+		end, endOK := ParseTimestamp(turn.End)
+		words := strings.Fields(turn.Text)
+		if !startOK || !endOK || end <= start || len(words) == 0 {
+			continue
+		}
+		// Source cues belong to the turn their start falls in
+		var slots []Cue
+		for _, cue := range source {
+			if cue.Start >= start && cue.Start < end {
+				slots = append(slots, Cue{Start: cue.Start, End: min(cue.End, end), Text: cue.Text})
+			}
+		}
+		if len(slots) == 0 {
+			slots = []Cue{{Start: start, End: end}}
+		}
+
+		weights := make([]int, len(slots))
+		total := 0
+		for i, slot := range slots {
+			weights[i] = max(wordcount.Count(slot.Text), 1)
+			total += weights[i]
+		}
+		first := true
+		used, cumulative := 0, 0
+		for i, slot := range slots {
+			cumulative += weights[i]
+			next := len(words) * cumulative / total
+			if next <= used {
+				continue
+			}
+			text := strings.Join(words[used:next], " ")
+			used = next
+			if first && speakerNames && turn.Speaker != "" {
+				text = turn.Speaker + ": " + text
+			}
+			first = false
+			cues = append(cues, splitCue(Cue{Start: slot.Start, End: slot.End, Text: text})...)
+		}
+	}
+	return cues
+}
+
+// splitCue wraps a cue's text into lines and, when they don't fit in one cue, splits it into
+// consecutive cues whose time is shared by text length
+func splitCue(cue Cue) []Cue {
+	lines := wrapLines(cue.Text, maxLineLength)
+	if len(lines) <= maxCueLines {
+		cue.Text = strings.Join(lines, "\n")
+		return []Cue{cue}
+	}
+	var groups []string
+	length := 0
+	for i := 0; i < len(lines); i += maxCueLines {
+		group := strings.Join(lines[i:min(i+maxCueLines, len(lines))], "\n")
+		groups = append(groups, group)
+		length += len(group)
+	}
+	cues := make([]Cue, len(groups))
+	duration := cue.End - cue.Start
+	start, done := cue.Start, 0
+	for i, group := range groups {
+		done += len(group)
+		end := cue.Start + duration*time.Duration(done)/time.Duration(length)
+		cues[i] = Cue{Start: start, End: end, Text: group}
+		start = end
+	}
+	return cues
+}
+
+// wrapLines breaks text between words into lines of at most width characters; a longer word
+// gets a line of its own
+func wrapLines(text string, width int) []string {
+	var lines []string
+	var line strings.Builder
+	for _, word := range strings.Fields(text) {
+		if line.Len() > 0 && line.Len()+1+len(word) > width {
+			lines = append(lines, line.String())
+			line.Reset()
+		}
+		if line.Len() > 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(word)
+	}
+	if line.Len() > 0 {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+// WriteSRT renders cues as a SubRip file
+func WriteSRT(cues []Cue) string {
+	var b strings.Builder
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(cue.Start, ','), formatTimestamp(cue.End, ','), cue.Text)
+	}
+	return b.String()
+}
+
+// WriteVTT renders cues as a WebVTT file
+func WriteVTT(cues []Cue) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, cue := range cues {
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n", formatTimestamp(cue.Start, '.'), formatTimestamp(cue.End, '.'), cue.Text)
+	}
+	return b.String()
+}
+
+// formatTimestamp writes d as HH:MM:SS followed by the separator and milliseconds
+func formatTimestamp(d time.Duration, separator byte) string {
+	millis := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", millis/3600000, millis/60000%60, millis/1000%60, separator, millis%1000)
+}
@@ -0,0 +1,102 @@
+package transcript
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"00:01:02,500", time.Minute + 2500*time.Millisecond, true},
+		{"00:01:02.500", time.Minute + 2500*time.Millisecond, true},
+		{"01:02.500", time.Minute + 2500*time.Millisecond, true},
+		{"1:00:00.000", time.Hour, true},
+		{" 00:00:01,000 ", time.Second, true},
+		{"00:01:02", 0, false},
+		{"00:01:02,5", 0, false},
+		{"02.500", 0, false},
+		{"1:2:3:4.000", 0, false},
+		{"aa:01:02,500", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := ParseTimestamp(tt.in)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ParseTimestamp(%q) = %v, %t, want %v, %t", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseCues(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Cue
+	}{
+		{
+			name:    "SRT",
+			content: "1\n00:00:01,000 --> 00:00:02,500\nHello\nthere\n\n2\n00:00:03,000 --> 00:00:04,000\nBye",
+			want: []Cue{
+				{Start: time.Second, End: 2500 * time.Millisecond, Text: "Hello there"},
+				{Start: 3 * time.Second, End: 4 * time.Second, Text: "Bye"},
+			},
+		},
+		{
+			name:    "WebVTT with header and note",
+			content: "WEBVTT\n\nNOTE a comment\n\n00:01.000 --> 00:02.000 align:start\n<v Ann>Hi",
+			want:    []Cue{{Start: time.Second, End: 2 * time.Second, Text: "<v Ann>Hi"}},
+		},
+		{
+			name:    "CRLF line endings",
+			content: "1\r\n00:00:01,000 --> 00:00:02,000\r\nHi\r\n\r\n",
+			want:    []Cue{{Start: time.Second, End: 2 * time.Second, Text: "Hi"}},
+		},
+		{
+			name:    "cue ending before it starts skipped",
+			content: "00:00:05,000 --> 00:00:04,000\nBackwards",
+		},
+		{
+			name:    "plain text",
+			content: "Host: Hello.\n\nGuest: Hi.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseCues(tt.content); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseCues(%q)\n got %+v\nwant %+v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTimings(t *testing.T) {
+	source := []Cue{
+		{Start: time.Second, End: 2 * time.Second},
+		{Start: 3 * time.Second, End: 4 * time.Second},
+	}
+	turns := []Turn{
+		{Start: "00:00:01,000", End: "00:00:04,000"},
+		{Start: "00:00:01,500", End: "00:00:02,000"},
+		{Start: "00:00:03,000", End: "00:00:02,000"},
+		{Start: "soon", End: "later"},
+		{},
+	}
+	if cleared := CheckTimings(turns, source); cleared != 3 {
+		t.Errorf("CheckTimings cleared %d turns, want 3", cleared)
+	}
+	if turns[0].Start == "" || turns[0].End == "" {
+		t.Errorf("turn spanning two cues lost its timings")
+	}
+	for i, turn := range turns[1:] {
+		if turn.Start != "" || turn.End != "" {
+			t.Errorf("turn %d kept timings %q-%q that match no cue", i+1, turn.Start, turn.End)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package transcript
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Turn is one merged speaker block from a combined transcript
+type Turn struct {
+	Speaker   string `json:"speaker"`
+	Text      string `json:"text"`
+	Sentiment string `json:"sentiment,omitempty"`
+	Tone      string `json:"tone,omitempty"`
+	// Start and End are the subtitle timings the turn spans, as written in the input
+	// (e.g. "00:01:02,500"), when it had any
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// Speakers returns the distinct speakers of turns in the order they first speak
+func Speakers(turns []Turn) []string {
+	var speakers []string
+	for _, turn := range turns {
+		if !slices.Contains(speakers, turn.Speaker) {
+			speakers = append(speakers, turn.Speaker)
+		}
+	}
+	return speakers
+}
+
+var turnBlockRegex = regexp.MustCompile(`(?s)^\*\*(.+?)\*\*:\s*(.*)$`)
+
+// ParseTurns splits the output of CombineTranscriptChunks back into speaker turns, unescaping
+// the speaker names. Blocks that don't carry a bold speaker tag are skipped.
+func ParseTurns(combined string) []Turn {
+	var turns []Turn
+	for _, block := range strings.Split(combined, "\n\n") {
+		matches := turnBlockRegex.FindStringSubmatch(strings.TrimSpace(block))
+		if len(matches) != 3 {
+			continue
+		}
+		turns = append(turns, Turn{
+			Speaker: unescapeName(strings.TrimSpace(matches[1])),
+			Text:    strings.TrimSpace(matches[2]),
+		})
+	}
+	return turns
+}
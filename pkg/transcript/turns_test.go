@@ -0,0 +1,136 @@
+package transcript
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseTurns(t *testing.T) {
+	tests := []struct {
+		name     string
+		combined string
+		want     []Turn
+	}{
+		{
+			name:     "bold speaker tags",
+			combined: "**Ann**: Hello there.\n\n**Bob**:   Hi.",
+			want:     []Turn{{Speaker: "Ann", Text: "Hello there."}, {Speaker: "Bob", Text: "Hi."}},
+		},
+		{
+			name:     "multi-line turn",
+			combined: "**Ann**: First line.\nSecond line.",
+			want:     []Turn{{Speaker: "Ann", Text: "First line.\nSecond line."}},
+		},
+		{
+			name:     "blocks without a speaker skipped",
+			combined: "# Heading\n\n**Ann**: Hi.\n\nAnn: plain",
+			want:     []Turn{{Speaker: "Ann", Text: "Hi."}},
+		},
+		{
+			name:     "empty",
+			combined: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseTurns(tt.combined); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseTurns(%q)\n got %+v\nwant %+v", tt.combined, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSpeakerAnalysis(t *testing.T) {
+	tests := []struct {
+		name     string
+		analysis string
+		rules    NameRules
+		want     map[string]string
+	}{
+		{
+			name:     "list after an introduction",
+			analysis: "The speakers are:\n- Host: Ann Lee\n- Guest 1: Bob Stone, an economist",
+			want:     map[string]string{"Host": "Ann Lee", "Guest 1": "Bob Stone"},
+		},
+		{
+			name:     "bold markers",
+			analysis: "- **Host**: **Ann Lee**",
+			want:     map[string]string{"Host": "Ann Lee"},
+		},
+		{
+			name:     "first of a repeated role kept, total skipped",
+			analysis: "- Total Speakers: 2\n- Host: Ann\n- Host: Someone Else",
+			want:     map[string]string{"Host": "Ann"},
+		},
+		{
+			name:     "one person under two roles",
+			analysis: "- Host: Dr. Jane Smith\n- Co-host: Jane",
+			want:     map[string]string{"Host": "Dr. Jane Smith", "Co-host": "Dr. Jane Smith"},
+		},
+		{
+			name:     "manual names left apart",
+			analysis: "- Host: Dr. Jane Smith\n- Co-host: Jane",
+			rules:    NameRules{Manual: true},
+			want:     map[string]string{"Host": "Dr. Jane Smith", "Co-host": "Jane"},
+		},
+		{
+			name:     "no list",
+			analysis: "I could not tell who is speaking.",
+			want:     map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseSpeakerAnalysis(tt.analysis, tt.rules); !maps.Equal(got, tt.want) {
+				t.Errorf("ParseSpeakerAnalysis(%q) = %v, want %v", tt.analysis, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "aliases of one speaker",
+			entries: []string{"Jane Smith=JS, Janie"},
+			want:    map[string]string{"js": "Jane Smith", "janie": "Jane Smith"},
+		},
+		{
+			name:    "no entries",
+			entries: nil,
+			want:    map[string]string{},
+		},
+		{
+			name:    "missing equals sign",
+			entries: []string{"Jane Smith"},
+			wantErr: true,
+		},
+		{
+			name:    "no aliases",
+			entries: []string{"Jane Smith="},
+			wantErr: true,
+		},
+		{
+			name:    "alias given for two speakers",
+			entries: []string{"Jane Smith=J", "John Smith=J"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAliases(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAliases(%q) error = %v, want error %t", tt.entries, err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("ParseAliases(%q) = %v, want %v", tt.entries, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Package webhook delivers JSON notifications signed with HMAC-SHA256, retrying failed
+// deliveries with exponential backoff and recording the ones that never succeed.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// Headers set on every delivery. The signature is "sha256=" followed by the hex HMAC-SHA256 of
+// the timestamp, a ".", and the body, keyed with the shared secret.
+const (
+	SignatureHeader = "X-Cutcrap-Signature"
+	TimestampHeader = "X-Cutcrap-Timestamp"
+)
+
+// initialBackoff is the wait before the first retry; it doubles for every retry after that
+const initialBackoff = 2 * time.Second
+
+// Sender posts payloads to webhook URLs
+type Sender struct {
+	Secret      string
+	MaxAttempts int
+	HTTPClient  *http.Client
+	// DeadLetterPath, when set, is a JSON Lines file that failed deliveries are appended to
+	DeadLetterPath string
+
+	mu sync.Mutex // serializes dead-letter writes
+}
+
+// New returns a sender signing with secret, making up to maxAttempts attempts per delivery
+// with timeout for each. Webhook URLs come from callers, so the client only connects to public
+// addresses and does not follow redirects.
+func New(secret string, maxAttempts int, timeout time.Duration, deadLetterPath string) *Sender {
+	return &Sender{
+		Secret:         secret,
+		MaxAttempts:    maxAttempts,
+		HTTPClient:     publicClient(timeout),
+		DeadLetterPath: deadLetterPath,
+	}
+}
+
+// IsPublic reports whether ip is an address webhooks may be delivered to: not loopback, private
+// (RFC 1918, RFC 4193), link-local (such as the 169.254.169.254 metadata service), carrier-grade
+// NAT, multicast or unspecified
+func IsPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() && ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() && !sharedAddressSpace.Contains(ip)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicClient returns a client that refuses to connect to non-public addresses, checked on the
+// resolved address of every connection so DNS names pointing inside cannot get around it. It does
+// not use a proxy, which would hide the address, and refuses redirects.
+func publicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !IsPublic(addrPort.Addr()) {
+				return fmt.Errorf("webhook address %s is not public", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        16,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errors.New("webhook redirects are not followed")
+		},
+	}
+}
+
+// Sign returns the signature header value for a delivery body sent at timestamp (Unix seconds)
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery's signature header against its timestamp header and body, for
+// receivers. Receivers should also reject timestamps too far from the current time.
+func Verify(secret, timestamp, signature string, body []byte) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+// Deliver posts payload as JSON to url. Network errors, timeouts, 408, 429 and 5xx responses are
+// retried with exponential backoff; other responses fail right away. A delivery that fails for
+// good is written to the dead-letter log before the error is returned.
+func (s *Sender) Deliver(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed marshal webhook payload: %w", err)
+	}
+
+	backoff := initialBackoff
+	attempt := 1
+	for ; ; attempt++ {
+		var retry bool
+		retry, err = s.post(ctx, url, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.MaxAttempts {
+			break
+		}
+		log.Printf("Webhook delivery to %s failed (attempt %d/%d), retrying in %v: %v", url, attempt, s.MaxAttempts, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		backoff *= 2
+	}
+
+	s.deadLetter(url, body, attempt, err)
+	return fmt.Errorf("webhook delivery failed after %d attempts: %w", attempt, err)
+}
+
+// post makes one delivery attempt and reports whether a failure is worth retrying
+func (s *Sender) post(ctx context.Context, url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed create webhook request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(s.Secret, timestamp, body))
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+// deadLetter records a delivery that failed for good, so it can be inspected and replayed
+func (s *Sender) deadLetter(url string, body []byte, attempts int, deliveryErr error) {
+	logging.Errorf("WEBHOOK DEAD LETTER | URL: %s | Attempts: %d | Error: %v", url, attempts, deliveryErr)
+	if s.DeadLetterPath == "" {
+		return
+	}
+	entry, err := json.Marshal(map[string]any{
+		"time":     time.Now().UTC(),
+		"url":      url,
+		"attempts": attempts,
+		"error":    deliveryErr.Error(),
+		"payload":  json.RawMessage(body),
+	})
+	if err != nil {
+		logging.Errorf("failed encode dead letter: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.DeadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		logging.Errorf("failed open webhook dead-letter log: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(entry, '\n')); err != nil {
+		logging.Errorf("failed write webhook dead-letter log: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package workers
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/textdiff"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// OrderedCombiner is a reorder buffer for chunk outputs that complete out of order. Chunk N is
+// emitted as soon as chunks 0..N-1 have been added, so output can be sent while later chunks are
+// still running. Blank outputs (failed or empty chunks) are not emitted but still advance the order.
+type OrderedCombiner struct {
+	emit    func(index int, content string) error
+	next    int
+	pending map[int]string
+	err     error
+}
+
+// NewOrderedCombiner returns a combiner that passes trimmed outputs to emit in chunk order
+func NewOrderedCombiner(emit func(index int, content string) error) *OrderedCombiner {
+	return &OrderedCombiner{emit: emit, pending: make(map[int]string)}
+}
+
+// Add records the output of chunk index and emits every output that is now in order. After emit
+// has failed, outputs are dropped and its error is returned.
+func (c *OrderedCombiner) Add(index int, content string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.pending[index] = content
+	for {
+		content, ok := c.pending[c.next]
+		if !ok {
+			return nil
+		}
+		delete(c.pending, c.next)
+		if err := c.send(c.next, content); err != nil {
+			return err
+		}
+		c.next++
+	}
+}
+
+// Close emits the outputs still waiting for a chunk that never completed (e.g. one that was
+// never dispatched because the job was cancelled), in chunk order
+func (c *OrderedCombiner) Close() error {
+	indexes := make([]int, 0, len(c.pending))
+	for index := range c.pending {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		if err := c.send(index, c.pending[index]); err != nil {
+			return err
+		}
+		delete(c.pending, index)
+	}
+	return c.err
+}
+
+// Pending returns the number of outputs held back until an earlier chunk completes
+func (c *OrderedCombiner) Pending() int { return len(c.pending) }
+
+func (c *OrderedCombiner) send(index int, content string) error {
+	if c.err != nil {
+		return c.err
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil
+	}
+	if err := c.emit(index, content); err != nil {
+		c.err = err
+		c.pending = nil
+		return err
+	}
+	return nil
+}
+
+// TrimOverlap drops the start of current, the output of a chunk that begins with share (0 to 1)
+// of its words repeated from the chunk before it. The model condenses a chunk in order, so that
+// share of the output covers the repeated words, however it was worded; the cut is made at the
+// sentence end nearest to it.
+func TrimOverlap(current string, share float64) string {
+	cut := int(math.Round(share * float64(wordcount.Count(current))))
+	if cut <= 0 {
+		return current
+	}
+	rest, dropped := current, 0
+	bestRest, bestDistance := current, cut
+	for _, sentence := range textdiff.Sentences(current) {
+		at := strings.Index(rest, sentence)
+		if at < 0 {
+			break
+		}
+		rest = rest[at+len(sentence):]
+		dropped += wordcount.Count(sentence)
+		if distance := abs(cut - dropped); distance < bestDistance {
+			bestRest, bestDistance = rest, distance
+		} else if dropped > cut {
+			break
+		}
+	}
+	return strings.TrimSpace(bestRest)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,139 @@
+package workers
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestOrderedCombiner(t *testing.T) {
+	type chunk struct {
+		index   int
+		content string
+	}
+	tests := []struct {
+		name string
+		adds []chunk
+		// emittedBeforeClose is what has been emitted once every chunk was added
+		emittedBeforeClose []string
+		emitted            []string
+	}{
+		{
+			name:               "in order",
+			adds:               []chunk{{0, "a"}, {1, "b"}, {2, "c"}},
+			emittedBeforeClose: []string{"a", "b", "c"},
+			emitted:            []string{"a", "b", "c"},
+		},
+		{
+			name:               "reversed",
+			adds:               []chunk{{2, "c"}, {1, "b"}, {0, "a"}},
+			emittedBeforeClose: []string{"a", "b", "c"},
+			emitted:            []string{"a", "b", "c"},
+		},
+		{
+			name:               "interleaved",
+			adds:               []chunk{{1, "b"}, {0, "a"}, {3, "d"}, {2, "c"}},
+			emittedBeforeClose: []string{"a", "b", "c", "d"},
+			emitted:            []string{"a", "b", "c", "d"},
+		},
+		{
+			name:               "blank outputs advance the order",
+			adds:               []chunk{{2, "c"}, {0, "  "}, {1, ""}},
+			emittedBeforeClose: []string{"c"},
+			emitted:            []string{"c"},
+		},
+		{
+			name:               "outputs are trimmed",
+			adds:               []chunk{{0, "\n a \n"}},
+			emittedBeforeClose: []string{"a"},
+			emitted:            []string{"a"},
+		},
+		{
+			name:               "close flushes outputs after a missing chunk",
+			adds:               []chunk{{0, "a"}, {3, "d"}, {2, "c"}},
+			emittedBeforeClose: []string{"a"},
+			emitted:            []string{"a", "c", "d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var emitted []string
+			combiner := NewOrderedCombiner(func(_ int, content string) error {
+				emitted = append(emitted, content)
+				return nil
+			})
+			for _, add := range tt.adds {
+				if err := combiner.Add(add.index, add.content); err != nil {
+					t.Fatalf("Add(%d): %v", add.index, err)
+				}
+			}
+			if !slices.Equal(emitted, tt.emittedBeforeClose) {
+				t.Errorf("emitted before Close = %q, want %q", emitted, tt.emittedBeforeClose)
+			}
+			if err := combiner.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if !slices.Equal(emitted, tt.emitted) {
+				t.Errorf("emitted = %q, want %q", emitted, tt.emitted)
+			}
+			if pending := combiner.Pending(); pending != 0 {
+				t.Errorf("Pending() = %d after Close, want 0", pending)
+			}
+		})
+	}
+}
+
+func TestOrderedCombinerEmitError(t *testing.T) {
+	failed := errors.New("client went away")
+	var emitted []int
+	combiner := NewOrderedCombiner(func(index int, _ string) error {
+		if index == 1 {
+			return failed
+		}
+		emitted = append(emitted, index)
+		return nil
+	})
+	if err := combiner.Add(2, "c"); err != nil {
+		t.Fatalf("Add(2): %v", err)
+	}
+	if err := combiner.Add(0, "a"); err != nil {
+		t.Fatalf("Add(0): %v", err)
+	}
+	if err := combiner.Add(1, "b"); !errors.Is(err, failed) {
+		t.Fatalf("Add(1) = %v, want %v", err, failed)
+	}
+	if err := combiner.Add(3, "d"); !errors.Is(err, failed) {
+		t.Errorf("Add after a failed emit = %v, want %v", err, failed)
+	}
+	if err := combiner.Close(); !errors.Is(err, failed) {
+		t.Errorf("Close = %v, want %v", err, failed)
+	}
+	if !slices.Equal(emitted, []int{0}) {
+		t.Errorf("emitted chunks %v, want [0]", emitted)
+	}
+}
+
+func TestTrimOverlap(t *testing.T) {
+	const text = "One two three four. Five six seven eight. Nine ten eleven twelve."
+	tests := []struct {
+		name  string
+		text  string
+		share float64
+		want  string
+	}{
+		{"no overlap", text, 0, text},
+		{"cut at the nearest sentence end", text, 0.25, "Five six seven eight. Nine ten eleven twelve."},
+		{"tie keeps the earlier sentence end", text, 0.5, "Five six seven eight. Nine ten eleven twelve."},
+		{"cut after two sentences", text, 0.7, "Nine ten eleven twelve."},
+		{"no sentence end near a small cut", text, 0.05, text},
+		{"whole output repeated", "One two three four.", 1, ""},
+		{"lines count as sentences", "One two\nthree four\nfive six", 0.3, "three four\nfive six"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimOverlap(tt.text, tt.share); got != tt.want {
+				t.Errorf("TrimOverlap(%q, %v) = %q, want %q", tt.text, tt.share, got, tt.want)
+			}
+		})
+	}
+}
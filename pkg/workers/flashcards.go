@@ -0,0 +1,49 @@
+package workers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/chunker"
+	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+)
+
+// MakeFlashcards derives question/answer pairs from processed output. The text is split on
+// paragraph boundaries like TranslateResult and each part goes through the worker pool; the
+// cards are returned in text order, without repeated questions.
+func MakeFlashcards(ctx context.Context, client *api.Client, text string, cfg *config.Config) []api.Flashcard {
+	chunks := chunker.ChunkByParagraph(ctx, text, cfg.ChunkSize)
+	model := fastModel(ctx, cfg)
+	perChunk := make([][]api.Flashcard, len(chunks))
+	runChunkPool(ctx, chunks, cfg, "flashcards", func(ctx context.Context, index int, chunk string, _ int) (string, error) {
+		cards, err := client.MakeFlashcards(ctx, model, chunk)
+		if err != nil {
+			return "", err
+		}
+		// Each worker writes only its own entry, so no locking is needed
+		perChunk[index] = cards
+		questions := make([]string, len(cards))
+		for i, card := range cards {
+			questions[i] = card.Question
+		}
+		return strings.Join(questions, "\n"), nil
+	})
+
+	seen := make(map[string]bool)
+	var cards []api.Flashcard
+	for _, chunkCards := range perChunk {
+		for _, card := range chunkCards {
+			card.Question, card.Answer = strings.TrimSpace(card.Question), strings.TrimSpace(card.Answer)
+			key := strings.ToLower(card.Question)
+			if card.Question == "" || card.Answer == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			cards = append(cards, card)
+		}
+	}
+	reqctx.Logger(ctx).Printf("Flashcards: %d cards from %d chunks", len(cards), len(chunks))
+	return cards
+}
@@ -0,0 +1,85 @@
+package workers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+)
+
+// maxGlossaryTerms caps the glossary of one document
+const maxGlossaryTerms = 60
+
+// ExtractGlossary extracts the key terms of every chunk through the worker pool and merges them
+// into one glossary. A term found in several chunks is listed once, with the definition from
+// the chunk it first appears in. Failed chunks only leave their terms out.
+func ExtractGlossary(ctx context.Context, client *api.Client, chunks []string, cfg *config.Config) []api.GlossaryTerm {
+	model := fastModel(ctx, cfg)
+	perChunk := make([][]api.GlossaryTerm, len(chunks))
+	runChunkPool(ctx, chunks, cfg, "glossary", func(ctx context.Context, index int, text string, _ int) (string, error) {
+		terms, err := client.ExtractTerms(ctx, model, text)
+		if err != nil {
+			return "", err
+		}
+		// Each worker writes only its own entry, so no locking is needed
+		perChunk[index] = terms
+		names := make([]string, len(terms))
+		for i, term := range terms {
+			names[i] = term.Term
+		}
+		return strings.Join(names, "\n"), nil
+	})
+
+	glossary := MergeGlossary(perChunk)
+	reqctx.Logger(ctx).Printf("Glossary: %d key terms from %d chunks", len(glossary), len(chunks))
+	return glossary
+}
+
+// MergeGlossary deduplicates the terms of several chunks, in chunk order, by their
+// case-insensitive spelling, and sorts them alphabetically. Past maxGlossaryTerms the terms of
+// later chunks are dropped.
+func MergeGlossary(perChunk [][]api.GlossaryTerm) []api.GlossaryTerm {
+	seen := make(map[string]bool)
+	var merged []api.GlossaryTerm
+	for _, terms := range perChunk {
+		for _, term := range terms {
+			term.Term, term.Definition = strings.TrimSpace(term.Term), strings.TrimSpace(term.Definition)
+			key := glossaryKey(term.Term)
+			if key == "" || term.Definition == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, term)
+		}
+	}
+	if len(merged) > maxGlossaryTerms {
+		merged = merged[:maxGlossaryTerms]
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return strings.ToLower(merged[i].Term) < strings.ToLower(merged[j].Term)
+	})
+	return merged
+}
+
+// glossaryKey normalizes a term for deduplication: case, surrounding punctuation and a plural "s"
+func glossaryKey(term string) string {
+	key := strings.ToLower(strings.Join(strings.Fields(term), " "))
+	key = strings.Trim(key, `.,;:!?"'*_`)
+	if len(key) > 3 && strings.HasSuffix(key, "s") && !strings.HasSuffix(key, "ss") {
+		key = strings.TrimSuffix(key, "s")
+	}
+	return key
+}
+
+// FormatGlossary renders terms as the markdown appendix of a condensed document
+func FormatGlossary(terms []api.GlossaryTerm) string {
+	var b strings.Builder
+	b.WriteString("# Glossary\n")
+	for _, term := range terms {
+		b.WriteString("\n- **" + term.Term + "**: " + term.Definition)
+	}
+	return b.String()
+}
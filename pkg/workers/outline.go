@@ -0,0 +1,89 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/chunker"
+	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/sections"
+)
+
+// outlineExcerptWords is how much of each section's opening text is sent for its gist, which
+// keeps an outline far cheaper than condensing the whole document
+const outlineExcerptWords = 300
+
+// Outline returns the heading hierarchy of a document with a one-line gist under each heading.
+// Every section gets one small call on its opening text through the worker pool. A document
+// without headings is split into chunks that the model names. A section whose call fails keeps
+// its heading without a gist.
+func Outline(ctx context.Context, client *api.Client, text string, cfg *config.Config) string {
+	logger := reqctx.Logger(ctx)
+	startTime := time.Now()
+
+	outline := sections.Sections(text)
+	if len(outline) == 1 && outline[0].Title == "" {
+		outline = nil
+		for _, chunk := range chunker.ChunkByParagraph(ctx, text, cfg.ChunkSize) {
+			outline = append(outline, sections.Section{Level: 1, Text: chunk})
+		}
+	}
+	if len(outline) == 0 {
+		return ""
+	}
+	logger.Printf("Outlining %d sections", len(outline))
+
+	excerpts := make([]string, len(outline))
+	for i, section := range outline {
+		words := strings.Fields(section.Text)
+		excerpts[i] = strings.Join(words[:min(len(words), outlineExcerptWords)], " ")
+	}
+
+	model := fastModel(ctx, cfg)
+	entries := make([]api.OutlineEntry, len(outline))
+	runChunkPool(ctx, excerpts, cfg, "outline", func(ctx context.Context, index int, excerpt string, _ int) (string, error) {
+		section := outline[index]
+		if excerpt == "" {
+			// A heading directly followed by a subheading has nothing of its own to summarize
+			entries[index] = api.OutlineEntry{Title: section.Title}
+			return section.Title, nil
+		}
+		entry, err := client.OutlineSection(ctx, model, section.Title, excerpt)
+		if err != nil {
+			return "", err
+		}
+		if section.Title != "" {
+			entry.Title = section.Title
+		}
+		// Each worker writes only its own entry, so no locking is needed
+		entries[index] = entry
+		return entry.Gist, nil
+	})
+	if ctx.Err() != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for i, section := range outline {
+		title, gist := entries[i].Title, strings.TrimSpace(entries[i].Gist)
+		if title == "" {
+			title = section.Title
+		}
+		if title == "" {
+			title = fmt.Sprintf("Part %d", i+1)
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(strings.Repeat("#", section.Level) + " " + title)
+		if gist != "" {
+			b.WriteString("\n" + gist)
+		}
+	}
+	logger.Printf("Outline completed in %v: %d sections", time.Since(startTime), len(outline))
+	return b.String()
+}
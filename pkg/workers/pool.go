@@ -3,9 +3,9 @@
 package workers
 
 import (
+	"cmp"
 	"context"
 	"fmt"
-	"log"
 	"strings"
 	"sync"
 	"time"
@@ -13,28 +13,200 @@ import (
 	"github.com/arnnvv/cutcrap/pkg/api"
 	"github.com/arnnvv/cutcrap/pkg/chunker"
 	"github.com/arnnvv/cutcrap/pkg/config"
+	"github.com/arnnvv/cutcrap/pkg/density"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+	"github.com/arnnvv/cutcrap/pkg/postprocess"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/router"
 	"github.com/arnnvv/cutcrap/pkg/transcript" // Needs the NEW parseSpeakerAnalysis and CombineTranscriptChunks
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
 )
 
+// ChunkResult is the output of one chunk together with the index of the input chunk it came from
+type ChunkResult struct {
+	Index   int
+	Content string
+}
+
+// Contents returns the outputs of results in the same order
+func Contents(results []ChunkResult) []string {
+	contents := make([]string, len(results))
+	for i, result := range results {
+		contents[i] = result.Content
+	}
+	return contents
+}
+
 // ProcessChunks processes text chunks in parallel.
 // For transcript mode, it now passes the Role->Name map to the API call.
-func ProcessChunks(ctx context.Context, chunks []string, cfg *config.Config, ratio float64, mode string, speakerRoleNameMap map[string]string) []string { // Takes map now
+// Results are strictly in chunk order. Failed and empty chunks are left out, so a result's
+// Index, not its position, is the input chunk it belongs to. words holds each chunk's word count
+// as returned by the chunker; when nil the chunks are counted here.
+func ProcessChunks(ctx context.Context, client *api.Client, chunks []string, words []int, cfg *config.Config, ratio float64, mode string, speakerRoleNameMap map[string]string) []ChunkResult { // Takes map now
+	var results []ChunkResult
+	StreamChunks(ctx, client, chunks, words, cfg, ratio, mode, speakerRoleNameMap, func(index int, content string) error {
+		results = append(results, ChunkResult{Index: index, Content: content})
+		return nil
+	})
+	return results
+}
+
+// StreamChunks is ProcessChunks with the outputs passed to emit in chunk order as soon as they
+// are ready (see OrderedCombiner) instead of being collected. Workers wait while emit blocks, so
+// a slow consumer holds back the job rather than buffering its output. An error from emit cancels
+// the remaining chunks and is returned.
+func StreamChunks(ctx context.Context, client *api.Client, chunks []string, words []int, cfg *config.Config, ratio float64, mode string, speakerRoleNameMap map[string]string, emit func(index int, content string) error) error {
+	logger := reqctx.Logger(ctx)
+	debug := reqctx.Debug(ctx)
+	isTranscript := mode == "transcript" || mode == "transcript_condensed"
+	if isTranscript && len(speakerRoleNameMap) > 0 {
+		debug.Printf("Using Speaker Role->Name map during chunk processing: %v", speakerRoleNameMap)
+	} else if isTranscript {
+		debug.Println("Processing transcript chunks WITHOUT speaker map context.")
+	}
+
+	targetWordCount := int(float64(cfg.ChunkSize) * ratio)
+	if targetWordCount <= 0 {
+		targetWordCount = 1
+	}
+
+	modelRouter := router.New(cfg.FastModel, cfg.StrongModel, cfg.RouteWordThreshold, cfg.RouteComplexityThreshold)
+	if model := api.OverridesFrom(ctx).Model; model != "" {
+		logger.Printf("Using model %s for every chunk (job override)", model)
+		modelRouter = router.New(model, "", 0, 0)
+	}
+	models := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		models[i] = modelRouter.Route(chunk)
+	}
+
+	if cacheName, cacheModel := createJobCache(ctx, client, chunks, models, cfg, targetWordCount, mode, speakerRoleNameMap); cacheName != "" {
+		defer func() {
+			// Use a fresh context so cleanup still happens when the job was cancelled
+			cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := client.DeleteCachedContext(cleanupCtx, cacheName); err != nil {
+				reqctx.Warn(ctx).Printf("Failed to delete cached context %s: %v", cacheName, err)
+			}
+		}()
+		return streamChunkPool(ctx, chunks, words, cfg, mode, func(ctx context.Context, index int, text string, words int) (string, error) {
+			return processFitting(ctx, client, mode, text, words, targetWordCount, func(ctx context.Context, text string, words, targetWordCount int) (string, error) {
+				// The cache is tied to its model; chunks routed elsewhere get the full prompt
+				if models[index] != cacheModel {
+					return client.ProcessTextWithMode(ctx, text, models[index], words, targetWordCount, mode, speakerRoleNameMap)
+				}
+				return client.ProcessChunkWithCache(ctx, text, cacheModel, mode, cacheName, words, targetWordCount)
+			})
+		}, emit)
+	}
+
+	// Without a shared cached prompt each chunk can get its own target, weighted by density
+	targets := make([]int, len(chunks))
+	for i := range targets {
+		targets[i] = targetWordCount
+	}
+	if cfg.DensityStrength > 0 && mode != "transcript" {
+		targets = density.Targets(chunks, ratio, cfg.DensityStrength)
+		logger.Printf("Density-weighted chunk targets (strength %.2f): %v", cfg.DensityStrength, targets)
+	}
+
+	return streamChunkPool(ctx, chunks, words, cfg, mode, func(ctx context.Context, index int, text string, words int) (string, error) {
+		return processFitting(ctx, client, mode, text, words, targets[index], func(ctx context.Context, text string, words, targetWordCount int) (string, error) {
+			return client.ProcessTextWithMode(ctx, text, models[index], words, targetWordCount, mode, speakerRoleNameMap)
+		})
+	}, emit)
+}
+
+// IsSmallInput reports whether text is under SMALL_INPUT_WORDS and goes to the model whole
+func IsSmallInput(cfg *config.Config, text string) bool {
+	return cfg.SmallInputWords > 0 && wordcount.Count(text) < cfg.SmallInputWords
+}
+
+// fastModel is the model of single calls made outside the chunk pool: the job's model override,
+// or FAST_MODEL
+func fastModel(ctx context.Context, cfg *config.Config) string {
+	return cmp.Or(api.OverridesFrom(ctx).Model, cfg.FastModel)
+}
+
+// ProcessWhole processes a small input with a single call, without chunking or the worker pool.
+// The target is ratio of the input's own length rather than of a full chunk.
+func ProcessWhole(ctx context.Context, client *api.Client, text string, cfg *config.Config, ratio float64, mode string, speakerRoleNameMap map[string]string) (string, error) {
+	model := router.New(cfg.FastModel, cfg.StrongModel, cfg.RouteWordThreshold, cfg.RouteComplexityThreshold).Route(text)
+	if override := api.OverridesFrom(ctx).Model; override != "" {
+		model = override
+	}
+	words := wordcount.Count(text)
+	targetWordCount := max(int(float64(words)*ratio), 1)
+	reqctx.Logger(ctx).Printf("Small input (%d words): processing in one call (mode: %s)", words, mode)
+	return client.ProcessWhole(ctx, text, model, targetWordCount, mode, speakerRoleNameMap)
+}
+
+// createJobCache caches the shared instructions and the whole document for large jobs, and
+// returns the cache with the model it is tied to: the job's model override, or FAST_MODEL. Only
+// chunks routed to that model (models[i] for chunk i) can use it. Returns "" when caching is
+// disabled, too few chunks would use the cache, or it could not be created.
+func createJobCache(ctx context.Context, client *api.Client, chunks, models []string, cfg *config.Config, targetWordCount int, mode string, speakerRoleNameMap map[string]string) (cacheName, model string) {
+	logger := reqctx.Logger(ctx)
+	overrides := api.OverridesFrom(ctx)
+	model = cfg.FastModel
+	if overrides.Model != "" {
+		model = overrides.Model
+	}
+	cached := 0
+	for _, chunkModel := range models {
+		if chunkModel == model {
+			cached++
+		}
+	}
+	if cfg.ContextCacheMinChunks <= 0 || cached < cfg.ContextCacheMinChunks {
+		return "", ""
+	}
+	instructions := api.BuildInstructions(mode, targetWordCount, speakerRoleNameMap, overrides)
+	cacheName, err := client.CreateCachedContext(ctx, model, instructions, strings.Join(chunks, "\n\n"), cfg.ContextCacheTTL)
+	if err != nil {
+		logger.Printf("Context caching unavailable, falling back to inline prompts: %v", err)
+		return "", ""
+	}
+	return cacheName, model
+}
+
+// chunkProcessor turns one input chunk of the given word count into its processed output
+type chunkProcessor func(ctx context.Context, index int, text string, words int) (string, error)
+
+// runChunkPool runs process over every chunk in parallel, bounded by cfg.MaxConcurrent.
+// The label is only used for logging. Failed and empty chunks are dropped from the result.
+func runChunkPool(ctx context.Context, chunks []string, cfg *config.Config, label string, process chunkProcessor) []string {
+	var results []string
+	streamChunkPool(ctx, chunks, nil, cfg, label, process, func(_ int, content string) error {
+		results = append(results, content)
+		return nil
+	})
+	return results
+}
+
+// streamChunkPool is runChunkPool passing each output to emit in chunk order as it is released
+// by an OrderedCombiner. words holds the chunks' word counts; when nil they are counted here.
+func streamChunkPool(ctx context.Context, chunks []string, words []int, cfg *config.Config, label string, process chunkProcessor, emit func(index int, content string) error) error {
+	logger := reqctx.Logger(ctx)
+	debug := reqctx.Debug(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	startTime := time.Now()
+	if words == nil {
+		words = make([]int, len(chunks))
+		for i, chunk := range chunks {
+			words[i] = wordcount.Count(chunk)
+		}
+	}
 	totalInputWords := 0
-	for _, chunk := range chunks {
-		totalInputWords += len(strings.Fields(chunk))
+	for _, count := range words {
+		totalInputWords += count
 	}
 
-	log.Printf("Starting to process %d chunks (mode: %s, total input: %d words)", len(chunks), mode, totalInputWords)
-	if mode == "transcript" && len(speakerRoleNameMap) > 0 {
-		log.Printf("Using Speaker Role->Name map during chunk processing: %v", speakerRoleNameMap)
-	} else if mode == "transcript" {
-		log.Println("Processing transcript chunks WITHOUT speaker map context.")
-	}
+	logger.Printf("Starting to process %d chunks (mode: %s, total input: %d words)", len(chunks), label, totalInputWords)
 
 	var (
 		wg         sync.WaitGroup
-		results    = make([]string, len(chunks))
 		semaphore  = make(chan struct{}, cfg.MaxConcurrent)
 		resultChan = make(chan struct {
 			index   int
@@ -46,29 +218,33 @@ func ProcessChunks(ctx context.Context, chunks []string, cfg *config.Config, rat
 	// Worker dispatcher goroutine
 	go func() {
 		defer close(resultChan)
-		log.Printf("Worker dispatcher: Starting %d workers.", len(chunks))
+		debug.Printf("Worker dispatcher: Starting %d workers.", len(chunks))
 		for i, chunk := range chunks {
 			if ctx.Err() != nil {
-				log.Printf("Ctx cancelled before dispatch chunk %d.", i)
+				debug.Printf("Ctx cancelled before dispatch chunk %d.", i)
 				break
 			}
 			wg.Add(1)
 			select {
 			case semaphore <- struct{}{}:
 			case <-ctx.Done():
-				log.Printf("Ctx cancelled waiting for semaphore chunk %d.", i)
+				debug.Printf("Ctx cancelled waiting for semaphore chunk %d.", i)
 				wg.Done()
 				return
 			}
 
-			// Pass the map to the worker
-			go func(index int, text string, roleNameMap map[string]string) {
+			go func(index int, text string, words int) {
+				ctx := metrics.WithChunkUsage(ctx, &metrics.ChunkUsage{Stage: label, Chunk: index})
 				chunkStartTime := time.Now()
 				var processedContent string
 				var processErr error
 				logPrefix := fmt.Sprintf("Worker chunk %d", index)
 				defer func() {
-					log.Printf("%s completed in %v", logPrefix, time.Since(chunkStartTime))
+					debug.Printf("%s completed in %v", logPrefix, time.Since(chunkStartTime))
+					// Chunks cut short by cancellation say nothing about the provider
+					if ctx.Err() == nil {
+						metrics.RecordChunk(ctx, time.Since(chunkStartTime), processErr != nil)
+					}
 					resultChan <- struct {
 						index   int
 						content string
@@ -79,128 +255,399 @@ func ProcessChunks(ctx context.Context, chunks []string, cfg *config.Config, rat
 				}()
 
 				if ctx.Err() != nil {
-					log.Printf("%s: Ctx cancelled before processing.", logPrefix)
+					debug.Printf("%s: Ctx cancelled before processing.", logPrefix)
 					processErr = ctx.Err()
 					return
 				}
 
-				targetWordCount := int(float64(cfg.ChunkSize) * ratio)
-				if targetWordCount <= 0 {
-					targetWordCount = 1
-				}
-
-				// Call API function, passing the roleNameMap
-				processedContent, processErr = api.ProcessTextWithMode(ctx, text, cfg.OpenRouterKey, targetWordCount, mode, roleNameMap) // Pass map
+				processedContent, processErr = processRecovering(ctx, process, index, text, words)
 
 				if processErr != nil {
-					log.Printf("%s: Error during API processing: %v", logPrefix, processErr)
+					reqctx.Error(ctx).Printf("%s: Error during API processing: %v", logPrefix, processErr)
 					processedContent = ""
 				} else if ctx.Err() != nil {
-					log.Printf("%s: Ctx cancelled after processing. Discarding.", logPrefix)
+					debug.Printf("%s: Ctx cancelled after processing. Discarding.", logPrefix)
 					processErr = ctx.Err()
 					processedContent = ""
 				} else {
-					log.Printf("%s: Successfully processed, result: %d words", logPrefix, len(strings.Fields(processedContent)))
+					debug.Printf("%s: Successfully processed, result: %d words", logPrefix, wordcount.Count(processedContent))
 				}
-			}(i, chunk, speakerRoleNameMap) // Pass map here
+			}(i, chunk, words[i])
 		}
-		log.Println("Worker dispatcher: All workers dispatched, waiting...")
+		debug.Println("Worker dispatcher: All workers dispatched, waiting...")
 		wg.Wait()
-		log.Println("Worker dispatcher: All workers completed.")
+		debug.Println("Worker dispatcher: All workers completed.")
 	}()
 
-	// Collect results
-	log.Println("Main thread: Collecting results...")
+	// Collect results, releasing them in order
+	debug.Println("Main thread: Collecting results...")
+	validResultsCount, totalOutputWords := 0, 0
+	combiner := NewOrderedCombiner(func(index int, content string) error {
+		validResultsCount++
+		totalOutputWords += wordcount.Count(content)
+		return emit(index, content)
+	})
 	processedCounter, errorCount := 0, 0
+	var emitErr error
 	for res := range resultChan {
 		processedCounter++
 		if res.err != nil {
 			errorCount++
-			log.Printf("Main thread: Error chunk %d: %v", res.index, res.err)
-		} else if res.index >= 0 && res.index < len(results) {
-			results[res.index] = res.content
-		} else {
+			reqctx.Error(ctx).Printf("Main thread: Error chunk %d: %v", res.index, res.err)
+		} else if res.index < 0 || res.index >= len(chunks) {
 			errorCount++
-			log.Printf("Error: Invalid index %d", res.index)
+			reqctx.Error(ctx).Printf("Invalid index %d", res.index)
+			continue
+		}
+		if emitErr != nil {
+			continue
+		}
+		// Failed chunks are added empty so they don't hold back the chunks after them
+		if emitErr = combiner.Add(res.index, res.content); emitErr != nil {
+			logger.Printf("Main thread: Emitting chunk output failed, cancelling remaining chunks: %v", emitErr)
+			cancel()
 		}
 	}
-	log.Printf("Main thread: Collection complete. Success: %d, Errors: %d", processedCounter-errorCount, errorCount)
+	if emitErr == nil {
+		emitErr = combiner.Close()
+	}
+	debug.Printf("Main thread: Collection complete. Success: %d, Errors: %d", processedCounter-errorCount, errorCount)
 
-	// Filter results
-	validResultsCount, totalOutputWords := 0, 0
-	var finalResults []string
-	for _, r := range results {
-		trimmedResult := strings.TrimSpace(r)
-		if trimmedResult != "" {
-			validResultsCount++
-			totalOutputWords += len(strings.Fields(trimmedResult))
-			finalResults = append(finalResults, trimmedResult)
-		}
+	logger.Printf("%s chunk processing completed in %v. Input: %d words, Output: %d words. Valid chunks: %d/%d",
+		label, time.Since(startTime), totalInputWords, totalOutputWords, validResultsCount, len(chunks))
+
+	return emitErr
+}
+
+// ProcessTranscript orchestrates: Analyze -> Chunk -> Process (with map) -> Combine (simple)
+func ProcessTranscript(ctx context.Context, client *api.Client, text string, cfg *config.Config, ratio float64) string {
+	logger := reqctx.Logger(ctx)
+	logger.Printf("Processing transcript (simple map approach) %d words, ratio %.2f", wordcount.Count(text), ratio)
+	overallStartTime := time.Now()
+
+	chunks, words, speakerRoleNameMap := prepareTranscript(ctx, client, text, cfg)
+	if len(chunks) == 0 {
+		return ""
 	}
 
-	// Log stats
-	if mode == "document" { /* ... log document stats ... */
-	} else { /* ... log transcript stats ... */
+	finalResult := processTranscriptTrack(ctx, client, chunks, words, cfg, ratio, "transcript", speakerRoleNameMap)
+
+	logger.Printf("Transcript processing completed in %v. Final words: %d", time.Since(overallStartTime), wordcount.Count(finalResult))
+	return finalResult
+}
+
+// ProcessTranscriptTurns is ProcessTranscript returning the speaker turns instead of the
+// formatted transcript, with the subtitle timings the model copied onto them
+func ProcessTranscriptTurns(ctx context.Context, client *api.Client, text string, cfg *config.Config, ratio float64) []transcript.Turn {
+	logger := reqctx.Logger(ctx)
+	logger.Printf("Processing transcript (turns) %d words, ratio %.2f", wordcount.Count(text), ratio)
+	overallStartTime := time.Now()
+
+	chunks, words, speakerRoleNameMap := prepareTranscript(ctx, client, text, cfg)
+	if len(chunks) == 0 {
+		return nil
 	}
-	log.Printf("%s chunk processing completed in %v. Input: %d words, Output: %d words. Valid chunks: %d/%d",
-		mode, time.Since(startTime), totalInputWords, totalOutputWords, validResultsCount, len(chunks))
 
-	return finalResults
+	turns := processTranscriptTurns(ctx, client, chunks, words, cfg, ratio, "transcript", speakerRoleNameMap)
+
+	logger.Printf("Transcript processing completed in %v. Turns: %d", time.Since(overallStartTime), len(turns))
+	return turns
 }
 
-// ProcessTranscript orchestrates: Analyze -> Chunk -> Process (with map) -> Combine (simple)
-func ProcessTranscript(ctx context.Context, text string, cfg *config.Config, ratio float64) string {
-	log.Printf("Processing transcript (simple map approach) %d words, ratio %.2f", len(strings.Fields(text)), ratio)
+// ProcessTranscriptTwoTrack produces the cleaned full-length transcript and a condensed
+// version in one job. Speaker analysis and chunking run once and are shared by both tracks.
+func ProcessTranscriptTwoTrack(ctx context.Context, client *api.Client, text string, cfg *config.Config, ratio float64) (full string, condensed string) {
+	logger := reqctx.Logger(ctx)
+	logger.Printf("Processing transcript (two-track) %d words, ratio %.2f", wordcount.Count(text), ratio)
 	overallStartTime := time.Now()
 
-	// --- Step 1: Analyze Speakers -> Get Role->Name Map ---
-	// Use the *new* parseSpeakerAnalysis which returns map[string]string
-	speakerAnalysisRaw, err := api.AnalyzeSpeakers(ctx, text, cfg.OpenRouterKey) // Still get raw text
+	chunks, words, speakerRoleNameMap := prepareTranscript(ctx, client, text, cfg)
+	if len(chunks) == 0 {
+		return "", ""
+	}
+
+	// Both tracks share the same semaphore size, so run them one after another to keep
+	// the total number of in-flight API calls within MaxConcurrent.
+	full = processTranscriptTrack(ctx, client, chunks, words, cfg, ratio, "transcript", speakerRoleNameMap)
+	if ctx.Err() != nil {
+		return "", ""
+	}
+	condensed = processTranscriptTrack(ctx, client, chunks, words, cfg, ratio, "transcript_condensed", speakerRoleNameMap)
+
+	logger.Printf("Two-track transcript processing completed in %v. Full: %d words, Condensed: %d words",
+		time.Since(overallStartTime), wordcount.Count(full), wordcount.Count(condensed))
+	return full, condensed
+}
+
+// ProcessTranscriptCompare condenses a transcript for two parameter sets. Speaker analysis and
+// chunking run once with ctx; each side then runs its chunks with its own context (carrying its
+// model and style) and ratio. The sides run concurrently with half of MaxConcurrent each, so
+// the total number of in-flight API calls stays the same.
+func ProcessTranscriptCompare(ctx context.Context, client *api.Client, text string, cfg *config.Config, sides [2]context.Context, ratios [2]float64) [2]string {
+	logger := reqctx.Logger(ctx)
+	logger.Printf("Processing transcript (compare) %d words, ratios %.2f and %.2f", wordcount.Count(text), ratios[0], ratios[1])
+	overallStartTime := time.Now()
+
+	var results [2]string
+	chunks, words, speakerRoleNameMap := prepareTranscript(ctx, client, text, cfg)
+	if len(chunks) == 0 {
+		return results
+	}
+
+	half := *cfg
+	half.MaxConcurrent = max(1, cfg.MaxConcurrent/2)
+	var wg sync.WaitGroup
+	for i := range sides {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = processTranscriptTrack(sides[i], client, chunks, words, &half, ratios[i], "transcript", speakerRoleNameMap)
+		}()
+	}
+	wg.Wait()
+
+	logger.Printf("Compare transcript processing completed in %v. Words: %d and %d",
+		time.Since(overallStartTime), wordcount.Count(results[0]), wordcount.Count(results[1]))
+	return results
+}
+
+// ProcessSpeakerSummary cleans the transcript like ProcessTranscript and then derives a
+// per-speaker summary from the combined result using the same role->name map.
+func ProcessSpeakerSummary(ctx context.Context, client *api.Client, text string, cfg *config.Config, ratio float64) string {
+	logger := reqctx.Logger(ctx)
+	logger.Printf("Processing transcript (speaker summary) %d words, ratio %.2f", wordcount.Count(text), ratio)
+	overallStartTime := time.Now()
+
+	chunks, words, speakerRoleNameMap := prepareTranscript(ctx, client, text, cfg)
+	if len(chunks) == 0 {
+		return ""
+	}
+
+	combined := processTranscriptTrack(ctx, client, chunks, words, cfg, ratio, "transcript", speakerRoleNameMap)
+	if combined == "" || ctx.Err() != nil {
+		return ""
+	}
+
+	summary, err := client.SummarizeBySpeaker(ctx, fastModel(ctx, cfg), combined, speakerRoleNameMap)
 	if err != nil {
-		log.Printf("WARNING: Speaker analysis failed: %v.", err)
+		logger.Printf("Speaker summary failed: %v", err)
+		return ""
+	}
+
+	logger.Printf("Speaker summary processing completed in %v. Final words: %d", time.Since(overallStartTime), wordcount.Count(summary))
+	return summary
+}
+
+type skipSpeakerAnalysisKey struct{}
+
+// WithoutSpeakerAnalysis makes transcript processing with ctx skip the speaker analysis call and
+// go straight to chunk processing with generic speaker labels, for input that already has clean
+// "Name:" tags
+func WithoutSpeakerAnalysis(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipSpeakerAnalysisKey{}, true)
+}
+
+func skipSpeakerAnalysis(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipSpeakerAnalysisKey{}).(bool)
+	return skip
+}
+
+type speakerNameRulesKey struct{}
+
+// WithSpeakerNameRules makes transcript processing with ctx unify speaker names by rules rather
+// than by matching short and titled forms alone
+func WithSpeakerNameRules(ctx context.Context, rules transcript.NameRules) context.Context {
+	return context.WithValue(ctx, speakerNameRulesKey{}, rules)
+}
+
+func speakerNameRules(ctx context.Context) transcript.NameRules {
+	rules, _ := ctx.Value(speakerNameRulesKey{}).(transcript.NameRules)
+	return rules
+}
+
+// prepareTranscript runs speaker analysis and chunking, returning the chunks with their word
+// counts. Returns nil chunks on failure.
+func prepareTranscript(ctx context.Context, client *api.Client, text string, cfg *config.Config) ([]string, []int, map[string]string) {
+	logger := reqctx.Logger(ctx)
+	// --- Step 1: Analyze Speakers -> Get Role->Name Map ---
+	var speakerAnalysisRaw string
+	var err error
+	if skipSpeakerAnalysis(ctx) {
+		logger.Printf("Skipping speaker analysis (requested)")
+	} else if speakerAnalysisRaw, err = client.AnalyzeSpeakers(ctx, text); err != nil {
+		reqctx.Warn(ctx).Printf("Speaker analysis failed: %v.", err)
 		speakerAnalysisRaw = ""
 	}
 	if ctx.Err() != nil {
-		log.Printf("Ctx cancelled during analysis.")
-		return ""
+		logger.Printf("Ctx cancelled during analysis.")
+		return nil, nil, nil
 	}
 
 	// Parse the raw analysis into the simple map
-	speakerRoleNameMap := transcript.ParseSpeakerAnalysis(speakerAnalysisRaw)
-	// -----------------------------
+	speakerRoleNameMap := transcript.ParseSpeakerAnalysis(speakerAnalysisRaw, speakerNameRules(ctx))
 
 	// --- Step 2: Chunk the Text ---
-	chunks, err := chunker.ChunkTextBySpace(text, cfg.ChunkSize, cfg.ChunkOverlap)
-	if err != nil {
-		log.Printf("Error chunking: %v", err)
-		return ""
+	// Small inputs are not chunked; processTranscriptTrack sends them whole
+	if IsSmallInput(cfg, text) {
+		return []string{text}, []int{wordcount.Count(text)}, speakerRoleNameMap
+	}
+	// Transcripts with speaker lines or subtitle cues are only split between turns
+	chunks, words, ok := chunker.ChunkByTurns(ctx, text, cfg.ChunkSize, cfg.ChunkOverlap)
+	if !ok {
+		chunks, words, err = chunker.ChunkTextBySpace(ctx, text, cfg.ChunkSize, cfg.ChunkOverlap)
+		if err != nil {
+			reqctx.Error(ctx).Printf("Error chunking: %v", err)
+			return nil, nil, nil
+		}
 	}
 	if len(chunks) == 0 {
-		log.Printf("Zero chunks created.")
+		logger.Printf("Zero chunks created.")
+		return nil, nil, nil
+	}
+	logger.Printf("Chunked transcript into %d parts.", len(chunks))
+	return chunks, words, speakerRoleNameMap
+}
+
+// processTranscriptTrack runs the chunk workers for one transcript mode and combines the output.
+func processTranscriptTrack(ctx context.Context, client *api.Client, chunks []string, words []int, cfg *config.Config, ratio float64, mode string, speakerRoleNameMap map[string]string) string {
+	doc, ok := processTranscriptDocument(ctx, client, chunks, words, cfg, ratio, mode, speakerRoleNameMap, &transcript.Format{Names: cfg.SpeakerNames})
+	if !ok || len(doc.Turns) == 0 {
 		return ""
 	}
-	log.Printf("Chunked transcript into %d parts.", len(chunks))
-	// -----------------------------
+	return doc.Text
+}
+
+// processTranscriptTurns runs the chunk workers for one transcript mode and returns the turns.
+func processTranscriptTurns(ctx context.Context, client *api.Client, chunks []string, words []int, cfg *config.Config, ratio float64, mode string, speakerRoleNameMap map[string]string) []transcript.Turn {
+	doc, _ := processTranscriptDocument(ctx, client, chunks, words, cfg, ratio, mode, speakerRoleNameMap, nil)
+	return doc.Turns
+}
 
+// processTranscriptDocument runs the chunk workers for one transcript mode, collects the turns
+// and runs them through postprocess.TranscriptStages, formatting them when format is not nil.
+// ok is false when no chunk was processed or ctx ended.
+func processTranscriptDocument(ctx context.Context, client *api.Client, chunks []string, words []int, cfg *config.Config, ratio float64, mode string, speakerRoleNameMap map[string]string, format *transcript.Format) (_ postprocess.Document, ok bool) {
+	logger := reqctx.Logger(ctx)
 	// --- Step 3: Process Chunks (Pass map to workers) ---
-	processedChunks := ProcessChunks(ctx, chunks, cfg, ratio, "transcript", speakerRoleNameMap) // Pass the map
-	// -----------------------------------------------------
+	var processedChunks []string
+	if len(chunks) == 1 && IsSmallInput(cfg, chunks[0]) {
+		result, err := ProcessWhole(ctx, client, chunks[0], cfg, ratio, mode, speakerRoleNameMap)
+		if err != nil {
+			reqctx.Error(ctx).Printf("Error processing small input: %v", err)
+		} else if strings.TrimSpace(result) != "" {
+			processedChunks = []string{result}
+		}
+	} else {
+		processedChunks = Contents(ProcessChunks(ctx, client, chunks, words, cfg, ratio, mode, speakerRoleNameMap))
+	}
 
 	if ctx.Err() != nil {
-		log.Printf("Ctx cancelled during chunk processing.")
-		return ""
+		logger.Printf("Ctx cancelled during chunk processing.")
+		return postprocess.Document{}, false
 	}
 	if len(processedChunks) == 0 {
-		log.Printf("No valid results from chunk processing.")
-		return ""
+		logger.Printf("No valid results from chunk processing.")
+		return postprocess.Document{}, false
+	}
+	logger.Printf("Successfully processed %d chunks via API (mode: %s).", len(processedChunks), mode)
+
+	// --- Step 4: Combine ---
+	doc := postprocess.Document{Mode: mode, Turns: transcript.CollectTurns(ctx, processedChunks)}
+	doc, err := postprocess.TranscriptStages(speakerRoleNameMap, speakerNameRules(ctx), format).Run(ctx, doc)
+	if err != nil {
+		logger.Printf("Combining transcript chunks failed: %v", err)
+		return postprocess.Document{}, false
 	}
-	log.Printf("Successfully processed %d chunks via API.", len(processedChunks))
+	return doc, true
+}
 
-	// --- Step 4: Combine and Final Format (Simple Bolding) ---
-	// Use the *new* CombineTranscriptChunks which doesn't need the map anymore
-	finalResult := transcript.CombineTranscriptChunks(processedChunks)
-	// -------------------------------------------------------------
+// toneBatchSize is how many speaker turns are labelled per API call
+const toneBatchSize = 25
 
-	log.Printf("Transcript processing completed in %v. Final words: %d", time.Since(overallStartTime), len(strings.Fields(finalResult)))
-	return finalResult
+// TagTurnTones fills in Sentiment and Tone on each turn. Turns are sent in batches,
+// at most cfg.MaxConcurrent at a time. A failed batch leaves its turns untagged.
+func TagTurnTones(ctx context.Context, client *api.Client, turns []transcript.Turn, cfg *config.Config) {
+	logger := reqctx.Logger(ctx)
+	startTime := time.Now()
+	logger.Printf("Starting tone tagging for %d turns (batch size %d)", len(turns), toneBatchSize)
+
+	model := fastModel(ctx, cfg)
+	var (
+		wg        sync.WaitGroup
+		semaphore = make(chan struct{}, cfg.MaxConcurrent)
+	)
+
+	for start := 0; start < len(turns); start += toneBatchSize {
+		end := min(start+toneBatchSize, len(turns))
+
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			logger.Printf("Ctx cancelled waiting for semaphore tone batch %d.", start/toneBatchSize)
+			wg.Wait()
+			return
+		}
+
+		wg.Add(1)
+		go func(batch []transcript.Turn) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					reqctx.Error(ctx).Printf("PANIC tagging tone batch: %v", recovered)
+				}
+				<-semaphore
+				wg.Done()
+			}()
+
+			lines := make([]string, len(batch))
+			for i, turn := range batch {
+				lines[i] = turn.Speaker + ": " + turn.Text
+			}
+
+			tags, err := client.TagTones(ctx, model, lines)
+			if err != nil {
+				logger.Printf("Tone batch failed: %v", err)
+				return
+			}
+			// Each goroutine writes only to its own sub-slice, so no locking is needed
+			for i := range batch {
+				batch[i].Sentiment = tags[i].Sentiment
+				batch[i].Tone = tags[i].Tone
+			}
+		}(turns[start:end])
+	}
+
+	wg.Wait()
+	logger.Printf("Tone tagging completed in %v", time.Since(startTime))
+}
+
+// TranslateResult runs a final translation pass over processed output. The text is split on
+// paragraph boundaries and translated through the same worker pool as the main pass. A chunk
+// whose translation fails keeps its original text, so nothing goes missing from the output.
+func TranslateResult(ctx context.Context, client *api.Client, text string, cfg *config.Config, targetLanguage string) string {
+	chunks := chunker.ChunkByParagraph(ctx, text, cfg.ChunkSize)
+	if len(chunks) == 0 {
+		return ""
+	}
+
+	model := fastModel(ctx, cfg)
+	translated := make([]string, len(chunks))
+	untranslated := 0
+	streamChunkPool(ctx, chunks, nil, cfg, "translate", func(ctx context.Context, _ int, chunk string, words int) (string, error) {
+		return processFitting(ctx, client, "translate", chunk, words, 0, func(ctx context.Context, chunk string, _, _ int) (string, error) {
+			return client.TranslateText(ctx, model, chunk, targetLanguage)
+		})
+	}, func(index int, content string) error {
+		translated[index] = content
+		return nil
+	})
+	for i, content := range translated {
+		if strings.TrimSpace(content) == "" {
+			translated[i] = chunks[i]
+			untranslated++
+		}
+	}
+	if untranslated > 0 {
+		reqctx.Warn(ctx).Printf("Translation failed for %d of %d chunks, keeping their original text", untranslated, len(chunks))
+	}
+	return strings.Join(translated, "\n\n")
 }
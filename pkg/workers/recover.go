@@ -0,0 +1,21 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+)
+
+// processRecovering runs process for one chunk, turning a panic (e.g. decoding a malformed
+// response) into that chunk's error so the rest of the job and the server carry on
+func processRecovering(ctx context.Context, process chunkProcessor, index int, text string, words int) (content string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			reqctx.Error(ctx).Printf("PANIC processing chunk %d: %v\n%s", index, recovered, debug.Stack())
+			content, err = "", fmt.Errorf("panic processing chunk %d: %v", index, recovered)
+		}
+	}()
+	return process(ctx, index, text, words)
+}
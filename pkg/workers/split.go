@@ -0,0 +1,52 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// maxSplitDepth bounds how often a chunk too long for the model's context is halved again
+const maxSplitDepth = 5
+
+// targetProcessor turns a chunk into output of about targetWordCount words
+type targetProcessor func(ctx context.Context, text string, words, targetWordCount int) (string, error)
+
+// processFitting runs process on a chunk, or on its halves (see api.SplitInHalf) when client
+// estimates it won't fit the model's context or the model rejects it as too long. Halves are
+// split again as needed, each with half the target, and their outputs joined with
+// api.JoinHalves, so a pathological chunk is condensed in pieces rather than dropped. words is
+// the chunk's word count; halves are counted as they are cut.
+func processFitting(ctx context.Context, client *api.Client, mode, text string, words, targetWordCount int, process targetProcessor) (string, error) {
+	return processFittingAt(ctx, client, mode, text, words, targetWordCount, process, 0)
+}
+
+func processFittingAt(ctx context.Context, client *api.Client, mode, text string, words, targetWordCount int, process targetProcessor, depth int) (string, error) {
+	canSplit := depth < maxSplitDepth && len(text) > 1
+	if canSplit && client.ExceedsContext(text) {
+		reqctx.Logger(ctx).Printf("Chunk of about %d tokens is over MAX_INPUT_TOKENS, splitting it in half", api.EstimateTokens(text))
+		return processHalves(ctx, client, mode, text, targetWordCount, process, depth)
+	}
+	result, err := process(ctx, text, words, targetWordCount)
+	if err == nil || !errors.Is(err, api.ErrContextLength) || !canSplit {
+		return result, err
+	}
+	reqctx.Logger(ctx).Printf("Chunk of %d words rejected as too long for the model's context, splitting it in half", words)
+	return processHalves(ctx, client, mode, text, targetWordCount, process, depth)
+}
+
+func processHalves(ctx context.Context, client *api.Client, mode, text string, targetWordCount int, process targetProcessor, depth int) (string, error) {
+	var outputs [2]string
+	for i, half := range api.SplitInHalf(text) {
+		output, err := processFittingAt(ctx, client, mode, half, wordcount.Count(half), max(targetWordCount/2, 1), process, depth+1)
+		if err != nil {
+			return "", fmt.Errorf("processing half %d of split chunk: %w", i+1, err)
+		}
+		outputs[i] = output
+	}
+	return api.JoinHalves(mode, outputs)
+}
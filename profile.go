@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+)
+
+// profile is a named set of processing defaults. Form fields sent with the profile override
+// its mode, ratio and format; style and model can only be set through a profile.
+type profile struct {
+	Mode   string
+	Ratio  float64
+	Style  string
+	Model  string
+	Format string
+}
+
+// parseProfiles parses the PROFILES setting: "name:key=value,key=value;name:..."
+func parseProfiles(spec string) (map[string]profile, error) {
+	profiles := make(map[string]profile)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, settings, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("profile %q must be written as name:key=value,...", entry)
+		}
+
+		var p profile
+		for _, setting := range strings.Split(settings, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(setting), "=")
+			if !ok {
+				return nil, fmt.Errorf("profile %s: setting %q must be key=value", name, setting)
+			}
+			switch key {
+			case "mode":
+				if processLabels[value] == "" {
+					return nil, fmt.Errorf("profile %s: unknown mode %q", name, value)
+				}
+				p.Mode = value
+			case "ratio":
+				ratio, err := strconv.ParseFloat(value, 64)
+				if err != nil || ratio <= 0 || ratio > 1 {
+					return nil, fmt.Errorf("profile %s: ratio must be > 0 and <= 1", name)
+				}
+				p.Ratio = ratio
+			case "style":
+				if _, ok := api.Styles[value]; !ok {
+					return nil, fmt.Errorf("profile %s: unknown style %q", name, value)
+				}
+				p.Style = value
+			case "model":
+				p.Model = value
+			case "format":
+				if value != api.FormatProse && value != api.FormatBullets {
+					return nil, fmt.Errorf("profile %s: format must be prose or bullets", name)
+				}
+				p.Format = value
+			default:
+				return nil, fmt.Errorf("profile %s: unknown setting %q", name, key)
+			}
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/cutcrap"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/metrics"
+	"github.com/arnnvv/cutcrap/pkg/reqctx"
+	"github.com/arnnvv/cutcrap/pkg/store"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// handleRefine condenses the output of a finished job further, to a new ratio of the original
+// source, instead of running the whole pipeline on the source again. The new job keeps the
+// original's settings and seed with the new ratio, so reprocessing it runs the full pipeline.
+func (s *server) handleRefine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	original, ok := s.ownedJob(w, r)
+	if !ok {
+		return
+	}
+	log.Printf("\n\n=== REFINE REQUEST === Job: %s", original.ID)
+	w, finish, ok := s.idempotent(w, r, map[string]string{"ratio": r.FormValue("ratio"), "priority": r.FormValue("priority")})
+	if !ok {
+		return
+	}
+	defer finish()
+
+	settings := original.Settings
+	if settings.TwoTrack || settings.TagTone || settings.ExecutiveSummary || settings.Flashcards != "" || settings.Output != "" || settings.Mode == cutcrap.ModeOutline {
+		writeRequestError(w, r, badRequest("Refining is not supported for two_track, tag_tone, executive_summary, flashcards, output=json or outline jobs"))
+		return
+	}
+	ratio, err := strconv.ParseFloat(r.FormValue("ratio"), 64)
+	if err != nil || ratio <= 0 || ratio >= settings.Ratio {
+		writeRequestError(w, r, badRequest("Invalid ratio value (must be > 0 and below the job's ratio of %g)", settings.Ratio))
+		return
+	}
+	priority, err := api.ParsePriority(strings.TrimSpace(r.FormValue("priority")))
+	if err != nil {
+		writeRequestError(w, r, badRequest("Invalid priority value: %v", err))
+		return
+	}
+	output, ok := s.jobOutput(original)
+	if !ok {
+		http.Error(w, "The output of this job is no longer available", http.StatusNotFound)
+		return
+	}
+
+	settings.Ratio = ratio
+	job := &jobs.Job{
+		ID:           jobs.NewID(),
+		CreatedAt:    time.Now(),
+		Settings:     settings,
+		Source:       original.Source,
+		DocumentHash: original.DocumentHash,
+		RefinedFrom:  original.ID,
+		Owner:        requestOwner(r),
+	}
+
+	ctx, cancel := context.WithTimeout(api.WithPriority(r.Context(), priority), jobTimeout(s.cfg, job.Source))
+	defer cancel()
+	s.running.add(job, cancel)
+	runInfo, stats := &api.RunInfo{Seed: &settings.Seed}, &metrics.PoolStats{}
+	ctx = api.WithRunInfo(ctx, runInfo)
+	ctx = metrics.WithPoolStats(ctx, stats)
+	ctx = reqctx.WithMetadata(ctx, reqctx.Metadata{JobID: job.ID, Tenant: r.Header.Get("X-Tenant-ID")})
+	defer s.recordJob(job, runInfo, stats)
+	w.Header().Set("X-Job-ID", job.ID)
+	if job.DocumentHash != "" {
+		w.Header().Set("X-Document-Hash", job.DocumentHash)
+	}
+
+	// The output is already original.Ratio of the source. It is in the target language when the
+	// job was translated, so it isn't translated again. Speaker summaries are plain prose by now.
+	opts := engineOptions(settings)
+	opts.Ratio, opts.TranslateTo = ratio/original.Settings.Ratio, ""
+	if opts.Glossary {
+		// The output already ends with its glossary, which is kept as it is
+		opts.Glossary, opts.KeepSections = false, append(opts.KeepSections, "Glossary")
+	}
+	mode := settings.Mode
+	if mode == cutcrap.ModeSpeakerSummary {
+		mode = cutcrap.ModeDocument
+	}
+	outputWordCount := wordcount.Count(output)
+	log.Printf("REFINE START | Job: %s | Of: %s | Mode: %s | Words: %d | Ratio: %.2f -> %.2f", job.ID, original.ID, mode, outputWordCount, original.Settings.Ratio, ratio)
+
+	result, err := s.engine.Condense(ctx, mode, output, opts)
+	if err != nil {
+		writeProcessError(w, r, mode, err)
+		return
+	}
+	log.Printf("RESPONSE READY (refined) | Input: %d words | Output: %d words", outputWordCount, wordcount.Count(result))
+
+	job.Output = result
+	s.saveResult(job, "txt", []byte(result))
+	s.writeResult(ctx, w, settings.Mode, result)
+}
+
+// jobOutput returns the plain-text output of a job, from memory or, for streamed results, from
+// the document store
+func (s *server) jobOutput(job *jobs.Job) (string, bool) {
+	if job.Output != "" {
+		return job.Output, true
+	}
+	if s.documents == nil || job.DocumentHash == "" {
+		return "", false
+	}
+	key, _, err := store.SettingsKey(job.Settings)
+	if err != nil {
+		return "", false
+	}
+	path := s.documents.ResultPath(job.DocumentHash, key+".txt")
+	if path == "" {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read stored result of job %s: %v", job.ID, err)
+		return "", false
+	}
+	return string(data), true
+}
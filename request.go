@@ -0,0 +1,606 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/i18n"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/sections"
+	"github.com/arnnvv/cutcrap/pkg/store"
+	"github.com/arnnvv/cutcrap/pkg/textenc"
+	"github.com/arnnvv/cutcrap/pkg/transcribe"
+	"github.com/arnnvv/cutcrap/pkg/transcript"
+	"github.com/arnnvv/cutcrap/pkg/webhook"
+)
+
+const (
+	maxTextFileSize = 10 << 20 // 10 MB
+	maxMergeFiles   = 50
+
+	// maxRequestSize caps the body of a /process request: the largest upload plus room for the
+	// other fields. It is read before the size of each file can be checked.
+	maxRequestSize = max(maxArchiveSize, maxAudioSize) + maxTextFileSize
+)
+
+// processFields are the form fields parseProcessRequest reads. They must be the properties of
+// the ProcessRequest schema in openapi.json, which checkOpenAPI verifies at startup.
+var processFields = []string{
+	"text", "file", "document", "upload", "files", "archive", "audio", "ratio", "mode", "two_track",
+	"tag_tone", "translate_to", "seed", "email_to", "webhook_url", "keep_sections", "prune_references",
+	"format", "executive_summary", "glossary", "flashcards", "skip_speaker_analysis", "speaker_aliases",
+	"keep_speaker_names", "output", "speaker_style", "speaker_separator", "turn_spacing", "revises",
+	"profile", "priority",
+}
+
+// processRequest is a decoded /process request, see processFields
+type processRequest struct {
+	Text        string
+	Charset     string // charset the text or text file was read as, "utf-8" unless converted
+	Document    string // hash of a stored source document
+	Archive     []byte // zip upload, nil when absent
+	Audio       []byte // audio upload to transcribe, nil when absent
+	AudioName   string
+	Ratio       float64
+	Mode        string
+	TwoTrack    bool
+	TagTone     bool
+	TranslateTo string
+	Seed        *int64 // nil when the client did not pick one
+	EmailTo     string
+	WebhookURL  string // result is POSTed here, signed, when the job finishes
+	Profile     string
+	Style       string // from the profile
+	Model       string // from the profile
+	Format      string // "prose" or "bullets"
+
+	// MergedFiles are the names of the files merged into Text, in order
+	MergedFiles []string
+
+	// KeepSections are heading patterns of sections to pass through verbatim
+	KeepSections []string
+
+	// PruneReferences drops reference list entries the output no longer cites
+	PruneReferences bool
+
+	// Glossary appends a glossary of key terms to the condensed document
+	Glossary bool
+
+	// ExecutiveSummary adds a one-paragraph executive summary to the condensed document
+	ExecutiveSummary bool
+
+	// Flashcards is the format of study flashcards returned instead of the output
+	Flashcards string
+
+	// SkipSpeakerAnalysis processes a transcript without the speaker analysis call
+	SkipSpeakerAnalysis bool
+
+	// SpeakerAliases are "Name=alias, alias" entries unifying the forms of a speaker's name
+	SpeakerAliases []string
+
+	// KeepSpeakerNames turns off the automatic unification of speaker names
+	KeepSpeakerNames bool
+
+	// Output is "json" for transcript turns as JSON instead of markdown, "" for markdown
+	Output string
+
+	// Priority orders this request's model calls against other jobs' when the server is busy
+	Priority api.Priority
+
+	// Revises is the hash of a stored previous version of the document, whose unchanged chunks
+	// are reused
+	Revises string
+
+	// SpeakerStyle ("plain"), SpeakerSeparator ("dash") and TurnSpacing ("newline") lay out a
+	// transcript; "" is the default of each
+	SpeakerStyle     string
+	SpeakerSeparator string
+	TurnSpacing      string
+}
+
+// requestError is a rejected request together with the response sent to the client
+type requestError struct {
+	Status  int
+	Message string
+	Fields  fieldErrors // the invalid fields, sent as JSON when set
+
+	// format and args are the English format of Message, translated when the error is sent. A
+	// Message set directly is translated as it is.
+	format string
+	args   []any
+}
+
+func (e *requestError) Error() string { return e.Message }
+
+// localized returns the message in lang
+func (e *requestError) localized(lang string) string {
+	if e.format == "" {
+		return i18n.Text(lang, e.Message)
+	}
+	return i18n.Sprintf(lang, e.format, e.args...)
+}
+
+func newRequestError(status int, format string, args ...any) *requestError {
+	return &requestError{Status: status, Message: fmt.Sprintf(format, args...), format: format, args: args}
+}
+
+func badRequest(format string, args ...any) *requestError {
+	return newRequestError(http.StatusBadRequest, format, args...)
+}
+
+// invalidField is badRequest for a single invalid field
+func invalidField(field, format string, args ...any) *requestError {
+	var errs fieldErrors
+	errs.add(field, format, args...)
+	return errs.err()
+}
+
+// fieldError is one invalid field of a request
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+
+	format string
+	args   []any
+}
+
+// fieldErrors collects the invalid fields of a request so they are all reported at once
+type fieldErrors []fieldError
+
+func (e *fieldErrors) add(field, format string, args ...any) {
+	*e = append(*e, fieldError{Field: field, Message: fmt.Sprintf(format, args...), format: format, args: args})
+}
+
+// err returns the collected fields as one bad request, or nil when there are none
+func (e fieldErrors) err() *requestError {
+	if len(e) == 0 {
+		return nil
+	}
+	messages := make([]string, len(e))
+	for i, field := range e {
+		messages[i] = field.Message
+	}
+	return &requestError{Status: http.StatusBadRequest, Message: strings.Join(messages, "; "), Fields: e}
+}
+
+// localized returns a copy of the fields with their messages in lang
+func (e fieldErrors) localized(lang string) fieldErrors {
+	translated := make(fieldErrors, len(e))
+	for i, field := range e {
+		translated[i] = fieldError{Field: field.Field, Message: i18n.Sprintf(lang, field.format, field.args...)}
+	}
+	return translated
+}
+
+// validationResponse is the body of a rejected request with invalid fields
+type validationResponse struct {
+	Error  string      `json:"error"`
+	Fields fieldErrors `json:"fields"`
+}
+
+// requestLanguage is the language error messages are sent to the client in, from its
+// Accept-Language header
+func requestLanguage(r *http.Request) string {
+	return i18n.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// writeRequestError logs and sends a parse or validation failure in the client's language.
+// Failures naming invalid fields are sent as a validationResponse, others as plain text.
+func writeRequestError(w http.ResponseWriter, r *http.Request, err error) {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		reqErr = &requestError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	logging.Errorf("VALIDATION FAILED: %s", reqErr.Message)
+	lang := requestLanguage(r)
+	w.Header().Set("Content-Language", lang)
+	if len(reqErr.Fields) == 0 {
+		http.Error(w, reqErr.localized(lang), reqErr.Status)
+		return
+	}
+	fields := reqErr.Fields.localized(lang)
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field.Message
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(reqErr.Status)
+	if err := json.NewEncoder(w).Encode(validationResponse{Error: strings.Join(messages, "; "), Fields: fields}); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// parseProcessRequest decodes the multipart form of a /process request, fills in the defaults of
+// the selected profile and validates it against the ProcessRequest schema. Other checks that
+// depend on server configuration are left to the handler.
+func parseProcessRequest(r *http.Request, profiles map[string]profile, uploads *store.UploadStore) (*processRequest, error) {
+	const maxMemory = 32 << 20 // 32 MB
+	r.Body = http.MaxBytesReader(nil, r.Body, maxRequestSize)
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		logging.Errorf("MULTIPART FORM PARSE ERROR: %v", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, newRequestError(http.StatusRequestEntityTooLarge, "Request is too large (at most %d MB)", maxRequestSize>>20)
+		}
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			return nil, badRequest("Invalid request format: Expected multipart/form-data")
+		}
+		return nil, badRequest("Invalid form data")
+	}
+
+	req := &processRequest{
+		Text:        r.FormValue("text"),
+		Document:    strings.TrimSpace(r.FormValue("document")),
+		Mode:        r.FormValue("mode"),
+		TwoTrack:    r.FormValue("two_track") == "true",
+		TagTone:     r.FormValue("tag_tone") == "true",
+		TranslateTo: strings.TrimSpace(r.FormValue("translate_to")),
+		EmailTo:     strings.TrimSpace(r.FormValue("email_to")),
+		WebhookURL:  strings.TrimSpace(r.FormValue("webhook_url")),
+		Profile:     strings.TrimSpace(r.FormValue("profile")),
+	}
+	ratioStr, seedStr := r.FormValue("ratio"), r.FormValue("seed")
+
+	// Form fields are raw bytes; text pasted from a non-UTF-8 page is converted like a file, and
+	// stray control characters are dropped
+	text, charset, err := textenc.DecodePasted([]byte(req.Text))
+	if err != nil {
+		return nil, invalidField("text", "Invalid text field: %v", err)
+	}
+	req.Text, req.Charset = text, charset
+
+	// A text file upload is processed like the text field, converted to UTF-8 first
+	if headers := r.MultipartForm.File["file"]; len(headers) > 0 {
+		if req.Text != "" || req.Document != "" {
+			return nil, invalidField("file", "file cannot be combined with text or document")
+		}
+		if req.Text, req.Charset, err = readTextFile(headers[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Several files are merged in form order into one document, each under its own heading
+	if headers := r.MultipartForm.File["files"]; len(headers) > 0 {
+		if req.Text != "" || req.Document != "" {
+			return nil, invalidField("files", "files cannot be combined with text, document or file")
+		}
+		if len(headers) > maxMergeFiles {
+			return nil, invalidField("files", "Too many files to merge (at most %d)", maxMergeFiles)
+		}
+		parts := make([]string, 0, len(headers))
+		for _, header := range headers {
+			text, _, err := readTextFile(header)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, mergeHeading(header.Filename)+"\n\n"+strings.TrimSpace(text))
+			req.MergedFiles = append(req.MergedFiles, header.Filename)
+		}
+		req.Text, req.Charset = strings.Join(parts, "\n\n"), textenc.UTF8
+	}
+
+	// A zip upload is processed member by member instead of the text field
+	if file, header, err := r.FormFile("archive"); err == nil {
+		defer file.Close()
+		if header.Size > maxArchiveSize {
+			return nil, &requestError{Status: http.StatusRequestEntityTooLarge, Message: "Archive is too large"}
+		}
+		if req.Archive, err = io.ReadAll(file); err != nil {
+			logging.Errorf("ARCHIVE READ FAILED: %v", err)
+			return nil, badRequest("Failed to read archive")
+		}
+	}
+
+	// An audio upload is transcribed and processed as a transcript
+	if file, header, err := r.FormFile("audio"); err == nil {
+		defer file.Close()
+		if !transcribe.Supported(header.Filename) {
+			return nil, invalidField("audio", "Unsupported audio format (expected %s)", strings.Join(transcribe.Formats, ", "))
+		}
+		if header.Size > maxAudioSize {
+			return nil, &requestError{Status: http.StatusRequestEntityTooLarge, Message: "Audio file is too large"}
+		}
+		if req.Audio, err = io.ReadAll(file); err != nil {
+			logging.Errorf("AUDIO READ FAILED: %v", err)
+			return nil, badRequest("Failed to read audio file")
+		}
+		req.AudioName = header.Filename
+		if req.Text != "" || req.Document != "" || req.Archive != nil {
+			return nil, invalidField("audio", "audio cannot be combined with text, document or archive")
+		}
+	}
+
+	// A resumable upload stands in for the file, archive or audio field its filename suggests
+	if id := strings.TrimSpace(r.FormValue("upload")); id != "" {
+		if req.Text != "" || req.Document != "" || req.Archive != nil || req.Audio != nil {
+			return nil, invalidField("upload", "upload cannot be combined with text, document, file, files, archive or audio")
+		}
+		if err := readUpload(req, uploads, id, requestOwner(r)); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Received Form Data: text(len)=%d, charset=%s, files=%q, archive(len)=%d, audio(len)=%d, document='%s', ratio='%s', mode='%s', two_track=%t, tag_tone=%t, translate_to='%s', seed='%s', email=%t, profile='%s', output='%s'",
+		len(req.Text), req.Charset, req.MergedFiles, len(req.Archive), len(req.Audio), req.Document, ratioStr, req.Mode, req.TwoTrack, req.TagTone, req.TranslateTo, seedStr, req.EmailTo != "", req.Profile, r.FormValue("output"))
+
+	// Every invalid field is collected and reported together
+	var errs fieldErrors
+	if len(req.Text) > maxTextFileSize {
+		errs.add("text", "Text is too large (at most %d MB)", maxTextFileSize>>20)
+	}
+
+	if req.Profile != "" {
+		if p, ok := profiles[req.Profile]; !ok {
+			errs.add("profile", "Unknown profile '%s'", req.Profile)
+		} else {
+			if ratioStr == "" && p.Ratio > 0 {
+				ratioStr = strconv.FormatFloat(p.Ratio, 'f', -1, 64)
+			}
+			if req.Mode == "" {
+				req.Mode = p.Mode
+			}
+			req.Style, req.Model = p.Style, p.Model
+			req.Format = p.Format
+		}
+	}
+
+	if ratioStr == "" && req.Mode == "outline" {
+		// An outline has no target length
+		ratioStr = "1"
+	}
+	if ratio, err := strconv.ParseFloat(ratioStr, 64); err != nil || ratio <= 0 || ratio > 1 {
+		errs.add("ratio", "Invalid ratio value (must be > 0 and <= 1)")
+	} else {
+		req.Ratio = ratio
+	}
+
+	if req.Mode == "" && req.Audio != nil {
+		req.Mode = "transcript"
+	}
+	if req.Mode == "" {
+		log.Printf("Mode field is missing, defaulting to 'document'")
+		req.Mode = "document"
+	}
+	modeValid := processLabels[req.Mode] != ""
+	if !modeValid {
+		errs.add("mode", "Invalid mode value (must be 'document', 'transcript', 'speaker_summary' or 'outline')")
+	}
+	// requireMode reports a field used outside the modes that support it. An invalid mode leaves
+	// nothing to check against, so only the mode itself is reported then.
+	requireMode := func(field, message string, modes ...string) {
+		if modeValid && !slices.Contains(modes, req.Mode) {
+			errs = append(errs, fieldError{Field: field, Message: message, format: message})
+		}
+	}
+	if len(req.MergedFiles) > 0 {
+		requireMode("files", "files is only supported in document and outline modes", "document", "outline")
+	}
+	if req.Audio != nil {
+		requireMode("audio", "audio uploads are only supported in transcript and speaker_summary modes", "transcript", "speaker_summary")
+	}
+
+	for _, pattern := range r.Form["keep_sections"] {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			req.KeepSections = append(req.KeepSections, pattern)
+		}
+	}
+	if len(req.KeepSections) > 0 {
+		requireMode("keep_sections", "keep_sections is only supported in document mode", "document")
+		if _, err := sections.CompileKeepList(req.KeepSections); err != nil {
+			errs.add("keep_sections", "Invalid keep_sections value: %v", err)
+		}
+	}
+
+	req.PruneReferences = r.FormValue("prune_references") == "true"
+	if req.PruneReferences {
+		requireMode("prune_references", "prune_references is only supported in document mode", "document")
+	}
+
+	if format := strings.TrimSpace(r.FormValue("format")); format != "" {
+		req.Format = format
+	}
+	if req.Format == api.FormatProse {
+		req.Format = ""
+	}
+	if req.Format != "" && req.Format != api.FormatBullets {
+		errs.add("format", "Invalid format value (must be 'prose' or 'bullets')")
+	} else if req.Format != "" {
+		requireMode("format", "format is only supported in document mode", "document")
+	}
+
+	req.Glossary = r.FormValue("glossary") == "true"
+	if req.Glossary {
+		requireMode("glossary", "glossary is only supported in document mode", "document")
+	}
+
+	req.ExecutiveSummary = r.FormValue("executive_summary") == "true"
+	if req.ExecutiveSummary {
+		requireMode("executive_summary", "executive_summary is only supported in document mode", "document")
+	}
+
+	req.Flashcards = strings.ToLower(strings.TrimSpace(r.FormValue("flashcards")))
+	if req.Flashcards != "" && flashcardFormats[req.Flashcards] == "" {
+		errs.add("flashcards", "Invalid flashcards value (must be 'csv', 'tsv' or 'json')")
+	}
+
+	if _, sent := r.Form["translate_to"]; sent {
+		if name, ok := api.LanguageName(req.TranslateTo); req.TranslateTo == "" {
+			errs.add("translate_to", "translate_to must not be empty")
+		} else if !ok {
+			errs.add("translate_to", "Unknown translate_to language '%s' (use an ISO 639-1 code such as 'de')", req.TranslateTo)
+		} else {
+			req.TranslateTo = name
+		}
+	}
+
+	req.SkipSpeakerAnalysis = r.FormValue("skip_speaker_analysis") == "true"
+	if req.SkipSpeakerAnalysis {
+		requireMode("skip_speaker_analysis", "skip_speaker_analysis is only supported in transcript and speaker_summary modes", "transcript", "speaker_summary")
+	}
+
+	for _, entry := range r.Form["speaker_aliases"] {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			req.SpeakerAliases = append(req.SpeakerAliases, entry)
+		}
+	}
+	if len(req.SpeakerAliases) > 0 {
+		requireMode("speaker_aliases", "speaker_aliases is only supported in transcript mode", "transcript")
+		if _, err := transcript.ParseAliases(req.SpeakerAliases); err != nil {
+			errs.add("speaker_aliases", "Invalid speaker_aliases value: %v", err)
+		}
+	}
+	req.KeepSpeakerNames = r.FormValue("keep_speaker_names") == "true"
+	if req.KeepSpeakerNames {
+		requireMode("keep_speaker_names", "keep_speaker_names is only supported in transcript mode", "transcript")
+	}
+
+	if req.TwoTrack {
+		requireMode("two_track", "two_track is only supported in transcript mode", "transcript")
+	}
+	if req.TagTone {
+		if req.TwoTrack {
+			errs.add("tag_tone", "tag_tone is only supported in transcript mode without two_track")
+		} else {
+			requireMode("tag_tone", "tag_tone is only supported in transcript mode without two_track", "transcript")
+		}
+	}
+	if req.Flashcards != "" {
+		requireMode("flashcards", "flashcards is not supported in outline mode", "document", "transcript", "speaker_summary")
+		if req.TwoTrack || req.TagTone || req.ExecutiveSummary {
+			errs.add("flashcards", "flashcards cannot be combined with two_track, tag_tone or executive_summary")
+		}
+	}
+	req.Output = strings.ToLower(strings.TrimSpace(r.FormValue("output")))
+	if req.Output == "markdown" {
+		req.Output = ""
+	}
+	switch req.Output {
+	case "":
+	case "json", "srt", "vtt", "podlove_chapters", "id3_chapters":
+		requireMode("output", "Output formats other than markdown are only supported in transcript mode", "transcript")
+		if req.TwoTrack || req.Flashcards != "" || req.Archive != nil {
+			errs.add("output", "output=%s cannot be combined with two_track, flashcards or archive uploads", req.Output)
+		} else if req.Output != "json" && req.TagTone {
+			errs.add("output", "output=%s cannot be combined with tag_tone", req.Output)
+		}
+	default:
+		errs.add("output", "Invalid output value (must be 'markdown', 'json', 'srt', 'vtt', 'podlove_chapters' or 'id3_chapters')")
+	}
+	// Transcript layout options; the defaults are stored as ""
+	layout := []struct {
+		field, defaultValue, other string
+		value                      *string
+	}{
+		{"speaker_style", "bold", "plain", &req.SpeakerStyle},
+		{"speaker_separator", "colon", "dash", &req.SpeakerSeparator},
+		{"turn_spacing", "blank_line", "newline", &req.TurnSpacing},
+	}
+	for _, option := range layout {
+		value := strings.ToLower(strings.TrimSpace(r.FormValue(option.field)))
+		switch value {
+		case "", option.defaultValue:
+		case option.other:
+			*option.value = value
+			requireMode(option.field, "speaker_style, speaker_separator and turn_spacing are only supported in transcript mode", "transcript")
+			if req.TagTone || req.Output != "" {
+				errs.add(option.field, "speaker_style, speaker_separator and turn_spacing cannot be combined with tag_tone or an output other than markdown")
+			}
+		default:
+			errs.add(option.field, "Invalid %s value (must be '%s' or '%s')", option.field, option.defaultValue, option.other)
+		}
+	}
+
+	req.Revises = strings.TrimSpace(r.FormValue("revises"))
+	if req.Revises != "" {
+		requireMode("revises", "revises is only supported in document mode", "document")
+		if req.Archive != nil {
+			errs.add("revises", "revises cannot be combined with archive uploads")
+		}
+	}
+	if req.Archive != nil && (req.TwoTrack || req.TagTone || req.ExecutiveSummary || req.Flashcards != "") {
+		errs.add("archive", "two_track, tag_tone, executive_summary and flashcards are not supported for archive uploads")
+	}
+
+	if priority, err := api.ParsePriority(strings.TrimSpace(r.FormValue("priority"))); err != nil {
+		errs.add("priority", "Invalid priority value: %v", err)
+	} else {
+		req.Priority = priority
+	}
+
+	if seedStr != "" {
+		if seed, err := strconv.ParseInt(seedStr, 10, 64); err != nil {
+			errs.add("seed", "Invalid seed value (must be an integer)")
+		} else {
+			req.Seed = &seed
+		}
+	}
+
+	if req.EmailTo != "" {
+		if addr, err := mail.ParseAddress(req.EmailTo); err != nil {
+			errs.add("email_to", "Invalid email_to address")
+		} else {
+			req.EmailTo = addr.Address
+		}
+	}
+	if req.WebhookURL != "" {
+		u, err := url.Parse(req.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.add("webhook_url", "Invalid webhook_url (must be an http or https URL)")
+		} else if ip, err := netip.ParseAddr(strings.Trim(u.Hostname(), "[]")); (err == nil && !webhook.IsPublic(ip)) || strings.EqualFold(u.Hostname(), "localhost") {
+			// Names are checked again on every connection, after they resolve
+			errs.add("webhook_url", "Invalid webhook_url (must be a public address)")
+		}
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// readTextFile reads a text file upload and converts it to UTF-8
+func readTextFile(header *multipart.FileHeader) (string, string, error) {
+	if header.Size > maxTextFileSize {
+		return "", "", newRequestError(http.StatusRequestEntityTooLarge, "Text file '%s' is too large", header.Filename)
+	}
+	file, err := header.Open()
+	if err != nil {
+		logging.Errorf("TEXT FILE READ FAILED: %v", err)
+		return "", "", badRequest("Failed to read text file '%s'", header.Filename)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		logging.Errorf("TEXT FILE READ FAILED: %v", err)
+		return "", "", badRequest("Failed to read text file '%s'", header.Filename)
+	}
+	text, charset, err := textenc.Decode(data, header.Header.Get("Content-Type"))
+	if err != nil {
+		return "", "", newRequestError(http.StatusUnsupportedMediaType, "Unsupported text file '%s': %v", header.Filename, err)
+	}
+	if charset != textenc.UTF8 {
+		log.Printf("Converted text file '%s' from %s to UTF-8", header.Filename, charset)
+	}
+	return text, charset, nil
+}
+
+// mergeHeading is the section heading a merged file goes under: its name without the extension
+func mergeHeading(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if trimmed := strings.TrimSuffix(name, path.Ext(name)); trimmed != "" {
+		name = trimmed
+	}
+	return "# " + strings.NewReplacer("_", " ", "\n", " ").Replace(name)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/api"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/search"
+)
+
+// Result counts of /search
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchResult is a job whose output matches a /search query
+type searchResult struct {
+	JobID        string    `json:"job_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Mode         string    `json:"mode"`
+	DocumentHash string    `json:"document_hash,omitempty"`
+	Score        float64   `json:"score"`
+	Snippet      string    `json:"snippet"`
+}
+
+// handleSearch finds the recorded jobs whose plain-text output contains every word of q
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query, limit, ok := searchParams(w, r)
+	if !ok {
+		return
+	}
+
+	hits, total := s.index.Search(query, requestOwner(r), limit)
+	log.Printf("SEARCH | Query: %q | Matches: %d", query, total)
+	s.writeSearchResults(w, query, total, hits)
+}
+
+// searchParams reads the q and limit parameters of a search, or responds with an error
+func searchParams(w http.ResponseWriter, r *http.Request) (query string, limit int, ok bool) {
+	query = strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeRequestError(w, r, badRequest("Missing q parameter"))
+		return "", 0, false
+	}
+	limit = defaultSearchLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n <= 0 || n > maxSearchLimit {
+			writeRequestError(w, r, badRequest("Invalid limit value (must be between 1 and %d)", maxSearchLimit))
+			return "", 0, false
+		}
+		limit = n
+	}
+	return query, limit, true
+}
+
+// writeSearchResults responds with the hits whose jobs are still recorded
+func (s *server) writeSearchResults(w http.ResponseWriter, query string, total int, hits []search.Hit) {
+	results := make([]searchResult, 0, len(hits))
+	for _, hit := range hits {
+		job, ok := s.jobs.Get(hit.ID)
+		if !ok {
+			continue
+		}
+		results = append(results, searchResult{
+			JobID:        job.ID,
+			CreatedAt:    job.CreatedAt,
+			Mode:         job.Settings.Mode,
+			DocumentHash: job.DocumentHash,
+			Score:        hit.Score,
+			Snippet:      hit.Snippet,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"query": query, "total": total, "results": results}); err != nil {
+		logging.Errorf("JSON ENCODE FAILED: %v", err)
+	}
+}
+
+// handleSemanticSearch finds the recorded jobs whose output is closest in meaning to q
+func (s *server) handleSemanticSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.vectors == nil {
+		http.Error(w, "Semantic search is not enabled on this server", http.StatusNotFound)
+		return
+	}
+	query, limit, ok := searchParams(w, r)
+	if !ok {
+		return
+	}
+
+	vectors, err := s.engine.Embed(r.Context(), api.EmbedQuery, []string{query})
+	if err != nil {
+		log.Printf("Failed to embed search query: %v", err)
+		http.Error(w, "Failed to embed query", http.StatusBadGateway)
+		return
+	}
+	hits, total := s.vectors.Search(vectors[0], requestOwner(r), limit)
+	log.Printf("SEMANTIC SEARCH | Query: %q | Indexed jobs: %d", query, s.vectors.Len())
+	s.writeSearchResults(w, query, total, hits)
+}
+
+// indexJob adds a recorded job's plain-text output to the search index and, with semantic search
+// enabled, embeds it in the background. JSON results have none and are not searchable.
+func (s *server) indexJob(job *jobs.Job) {
+	output, ok := s.jobOutput(job)
+	if !ok {
+		return
+	}
+	s.index.Add(job.ID, job.Owner, output)
+	if s.vectors != nil {
+		go s.embedJob(job.ID, job.Owner, output)
+	}
+}
+
+// passageWords is the size of the passages job outputs are embedded in
+const passageWords = 200
+
+// embedJob embeds the passages of a job's output and adds them to the vector index
+func (s *server) embedJob(id, owner, output string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.RequestTimeout)
+	defer cancel()
+	texts := search.Passages(output, passageWords)
+	vectors, err := s.engine.Embed(ctx, api.EmbedDocument, texts)
+	if err != nil {
+		logging.Warnf("Failed to embed output of job %s: %v", id, err)
+		return
+	}
+	passages := make([]search.Passage, len(texts))
+	for i, text := range texts {
+		passages[i] = search.Passage{Text: text, Vector: vectors[i]}
+	}
+	// The job may have been evicted while its output was embedded; adding under the store's lock
+	// keeps an eviction from slipping in between the check and the add
+	if !s.jobs.WithJob(id, func(*jobs.Job) { s.vectors.Add(id, owner, passages) }) {
+		return
+	}
+	log.Printf("Job %s embedded for semantic search (%d passages)", id, len(passages))
+}
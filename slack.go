@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/slack"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+const maxSlackBody = 1 << 20 // 1 MB; slash command text and event payloads are small
+
+// slackEvent is the subset of the Events API envelope that is handled
+type slackEvent struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Event     struct {
+		Type      string `json:"type"`
+		FileID    string `json:"file_id"`
+		ChannelID string `json:"channel_id"`
+		UserID    string `json:"user_id"`
+	} `json:"event"`
+}
+
+// handleSlack serves slash commands and Events API callbacks. Slack expects an answer within
+// three seconds, so requests are acknowledged right away and processed in the background.
+func (s *server) handleSlack(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSlackBody))
+	if err != nil {
+		http.Error(w, "Failed to read request", http.StatusBadRequest)
+		return
+	}
+	if err := slack.Verify(s.cfg.SlackSigningSecret, r.Header.Get("X-Slack-Request-Timestamp"), r.Header.Get("X-Slack-Signature"), body, time.Now()); err != nil {
+		logging.Errorf("SLACK VERIFICATION FAILED: %v", err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		s.handleSlackEvent(w, r, body)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	s.handleSlackCommand(w, form)
+}
+
+// handleSlackCommand processes "/condense [ratio=0.3] [mode=document] <text>" and replies via response_url
+func (s *server) handleSlackCommand(w http.ResponseWriter, form url.Values) {
+	responseURL := form.Get("response_url")
+	log.Printf("SLACK COMMAND %s from user %s in channel %s", form.Get("command"), form.Get("user_id"), form.Get("channel_id"))
+
+	settings, text, err := s.chatSettings(form.Get("text"))
+	if err != nil {
+		writeSlackReply(w, "Could not read options: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(text) == "" {
+		writeSlackReply(w, fmt.Sprintf("Usage: %s [ratio=0.5] [mode=document|transcript|speaker_summary|outline] <text>", form.Get("command")))
+		return
+	}
+
+	go func() {
+		ctx := context.Background()
+		reply := s.runChatJob(ctx, "slack", text, settings)
+		if err := s.slack.Respond(ctx, responseURL, reply, true); err != nil {
+			logging.Errorf("SLACK REPLY FAILED: %v", err)
+		}
+	}()
+	writeSlackReply(w, fmt.Sprintf("Condensing %d words (mode: %s, ratio: %.2f)…", wordcount.Count(text), settings.Mode, settings.Ratio))
+}
+
+// handleSlackEvent answers url_verification and processes file_shared events in the file's thread
+func (s *server) handleSlackEvent(w http.ResponseWriter, r *http.Request, body []byte) {
+	var event slackEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "Invalid event payload", http.StatusBadRequest)
+		return
+	}
+
+	if event.Type == "url_verification" {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, event.Challenge)
+		return
+	}
+
+	// Slack retries events it thinks timed out; the first delivery is already being processed
+	if r.Header.Get("X-Slack-Retry-Num") != "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if event.Type == "event_callback" && event.Event.Type == "file_shared" {
+		log.Printf("SLACK FILE SHARED %s by user %s in channel %s", event.Event.FileID, event.Event.UserID, event.Event.ChannelID)
+		go s.processSlackFile(context.Background(), event.Event.FileID, event.Event.ChannelID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// processSlackFile downloads a shared text file, condenses it and replies in the thread that shared it
+func (s *server) processSlackFile(ctx context.Context, fileID, channel string) {
+	file, err := s.slack.FileInfo(ctx, fileID)
+	if err != nil {
+		logging.Errorf("SLACK FILE LOOKUP FAILED: %v", err)
+		return
+	}
+	threadTS := file.ThreadTS(channel)
+
+	reply := func(text string) {
+		if err := s.slack.PostMessage(ctx, channel, threadTS, text); err != nil {
+			logging.Errorf("SLACK REPLY FAILED: %v", err)
+		}
+	}
+
+	data, err := s.slack.Download(ctx, file.URLPrivateDownload)
+	if err != nil {
+		logging.Errorf("SLACK FILE DOWNLOAD FAILED: %v", err)
+		reply("Could not download " + file.Name + ".")
+		return
+	}
+	if !utf8.Valid(data) {
+		reply("Only plain text files can be condensed; " + file.Name + " is not text.")
+		return
+	}
+
+	settings, _, _ := s.chatSettings("")
+	reply(s.runChatJob(ctx, "slack", string(data), settings))
+}
+
+// writeSlackReply sends an immediate ephemeral reply to a slash command
+func writeSlackReply(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": text})
+}
+
+// chatSettings builds job settings for chat integrations from leading inline options such as
+// "ratio=0.3 mode=document", returning the remaining text
+func (s *server) chatSettings(text string) (jobs.Settings, string, error) {
+	settings := jobs.Settings{
+		Mode:  s.cfg.IntegrationMode,
+		Ratio: s.cfg.IntegrationRatio,
+		Seed:  rand.Int64N(1 << 31),
+	}
+
+	rest := strings.TrimSpace(text)
+	for {
+		token, remainder := rest, ""
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			token, remainder = rest[:i], rest[i:]
+		}
+		key, value, ok := strings.Cut(token, "=")
+		if !ok {
+			break
+		}
+		switch key {
+		case "ratio":
+			ratio, err := strconv.ParseFloat(value, 64)
+			if err != nil || ratio <= 0 || ratio > 1 {
+				return settings, "", fmt.Errorf("ratio must be > 0 and <= 1")
+			}
+			settings.Ratio = ratio
+		case "mode":
+			if processLabels[value] == "" {
+				return settings, "", fmt.Errorf("mode must be 'document', 'transcript', 'speaker_summary' or 'outline'")
+			}
+			settings.Mode = value
+		default:
+			return settings, rest, nil // Not an option; the text itself starts with "key=value"
+		}
+		rest = strings.TrimSpace(remainder)
+	}
+	return settings, rest, nil
+}
+
+// runChatJob processes text for a chat integration and returns the message to post back
+func (s *server) runChatJob(ctx context.Context, source, text string, settings jobs.Settings) string {
+	job := &jobs.Job{
+		ID:        jobs.NewID(),
+		CreatedAt: time.Now(),
+		Settings:  settings,
+		Source:    text,
+	}
+	log.Printf("CHAT JOB (%s) | Job: %s | Mode: %s | Words: %d", source, job.ID, settings.Mode, wordcount.Count(text))
+
+	result, err := s.runTextJob(ctx, job)
+	if err != nil {
+		logging.Errorf("CHAT JOB FAILED (%s) | Job: %s | %v", source, job.ID, err)
+		return fmt.Sprintf("Sorry, processing failed (job %s).", job.ID)
+	}
+	if strings.TrimSpace(result) == "" {
+		return fmt.Sprintf("Processing produced no output (job %s).", job.ID)
+	}
+	return result
+}
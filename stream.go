@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/cutcrap"
+	"github.com/arnnvv/cutcrap/pkg/jobs"
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/store"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// shouldStream reports whether a plain-text result is large enough to be streamed. PDF output
+// needs the whole text, so streaming is off when PDF_API is set.
+func (s *server) shouldStream(mode string, settings jobs.Settings, inputWordCount int) bool {
+	if s.cfg.StreamMinWords <= 0 || inputWordCount < s.cfg.StreamMinWords || s.cfg.Pdf_api != "" {
+		return false
+	}
+	return s.engine.CanStream(mode, engineOptions(settings))
+}
+
+// streamResult condenses a job straight into the response, and into the document store when
+// enabled, flushing after every chunk. A slow client blocks the writes instead of the output
+// piling up in memory.
+func (s *server) streamResult(ctx context.Context, w http.ResponseWriter, r *http.Request, job *jobs.Job, opts cutcrap.Options, inputWordCount int) {
+	mode := job.Settings.Mode
+	out := &responseStream{w: w, filename: resultFilename(mode, "txt")}
+
+	out.tee = s.createResult(job)
+
+	log.Printf("Streaming response as plain text (input of %d words)", inputWordCount)
+	err := s.engine.CondenseTo(ctx, mode, job.Source, opts, out)
+	if err != nil {
+		if out.tee != nil {
+			out.tee.Abort()
+		}
+		if out.written == 0 {
+			writeProcessError(w, r, mode, err)
+			return
+		}
+		logging.Errorf("STREAM FAILED after %d bytes: %v", out.written, err)
+		markFailed(w)
+		return
+	}
+	out.start()
+
+	if out.tee != nil {
+		if err := out.tee.Commit(); err != nil {
+			logging.Warnf("Failed to store result for job %s: %v", job.ID, err)
+		}
+	}
+	log.Printf("RESPONSE STREAMED | Input: %d words | Output: %d bytes", inputWordCount, out.written)
+}
+
+// streamEvents sends a job's output as server-sent events: "start" with the job ID and an
+// estimated chunk count, a "chunk" event for every processed chunk as soon as it is ready in
+// order, then "done" with the job ID, or "error" with the message an HTTP error response would
+// have carried
+func (s *server) streamEvents(ctx context.Context, w http.ResponseWriter, r *http.Request, job *jobs.Job, opts cutcrap.Options) {
+	mode := job.Settings.Mode
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	log.Printf("Streaming response as server-sent events")
+	if s.cfg.HeartbeatMode != "off" {
+		if hb := startHeartbeat(w, s.cfg.HeartbeatInterval, ": keep-alive\n\n", false, nil); hb != nil {
+			defer hb.Stop()
+			w = hb
+		}
+	}
+
+	// The chunk estimate lets clients show progress; the actual count can differ a little
+	words, step := wordcount.Count(job.Source), max(s.cfg.ChunkSize-s.cfg.ChunkOverlap, 1)
+	start, _ := json.Marshal(map[string]any{"job_id": job.ID, "estimated_chunks": max((words+step-1)/step, 1)})
+	writeEvent(w, "start", string(start))
+
+	stored := s.createResult(job)
+	separator, chunks := "", 0
+	err := s.engine.CondenseStream(ctx, mode, job.Source, opts, func(chunk string) error {
+		if stored != nil {
+			if _, err := io.WriteString(stored, separator+chunk); err != nil {
+				logging.Warnf("Failed to store streamed result: %v", err)
+				stored.Abort()
+				stored = nil
+			}
+			separator = "\n\n"
+		}
+		chunks++
+		return writeEvent(w, "chunk", chunk)
+	})
+	if err != nil {
+		if stored != nil {
+			stored.Abort()
+		}
+		_, message := processError(requestLanguage(r), mode, err)
+		logging.Errorf("EVENT STREAM FAILED after %d chunks: %v", chunks, err)
+		writeEvent(w, "error", message)
+		markFailed(w)
+		return
+	}
+
+	if stored != nil {
+		if err := stored.Commit(); err != nil {
+			logging.Warnf("Failed to store result for job %s: %v", job.ID, err)
+		}
+	}
+	done, _ := json.Marshal(map[string]any{"job_id": job.ID, "chunks": chunks})
+	writeEvent(w, "done", string(done))
+	log.Printf("RESPONSE STREAMED | Events: %d chunks", chunks)
+}
+
+// writeEvent sends one server-sent event, splitting multi-line data over several data lines
+func writeEvent(w http.ResponseWriter, event, data string) error {
+	var b strings.Builder
+	b.WriteString("event: " + event + "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// createResult starts a stored result for a job when the document store is enabled
+func (s *server) createResult(job *jobs.Job) *store.ResultWriter {
+	if s.documents == nil || job.DocumentHash == "" {
+		return nil
+	}
+	stored, err := s.documents.CreateResult(job.DocumentHash, job.Settings, "txt")
+	if err != nil {
+		logging.Warnf("Failed to store result for job %s: %v", job.ID, err)
+		return nil
+	}
+	return stored
+}
+
+// responseStream sends the plain-text headers on the first write and flushes every write to the
+// client. Writes are copied to tee when it is set; a failed copy only stops the copying.
+type responseStream struct {
+	w        http.ResponseWriter
+	filename string
+	tee      *store.ResultWriter
+	started  bool
+	written  int64
+}
+
+func (rs *responseStream) start() {
+	if rs.started {
+		return
+	}
+	rs.started = true
+	rs.w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rs.w.Header().Set("Content-Disposition", "attachment; filename="+rs.filename)
+	rs.w.WriteHeader(http.StatusOK)
+}
+
+func (rs *responseStream) Write(p []byte) (int, error) {
+	rs.start()
+	if rs.tee != nil {
+		if _, err := rs.tee.Write(p); err != nil {
+			logging.Warnf("Failed to store streamed result: %v", err)
+			rs.tee.Abort()
+			rs.tee = nil
+		}
+	}
+	n, err := rs.w.Write(p)
+	rs.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if flusher, ok := rs.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, nil
+}
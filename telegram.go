@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/telegram"
+	"github.com/arnnvv/cutcrap/pkg/wordcount"
+)
+
+// telegramPollTimeout is how long each getUpdates call waits for new messages
+const telegramPollTimeout = 50 * time.Second
+
+const telegramUsage = "Send me text or a .txt/.md document and I'll reply with the condensed version.\n" +
+	"Options go at the start of the message or caption: ratio=0.3 mode=document|transcript|speaker_summary|outline"
+
+// runTelegramBot long-polls the Bot API until ctx is cancelled, handling each message in its own goroutine
+func (s *server) runTelegramBot(ctx context.Context) {
+	log.Printf("Telegram bot polling started")
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := s.telegram.GetUpdates(ctx, offset, telegramPollTimeout)
+		if err != nil {
+			logging.Errorf("TELEGRAM POLL FAILED: %v", err)
+			time.Sleep(5 * time.Second) // Back off before polling again
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message != nil {
+				go s.handleTelegramMessage(ctx, update.Message)
+			}
+		}
+	}
+}
+
+// handleTelegramMessage condenses a text message or document and replies to it
+func (s *server) handleTelegramMessage(ctx context.Context, msg *telegram.Message) {
+	reply := func(text string) {
+		if err := s.telegram.SendMessage(ctx, msg.Chat.ID, msg.MessageID, text); err != nil {
+			logging.Errorf("TELEGRAM REPLY FAILED: %v", err)
+		}
+	}
+
+	input := msg.Text
+	if msg.Document != nil {
+		input = msg.Caption
+	}
+	if strings.HasPrefix(input, "/start") || strings.HasPrefix(input, "/help") {
+		reply(telegramUsage)
+		return
+	}
+
+	settings, text, err := s.chatSettings(input)
+	if err != nil {
+		reply("Could not read options: " + err.Error())
+		return
+	}
+
+	if msg.Document != nil {
+		log.Printf("TELEGRAM DOCUMENT '%s' (%d bytes) in chat %d", msg.Document.FileName, msg.Document.FileSize, msg.Chat.ID)
+		data, err := s.telegram.Download(ctx, msg.Document.FileID)
+		if err != nil {
+			logging.Errorf("TELEGRAM DOWNLOAD FAILED: %v", err)
+			reply("Could not download " + msg.Document.FileName + ".")
+			return
+		}
+		if !utf8.Valid(data) {
+			reply("Only plain text documents can be condensed; " + msg.Document.FileName + " is not text.")
+			return
+		}
+		text = string(data)
+	}
+
+	if strings.TrimSpace(text) == "" {
+		reply(telegramUsage)
+		return
+	}
+	reply(fmt.Sprintf("Condensing %d words (mode: %s, ratio: %.2f)…", wordcount.Count(text), settings.Mode, settings.Ratio))
+	reply(s.runChatJob(ctx, "telegram", text, settings))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// webFiles is the upload page served at /, so the service can be used from a browser without
+// a separate frontend. It posts to /v1/process with Accept: text/event-stream for progress.
+//
+//go:embed web
+var webFiles embed.FS
+
+// handleUI serves the embedded web UI. Paths that match no other route end up here and get a 404.
+func handleUI() http.Handler {
+	root, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	files := http.FileServerFS(root)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+	"github.com/arnnvv/cutcrap/pkg/store"
+	"github.com/arnnvv/cutcrap/pkg/textenc"
+	"github.com/arnnvv/cutcrap/pkg/transcribe"
+)
+
+// tusVersion is the tus resumable upload protocol version spoken by /uploads
+const tusVersion = "1.0.0"
+
+// maxUploadSize caps resumable uploads at the largest source file /process accepts
+const maxUploadSize = maxAudioSize
+
+// uploadStatus is the state of a resumable upload
+type uploadStatus struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	Complete  bool      `json:"complete"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handleUploads starts a resumable upload of a large source file. It speaks the core and
+// creation parts of tus 1.0.0: Upload-Length gives the size and Upload-Metadata may carry the
+// base64 filename, which decides how /process reads the upload. Clients without a tus library
+// can send the same headers and PATCH the pieces in order.
+func (s *server) handleUploads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.tusRequest(w, r) {
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeRequestError(w, r, badRequest("Missing or invalid Upload-Length header"))
+		return
+	}
+	if length > s.uploads.MaxSize() {
+		http.Error(w, "Upload is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	filename, err := uploadFilename(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		writeRequestError(w, r, badRequest("Invalid Upload-Metadata header: %v", err))
+		return
+	}
+
+	upload, err := s.uploads.Create(filename, length, requestOwner(r))
+	switch {
+	case errors.Is(err, store.ErrUploadLimit):
+		http.Error(w, "Too many uploads in progress; finish or delete one first", http.StatusTooManyRequests)
+		return
+	case errors.Is(err, store.ErrUploadSpace):
+		http.Error(w, "Upload storage is full", http.StatusInsufficientStorage)
+		return
+	case err != nil:
+		logging.Errorf("UPLOAD CREATE FAILED: %v", err)
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", apiVersion+"/uploads/"+upload.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleUpload resumes an upload: HEAD reports how many bytes arrived, PATCH appends the next
+// piece at that offset, GET describes the upload and DELETE discards it
+func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "HEAD" && r.Method != "GET" && r.Method != "PATCH" && r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.tusRequest(w, r) {
+		return
+	}
+	id, owner := r.PathValue("id"), requestOwner(r)
+
+	switch r.Method {
+	case "HEAD", "GET":
+		upload, err := s.uploads.Get(id, owner)
+		if err != nil {
+			s.writeUploadError(w, id, err)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method == "HEAD" {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		status := uploadStatus{
+			ID:        upload.ID,
+			Filename:  upload.Filename,
+			Length:    upload.Length,
+			Offset:    upload.Offset,
+			Complete:  upload.Complete(),
+			ExpiresAt: upload.CreatedAt.Add(s.cfg.UploadExpiry),
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			logging.Errorf("JSON ENCODE FAILED: %v", err)
+		}
+
+	case "PATCH":
+		if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+			http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+			return
+		}
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			writeRequestError(w, r, badRequest("Missing or invalid Upload-Offset header"))
+			return
+		}
+		upload, err := s.uploads.Append(id, owner, offset, r.Body)
+		if err != nil {
+			s.writeUploadError(w, id, err)
+			return
+		}
+		if upload.Complete() {
+			log.Printf("Upload %s complete (%d bytes)", id, upload.Length)
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		w.WriteHeader(http.StatusNoContent)
+
+	case "DELETE":
+		if err := s.uploads.Delete(id, owner); err != nil {
+			s.writeUploadError(w, id, err)
+			return
+		}
+		log.Printf("Upload %s deleted", id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// tusRequest checks that resumable uploads are enabled and the client speaks a supported tus
+// version, answering the request when not. Requests without Tus-Resumable are accepted.
+func (s *server) tusRequest(w http.ResponseWriter, r *http.Request) bool {
+	if s.uploads == nil {
+		http.Error(w, "Resumable uploads are not enabled on this server", http.StatusNotFound)
+		return false
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if version := r.Header.Get("Tus-Resumable"); version != "" && version != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported Tus-Resumable version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// writeUploadError answers a failed upload operation
+func (s *server) writeUploadError(w http.ResponseWriter, id string, err error) {
+	switch {
+	case errors.Is(err, store.ErrUploadNotFound):
+		http.Error(w, "Upload not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrOffsetMismatch), errors.Is(err, store.ErrUploadBusy):
+		http.Error(w, "Upload conflict: "+err.Error(), http.StatusConflict)
+	default:
+		logging.Errorf("UPLOAD %s FAILED: %v", id, err)
+		http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+	}
+}
+
+// uploadFilename reads the filename (or name) key of a tus Upload-Metadata header, a comma
+// separated list of "key base64value" pairs
+func uploadFilename(metadata string) (string, error) {
+	for _, pair := range strings.Split(metadata, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key != "filename" && key != "name" {
+			continue
+		}
+		name, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", errors.New("filename is not base64")
+		}
+		return path.Base(strings.ReplaceAll(string(name), "\\", "/")), nil
+	}
+	return "", nil
+}
+
+// readUpload fills in req from a complete resumable upload of owner, by its filename: a zip
+// upload is the archive, an audio upload is transcribed and anything else is read as a text file.
+// Uploads are kept until they expire, so a failed job can be retried without sending the file
+// again.
+func readUpload(req *processRequest, uploads *store.UploadStore, id, owner string) error {
+	if uploads == nil {
+		return invalidField("upload", "Resumable uploads are not enabled on this server")
+	}
+	upload, data, err := uploads.Read(id, owner)
+	switch {
+	case errors.Is(err, store.ErrUploadNotFound):
+		return newRequestError(http.StatusNotFound, "Upload not found")
+	case errors.Is(err, store.ErrUploadIncomplete):
+		return invalidField("upload", "Upload is incomplete (%d of %d bytes received)", upload.Offset, upload.Length)
+	case err != nil:
+		logging.Errorf("UPLOAD READ FAILED: %v", err)
+		return badRequest("Failed to read upload")
+	}
+
+	switch {
+	case strings.EqualFold(path.Ext(upload.Filename), ".zip"):
+		if len(data) > maxArchiveSize {
+			return newRequestError(http.StatusRequestEntityTooLarge, "Archive is too large")
+		}
+		req.Archive = data
+	case transcribe.Supported(upload.Filename):
+		req.Audio, req.AudioName = data, upload.Filename
+	default:
+		if len(data) > maxTextFileSize {
+			return newRequestError(http.StatusRequestEntityTooLarge, "Text file '%s' is too large", upload.Filename)
+		}
+		text, charset, err := textenc.Decode(data, "")
+		if err != nil {
+			return newRequestError(http.StatusUnsupportedMediaType, "Unsupported text file '%s': %v", upload.Filename, err)
+		}
+		req.Text, req.Charset = text, charset
+	}
+	return nil
+}
+
+// runUploadExpiry deletes uploads older than UPLOAD_EXPIRY every JANITOR_INTERVAL
+func (s *server) runUploadExpiry() {
+	ticker := time.NewTicker(s.cfg.JanitorInterval)
+	defer ticker.Stop()
+	for {
+		expired, err := s.uploads.Expire(time.Now().Add(-s.cfg.UploadExpiry))
+		if err != nil {
+			logging.Warnf("Failed to expire uploads: %v", err)
+		} else if expired > 0 {
+			log.Printf("Expired %d uploads", expired)
+		}
+		<-ticker.C
+	}
+}
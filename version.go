@@ -0,0 +1,32 @@
+package main
+
+import "net/http"
+
+// apiVersion is the path prefix of the current API. A breaking change (a new response format,
+// a changed parameter) ships under a new prefix while the old one keeps its behavior.
+const apiVersion = "/v1"
+
+// apiRoute is an API endpoint, registered under apiVersion and as a legacy unversioned path
+type apiRoute struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// registerAPI registers every route wrapped in stack under apiVersion and at its unversioned
+// path, which clients written before versioning still call
+func registerAPI(mux *http.ServeMux, routes []apiRoute, stack ...middleware) {
+	for _, route := range routes {
+		mux.Handle(apiVersion+route.pattern, chain(route.handler, stack...))
+		mux.Handle(route.pattern, chain(legacyRoute(route.handler), stack...))
+	}
+}
+
+// legacyRoute serves an unversioned path with the v1 handler. Responses are marked deprecated
+// and link the versioned path, so clients can find and switch to it.
+func legacyRoute(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+apiVersion+r.URL.EscapedPath()+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/arnnvv/cutcrap/pkg/logging"
+)
+
+// webhookPayload is the body of a job notification. Text and JSON results are sent in Output,
+// binary ones (PDF, zip) base64-encoded in OutputBase64.
+type webhookPayload struct {
+	Event        string `json:"event"` // "job.completed" or "job.failed"
+	JobID        string `json:"job_id,omitempty"`
+	Status       int    `json:"status"`
+	ContentType  string `json:"content_type,omitempty"`
+	Filename     string `json:"filename,omitempty"`
+	Output       string `json:"output,omitempty"`
+	OutputBase64 string `json:"output_base64,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// notifyWebhook posts a captured response to the job's webhook. Retries and dead letters are
+// handled by the sender.
+func (s *server) notifyWebhook(url, jobID string, res *bufferedResponse) {
+	payload := webhookPayload{Event: "job.completed", JobID: jobID, Status: res.status}
+	if res.status == 0 {
+		// The job never answered, e.g. its connection to the provider broke; that is a delivery
+		// error, not a job result with a status
+		payload.Event = "job.failed"
+		payload.Status = http.StatusBadGateway
+		payload.Error = "delivery error: the job ended without a response"
+	} else if res.status != http.StatusOK {
+		payload.Event = "job.failed"
+		payload.Error = strings.TrimSpace(res.body.String())
+	} else {
+		payload.ContentType = res.header.Get("Content-Type")
+		payload.Filename = res.filename("")
+		mediaType, _, _ := mime.ParseMediaType(payload.ContentType)
+		if strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" {
+			payload.Output = res.body.String()
+		} else {
+			payload.OutputBase64 = base64.StdEncoding.EncodeToString(res.body.Bytes())
+		}
+	}
+
+	if err := s.webhooks.Deliver(context.Background(), url, payload); err != nil {
+		logging.Errorf("WEBHOOK DELIVERY FAILED: %v", err)
+		return
+	}
+	log.Printf("Result delivered to webhook %s (job %q, status %d, %d bytes)", url, jobID, res.status, res.body.Len())
+}